@@ -0,0 +1,141 @@
+// Package bolt11 decodes the parts of lightning invoices that nostr applications care about (the
+// amount, the payment hash and the description hash). The signature is not checked.
+package bolt11
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+)
+
+// Invoice has the parts of a bolt11 invoice we care about.
+type Invoice struct {
+	Amount          uint64 // msats, zero if the invoice has no amount
+	PaymentHash     string
+	DescriptionHash string
+}
+
+// Decode parses a bolt11 invoice, with or without the "lightning:" prefix.
+func Decode(invoice string) (Invoice, error) {
+	var inv Invoice
+
+	invoice = strings.TrimPrefix(strings.ToLower(invoice), "lightning:")
+	hrp, words, err := bech32.DecodeNoLimit(invoice)
+	if err != nil {
+		return inv, err
+	}
+	if len(words) < 7+104 {
+		return inv, fmt.Errorf("invoice is too short")
+	}
+	if inv.Amount, err = amountFromHRP(hrp); err != nil {
+		return inv, err
+	}
+
+	// skip the timestamp and stop before the signature
+	data := words[7 : len(words)-104]
+	for len(data) >= 3 {
+		typ := data[0]
+		size := int(data[1])<<5 | int(data[2])
+		if len(data) < 3+size {
+			return inv, fmt.Errorf("invoice field is truncated")
+		}
+		field := data[3 : 3+size]
+		data = data[3+size:]
+
+		switch typ {
+		case 1: // p
+			if b, err := bech32.ConvertBits(field, 5, 8, false); err == nil && len(b) == 32 {
+				inv.PaymentHash = hex.EncodeToString(b)
+			}
+		case 23: // h
+			if b, err := bech32.ConvertBits(field, 5, 8, false); err == nil && len(b) == 32 {
+				inv.DescriptionHash = hex.EncodeToString(b)
+			}
+		}
+	}
+
+	return inv, nil
+}
+
+// DecodeAmount returns the amount of a bolt11 invoice in msats (zero if it has no amount).
+//
+// Unlike Decode it only looks at the human readable part, so it doesn't fail on invoices with a bad
+// checksum or that are truncated.
+func DecodeAmount(invoice string) (uint64, error) {
+	invoice = strings.TrimPrefix(strings.ToLower(invoice), "lightning:")
+
+	// "1" is not in the bech32 charset, so the last one is always the separator
+	idx := strings.LastIndexByte(invoice, '1')
+	if idx == -1 {
+		return 0, fmt.Errorf("invalid invoice")
+	}
+	return amountFromHRP(invoice[0:idx])
+}
+
+func amountFromHRP(hrp string) (uint64, error) {
+	// the amount is at the end of the human readable part, after one of the network prefixes
+	var amount string
+	switch {
+	case strings.HasPrefix(hrp, "lnbcrt"):
+		amount = hrp[6:]
+	case strings.HasPrefix(hrp, "lntbs"):
+		amount = hrp[5:]
+	case strings.HasPrefix(hrp, "lnbc"), strings.HasPrefix(hrp, "lntb"), strings.HasPrefix(hrp, "lnsb"):
+		amount = hrp[4:]
+	default:
+		return 0, fmt.Errorf("unknown invoice prefix '%s'", hrp)
+	}
+	if amount == "" {
+		return 0, nil
+	}
+	return ParseAmount(amount)
+}
+
+// ParseAmount parses the amount that goes in the human readable part of an invoice (like "2500u")
+// and returns it in msats.
+func ParseAmount(amount string) (uint64, error) {
+	if amount == "" {
+		return 0, fmt.Errorf("empty invoice amount")
+	}
+
+	unit := amount[len(amount)-1]
+	if unit >= '0' && unit <= '9' {
+		unit = 0
+	} else {
+		amount = amount[0 : len(amount)-1]
+	}
+
+	// msats in one unit of each multiplier, the "p" unit is a tenth of a msat
+	var multiplier, divisor uint64 = 0, 1
+	switch unit {
+	case 0:
+		multiplier = 100_000_000_000
+	case 'm':
+		multiplier = 100_000_000
+	case 'u':
+		multiplier = 100_000
+	case 'n':
+		multiplier = 100
+	case 'p':
+		multiplier = 1
+		divisor = 10
+	default:
+		return 0, fmt.Errorf("invalid invoice amount multiplier '%c'", unit)
+	}
+
+	value, err := strconv.ParseUint(amount, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid invoice amount: %w", err)
+	}
+	if value%divisor != 0 {
+		return 0, fmt.Errorf("invalid invoice amount: sub-millisatoshi precision")
+	}
+	if value > math.MaxUint64/multiplier {
+		return 0, fmt.Errorf("invalid invoice amount: too large")
+	}
+	return value * multiplier / divisor, nil
+}
@@ -0,0 +1,52 @@
+package bolt11
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAmount(t *testing.T) {
+	for amount, expected := range map[string]uint64{
+		"1":     100_000_000_000,
+		"25m":   2_500_000_000,
+		"2500u": 250_000_000,
+		"10n":   1000,
+		"10p":   1,
+		"210p":  21,
+	} {
+		msats, err := ParseAmount(amount)
+		require.NoError(t, err)
+		require.Equal(t, expected, msats, amount)
+	}
+
+	_, err := ParseAmount("11p")
+	require.Error(t, err)
+	_, err = ParseAmount("10x")
+	require.Error(t, err)
+}
+
+func TestParseAmountOverflow(t *testing.T) {
+	// 184467441 BTC is more than what fits in an uint64 of msats
+	_, err := ParseAmount("184467441")
+	require.ErrorContains(t, err, "too large")
+	_, err = ParseAmount("184467440737096m")
+	require.ErrorContains(t, err, "too large")
+
+	msats, err := ParseAmount("184467440")
+	require.NoError(t, err)
+	require.Equal(t, uint64(18_446_744_000_000_000_000), msats)
+}
+
+func TestDecodeAmount(t *testing.T) {
+	msats, err := DecodeAmount("lnbc2500u1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypq")
+	require.NoError(t, err)
+	require.Equal(t, uint64(250_000_000), msats)
+
+	msats, err = DecodeAmount("LIGHTNING:LNBCRT1QQQQ")
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), msats)
+
+	_, err = DecodeAmount("lnxyz10u1qqqq")
+	require.Error(t, err)
+}
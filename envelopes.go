@@ -1,6 +1,7 @@
 package nostr
 
 import (
+	"bytes"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"unsafe"
 
 	"github.com/mailru/easyjson"
+	jlexer "github.com/mailru/easyjson/jlexer"
 	jwriter "github.com/mailru/easyjson/jwriter"
 	"github.com/tidwall/gjson"
 )
@@ -20,6 +22,15 @@ type MessageParser interface {
 	ParseMessage(string) (Envelope, error)
 }
 
+// BytesMessageParser is an optional interface for a MessageParser that can parse messages without
+// copying them. The parsers returned by NewMessageParser implement it.
+type BytesMessageParser interface {
+	// ParseMessageBytes parses a message into an Envelope without copying it. The envelope (and the
+	// event inside it, if any) may point to the given buffer, so the buffer must not be modified
+	// while the envelope is in use -- use Event.Clone() to keep events around after that.
+	ParseMessageBytes([]byte) (Envelope, error)
+}
+
 // Deprecated: use NewMessageParser instead
 func ParseMessage(message string) Envelope {
 	firstQuote := strings.IndexRune(message, '"')
@@ -66,6 +77,56 @@ func ParseMessage(message string) Envelope {
 	return v
 }
 
+// parseMessageBytes is the easyjson implementation of ParseMessageBytes: EVENT messages are decoded
+// in place, other messages are small so they go through the normal FromJSON.
+func parseMessageBytes(message []byte) (Envelope, error) {
+	firstQuote := bytes.IndexByte(message, '"')
+	if firstQuote == -1 {
+		return nil, errors.New("malformed json")
+	}
+	secondQuote := bytes.IndexByte(message[firstQuote+1:], '"')
+	if secondQuote == -1 {
+		return nil, errors.New("malformed json")
+	}
+	label := message[firstQuote+1 : firstQuote+1+secondQuote]
+
+	var v Envelope
+	switch string(label) {
+	case "EVENT":
+		env := &EventEnvelope{}
+		if err := env.fromJSONBytes(message); err != nil {
+			return nil, err
+		}
+		return env, nil
+	case "REQ":
+		v = &ReqEnvelope{}
+	case "COUNT":
+		v = &CountEnvelope{}
+	case "NOTICE":
+		x := NoticeEnvelope("")
+		v = &x
+	case "EOSE":
+		x := EOSEEnvelope("")
+		v = &x
+	case "OK":
+		v = &OKEnvelope{}
+	case "AUTH":
+		v = &AuthEnvelope{}
+	case "CLOSED":
+		v = &ClosedEnvelope{}
+	case "CLOSE":
+		x := CloseEnvelope("")
+		v = &x
+	default:
+		return nil, UnknownLabel
+	}
+
+	if err := v.FromJSON(unsafe.String(unsafe.SliceData(message), len(message))); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
 // Envelope is the interface for all nostr message envelopes.
 type Envelope interface {
 	Label() string
@@ -108,6 +169,80 @@ func (v *EventEnvelope) FromJSON(data string) error {
 	}
 }
 
+// fromJSONBytes is like FromJSON, but the subscription id and the event fields point to data.
+func (v *EventEnvelope) fromJSONBytes(data []byte) error {
+	in := jlexer.Lexer{Data: data}
+	in.Delim('[')
+	in.UnsafeString() // the label
+	in.WantComma()
+	if !in.IsDelim('{') {
+		subid := in.UnsafeString()
+		v.SubscriptionID = &subid
+		in.WantComma()
+	}
+	decodeEventAliased(&in, &v.Event)
+	in.WantComma()
+	in.Delim(']')
+
+	if err := in.Error(); err != nil {
+		return fmt.Errorf("failed to decode EVENT envelope: %w", err)
+	}
+	return nil
+}
+
+// decodeEventAliased is the same as the easyjson generated decoder for Event, except that
+// it doesn't copy strings.
+func decodeEventAliased(in *jlexer.Lexer, out *Event) {
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(true)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "id":
+			out.ID = in.UnsafeString()
+		case "pubkey":
+			out.PubKey = in.UnsafeString()
+		case "created_at":
+			out.CreatedAt = Timestamp(in.Int64())
+		case "kind":
+			out.Kind = in.Int()
+		case "tags":
+			in.Delim('[')
+			out.Tags = make(Tags, 0, 7)
+			for !in.IsDelim(']') {
+				var tag Tag
+				if in.IsNull() {
+					in.Skip()
+				} else {
+					in.Delim('[')
+					tag = make(Tag, 0, 5)
+					for !in.IsDelim(']') {
+						tag = append(tag, in.UnsafeString())
+						in.WantComma()
+					}
+					in.Delim(']')
+				}
+				out.Tags = append(out.Tags, tag)
+				in.WantComma()
+			}
+			in.Delim(']')
+		case "content":
+			out.Content = in.UnsafeString()
+		case "sig":
+			out.Sig = in.UnsafeString()
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+}
+
 func (v EventEnvelope) MarshalJSON() ([]byte, error) {
 	w := jwriter.Writer{NoEscapeHTML: true}
 	w.RawString(`["EVENT",`)
@@ -1,11 +1,12 @@
-//go:build sonic
-
 package nostr
 
 import (
+	"bufio"
+	"bytes"
 	stdlibjson "encoding/json"
 	"fmt"
 	"math/rand/v2"
+	"os"
 	"testing"
 	"time"
 	"unsafe"
@@ -33,11 +34,25 @@ func BenchmarkParseMessage(b *testing.B) {
 				}
 			})
 
-			b.Run("sonic", func(b *testing.B) {
-				smp := NewSonicMessageParser()
+			// this is the sonic parser when built with the "sonic" tag
+			b.Run("parser", func(b *testing.B) {
+				mp := NewMessageParser()
 				for b.Loop() {
 					for _, msg := range messages {
-						_, _ = smp.ParseMessage(msg)
+						_, _ = mp.ParseMessage(msg)
+					}
+				}
+			})
+
+			b.Run("parser-bytes", func(b *testing.B) {
+				mp := any(NewMessageParser()).(BytesMessageParser)
+				bmessages := make([][]byte, len(messages))
+				for i, msg := range messages {
+					bmessages[i] = []byte(msg)
+				}
+				for b.Loop() {
+					for _, msg := range bmessages {
+						_, _ = mp.ParseMessageBytes(msg)
 					}
 				}
 			})
@@ -45,6 +60,58 @@ func BenchmarkParseMessage(b *testing.B) {
 	}
 }
 
+// BenchmarkParseMessageCorpus compares what the relay reader loop used to do (copying each message
+// into a string and parsing it) with parsing the bytes in place and only cloning the events.
+func BenchmarkParseMessageCorpus(b *testing.B) {
+	file, err := os.ReadFile("testdata/messages.jsonl")
+	if err != nil {
+		b.Skipf("testdata/messages.jsonl could not be opened: %v", err)
+	}
+
+	messages := make([][]byte, 0, 1000)
+	scanner := bufio.NewScanner(bytes.NewReader(file))
+	scanner.Buffer(make([]byte, 0, 1<<16), 1<<24)
+	for scanner.Scan() {
+		if line := scanner.Bytes(); len(line) > 0 {
+			messages = append(messages, bytes.Clone(line))
+		}
+	}
+
+	b.Run("string", func(b *testing.B) {
+		b.ReportAllocs()
+		mp := NewMessageParser()
+		for b.Loop() {
+			for _, msg := range messages {
+				_, _ = mp.ParseMessage(string(msg))
+			}
+		}
+	})
+
+	b.Run("bytes", func(b *testing.B) {
+		b.ReportAllocs()
+		mp := any(NewMessageParser()).(BytesMessageParser)
+		for b.Loop() {
+			for _, msg := range messages {
+				_, _ = mp.ParseMessageBytes(msg)
+			}
+		}
+	})
+
+	b.Run("bytes-clone", func(b *testing.B) {
+		b.ReportAllocs()
+		mp := any(NewMessageParser()).(BytesMessageParser)
+		for b.Loop() {
+			for _, msg := range messages {
+				if env, _ := mp.ParseMessageBytes(msg); env != nil {
+					if evt, ok := env.(*EventEnvelope); ok {
+						_ = evt.Event.Clone()
+					}
+				}
+			}
+		}
+	})
+}
+
 func generateTestMessages(typ string) []string {
 	messages := make([]string, 0, 600)
 
@@ -13,6 +13,8 @@ func NewMessageParser() MessageParser {
 
 type messageParser struct{}
 
+var _ BytesMessageParser = messageParser{}
+
 func (messageParser) ParseMessage(message string) (Envelope, error) {
 	firstQuote := strings.IndexRune(message, '"')
 	if firstQuote == -1 {
@@ -56,3 +58,7 @@ func (messageParser) ParseMessage(message string) (Envelope, error) {
 	}
 	return v, nil
 }
+
+func (messageParser) ParseMessageBytes(message []byte) (Envelope, error) {
+	return parseMessageBytes(message)
+}
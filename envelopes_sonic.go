@@ -503,6 +503,11 @@ func NewMessageParser() sonicMessageParser {
 
 var NewSonicMessageParser = NewMessageParser
 
+var (
+	_ MessageParser      = sonicMessageParser{}
+	_ BytesMessageParser = sonicMessageParser{}
+)
+
 func (smp *sonicMessageParser) doneWithFilterSlice(slice []Filter) {
 	if unsafe.SliceData(smp.reusableFilterArray) == unsafe.SliceData(slice) {
 		smp.reusableFilterArray = slice[len(slice):]
@@ -562,3 +567,9 @@ func (smp sonicMessageParser) ParseMessage(message string) (Envelope, error) {
 
 	return sv.mainEnvelope, err
 }
+
+// ParseMessageBytes is like ParseMessage, but it doesn't copy the message, so the returned envelope
+// may point to it. See BytesMessageParser.
+func (smp sonicMessageParser) ParseMessageBytes(message []byte) (Envelope, error) {
+	return smp.ParseMessage(unsafe.String(unsafe.SliceData(message), len(message)))
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"strconv"
+	"unsafe"
 
 	"github.com/mailru/easyjson"
 )
@@ -24,6 +25,58 @@ func (evt Event) String() string {
 	return string(j)
 }
 
+// Clone returns a deep copy of the event that doesn't share any memory with the original.
+//
+// Events parsed with ParseMessageBytes() point to the buffer they were parsed from, so they must be
+// cloned if they are going to be kept around after that buffer is reused.
+func (evt Event) Clone() Event {
+	size := len(evt.ID) + len(evt.PubKey) + len(evt.Content) + len(evt.Sig)
+	items := 0
+	for _, tag := range evt.Tags {
+		items += len(tag)
+		for _, item := range tag {
+			size += len(item)
+		}
+	}
+
+	// all strings go into a single buffer, it never grows so they can all point to it
+	buf := make([]byte, 0, size)
+	clone := func(s string) string {
+		if len(s) == 0 {
+			return ""
+		}
+		start := len(buf)
+		buf = append(buf, s...)
+		return unsafe.String(&buf[start], len(s))
+	}
+
+	cloned := Event{
+		ID:        clone(evt.ID),
+		PubKey:    clone(evt.PubKey),
+		CreatedAt: evt.CreatedAt,
+		Kind:      evt.Kind,
+		Content:   clone(evt.Content),
+		Sig:       clone(evt.Sig),
+	}
+
+	if evt.Tags != nil {
+		cloned.Tags = make(Tags, len(evt.Tags))
+		all := make([]string, items)
+		for i, tag := range evt.Tags {
+			if tag == nil {
+				continue
+			}
+			cloned.Tags[i] = all[0:len(tag):len(tag)]
+			all = all[len(tag):]
+			for j, item := range tag {
+				cloned.Tags[i][j] = clone(item)
+			}
+		}
+	}
+
+	return cloned
+}
+
 // GetID computes the event ID and returns it as a hex string.
 func (evt *Event) GetID() string {
 	h := sha256.Sum256(evt.Serialize())
@@ -0,0 +1,445 @@
+package keyer
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/nbd-wtf/go-nostr/nip44"
+	"github.com/nbd-wtf/go-nostr/nip49"
+)
+
+// ErrKeystoreLocked is returned when an operation needs the keys but the Keystore is locked and there
+// is no PasswordHandler to ask for the password.
+var ErrKeystoreLocked = errors.New("keystore is locked")
+
+// KeystoreStorage is where a Keystore keeps its data.
+type KeystoreStorage interface {
+	// Load returns the stored data, or nil if nothing was stored yet.
+	Load() ([]byte, error)
+
+	// Save replaces the stored data.
+	Save(data []byte) error
+}
+
+// KeystoreFile is a KeystoreStorage backed by a file in the given path. Writes are atomic and the file
+// is only readable by its owner.
+type KeystoreFile string
+
+func (path KeystoreFile) Load() ([]byte, error) {
+	data, err := os.ReadFile(string(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (path KeystoreFile) Save(data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(string(path)), filepath.Base(string(path))+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), string(path))
+}
+
+// KeystoreIdentity is one of the keys stored in a Keystore.
+type KeystoreIdentity struct {
+	Label     string                `json:"label"`
+	PubKey    string                `json:"pubkey"`
+	Ncryptsec string                `json:"ncryptsec"`
+	Security  nip49.KeySecurityByte `json:"security"`
+	CreatedAt nostr.Timestamp       `json:"created_at"`
+}
+
+type keystoreData struct {
+	Version    int                `json:"version"`
+	Identities []KeystoreIdentity `json:"identities"`
+}
+
+// Keystore manages multiple identities, each stored as a NIP-49 ncryptsec, all encrypted with the
+// same password.
+//
+// Once unlocked the secret keys are kept in memory until Lock is called or the unlock expires.
+type Keystore struct {
+	// PasswordHandler, if set, is called when a signer needs the keys while the keystore is locked.
+	// The keystore is then unlocked with the returned password for UnlockTTL.
+	PasswordHandler func(context.Context) string
+	UnlockTTL       time.Duration
+
+	// LogN is the scrypt work factor used when encrypting keys, defaults to 16.
+	LogN uint8
+
+	storage    KeystoreStorage
+	mu         sync.Mutex
+	identities []KeystoreIdentity
+	password   string
+	keys       map[string]string // pubkey -> secret key, nil when locked
+	expires    time.Time         // zero means it doesn't expire
+}
+
+// OpenKeystore opens the keystore file at the given path, which will be created when the first identity
+// is added if it doesn't exist.
+func OpenKeystore(path string) (*Keystore, error) {
+	return NewKeystore(KeystoreFile(path))
+}
+
+// NewKeystore loads a keystore from any storage.
+func NewKeystore(storage KeystoreStorage) (*Keystore, error) {
+	ks := &Keystore{storage: storage, LogN: 16}
+
+	data, err := storage.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keystore: %w", err)
+	}
+	if len(data) > 0 {
+		var kd keystoreData
+		if err := json.Unmarshal(data, &kd); err != nil {
+			return nil, fmt.Errorf("invalid keystore: %w", err)
+		}
+		if kd.Version != 1 {
+			return nil, fmt.Errorf("unsupported keystore version %d", kd.Version)
+		}
+		ks.identities = kd.Identities
+	}
+
+	return ks, nil
+}
+
+// Identities returns all the identities in the keystore, this works even when it is locked.
+func (ks *Keystore) Identities() []KeystoreIdentity {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return slices.Clone(ks.identities)
+}
+
+// Unlock decrypts all keys with the given password and keeps them in memory for ttl (or until Lock is
+// called if ttl is 0). When the keystore is empty this just sets the password for new identities.
+func (ks *Keystore) Unlock(password string, ttl time.Duration) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	keys := make(map[string]string, len(ks.identities))
+	for _, id := range ks.identities {
+		sk, err := nip49.Decrypt(id.Ncryptsec, password)
+		if err != nil {
+			return fmt.Errorf("invalid password: %w", err)
+		}
+		keys[id.PubKey] = sk
+	}
+
+	ks.password = password
+	ks.keys = keys
+	ks.expires = time.Time{}
+	if ttl > 0 {
+		ks.expires = time.Now().Add(ttl)
+	}
+	return nil
+}
+
+// Lock forgets the password and all the decrypted keys.
+func (ks *Keystore) Lock() {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.lock()
+}
+
+func (ks *Keystore) lock() {
+	ks.password = ""
+	ks.keys = nil
+	ks.expires = time.Time{}
+}
+
+// IsUnlocked tells if the keys are available.
+func (ks *Keystore) IsUnlocked() bool {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.isUnlocked()
+}
+
+func (ks *Keystore) isUnlocked() bool {
+	if ks.keys != nil && !ks.expires.IsZero() && time.Now().After(ks.expires) {
+		ks.lock()
+	}
+	return ks.keys != nil
+}
+
+// ChangePassword re-encrypts all keys with a new password.
+func (ks *Keystore) ChangePassword(oldPassword, newPassword string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	identities := slices.Clone(ks.identities)
+	keys := make(map[string]string, len(identities))
+	for i, id := range identities {
+		sk, err := nip49.Decrypt(id.Ncryptsec, oldPassword)
+		if err != nil {
+			return fmt.Errorf("invalid password: %w", err)
+		}
+		ncryptsec, err := nip49.Encrypt(sk, newPassword, ks.LogN, id.Security)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", id.Label, err)
+		}
+		identities[i].Ncryptsec = ncryptsec
+		keys[id.PubKey] = sk
+	}
+
+	if err := ks.save(identities); err != nil {
+		return err
+	}
+	ks.identities = identities
+	if ks.isUnlocked() {
+		ks.password = newPassword
+		ks.keys = keys
+	}
+	return nil
+}
+
+// Generate creates a new identity with a random key. The keystore must be unlocked.
+func (ks *Keystore) Generate(label string) (KeystoreIdentity, error) {
+	return ks.add(label, nostr.GeneratePrivateKey(), nip49.NotKnownToHaveBeenHandledInsecurely)
+}
+
+// Import adds an identity from an nsec, a hex secret key or an ncryptsec (which is decrypted with the given
+// password and re-encrypted with the keystore password). The keystore must be unlocked.
+func (ks *Keystore) Import(label string, input string, password string) (KeystoreIdentity, error) {
+	if strings.HasPrefix(input, "ncryptsec1") {
+		ksb, err := nip49.GetKeySecurityByte(input)
+		if err != nil {
+			return KeystoreIdentity{}, err
+		}
+		sk, err := nip49.Decrypt(input, password)
+		if err != nil {
+			return KeystoreIdentity{}, fmt.Errorf("failed to decrypt: %w", err)
+		}
+		return ks.add(label, sk, ksb)
+	}
+
+	if prefix, data, err := nip19.Decode(input); err == nil {
+		if prefix != "nsec" {
+			return KeystoreIdentity{}, fmt.Errorf("expected nsec, got %s", prefix)
+		}
+		return ks.add(label, data.(string), nip49.KnownToHaveBeenHandledInsecurely)
+	}
+
+	if b, err := hex.DecodeString(input); err == nil && len(b) == 32 {
+		return ks.add(label, input, nip49.KnownToHaveBeenHandledInsecurely)
+	}
+
+	return KeystoreIdentity{}, fmt.Errorf("unsupported key format")
+}
+
+func (ks *Keystore) add(label string, sk string, ksb nip49.KeySecurityByte) (KeystoreIdentity, error) {
+	pk, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		return KeystoreIdentity{}, err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if !ks.isUnlocked() {
+		return KeystoreIdentity{}, ErrKeystoreLocked
+	}
+	for _, id := range ks.identities {
+		if id.PubKey == pk {
+			return KeystoreIdentity{}, fmt.Errorf("%s is already in the keystore as '%s'", pk, id.Label)
+		}
+		if label != "" && id.Label == label {
+			return KeystoreIdentity{}, fmt.Errorf("there is already an identity labeled '%s'", label)
+		}
+	}
+
+	ncryptsec, err := nip49.Encrypt(sk, ks.password, ks.LogN, ksb)
+	if err != nil {
+		return KeystoreIdentity{}, err
+	}
+	id := KeystoreIdentity{
+		Label:     label,
+		PubKey:    pk,
+		Ncryptsec: ncryptsec,
+		Security:  ksb,
+		CreatedAt: nostr.Now(),
+	}
+
+	identities := append(slices.Clone(ks.identities), id)
+	if err := ks.save(identities); err != nil {
+		return KeystoreIdentity{}, err
+	}
+	ks.identities = identities
+	ks.keys[pk] = sk
+
+	return id, nil
+}
+
+// Export returns the key for an identity as an ncryptsec encrypted with the given password. The keystore
+// must be unlocked.
+func (ks *Keystore) Export(identity string, password string) (string, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	idx, err := ks.find(identity)
+	if err != nil {
+		return "", err
+	}
+	if !ks.isUnlocked() {
+		return "", ErrKeystoreLocked
+	}
+
+	id := ks.identities[idx]
+	return nip49.Encrypt(ks.keys[id.PubKey], password, ks.LogN, id.Security)
+}
+
+// Remove deletes an identity from the keystore.
+func (ks *Keystore) Remove(identity string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	idx, err := ks.find(identity)
+	if err != nil {
+		return err
+	}
+
+	pk := ks.identities[idx].PubKey
+	identities := slices.Delete(slices.Clone(ks.identities), idx, idx+1)
+	if err := ks.save(identities); err != nil {
+		return err
+	}
+	ks.identities = identities
+	delete(ks.keys, pk)
+
+	return nil
+}
+
+// Get returns a signer for an identity, given by npub, hex public key or label. The signer can be obtained
+// while the keystore is locked, but it will only work when it is unlocked (or if there is a PasswordHandler).
+func (ks *Keystore) Get(identity string) (nostr.Keyer, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	idx, err := ks.find(identity)
+	if err != nil {
+		return nil, err
+	}
+	return &KeystoreSigner{ks, ks.identities[idx].PubKey}, nil
+}
+
+func (ks *Keystore) find(identity string) (int, error) {
+	pk := identity
+	if prefix, data, err := nip19.Decode(identity); err == nil && prefix == "npub" {
+		pk = data.(string)
+	}
+
+	if idx := slices.IndexFunc(ks.identities, func(id KeystoreIdentity) bool { return id.PubKey == pk }); idx != -1 {
+		return idx, nil
+	}
+	if idx := slices.IndexFunc(ks.identities, func(id KeystoreIdentity) bool { return id.Label == identity }); idx != -1 {
+		return idx, nil
+	}
+	return -1, fmt.Errorf("identity '%s' not found", identity)
+}
+
+func (ks *Keystore) save(identities []KeystoreIdentity) error {
+	data, err := json.MarshalIndent(keystoreData{Version: 1, Identities: identities}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ks.storage.Save(data); err != nil {
+		return fmt.Errorf("failed to save keystore: %w", err)
+	}
+	return nil
+}
+
+func (ks *Keystore) secretKey(ctx context.Context, pk string) (string, error) {
+	ks.mu.Lock()
+	unlocked := ks.isUnlocked()
+	ks.mu.Unlock()
+
+	if !unlocked {
+		if ks.PasswordHandler == nil {
+			return "", ErrKeystoreLocked
+		}
+		if err := ks.Unlock(ks.PasswordHandler(ctx), ks.UnlockTTL); err != nil {
+			return "", err
+		}
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	sk, ok := ks.keys[pk]
+	if !ok {
+		return "", fmt.Errorf("identity %s not found", pk)
+	}
+	return sk, nil
+}
+
+// KeystoreSigner is a signer for one of the identities in a Keystore.
+type KeystoreSigner struct {
+	keystore *Keystore
+	pk       string
+}
+
+// GetPublicKey returns the public key of this identity, it works even if the keystore is locked.
+func (ks *KeystoreSigner) GetPublicKey(ctx context.Context) (string, error) { return ks.pk, nil }
+
+// SignEvent signs the provided event with the key from the keystore.
+func (ks *KeystoreSigner) SignEvent(ctx context.Context, evt *nostr.Event) error {
+	sk, err := ks.keystore.secretKey(ctx, ks.pk)
+	if err != nil {
+		return err
+	}
+	return evt.Sign(sk)
+}
+
+// Encrypt encrypts a plaintext message for a recipient using NIP-44.
+func (ks *KeystoreSigner) Encrypt(ctx context.Context, plaintext string, recipient string) (string, error) {
+	sk, err := ks.keystore.secretKey(ctx, ks.pk)
+	if err != nil {
+		return "", err
+	}
+	ck, err := nip44.GenerateConversationKey(recipient, sk)
+	if err != nil {
+		return "", err
+	}
+	return nip44.Encrypt(plaintext, ck)
+}
+
+// Decrypt decrypts a base64-encoded ciphertext from a sender using NIP-44.
+func (ks *KeystoreSigner) Decrypt(ctx context.Context, base64ciphertext string, sender string) (string, error) {
+	sk, err := ks.keystore.secretKey(ctx, ks.pk)
+	if err != nil {
+		return "", err
+	}
+	ck, err := nip44.GenerateConversationKey(sender, sk)
+	if err != nil {
+		return "", err
+	}
+	return nip44.Decrypt(base64ciphertext, ck)
+}
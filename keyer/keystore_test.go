@@ -0,0 +1,116 @@
+package keyer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/nbd-wtf/go-nostr/nip49"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeystore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+
+	ks, err := OpenKeystore(path)
+	require.NoError(t, err)
+	ks.LogN = 4
+	require.Empty(t, ks.Identities())
+
+	_, err = ks.Generate("bot1")
+	require.ErrorIs(t, err, ErrKeystoreLocked)
+
+	require.NoError(t, ks.Unlock("hunter2", 0))
+	bot1, err := ks.Generate("bot1")
+	require.NoError(t, err)
+	require.Equal(t, nip49.NotKnownToHaveBeenHandledInsecurely, bot1.Security)
+
+	sk := nostr.GeneratePrivateKey()
+	nsec, _ := nip19.EncodePrivateKey(sk)
+	bot2, err := ks.Import("bot2", nsec, "")
+	require.NoError(t, err)
+	require.Equal(t, nip49.KnownToHaveBeenHandledInsecurely, bot2.Security)
+	_, err = ks.Import("again", sk, "")
+	require.Error(t, err, "duplicate keys are not allowed")
+
+	other := nostr.GeneratePrivateKey()
+	ncryptsec, _ := nip49.Encrypt(other, "other password", 4, nip49.ClientDoesNotTrackThisData)
+	bot3, err := ks.Import("bot3", ncryptsec, "other password")
+	require.NoError(t, err)
+	require.Equal(t, nip49.ClientDoesNotTrackThisData, bot3.Security)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// reopen from disk
+	ks, err = OpenKeystore(path)
+	require.NoError(t, err)
+	ks.LogN = 4
+	require.Len(t, ks.Identities(), 3)
+
+	npub, _ := nip19.EncodePublicKey(bot2.PubKey)
+	signer, err := ks.Get(npub)
+	require.NoError(t, err)
+	pk, _ := signer.GetPublicKey(ctx)
+	require.Equal(t, bot2.PubKey, pk)
+
+	evt := &nostr.Event{Kind: 1, CreatedAt: nostr.Now(), Content: "hello"}
+	require.ErrorIs(t, signer.SignEvent(ctx, evt), ErrKeystoreLocked)
+
+	require.Error(t, ks.Unlock("wrong", 0))
+	require.NoError(t, ks.Unlock("hunter2", 50*time.Millisecond))
+	require.NoError(t, signer.SignEvent(ctx, evt))
+	require.Equal(t, bot2.PubKey, evt.PubKey)
+	ok, _ := evt.CheckSignature()
+	require.True(t, ok)
+
+	// encryption works between identities
+	bot3Signer, err := ks.Get("bot3")
+	require.NoError(t, err)
+	ciphertext, err := signer.Encrypt(ctx, "secret", bot3.PubKey)
+	require.NoError(t, err)
+	plaintext, err := bot3Signer.Decrypt(ctx, ciphertext, bot2.PubKey)
+	require.NoError(t, err)
+	require.Equal(t, "secret", plaintext)
+
+	// the unlock expires
+	time.Sleep(60 * time.Millisecond)
+	require.False(t, ks.IsUnlocked())
+
+	// unless there is a password handler
+	asked := 0
+	ks.PasswordHandler = func(context.Context) string { asked++; return "hunter2" }
+	ks.UnlockTTL = time.Minute
+	require.NoError(t, signer.SignEvent(ctx, evt))
+	require.NoError(t, signer.SignEvent(ctx, evt))
+	require.Equal(t, 1, asked)
+	ks.PasswordHandler = nil
+
+	// export with another password
+	exported, err := ks.Export(bot1.PubKey, "export")
+	require.NoError(t, err)
+	exportedSk, err := nip49.Decrypt(exported, "export")
+	require.NoError(t, err)
+	exportedPk, _ := nostr.GetPublicKey(exportedSk)
+	require.Equal(t, bot1.PubKey, exportedPk)
+
+	// password rotation
+	require.Error(t, ks.ChangePassword("wrong", "correct horse"))
+	require.NoError(t, ks.ChangePassword("hunter2", "correct horse"))
+	ks.Lock()
+	ks, err = OpenKeystore(path)
+	require.NoError(t, err)
+	require.Error(t, ks.Unlock("hunter2", 0))
+	require.NoError(t, ks.Unlock("correct horse", 0))
+
+	require.NoError(t, ks.Remove("bot1"))
+	require.Len(t, ks.Identities(), 2)
+	_, err = ks.Get(bot1.PubKey)
+	require.Error(t, err)
+}
@@ -19,6 +19,7 @@ var (
 	_ nostr.Keyer = (*BunkerSigner)(nil)
 	_ nostr.Keyer = (*EncryptedKeySigner)(nil)
 	_ nostr.Keyer = (*KeySigner)(nil)
+	_ nostr.Keyer = (*KeystoreSigner)(nil)
 	_ nostr.Keyer = (*ManualSigner)(nil)
 )
 
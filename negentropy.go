@@ -0,0 +1,157 @@
+package nostr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mailru/easyjson/jwriter"
+	"github.com/tidwall/gjson"
+)
+
+// NegentropySession represents a NIP-77 reconciliation session opened on a relay connection.
+//
+// The actual negentropy protocol is implemented in the nip77 package, this just takes care of
+// routing the NEG-MSG messages with the right id so many sessions can run concurrently on the same
+// connection, alongside normal subscriptions.
+type NegentropySession struct {
+	counter int64
+	id      string
+
+	Relay  *Relay
+	Filter Filter
+
+	// Messages emits the hex payload of every NEG-MSG received from the relay for this session.
+	// It will be closed when the session ends.
+	Messages chan string
+	mu       sync.Mutex
+
+	// Context will be .Done() when the session ends, context.Cause() will have the reason.
+	Context context.Context
+	cancel  context.CancelCauseFunc
+}
+
+// OpenNegentropy sends a "NEG-OPEN" with the given filter and initial negentropy message.
+// Replies from the relay will come through session.Messages. Call session.Close() when done.
+func (r *Relay) OpenNegentropy(ctx context.Context, filter Filter, initialMessage string) (*NegentropySession, error) {
+	if !r.hasConnection() {
+		return nil, fmt.Errorf("not connected to %s", r.URL)
+	}
+
+	current := subscriptionIDCounter.Add(1)
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	session := &NegentropySession{
+		counter:  current,
+		id:       strconv.FormatInt(current, 10) + ":neg",
+		Relay:    r,
+		Filter:   filter,
+		Messages: make(chan string, 1),
+		Context:  ctx,
+		cancel:   cancel,
+	}
+	r.negentropySessions.Store(current, session)
+
+	go func() {
+		<-session.Context.Done()
+		r.negentropySessions.Delete(session.counter)
+
+		session.mu.Lock()
+		close(session.Messages)
+		session.mu.Unlock()
+	}()
+
+	w := jwriter.Writer{NoEscapeHTML: true}
+	w.RawString(`["NEG-OPEN","`)
+	w.RawString(session.id)
+	w.RawString(`",`)
+	filter.MarshalEasyJSON(&w)
+	w.RawString(`,"`)
+	w.RawString(initialMessage)
+	w.RawString(`"]`)
+	open, _ := w.BuildBytes()
+
+	if err := <-r.write(ctx, open); err != nil {
+		err = fmt.Errorf("failed to write NEG-OPEN: %w", err)
+		cancel(err)
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// GetID returns the id used in NEG-* messages for this session.
+func (ns *NegentropySession) GetID() string { return ns.id }
+
+// Send sends a "NEG-MSG" with the given hex payload to the relay.
+func (ns *NegentropySession) Send(message string) error {
+	if err := context.Cause(ns.Context); err != nil {
+		return err
+	}
+
+	msg := make([]byte, 0, 15+len(ns.id)+len(message))
+	msg = append(msg, `["NEG-MSG","`...)
+	msg = append(msg, ns.id...)
+	msg = append(msg, `","`...)
+	msg = append(msg, message...)
+	msg = append(msg, `"]`...)
+	return <-ns.Relay.write(ns.Context, msg)
+}
+
+// Close sends a "NEG-CLOSE" to the relay (if the session is still open) and ends the session.
+func (ns *NegentropySession) Close() {
+	if ns.Context.Err() == nil && ns.Relay.IsConnected() {
+		msg := make([]byte, 0, 16+len(ns.id))
+		msg = append(msg, `["NEG-CLOSE","`...)
+		msg = append(msg, ns.id...)
+		msg = append(msg, `"]`...)
+		<-ns.Relay.Write(msg)
+	}
+	ns.cancel(errors.New("Close() called"))
+}
+
+func (ns *NegentropySession) dispatchMessage(message string) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	if ns.Context.Err() != nil {
+		return
+	}
+
+	select {
+	case ns.Messages <- message:
+	case <-ns.Context.Done():
+	}
+}
+
+// handleNegentropyMessage routes NEG-MSG and NEG-ERR messages to their sessions,
+// it returns false if the message wasn't one of these.
+func (r *Relay) handleNegentropyMessage(message string) bool {
+	if !strings.HasPrefix(message, `["NEG-`) {
+		return false
+	}
+
+	arr := gjson.Parse(message).Array()
+	if len(arr) < 3 {
+		return false
+	}
+
+	session, ok := r.negentropySessions.Load(subIdToSerial(arr[1].Str))
+	if !ok {
+		return false
+	}
+
+	switch arr[0].Str {
+	case "NEG-MSG":
+		session.dispatchMessage(arr[2].Str)
+	case "NEG-ERR", "NEG-ERROR":
+		session.cancel(fmt.Errorf("%s from relay: %s", arr[0].Str, arr[2].Str))
+	default:
+		return false
+	}
+
+	return true
+}
@@ -70,3 +70,62 @@ func GetImmediateParent(tags nostr.Tags) nostr.Pointer {
 
 	return nil
 }
+
+// MakeReply returns the tags for a kind:1 reply to the given event: the "root" and "reply" marked "e"
+// tags (or just "root" if the parent is the root) and "p" tags for the parent author and for everybody
+// tagged in the parent.
+//
+// relayHint is a relay where the parent can be found, it can be empty.
+func MakeReply(parent *nostr.Event, relayHint string) nostr.Tags {
+	tags := make(nostr.Tags, 0, 2+len(parent.Tags))
+
+	if root := getRootTag(parent.Tags); root != nil {
+		// propagate the root from the parent
+		rootTag := nostr.Tag{"e", root[1], "", "root"}
+		if len(root) > 2 {
+			rootTag[2] = root[2]
+		}
+		if pointer, err := nostr.EventPointerFromTag(root); err == nil && pointer.Author != "" {
+			rootTag = append(rootTag, pointer.Author)
+		}
+		tags = append(tags,
+			rootTag,
+			nostr.Tag{"e", parent.ID, relayHint, "reply", parent.PubKey},
+		)
+	} else {
+		// the parent is the root
+		tags = append(tags, nostr.Tag{"e", parent.ID, relayHint, "root", parent.PubKey})
+	}
+
+	tags = append(tags, nostr.Tag{"p", parent.PubKey})
+	for _, tag := range parent.Tags {
+		if len(tag) < 2 || tag[0] != "p" || !nostr.IsValidPublicKey(tag[1]) || tags.FindWithValue("p", tag[1]) != nil {
+			continue
+		}
+		if len(tag) > 2 && tag[2] != "" {
+			tags = append(tags, nostr.Tag{"p", tag[1], tag[2]})
+		} else {
+			tags = append(tags, nostr.Tag{"p", tag[1]})
+		}
+	}
+
+	return tags
+}
+
+// getRootTag finds the "e" tag with the "root" marker, or the first unmarked "e" tag for events that
+// use the deprecated positional scheme.
+func getRootTag(tags nostr.Tags) nostr.Tag {
+	var firstUnmarked nostr.Tag
+	for _, tag := range tags {
+		if len(tag) < 2 || tag[0] != "e" {
+			continue
+		}
+		if len(tag) >= 4 && tag[3] == "root" {
+			return tag
+		}
+		if firstUnmarked == nil && (len(tag) < 4 || tag[3] == "") {
+			firstUnmarked = tag
+		}
+	}
+	return firstUnmarked
+}
@@ -0,0 +1,68 @@
+package nip10
+
+import (
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeReply(t *testing.T) {
+	alice := nostr.GeneratePrivateKey()
+	bob := nostr.GeneratePrivateKey()
+	carol := nostr.GeneratePrivateKey()
+	alicePk, _ := nostr.GetPublicKey(alice)
+	bobPk, _ := nostr.GetPublicKey(bob)
+	carolPk, _ := nostr.GetPublicKey(carol)
+
+	root := &nostr.Event{Kind: 1, CreatedAt: nostr.Now(), Content: "root", Tags: nostr.Tags{{"p", carolPk, "wss://carol.com"}}}
+	root.Sign(alice)
+
+	// reply to the root
+	tags := MakeReply(root, "wss://relay.com")
+	require.Equal(t, nostr.Tags{
+		{"e", root.ID, "wss://relay.com", "root", alicePk},
+		{"p", alicePk},
+		{"p", carolPk, "wss://carol.com"},
+	}, tags)
+
+	reply := &nostr.Event{Kind: 1, CreatedAt: nostr.Now(), Content: "reply", Tags: tags}
+	reply.Sign(bob)
+	require.Equal(t, root.ID, GetThreadRoot(reply.Tags).(nostr.EventPointer).ID)
+	require.Equal(t, root.ID, GetImmediateParent(reply.Tags).(nostr.EventPointer).ID)
+
+	// reply to the reply, the root is propagated
+	tags = MakeReply(reply, "")
+	require.Equal(t, nostr.Tags{
+		{"e", root.ID, "wss://relay.com", "root", alicePk},
+		{"e", reply.ID, "", "reply", bobPk},
+		{"p", bobPk},
+		{"p", alicePk},
+		{"p", carolPk, "wss://carol.com"},
+	}, tags)
+
+	rootPointer := GetThreadRoot(tags).(nostr.EventPointer)
+	require.Equal(t, root.ID, rootPointer.ID)
+	require.Equal(t, alicePk, rootPointer.Author)
+	require.Equal(t, []string{"wss://relay.com"}, rootPointer.Relays)
+	parentPointer := GetImmediateParent(tags).(nostr.EventPointer)
+	require.Equal(t, reply.ID, parentPointer.ID)
+	require.Equal(t, bobPk, parentPointer.Author)
+
+	// replying to an event that uses positional "e" tags
+	legacy := &nostr.Event{Kind: 1, CreatedAt: nostr.Now(), Content: "legacy", Tags: nostr.Tags{
+		{"e", root.ID},
+		{"e", reply.ID},
+		{"p", alicePk},
+	}}
+	legacy.Sign(carol)
+	tags = MakeReply(legacy, "")
+	require.Equal(t, nostr.Tags{
+		{"e", root.ID, "", "root"},
+		{"e", legacy.ID, "", "reply", carolPk},
+		{"p", carolPk},
+		{"p", alicePk},
+	}, tags)
+	require.Equal(t, root.ID, GetThreadRoot(tags).(nostr.EventPointer).ID)
+	require.Equal(t, legacy.ID, GetImmediateParent(tags).(nostr.EventPointer).ID)
+}
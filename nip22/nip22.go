@@ -1,6 +1,11 @@
 package nip22
 
 import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/nbd-wtf/go-nostr/nip73"
 )
@@ -44,3 +49,137 @@ func GetImmediateParent(tags nostr.Tags) nostr.Pointer {
 	}
 	return nil
 }
+
+// MakeComment returns the tags for a kind:1111 comment on the given event. If the parent is itself a
+// comment the root scope (the uppercase tags) is copied from it, otherwise the parent is the root.
+//
+// relayHint is a relay where the parent can be found, it can be empty.
+func MakeComment(parent *nostr.Event, relayHint string) nostr.Tags {
+	tags := make(nostr.Tags, 0, 8+len(parent.Tags))
+	kind := strconv.Itoa(parent.Kind)
+
+	if parent.Kind == nostr.KindComment {
+		for _, tag := range parent.Tags {
+			if len(tag) >= 2 && (tag[0] == "E" || tag[0] == "A" || tag[0] == "I" || tag[0] == "K" || tag[0] == "P") {
+				tags = append(tags, slices.Clone(tag))
+			}
+		}
+	} else {
+		if nostr.IsReplaceableKind(parent.Kind) || nostr.IsAddressableKind(parent.Kind) {
+			tags = append(tags, nostr.Tag{"A", address(parent), relayHint})
+		} else {
+			tags = append(tags, nostr.Tag{"E", parent.ID, relayHint, parent.PubKey})
+		}
+		tags = append(tags,
+			nostr.Tag{"K", kind},
+			nostr.Tag{"P", parent.PubKey},
+		)
+	}
+
+	if nostr.IsReplaceableKind(parent.Kind) || nostr.IsAddressableKind(parent.Kind) {
+		// the address comes first so it's taken as the parent, the id just pins the version
+		tags = append(tags, nostr.Tag{"a", address(parent), relayHint})
+	}
+	tags = append(tags,
+		nostr.Tag{"e", parent.ID, relayHint, parent.PubKey},
+		nostr.Tag{"k", kind},
+		nostr.Tag{"p", parent.PubKey},
+	)
+
+	// everybody else in the conversation
+	for _, tag := range parent.Tags {
+		if len(tag) < 2 || tag[0] != "p" || !nostr.IsValidPublicKey(tag[1]) || tags.FindWithValue("p", tag[1]) != nil {
+			continue
+		}
+		if len(tag) > 2 && tag[2] != "" {
+			tags = append(tags, nostr.Tag{"p", tag[1], tag[2]})
+		} else {
+			tags = append(tags, nostr.Tag{"p", tag[1]})
+		}
+	}
+
+	return tags
+}
+
+// MakeCommentOn returns the tags for a top-level kind:1111 comment on something we only have a pointer to,
+// which is mostly useful for nip73.ExternalPointer.
+//
+// For EventPointers the Kind and Author should be set, otherwise the "K" and "P" tags will be missing.
+func MakeCommentOn(target nostr.Pointer) nostr.Tags {
+	switch v := target.(type) {
+	case nostr.EventPointer:
+		relay := ""
+		if len(v.Relays) > 0 {
+			relay = v.Relays[0]
+		}
+		tags := nostr.Tags{{"E", v.ID, relay, v.Author}}
+		if v.Kind != 0 {
+			tags = append(tags, nostr.Tag{"K", strconv.Itoa(v.Kind)})
+		}
+		if v.Author != "" {
+			tags = append(tags, nostr.Tag{"P", v.Author})
+		}
+		tags = append(tags, nostr.Tag{"e", v.ID, relay, v.Author})
+		if v.Kind != 0 {
+			tags = append(tags, nostr.Tag{"k", strconv.Itoa(v.Kind)})
+		}
+		if v.Author != "" {
+			tags = append(tags, nostr.Tag{"p", v.Author})
+		}
+		return tags
+	case nostr.EntityPointer:
+		relay := ""
+		if len(v.Relays) > 0 {
+			relay = v.Relays[0]
+		}
+		return nostr.Tags{
+			{"A", v.AsTagReference(), relay},
+			{"K", strconv.Itoa(v.Kind)},
+			{"P", v.PublicKey},
+			{"a", v.AsTagReference(), relay},
+			{"k", strconv.Itoa(v.Kind)},
+			{"p", v.PublicKey},
+		}
+	case nip73.ExternalPointer:
+		kind := externalKind(v.Thing)
+		return nostr.Tags{
+			{"I", v.Thing},
+			{"K", kind},
+			{"i", v.Thing},
+			{"k", kind},
+		}
+	}
+	return nil
+}
+
+// multi-part NIP-73 kinds, the others are just whatever comes before the first ":"
+var externalKinds = []string{
+	"podcast:item:guid",
+	"podcast:publisher:guid",
+	"podcast:guid",
+	"bitcoin:address",
+	"bitcoin:tx",
+}
+
+// externalKind returns the NIP-73 kind for the "K" and "k" tags of an external identifier.
+func externalKind(thing string) string {
+	switch {
+	case strings.HasPrefix(thing, "https://"), strings.HasPrefix(thing, "http://"):
+		return "web"
+	case strings.HasPrefix(thing, "#"):
+		return "#"
+	}
+	for _, kind := range externalKinds {
+		if strings.HasPrefix(thing, kind+":") {
+			return kind
+		}
+	}
+	if idx := strings.Index(thing, ":"); idx != -1 {
+		return thing[0:idx]
+	}
+	return thing
+}
+
+func address(evt *nostr.Event) string {
+	return fmt.Sprintf("%d:%s:%s", evt.Kind, evt.PubKey, evt.Tags.GetD())
+}
@@ -0,0 +1,113 @@
+package nip22
+
+import (
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip73"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeComment(t *testing.T) {
+	alice := nostr.GeneratePrivateKey()
+	bob := nostr.GeneratePrivateKey()
+	alicePk, _ := nostr.GetPublicKey(alice)
+	bobPk, _ := nostr.GetPublicKey(bob)
+
+	t.Run("regular event", func(t *testing.T) {
+		root := &nostr.Event{Kind: 20, CreatedAt: nostr.Now(), Content: "a picture"}
+		root.Sign(alice)
+
+		tags := MakeComment(root, "wss://relay.com")
+		require.Equal(t, nostr.Tags{
+			{"E", root.ID, "wss://relay.com", alicePk},
+			{"K", "20"},
+			{"P", alicePk},
+			{"e", root.ID, "wss://relay.com", alicePk},
+			{"k", "20"},
+			{"p", alicePk},
+		}, tags)
+		require.Equal(t, root.ID, GetThreadRoot(tags).(nostr.EventPointer).ID)
+		require.Equal(t, root.ID, GetImmediateParent(tags).(nostr.EventPointer).ID)
+
+		// replying to the comment keeps the root scope
+		comment := &nostr.Event{Kind: nostr.KindComment, CreatedAt: nostr.Now(), Content: "nice", Tags: tags}
+		comment.Sign(bob)
+		tags = MakeComment(comment, "")
+		require.Equal(t, nostr.Tags{
+			{"E", root.ID, "wss://relay.com", alicePk},
+			{"K", "20"},
+			{"P", alicePk},
+			{"e", comment.ID, "", bobPk},
+			{"k", "1111"},
+			{"p", bobPk},
+			{"p", alicePk},
+		}, tags)
+		require.Equal(t, root.ID, GetThreadRoot(tags).(nostr.EventPointer).ID)
+		require.Equal(t, comment.ID, GetImmediateParent(tags).(nostr.EventPointer).ID)
+	})
+
+	t.Run("addressable event", func(t *testing.T) {
+		root := &nostr.Event{Kind: 30023, CreatedAt: nostr.Now(), Content: "an article", Tags: nostr.Tags{{"d", "banana"}}}
+		root.Sign(alice)
+		addr := "30023:" + alicePk + ":banana"
+
+		tags := MakeComment(root, "wss://relay.com")
+		require.Equal(t, nostr.Tags{
+			{"A", addr, "wss://relay.com"},
+			{"K", "30023"},
+			{"P", alicePk},
+			{"a", addr, "wss://relay.com"},
+			{"e", root.ID, "wss://relay.com", alicePk},
+			{"k", "30023"},
+			{"p", alicePk},
+		}, tags)
+		require.Equal(t, addr, GetThreadRoot(tags).(nostr.EntityPointer).AsTagReference())
+		require.Equal(t, addr, GetImmediateParent(tags).(nostr.EntityPointer).AsTagReference())
+
+		comment := &nostr.Event{Kind: nostr.KindComment, CreatedAt: nostr.Now(), Content: "great", Tags: tags}
+		comment.Sign(bob)
+		tags = MakeComment(comment, "")
+		require.Equal(t, addr, GetThreadRoot(tags).(nostr.EntityPointer).AsTagReference())
+		require.Equal(t, comment.ID, GetImmediateParent(tags).(nostr.EventPointer).ID)
+		require.Equal(t, "A", tags[0][0])
+	})
+
+	t.Run("external", func(t *testing.T) {
+		for thing, kind := range map[string]string{
+			"https://example.com/article":        "web",
+			"#nostr":                             "#",
+			"isbn:9780765382030":                 "isbn",
+			"podcast:item:guid:d98d189b-dc7b-45": "podcast:item:guid",
+			"geo:9q8yy":                          "geo",
+		} {
+			tags := MakeCommentOn(nip73.ExternalPointer{Thing: thing})
+			require.Equal(t, nostr.Tags{{"I", thing}, {"K", kind}, {"i", thing}, {"k", kind}}, tags)
+			require.Equal(t, thing, GetThreadRoot(tags).(nip73.ExternalPointer).Thing)
+			require.Equal(t, thing, GetImmediateParent(tags).(nip73.ExternalPointer).Thing)
+
+			comment := &nostr.Event{Kind: nostr.KindComment, CreatedAt: nostr.Now(), Content: "hm", Tags: tags}
+			comment.Sign(bob)
+			reply := MakeComment(comment, "")
+			require.Equal(t, thing, GetThreadRoot(reply).(nip73.ExternalPointer).Thing)
+			require.Equal(t, comment.ID, GetImmediateParent(reply).(nostr.EventPointer).ID)
+		}
+	})
+
+	t.Run("pointers", func(t *testing.T) {
+		id := "b3e392b11f5d4f28321cedd09303a748acfd0487aea5a7450b3481c60b6e4f87"
+		tags := MakeCommentOn(nostr.EventPointer{ID: id, Kind: 1063, Author: alicePk, Relays: []string{"wss://relay.com"}})
+		require.Equal(t, nostr.Tags{
+			{"E", id, "wss://relay.com", alicePk},
+			{"K", "1063"},
+			{"P", alicePk},
+			{"e", id, "wss://relay.com", alicePk},
+			{"k", "1063"},
+			{"p", alicePk},
+		}, tags)
+		require.Equal(t, id, GetThreadRoot(tags).(nostr.EventPointer).ID)
+
+		tags = MakeCommentOn(nostr.EntityPointer{PublicKey: alicePk, Kind: 30023, Identifier: "x"})
+		require.Equal(t, "30023:"+alicePk+":x", GetImmediateParent(tags).(nostr.EntityPointer).AsTagReference())
+	})
+}
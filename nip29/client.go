@@ -0,0 +1,156 @@
+package nip29
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Client acts on groups on behalf of a user. Events are published directly to the group relay, which is
+// authenticated with the same signer whenever it asks for it.
+//
+// The pool should have an auth handler (nostr.WithAuthHandler) for reading from private groups.
+type Client struct {
+	Signer nostr.Signer
+	Pool   *nostr.SimplePool
+
+	// PreviousReferences is how many recent events are referenced in the "previous" tag of every
+	// published event.
+	PreviousReferences int
+
+	mu        sync.Mutex
+	timelines map[GroupAddress]*Timeline
+}
+
+func NewClient(signer nostr.Signer, pool *nostr.SimplePool) *Client {
+	return &Client{
+		Signer:             signer,
+		Pool:               pool,
+		PreviousReferences: 3,
+		timelines:          make(map[GroupAddress]*Timeline),
+	}
+}
+
+// Timeline returns the timeline for a group. Events received from the group should be added to it
+// so they can be referenced by the next events we publish.
+func (c *Client) Timeline(address GroupAddress) *Timeline {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tl, ok := c.timelines[address]
+	if !ok {
+		tl = &Timeline{}
+		c.timelines[address] = tl
+	}
+	return tl
+}
+
+// Join asks to join a group, with an invite code in case it is closed.
+func (c *Client) Join(ctx context.Context, address GroupAddress, inviteCode string, reason string) error {
+	_, err := c.Publish(ctx, address, MakeJoinRequest(address.ID, inviteCode, reason))
+	return err
+}
+
+// Leave asks to be removed from a group.
+func (c *Client) Leave(ctx context.Context, address GroupAddress, reason string) error {
+	_, err := c.Publish(ctx, address, MakeLeaveRequest(address.ID, reason))
+	return err
+}
+
+// Moderate publishes a moderation action, it will only be accepted if we have the permissions for it.
+func (c *Client) Moderate(ctx context.Context, address GroupAddress, action Action, reason string) error {
+	_, err := c.Publish(ctx, address, MakeModerationEvent(address.ID, action, reason))
+	return err
+}
+
+// Publish adds the "h" tag (if missing) and a "previous" tag to an event, signs it and publishes it
+// to the group relay. It returns the signed event.
+func (c *Client) Publish(ctx context.Context, address GroupAddress, evt nostr.Event) (nostr.Event, error) {
+	if evt.Tags.FindWithValue("h", address.ID) == nil {
+		evt.Tags = append(evt.Tags, nostr.Tag{"h", address.ID})
+	}
+
+	tl := c.Timeline(address)
+	if evt.Tags.Find("previous") == nil {
+		if tag := tl.PreviousTag(c.PreviousReferences); tag != nil {
+			evt.Tags = append(evt.Tags, tag)
+		}
+	}
+
+	if err := c.Signer.SignEvent(ctx, &evt); err != nil {
+		return evt, fmt.Errorf("failed to sign: %w", err)
+	}
+
+	relay, err := c.Pool.EnsureRelay(address.Relay)
+	if err != nil {
+		return evt, err
+	}
+
+	err = relay.Publish(ctx, evt)
+	if err != nil && strings.HasPrefix(err.Error(), "msg: auth-required:") {
+		if authErr := relay.Auth(ctx, func(authEvent *nostr.Event) error {
+			return c.Signer.SignEvent(ctx, authEvent)
+		}); authErr != nil {
+			return evt, fmt.Errorf("failed to auth: %w", authErr)
+		}
+		err = relay.Publish(ctx, evt)
+	}
+	if err != nil {
+		return evt, err
+	}
+
+	tl.Add(evt.ID)
+	return evt, nil
+}
+
+// FetchGroup loads the current state of a group from its relay. It uses the 39000-39003 snapshots when
+// the relay publishes them, otherwise it replays all the moderation events.
+func (c *Client) FetchGroup(ctx context.Context, address GroupAddress) (*GroupState, error) {
+	gs := NewGroupState(address)
+
+	hasSnapshot := false
+	for ie := range c.Pool.FetchMany(ctx, []string{address.Relay}, nostr.Filter{
+		Kinds: MetadataEventKinds,
+		Tags:  nostr.TagMap{"d": []string{address.ID}},
+	}, nostr.WithLabel("nip29")) {
+		switch ie.Kind {
+		case nostr.KindSimpleGroupMetadata:
+			hasSnapshot = gs.MergeInMetadataEvent(ie.Event) == nil
+		case nostr.KindSimpleGroupAdmins:
+			gs.MergeInAdminsEvent(ie.Event)
+		case nostr.KindSimpleGroupMembers:
+			gs.MergeInMembersEvent(ie.Event)
+		case nostr.KindSimpleGroupRoles:
+			gs.MergeInRolesEvent(ie.Event)
+		}
+	}
+	if hasSnapshot {
+		return gs, nil
+	}
+
+	gs = NewGroupState(address)
+	tl := c.Timeline(address)
+	events := make([]*nostr.Event, 0, 50)
+	for ie := range c.Pool.FetchMany(ctx, []string{address.Relay}, nostr.Filter{
+		Kinds: ModerationEventKinds,
+		Tags:  nostr.TagMap{"h": []string{address.ID}},
+	}, nostr.WithLabel("nip29")) {
+		events = append(events, ie.Event)
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("group '%s' not found", address)
+	}
+
+	slices.SortFunc(events, nostr.CompareEventPtr)
+	for _, evt := range events {
+		tl.Add(evt.ID)
+	}
+
+	// invalid events are just skipped
+	gs.Replay(events)
+	return gs, nil
+}
@@ -0,0 +1,113 @@
+package nip29
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// MakeJoinRequest returns an unsigned kind 9021 event asking to join a group. inviteCode is only needed
+// for closed groups.
+func MakeJoinRequest(groupID string, inviteCode string, reason string) nostr.Event {
+	evt := nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      nostr.KindSimpleGroupJoinRequest,
+		Content:   reason,
+		Tags:      nostr.Tags{{"h", groupID}},
+	}
+	if inviteCode != "" {
+		evt.Tags = append(evt.Tags, nostr.Tag{"code", inviteCode})
+	}
+	return evt
+}
+
+// MakeLeaveRequest returns an unsigned kind 9022 event asking to be removed from a group.
+func MakeLeaveRequest(groupID string, reason string) nostr.Event {
+	return nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      nostr.KindSimpleGroupLeaveRequest,
+		Content:   reason,
+		Tags:      nostr.Tags{{"h", groupID}},
+	}
+}
+
+// MakeModerationEvent returns an unsigned moderation event (kinds 9000-9009) for the given action.
+func MakeModerationEvent(groupID string, action Action, reason string) nostr.Event {
+	return nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      action.Kind(),
+		Content:   reason,
+		Tags:      append(nostr.Tags{{"h", groupID}}, action.Tags()...),
+	}
+}
+
+// TimelineSize is how many recent events are kept by a Timeline.
+const TimelineSize = 50
+
+// Timeline keeps the ids of the last events seen in a group, so new events can reference them in a
+// "previous" tag (which prevents them from being published out of context in another relay) and relays
+// can check these references.
+type Timeline struct {
+	mu   sync.Mutex
+	ids  [TimelineSize]string
+	next int
+	size int
+}
+
+// Add records an event as seen in the group.
+func (tl *Timeline) Add(id string) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	tl.ids[tl.next] = id
+	tl.next = (tl.next + 1) % TimelineSize
+	tl.size = min(tl.size+1, TimelineSize)
+}
+
+// PreviousTag returns a "previous" tag referencing the n most recent events, or nil if no events
+// were seen yet.
+func (tl *Timeline) PreviousTag(n int) nostr.Tag {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	n = min(n, tl.size)
+	if n == 0 {
+		return nil
+	}
+
+	tag := make(nostr.Tag, 1, 1+n)
+	tag[0] = "previous"
+	for i := 1; i <= n; i++ {
+		id := tl.ids[(tl.next-i+TimelineSize)%TimelineSize]
+		tag = append(tag, id[0:min(8, len(id))])
+	}
+	return tag
+}
+
+// CheckPrevious returns an error if any of the references in the event "previous" tag is not among the
+// events in the timeline.
+func (tl *Timeline) CheckPrevious(evt *nostr.Event) error {
+	tag := evt.Tags.Find("previous")
+	if tag == nil {
+		return nil
+	}
+
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	for _, ref := range tag[1:] {
+		found := false
+		for i := 0; i < tl.size; i++ {
+			if strings.HasPrefix(tl.ids[i], ref) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown previous event '%s'", ref)
+		}
+	}
+	return nil
+}
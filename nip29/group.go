@@ -200,7 +200,7 @@ func (group Group) ToMembersEvent() *nostr.Event {
 func (group Group) ToRolesEvent() *nostr.Event {
 	evt := &nostr.Event{
 		Kind:      nostr.KindSimpleGroupRoles,
-		CreatedAt: group.LastMembersUpdate,
+		CreatedAt: group.LastRolesUpdate,
 		Tags:      make(nostr.Tags, 1, 1+len(group.Members)),
 	}
 	evt.Tags[0] = nostr.Tag{"d", group.Address.ID}
@@ -300,3 +300,32 @@ func (group *Group) MergeInMembersEvent(evt *nostr.Event) error {
 
 	return nil
 }
+
+func (group *Group) MergeInRolesEvent(evt *nostr.Event) error {
+	if evt.Kind != nostr.KindSimpleGroupRoles {
+		return fmt.Errorf("expected kind %d, got %d", nostr.KindSimpleGroupRoles, evt.Kind)
+	}
+	if evt.CreatedAt < group.LastRolesUpdate {
+		return fmt.Errorf("event is older than our last update (%d vs %d)", evt.CreatedAt, group.LastRolesUpdate)
+	}
+
+	group.LastRolesUpdate = evt.CreatedAt
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		if tag[0] != "role" {
+			continue
+		}
+
+		role := group.GetRoleByName(tag[1])
+		if len(tag) >= 3 {
+			role.Description = tag[2]
+		}
+		if !slices.Contains(group.Roles, role) {
+			group.Roles = append(group.Roles, role)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,252 @@
+package nip29
+
+import (
+	"fmt"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Action is a moderation action, one of the 9000-9009 kinds. It can be turned into an event with
+// MakeModerationEvent, parsed back from one with ParseAction and applied to a Group.
+type Action interface {
+	Kind() int
+	Tags() nostr.Tags
+	Apply(group *Group, createdAt nostr.Timestamp)
+}
+
+var (
+	_ Action = PutUser{}
+	_ Action = RemoveUser{}
+	_ Action = EditMetadata{}
+	_ Action = DeleteEvent{}
+	_ Action = CreateGroup{}
+	_ Action = DeleteGroup{}
+	_ Action = CreateInvite{}
+)
+
+// PutUser adds a member to the group, optionally with roles. When roles are given they replace the
+// roles the member had before.
+type PutUser struct {
+	PubKey string
+	Roles  []string
+}
+
+func (a PutUser) Kind() int { return nostr.KindSimpleGroupPutUser }
+
+func (a PutUser) Tags() nostr.Tags {
+	return nostr.Tags{append(nostr.Tag{"p", a.PubKey}, a.Roles...)}
+}
+
+func (a PutUser) Apply(group *Group, createdAt nostr.Timestamp) {
+	roles, exists := group.Members[a.PubKey]
+	if len(a.Roles) > 0 {
+		roles = make([]*Role, len(a.Roles))
+		for i, name := range a.Roles {
+			roles[i] = group.GetRoleByName(name)
+		}
+		group.LastAdminsUpdate = createdAt
+	} else if exists && len(roles) > 0 {
+		// nothing changes
+		return
+	}
+
+	group.Members[a.PubKey] = roles
+	group.LastMembersUpdate = createdAt
+}
+
+// RemoveUser removes a member from the group.
+type RemoveUser struct {
+	PubKey string
+}
+
+func (a RemoveUser) Kind() int { return nostr.KindSimpleGroupRemoveUser }
+
+func (a RemoveUser) Tags() nostr.Tags { return nostr.Tags{{"p", a.PubKey}} }
+
+func (a RemoveUser) Apply(group *Group, createdAt nostr.Timestamp) {
+	if roles, exists := group.Members[a.PubKey]; exists {
+		if len(roles) > 0 {
+			group.LastAdminsUpdate = createdAt
+		}
+		delete(group.Members, a.PubKey)
+		group.LastMembersUpdate = createdAt
+	}
+}
+
+// EditMetadata changes the metadata of the group. Only the fields that are not nil are changed.
+type EditMetadata struct {
+	Name    *string
+	About   *string
+	Picture *string
+	Private *bool
+	Closed  *bool
+}
+
+func (a EditMetadata) Kind() int { return nostr.KindSimpleGroupEditMetadata }
+
+func (a EditMetadata) Tags() nostr.Tags {
+	tags := make(nostr.Tags, 0, 5)
+	if a.Name != nil {
+		tags = append(tags, nostr.Tag{"name", *a.Name})
+	}
+	if a.About != nil {
+		tags = append(tags, nostr.Tag{"about", *a.About})
+	}
+	if a.Picture != nil {
+		tags = append(tags, nostr.Tag{"picture", *a.Picture})
+	}
+	if a.Private != nil {
+		if *a.Private {
+			tags = append(tags, nostr.Tag{"private"})
+		} else {
+			tags = append(tags, nostr.Tag{"public"})
+		}
+	}
+	if a.Closed != nil {
+		if *a.Closed {
+			tags = append(tags, nostr.Tag{"closed"})
+		} else {
+			tags = append(tags, nostr.Tag{"open"})
+		}
+	}
+	return tags
+}
+
+func (a EditMetadata) Apply(group *Group, createdAt nostr.Timestamp) {
+	if a.Name != nil {
+		group.Name = *a.Name
+	}
+	if a.About != nil {
+		group.About = *a.About
+	}
+	if a.Picture != nil {
+		group.Picture = *a.Picture
+	}
+	if a.Private != nil {
+		group.Private = *a.Private
+	}
+	if a.Closed != nil {
+		group.Closed = *a.Closed
+	}
+	group.LastMetadataUpdate = createdAt
+}
+
+// DeleteEvent removes an event from the group. It doesn't change the Group itself, relays should
+// delete the event from their databases and GroupState keeps track of it.
+type DeleteEvent struct {
+	EventID string
+}
+
+func (a DeleteEvent) Kind() int { return nostr.KindSimpleGroupDeleteEvent }
+
+func (a DeleteEvent) Tags() nostr.Tags { return nostr.Tags{{"e", a.EventID}} }
+
+func (a DeleteEvent) Apply(group *Group, createdAt nostr.Timestamp) {}
+
+// CreateGroup creates the group.
+type CreateGroup struct{}
+
+func (a CreateGroup) Kind() int { return nostr.KindSimpleGroupCreateGroup }
+
+func (a CreateGroup) Tags() nostr.Tags { return nostr.Tags{} }
+
+func (a CreateGroup) Apply(group *Group, createdAt nostr.Timestamp) {
+	group.LastMetadataUpdate = createdAt
+}
+
+// DeleteGroup deletes the group. Relays should delete everything related to it.
+type DeleteGroup struct{}
+
+func (a DeleteGroup) Kind() int { return nostr.KindSimpleGroupDeleteGroup }
+
+func (a DeleteGroup) Tags() nostr.Tags { return nostr.Tags{} }
+
+func (a DeleteGroup) Apply(group *Group, createdAt nostr.Timestamp) {
+	clear(group.Members)
+	group.LastMembersUpdate = createdAt
+	group.LastAdminsUpdate = createdAt
+}
+
+// CreateInvite creates an invite code that can be used in a join request to enter a closed group.
+type CreateInvite struct {
+	Code string
+}
+
+func (a CreateInvite) Kind() int { return nostr.KindSimpleGroupCreateInvite }
+
+func (a CreateInvite) Tags() nostr.Tags { return nostr.Tags{{"code", a.Code}} }
+
+func (a CreateInvite) Apply(group *Group, createdAt nostr.Timestamp) {}
+
+// ParseAction reads a moderation event back into an Action. It doesn't check who has signed it.
+func ParseAction(evt *nostr.Event) (Action, error) {
+	switch evt.Kind {
+	case nostr.KindSimpleGroupPutUser:
+		tag := evt.Tags.Find("p")
+		if tag == nil || !nostr.IsValid32ByteHex(tag[1]) {
+			return nil, fmt.Errorf("missing or invalid 'p' tag")
+		}
+		a := PutUser{PubKey: tag[1]}
+		if len(tag) > 2 {
+			a.Roles = tag[2:]
+		}
+		return a, nil
+	case nostr.KindSimpleGroupRemoveUser:
+		tag := evt.Tags.Find("p")
+		if tag == nil || !nostr.IsValid32ByteHex(tag[1]) {
+			return nil, fmt.Errorf("missing or invalid 'p' tag")
+		}
+		return RemoveUser{PubKey: tag[1]}, nil
+	case nostr.KindSimpleGroupEditMetadata:
+		a := EditMetadata{}
+		yes := true
+		no := false
+		for _, tag := range evt.Tags {
+			if len(tag) == 0 {
+				continue
+			}
+			switch tag[0] {
+			case "name", "about", "picture":
+				if len(tag) < 2 {
+					continue
+				}
+				value := tag[1]
+				switch tag[0] {
+				case "name":
+					a.Name = &value
+				case "about":
+					a.About = &value
+				case "picture":
+					a.Picture = &value
+				}
+			case "private":
+				a.Private = &yes
+			case "public":
+				a.Private = &no
+			case "closed":
+				a.Closed = &yes
+			case "open":
+				a.Closed = &no
+			}
+		}
+		return a, nil
+	case nostr.KindSimpleGroupDeleteEvent:
+		tag := evt.Tags.Find("e")
+		if tag == nil || !nostr.IsValid32ByteHex(tag[1]) {
+			return nil, fmt.Errorf("missing or invalid 'e' tag")
+		}
+		return DeleteEvent{EventID: tag[1]}, nil
+	case nostr.KindSimpleGroupCreateGroup:
+		return CreateGroup{}, nil
+	case nostr.KindSimpleGroupDeleteGroup:
+		return DeleteGroup{}, nil
+	case nostr.KindSimpleGroupCreateInvite:
+		tag := evt.Tags.Find("code")
+		if tag == nil || tag[1] == "" {
+			return nil, fmt.Errorf("missing 'code' tag")
+		}
+		return CreateInvite{Code: tag[1]}, nil
+	default:
+		return nil, fmt.Errorf("kind %d is not a moderation action", evt.Kind)
+	}
+}
@@ -1,8 +1,14 @@
 package nip29
 
 import (
+	"context"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/keyer"
+	"github.com/nbd-wtf/go-nostr/nostrtest"
 	"github.com/stretchr/testify/require"
 )
 
@@ -58,3 +64,141 @@ func TestGroupEventBackAndForth(t *testing.T) {
 	require.Equal(t, "banana", group2.Name, "merge of meta1 into group2 failed")
 	require.Equal(t, "abc", group2.Address.ID, "merge of meta1 into group2 failed")
 }
+
+func TestGroupStateReplay(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	gad := GroupAddress{Relay: "wss://groups.com", ID: "abc"}
+
+	name := "the group"
+	closed := true
+	actions := []Action{
+		CreateGroup{},
+		PutUser{PubKey: ALICE, Roles: []string{"admin"}},
+		EditMetadata{Name: &name, Closed: &closed},
+		PutUser{PubKey: BOB},
+		PutUser{PubKey: CAROL},
+		CreateInvite{Code: "xyz"},
+		RemoveUser{PubKey: BOB},
+		DeleteEvent{EventID: "fb3b6e6a83a4a7d67d6c1d98b85b1ef9d5a4c1c8c5b69d0b8b5a0a6a8f4e7d31"},
+		PutUser{PubKey: ALICE},
+	}
+	events := make([]*nostr.Event, len(actions))
+	for i, action := range actions {
+		evt := MakeModerationEvent(gad.ID, action, "")
+		evt.CreatedAt = nostr.Timestamp(1000 + i)
+		require.NoError(t, evt.Sign(sk))
+		parsed, err := ParseAction(&evt)
+		require.NoError(t, err)
+		require.Equal(t, action, parsed)
+		events[len(events)-1-i] = &evt // reversed, as relays return them
+	}
+
+	// also some noise
+	other := MakeModerationEvent("other", PutUser{PubKey: DEREK}, "")
+	other.Sign(sk)
+	msg := nostr.Event{Kind: 9, Tags: nostr.Tags{{"h", gad.ID}}}
+	msg.Sign(sk)
+	events = append(events, &other, &msg)
+
+	gs := NewGroupState(gad)
+	err := gs.Replay(events)
+	require.ErrorContains(t, err, "not for group")
+
+	require.Equal(t, "the group", gs.Name)
+	require.True(t, gs.Closed)
+	require.False(t, gs.Private)
+	require.True(t, gs.IsAdmin(ALICE))
+	require.True(t, gs.HasRole(ALICE, "admin"))
+	require.False(t, gs.IsMember(BOB))
+	require.True(t, gs.IsMember(CAROL))
+	require.False(t, gs.IsAdmin(CAROL))
+	require.False(t, gs.IsMember(DEREK))
+	require.Contains(t, gs.DeletedEvents, "fb3b6e6a83a4a7d67d6c1d98b85b1ef9d5a4c1c8c5b69d0b8b5a0a6a8f4e7d31")
+	require.Equal(t, nostr.Timestamp(1006), gs.LastMembersUpdate)
+
+	join := MakeJoinRequest(gad.ID, "", "")
+	join.Sign(sk)
+	require.ErrorContains(t, gs.CheckJoinRequest(&join), "closed")
+	join = MakeJoinRequest(gad.ID, "xyz", "")
+	join.Sign(sk)
+	require.NoError(t, gs.CheckJoinRequest(&join))
+
+	del := MakeModerationEvent(gad.ID, DeleteGroup{}, "")
+	del.CreatedAt = 2000
+	require.NoError(t, gs.ApplyEvent(&del))
+	require.True(t, gs.Deleted)
+	require.Empty(t, gs.Members)
+}
+
+func TestTimeline(t *testing.T) {
+	tl := &Timeline{}
+	require.Nil(t, tl.PreviousTag(3))
+
+	ids := make([]string, 60)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%08x%056d", i+1, 0)
+		tl.Add(ids[i])
+	}
+
+	tag := tl.PreviousTag(3)
+	require.Equal(t, nostr.Tag{"previous", ids[59][0:8], ids[58][0:8], ids[57][0:8]}, tag)
+
+	evt := nostr.Event{Tags: nostr.Tags{tag}}
+	require.NoError(t, tl.CheckPrevious(&evt))
+
+	// these are too old
+	evt.Tags = nostr.Tags{{"previous", ids[59][0:8], ids[2][0:8]}}
+	require.Error(t, tl.CheckPrevious(&evt))
+}
+
+func TestClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	relay := nostrtest.NewRelay()
+	relay.RequireAuth = true
+	url := relay.Start()
+	defer relay.Close()
+
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	signer, _ := keyer.NewPlainKeySigner(sk)
+	pool := nostr.NewSimplePool(ctx, nostr.WithAuthHandler(func(ctx context.Context, ie nostr.RelayEvent) error {
+		return ie.Sign(sk)
+	}))
+
+	gad := GroupAddress{Relay: url, ID: "grp"}
+	client := NewClient(signer, pool)
+	require.NoError(t, client.Moderate(ctx, gad, CreateGroup{}, ""))
+	require.NoError(t, client.Moderate(ctx, gad, PutUser{PubKey: pk, Roles: []string{"king"}}, ""))
+	require.NoError(t, client.Moderate(ctx, gad, PutUser{PubKey: BOB}, ""))
+	require.NoError(t, client.Join(ctx, gad, "", "hello"))
+
+	joins, _ := relay.Store.QueryEvents(ctx, nostr.Filter{Kinds: []int{nostr.KindSimpleGroupJoinRequest}})
+	require.Len(t, joins, 1)
+	require.Equal(t, "previous", joins[0].Tags.Find("previous")[0])
+	require.Len(t, joins[0].Tags.Find("previous"), 4)
+
+	gs, err := client.FetchGroup(ctx, gad)
+	require.NoError(t, err)
+	require.True(t, gs.HasRole(pk, "king"))
+	require.True(t, gs.IsMember(BOB))
+
+	// now with a snapshot
+	gs.Name = "snapshot"
+	gs.LastMetadataUpdate = nostr.Now()
+	meta := gs.ToMetadataEvent()
+	meta.Sign(nostr.GeneratePrivateKey())
+	require.NoError(t, relay.Store.SaveEvent(ctx, meta))
+	members := gs.ToMembersEvent()
+	members.Sign(nostr.GeneratePrivateKey())
+	require.NoError(t, relay.Store.SaveEvent(ctx, members))
+
+	gs, err = client.FetchGroup(ctx, gad)
+	require.NoError(t, err)
+	require.Equal(t, "snapshot", gs.Name)
+	require.True(t, gs.IsMember(BOB))
+
+	_, err = client.FetchGroup(ctx, GroupAddress{Relay: url, ID: "nothing"})
+	require.Error(t, err)
+}
@@ -0,0 +1,105 @@
+package nip29
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// GroupState rebuilds a Group by replaying its moderation events in order, which is necessary for relays
+// that don't publish the 39000-39003 snapshots. Relays can also use it to keep their own state.
+//
+// It doesn't check who signed the moderation events, it assumes the relay has done that. Relays should
+// check with Group.IsAdmin (or their own rules) before accepting them.
+type GroupState struct {
+	Group
+
+	Deleted       bool
+	DeletedEvents map[string]struct{}
+	Invites       map[string]struct{}
+}
+
+func NewGroupState(address GroupAddress) *GroupState {
+	return &GroupState{
+		Group: Group{
+			Address: address,
+			Name:    address.ID,
+			Members: make(map[string][]*Role),
+		},
+		DeletedEvents: make(map[string]struct{}),
+		Invites:       make(map[string]struct{}),
+	}
+}
+
+// ApplyEvent applies a single moderation event to the state. Events must be applied in the order they
+// were created.
+func (gs *GroupState) ApplyEvent(evt *nostr.Event) error {
+	if tag := evt.Tags.Find("h"); tag == nil || tag[1] != gs.Address.ID {
+		return fmt.Errorf("event is not for group '%s'", gs.Address.ID)
+	}
+
+	action, err := ParseAction(evt)
+	if err != nil {
+		return err
+	}
+
+	switch a := action.(type) {
+	case CreateGroup:
+		gs.Deleted = false
+	case DeleteGroup:
+		gs.Deleted = true
+	case DeleteEvent:
+		gs.DeletedEvents[a.EventID] = struct{}{}
+	case CreateInvite:
+		gs.Invites[a.Code] = struct{}{}
+	}
+
+	action.Apply(&gs.Group, evt.CreatedAt)
+	return nil
+}
+
+// Replay applies all the moderation events among the given ones, sorted by their creation date. Other
+// kinds are ignored. Invalid events are skipped and their errors are returned at the end.
+func (gs *GroupState) Replay(events []*nostr.Event) error {
+	sorted := make([]*nostr.Event, 0, len(events))
+	for _, evt := range events {
+		if ModerationEventKinds.Includes(evt.Kind) {
+			sorted = append(sorted, evt)
+		}
+	}
+	slices.SortStableFunc(sorted, func(a, b *nostr.Event) int { return cmp.Compare(a.CreatedAt, b.CreatedAt) })
+
+	var errs []error
+	for _, evt := range sorted {
+		if err := gs.ApplyEvent(evt); err != nil {
+			errs = append(errs, fmt.Errorf("event %s: %w", evt.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckJoinRequest tells if a kind 9021 join request can be accepted right away: that is the case for
+// open groups or when it has a valid invite code.
+func (gs *GroupState) CheckJoinRequest(evt *nostr.Event) error {
+	if evt.Kind != nostr.KindSimpleGroupJoinRequest {
+		return fmt.Errorf("expected kind %d, got %d", nostr.KindSimpleGroupJoinRequest, evt.Kind)
+	}
+	if gs.Deleted {
+		return fmt.Errorf("group was deleted")
+	}
+	if gs.IsMember(evt.PubKey) {
+		return fmt.Errorf("already a member")
+	}
+	if !gs.Closed {
+		return nil
+	}
+	if tag := evt.Tags.Find("code"); tag != nil {
+		if _, ok := gs.Invites[tag[1]]; ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("group is closed")
+}
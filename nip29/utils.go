@@ -10,3 +10,19 @@ func (group Group) GetRoleByName(name string) *Role {
 		return group.Roles[idx]
 	}
 }
+
+// IsMember tells if the pubkey is a member of the group, with or without roles.
+func (group Group) IsMember(pubkey string) bool {
+	_, ok := group.Members[pubkey]
+	return ok
+}
+
+// IsAdmin tells if the pubkey is a member of the group with at least one role.
+func (group Group) IsAdmin(pubkey string) bool {
+	return len(group.Members[pubkey]) > 0
+}
+
+// HasRole tells if the pubkey is a member of the group with the given role.
+func (group Group) HasRole(pubkey string, roleName string) bool {
+	return slices.ContainsFunc(group.Members[pubkey], func(role *Role) bool { return role.Name == roleName })
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/rand"
 	"net/url"
+	"slices"
 	"strconv"
 	"sync/atomic"
 
@@ -113,7 +114,7 @@ func NewBunker(
 
 	go func() {
 		now := nostr.Now()
-		events := pool.SubscribeMany(ctx, relays, nostr.Filter{
+		events := pool.SubscribeMany(ctx, slices.Clone(relays), nostr.Filter{
 			Tags:      nostr.TagMap{"p": []string{clientPublicKey}},
 			Kinds:     []int{nostr.KindNostrConnect},
 			Since:     &now,
@@ -141,7 +142,7 @@ func NewBunker(
 			if resp.Result == "auth_url" {
 				// special case
 				authURL := resp.Error
-				if _, ok := bunker.expectingAuth.Load(resp.ID); ok {
+				if _, ok := bunker.expectingAuth.LoadAndDelete(resp.ID); ok {
 					bunker.onAuth(authURL)
 				}
 				continue
@@ -257,8 +258,12 @@ func (bunker *BunkerClient) RPC(ctx context.Context, method string, params []str
 
 	respWaiter := make(chan Response)
 	bunker.listeners.Store(id, respWaiter)
+	if bunker.onAuth != nil {
+		bunker.expectingAuth.Store(id, struct{}{})
+	}
 	defer func() {
 		bunker.listeners.Delete(id)
+		bunker.expectingAuth.Delete(id)
 		close(respWaiter)
 	}()
 	hasWorked := make(chan struct{})
@@ -0,0 +1,153 @@
+package nip46
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+	"github.com/nbd-wtf/go-nostr/nip44"
+)
+
+// ClientMetadata is the information about the client application that goes in a nostrconnect:// URI.
+type ClientMetadata struct {
+	Name  string
+	URL   string
+	Image string
+}
+
+// PendingBunker is returned by NewBunkerFromNostrConnect and resolves to a *BunkerClient once the
+// remote signer has answered our nostrconnect:// URI.
+type PendingBunker struct {
+	done   chan struct{}
+	bunker *BunkerClient
+	err    error
+}
+
+// Done returns a channel that is closed once the remote signer has connected or we gave up waiting.
+func (pb *PendingBunker) Done() <-chan struct{} { return pb.done }
+
+// Wait blocks until the remote signer connects, the context given to NewBunkerFromNostrConnect
+// is canceled or the ctx given here is canceled.
+func (pb *PendingBunker) Wait(ctx context.Context) (*BunkerClient, error) {
+	select {
+	case <-pb.done:
+		return pb.bunker, pb.err
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
+
+// NewBunkerFromNostrConnect starts the client-initiated flow: it returns a nostrconnect:// URI that must
+// be shown to the user (usually as a QR code) so they can paste it in their remote signer, and starts
+// listening on the given relays for the signer response carrying our secret.
+//
+// perms is a list of permissions like "sign_event:1" or "nip44_encrypt".
+// pool can be passed to reuse an existing pool, otherwise a new pool will be created.
+func NewBunkerFromNostrConnect(
+	ctx context.Context,
+	clientSecretKey string,
+	relays []string,
+	metadata ClientMetadata,
+	perms []string,
+	pool *nostr.SimplePool,
+	onAuth func(string),
+) (string, *PendingBunker, error) {
+	if len(relays) == 0 {
+		return "", nil, fmt.Errorf("at least one relay is required")
+	}
+
+	clientPublicKey, err := nostr.GetPublicKey(clientSecretKey)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid client secret key: %w", err)
+	}
+
+	if pool == nil {
+		pool = nostr.NewSimplePool(ctx)
+	}
+
+	random := make([]byte, 8)
+	rand.Read(random)
+	secret := hex.EncodeToString(random)
+
+	qs := url.Values{}
+	for _, relay := range relays {
+		qs.Add("relay", relay)
+	}
+	qs.Set("secret", secret)
+	if len(perms) > 0 {
+		qs.Set("perms", strings.Join(perms, ","))
+	}
+	if metadata.Name != "" {
+		qs.Set("name", metadata.Name)
+	}
+	if metadata.URL != "" {
+		qs.Set("url", metadata.URL)
+	}
+	if metadata.Image != "" {
+		qs.Set("image", metadata.Image)
+	}
+	uri := "nostrconnect://" + clientPublicKey + "?" + strings.ReplaceAll(qs.Encode(), "+", "%20")
+
+	pending := &PendingBunker{done: make(chan struct{})}
+
+	go func() {
+		defer close(pending.done)
+
+		subCtx, cancel := context.WithCancelCause(ctx)
+		defer cancel(fmt.Errorf("nostrconnect flow ended"))
+
+		now := nostr.Now()
+		events := pool.SubscribeMany(subCtx, relays, nostr.Filter{
+			Tags:      nostr.TagMap{"p": []string{clientPublicKey}},
+			Kinds:     []int{nostr.KindNostrConnect},
+			Since:     &now,
+			LimitZero: true,
+		}, nostr.WithLabel("nostrconnect"))
+
+		for ie := range events {
+			if ie.Kind != nostr.KindNostrConnect {
+				continue
+			}
+
+			var plain string
+			ck, err := nip44.GenerateConversationKey(ie.PubKey, clientSecretKey)
+			if err != nil {
+				continue
+			}
+			plain, err = nip44.Decrypt(ie.Content, ck)
+			if err != nil {
+				sharedSecret, err := nip04.ComputeSharedSecret(ie.PubKey, clientSecretKey)
+				if err != nil {
+					continue
+				}
+				plain, err = nip04.Decrypt(ie.Content, sharedSecret)
+				if err != nil {
+					continue
+				}
+			}
+
+			var resp Response
+			if err := json.Unmarshal([]byte(plain), &resp); err != nil {
+				continue
+			}
+
+			// the signer proves it got our URI by sending back the secret
+			if resp.Result != secret {
+				continue
+			}
+
+			// the author of the response is the remote signer pubkey we must talk to from now on
+			pending.bunker = NewBunker(ctx, clientSecretKey, ie.PubKey, relays, pool, onAuth)
+			return
+		}
+
+		pending.err = fmt.Errorf("stopped waiting for a nostrconnect response: %w", context.Cause(ctx))
+	}()
+
+	return uri, pending, nil
+}
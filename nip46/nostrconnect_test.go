@@ -0,0 +1,97 @@
+package nip46
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nostrtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNostrConnectFlow(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	relay := nostrtest.NewRelay()
+	relayURL := relay.Start()
+	defer relay.Close()
+
+	clientSecretKey := nostr.GeneratePrivateKey()
+	clientPublicKey, _ := nostr.GetPublicKey(clientSecretKey)
+
+	uri, pending, err := NewBunkerFromNostrConnect(ctx, clientSecretKey, []string{relayURL},
+		ClientMetadata{Name: "test client", URL: "https://example.com"},
+		[]string{"sign_event:1", "nip44_encrypt"},
+		nil, nil)
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(uri)
+	require.NoError(t, err)
+	require.Equal(t, "nostrconnect", parsed.Scheme)
+	require.Equal(t, clientPublicKey, parsed.Host)
+	require.Equal(t, []string{relayURL}, parsed.Query()["relay"])
+	require.Equal(t, "sign_event:1,nip44_encrypt", parsed.Query().Get("perms"))
+	require.Equal(t, "test client", parsed.Query().Get("name"))
+	secret := parsed.Query().Get("secret")
+	require.NotEmpty(t, secret)
+
+	// the remote signer side
+	signerSecretKey := nostr.GeneratePrivateKey()
+	signerPublicKey, _ := nostr.GetPublicKey(signerSecretKey)
+	signer := NewStaticKeySigner(signerSecretKey)
+	session, err := signer.getOrCreateSession(clientPublicKey)
+	require.NoError(t, err)
+
+	signerPool := nostr.NewSimplePool(ctx)
+	go func() {
+		// serve requests from the client once it is connected
+		now := nostr.Now()
+		for ie := range signerPool.SubscribeMany(ctx, []string{relayURL}, nostr.Filter{
+			Kinds: []int{nostr.KindNostrConnect},
+			Tags:  nostr.TagMap{"p": []string{signerPublicKey}},
+			Since: &now,
+		}) {
+			_, _, eventResponse, err := signer.HandleRequest(ctx, ie.Event)
+			if err != nil {
+				continue
+			}
+			signerPool.PublishMany(ctx, []string{relayURL}, eventResponse)
+		}
+	}()
+
+	// keep sending the connect response until the client picks it up,
+	// since these events are ephemeral and the client might not be subscribed yet
+	go func() {
+		for {
+			_, evt, err := session.MakeResponse("connect-1", clientPublicKey, secret, nil)
+			if err != nil {
+				return
+			}
+			evt.Sign(signerSecretKey)
+			signerPool.PublishMany(ctx, []string{relayURL}, evt)
+
+			select {
+			case <-pending.Done():
+				return
+			case <-ctx.Done():
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}()
+
+	bunker, err := pending.Wait(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, bunker)
+
+	pubkey, err := bunker.GetPublicKey(ctx)
+	require.NoError(t, err)
+	require.Equal(t, signerPublicKey, pubkey)
+
+	evt := nostr.Event{Kind: 1, Content: "hello", CreatedAt: nostr.Now()}
+	require.NoError(t, bunker.SignEvent(ctx, &evt))
+	require.Equal(t, signerPublicKey, evt.PubKey)
+}
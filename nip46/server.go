@@ -0,0 +1,622 @@
+package nip46
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mailru/easyjson"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+	"github.com/nbd-wtf/go-nostr/nip44"
+	"github.com/nbd-wtf/go-nostr/sdk/kvstore"
+	"github.com/nbd-wtf/go-nostr/sdk/kvstore/memory"
+)
+
+var _ Signer = (*Server)(nil)
+
+// Permission is a single item from a NIP-46 "perms" string, like "sign_event:1" or "nip44_encrypt".
+type Permission struct {
+	Method string
+	Param  string // for sign_event this is the kind, empty means anything
+}
+
+// Permissions is a list of permissions, as given in a "perms" string.
+type Permissions []Permission
+
+// ParsePermissions parses a comma-separated "perms" string.
+func ParsePermissions(perms string) Permissions {
+	result := make(Permissions, 0, strings.Count(perms, ",")+1)
+	for _, item := range strings.Split(perms, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		method, param, _ := strings.Cut(item, ":")
+		result = result.Add(Permission{method, param})
+	}
+	return result
+}
+
+func (perms Permissions) String() string {
+	items := make([]string, len(perms))
+	for i, perm := range perms {
+		if perm.Param == "" {
+			items[i] = perm.Method
+		} else {
+			items[i] = perm.Method + ":" + perm.Param
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// Allows tells if calling method with the given param (the kind, for sign_event) is permitted.
+func (perms Permissions) Allows(method string, param string) bool {
+	return slices.ContainsFunc(perms, func(perm Permission) bool {
+		return perm.Method == method && (perm.Param == "" || perm.Param == param)
+	})
+}
+
+// Add returns the permissions with the new ones added, skipping duplicates.
+func (perms Permissions) Add(others ...Permission) Permissions {
+	for _, perm := range others {
+		if !slices.Contains(perms, perm) {
+			perms = append(perms, perm)
+		}
+	}
+	return perms
+}
+
+// ServerSession is what the Server knows about a connected client.
+type ServerSession struct {
+	Client      string          `json:"client"`
+	Permissions string          `json:"perms"`
+	CreatedAt   nostr.Timestamp `json:"created_at"`
+}
+
+type pendingRequest struct {
+	event   *nostr.Event
+	req     Request
+	session Session
+	timer   *time.Timer
+}
+
+// challenges (auth_url prompts) are limited for the whole server, since most of them come from strangers
+const (
+	challengeRate      = 0.5 // per second
+	challengeBurst     = 10
+	maxPendingRequests = 100
+)
+
+// Server is a NIP-46 remote signer that listens for requests on a set of relays and answers them on
+// behalf of a user, keeping track of what each client is allowed to do.
+//
+// Clients connect with a one-time secret from BunkerURL and get the permissions they ask for (or whatever
+// AuthorizeConnect decides). Anything else is either refused or, if AuthURL is set, put on hold while the
+// user is sent to that URL to approve it, which must end with a call to Approve or Deny.
+//
+// Replies are encrypted with the same scheme (NIP-44 or NIP-04) the client used for its request.
+//
+// The secrets given out by BunkerURL are only kept in memory, so the bunker URLs that weren't used yet stop
+// working when the server is restarted. Only the sessions of clients that already connected go in Store.
+//
+//	server, _ := nip46.NewServer(pool, bunkerSecretKey, userKeyer, []string{"wss://relay.nsec.app"})
+//	server.Store = myPersistentStore
+//	server.RateLimit, server.RateBurst = 1, 10
+//	fmt.Println(server.BunkerURL())
+//	server.Run(ctx)
+type Server struct {
+	// Store is where sessions are persisted, it defaults to an in-memory store.
+	Store kvstore.KVStore
+
+	// AuthorizeConnect, unless nil, decides which of the requested permissions are granted to a client
+	// that connects with a valid secret.
+	AuthorizeConnect func(client string, requested Permissions) Permissions
+
+	// AuthURL, unless nil, is called when a client asks for something it isn't allowed to do yet and
+	// should return a URL where the user can approve it. To protect the user from spam only a few of these
+	// can happen every second and only a limited number of requests is kept waiting, the others are
+	// refused right away.
+	AuthURL func(client string, req Request) string
+
+	// AuthTimeout is how long requests wait for Approve or Deny, defaults to 5 minutes.
+	AuthTimeout time.Duration
+
+	// RateLimit is how many requests per second each client can make, with bursts of up to RateBurst.
+	// Clients that haven't connected yet all share the same limit. 0 means unlimited.
+	RateLimit float64
+	RateBurst int
+
+	// OnEventSigned, unless nil, is called after every event is signed.
+	OnEventSigned func(client string, event nostr.Event)
+
+	pool      *nostr.SimplePool
+	relays    []string
+	secretKey string
+	publicKey string
+	user      nostr.Keyer
+
+	mu         sync.Mutex
+	ctx        context.Context
+	secrets    []string
+	sessions   map[string]Session // crypto state of connected clients, not persisted
+	pending    map[string][]*pendingRequest
+	npending   int
+	buckets    map[string]*serverBucket // for connected clients
+	strangers  serverBucket             // shared by everybody else
+	challenges serverBucket
+}
+
+// serverBucket is a token bucket, the zero value is full.
+type serverBucket struct {
+	tokens   float64
+	refilled time.Time
+}
+
+func (b *serverBucket) take(rate float64, burst float64) bool {
+	now := time.Now()
+	if b.refilled.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens = min(burst, b.tokens+now.Sub(b.refilled).Seconds()*rate)
+	}
+	b.refilled = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// NewServer creates a Server that talks to clients using secretKey and signs with user. Call Run to start it.
+func NewServer(pool *nostr.SimplePool, secretKey string, user nostr.Keyer, relays []string) (*Server, error) {
+	pk, err := nostr.GetPublicKey(secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key: %w", err)
+	}
+
+	return &Server{
+		Store:       memory.NewStore(),
+		AuthTimeout: 5 * time.Minute,
+		pool:        pool,
+		relays:      relays,
+		secretKey:   secretKey,
+		publicKey:   pk,
+		user:        user,
+		sessions:    make(map[string]Session),
+		pending:     make(map[string][]*pendingRequest),
+		buckets:     make(map[string]*serverBucket),
+	}, nil
+}
+
+// PublicKey is the key clients must send their requests to.
+func (s *Server) PublicKey() string { return s.publicKey }
+
+// BunkerURL returns a bunker:// URL with a new one-time secret, to be given to a client.
+func (s *Server) BunkerURL() string {
+	secretb := make([]byte, 16)
+	rand.Read(secretb)
+	secret := hex.EncodeToString(secretb)
+
+	s.mu.Lock()
+	s.secrets = append(s.secrets, secret)
+	s.mu.Unlock()
+
+	qs := url.Values{}
+	for _, relay := range s.relays {
+		qs.Add("relay", relay)
+	}
+	qs.Set("secret", secret)
+	return "bunker://" + s.publicKey + "?" + qs.Encode()
+}
+
+// Run listens for requests and answers them until ctx is canceled.
+func (s *Server) Run(ctx context.Context) error {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+
+	now := nostr.Now()
+	for ie := range s.pool.SubscribeMany(ctx, slices.Clone(s.relays), nostr.Filter{
+		Kinds:     []int{nostr.KindNostrConnect},
+		Tags:      nostr.TagMap{"p": []string{s.publicKey}},
+		Since:     &now,
+		LimitZero: true,
+	}, nostr.WithLabel("bunker46server")) {
+		go func(event *nostr.Event) {
+			_, _, eventResponse, err := s.HandleRequest(ctx, event)
+			if err != nil {
+				return
+			}
+			s.publish(ctx, eventResponse)
+		}(ie.Event)
+	}
+
+	return context.Cause(ctx)
+}
+
+func (s *Server) publish(ctx context.Context, evt nostr.Event) {
+	for range s.pool.PublishMany(ctx, s.relays, evt) {
+	}
+}
+
+// GetSession returns the encryption state for a connected client.
+func (s *Server) GetSession(clientPubkey string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[clientPubkey]
+	return session, ok
+}
+
+// GetServerSession returns the persisted session for a client, if it has connected.
+func (s *Server) GetServerSession(clientPubkey string) (ServerSession, bool) {
+	data, err := s.Store.Get(sessionKey(clientPubkey))
+	if err != nil || data == nil {
+		return ServerSession{}, false
+	}
+	var ss ServerSession
+	if err := json.Unmarshal(data, &ss); err != nil {
+		return ServerSession{}, false
+	}
+	return ss, true
+}
+
+// Approve grants permissions to a client and answers its pending requests.
+func (s *Server) Approve(clientPubkey string, perms Permissions) error {
+	if err := s.grant(clientPubkey, perms); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	pending := s.pending[clientPubkey]
+	delete(s.pending, clientPubkey)
+	s.npending -= len(pending)
+	ctx := s.ctx
+	s.mu.Unlock()
+
+	for _, pr := range pending {
+		pr.timer.Stop()
+		if ctx == nil {
+			continue
+		}
+		go func() {
+			_, _, eventResponse, err := s.HandleRequest(ctx, pr.event)
+			if err == nil {
+				s.publish(ctx, eventResponse)
+			}
+		}()
+	}
+	return nil
+}
+
+// Deny refuses all pending requests from a client.
+func (s *Server) Deny(clientPubkey string) {
+	s.mu.Lock()
+	pending := s.pending[clientPubkey]
+	delete(s.pending, clientPubkey)
+	s.npending -= len(pending)
+	s.mu.Unlock()
+
+	for _, pr := range pending {
+		pr.timer.Stop()
+		s.refuse(pr, "denied")
+	}
+}
+
+// Revoke deletes the session of a client, which will have to connect again.
+func (s *Server) Revoke(clientPubkey string) error {
+	s.mu.Lock()
+	delete(s.sessions, clientPubkey)
+	delete(s.buckets, clientPubkey)
+	s.mu.Unlock()
+
+	return s.Store.Delete(sessionKey(clientPubkey))
+}
+
+func (s *Server) grant(clientPubkey string, perms Permissions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Store.Update(sessionKey(clientPubkey), func(data []byte) ([]byte, error) {
+		ss := ServerSession{Client: clientPubkey, CreatedAt: nostr.Now()}
+		if data != nil {
+			if err := json.Unmarshal(data, &ss); err != nil {
+				return nil, err
+			}
+		}
+		ss.Permissions = ParsePermissions(ss.Permissions).Add(perms...).String()
+		return json.Marshal(ss)
+	})
+}
+
+// HandleRequest answers a single request. The returned event must be published to the relays, which is
+// done automatically by Run.
+func (s *Server) HandleRequest(ctx context.Context, event *nostr.Event) (
+	req Request,
+	resp Response,
+	eventResponse nostr.Event,
+	err error,
+) {
+	if event.Kind != nostr.KindNostrConnect {
+		return req, resp, eventResponse,
+			fmt.Errorf("event kind is %d, but we expected %d", event.Kind, nostr.KindNostrConnect)
+	}
+	if p := event.Tags.Find("p"); p == nil || p[1] != s.publicKey {
+		return req, resp, eventResponse, fmt.Errorf("request is not for us")
+	}
+
+	ss, connected := s.GetServerSession(event.PubKey)
+	allowed := s.allowRate(event.PubKey, connected)
+	if !allowed && !connected {
+		// don't waste our time with strangers
+		return req, resp, eventResponse, fmt.Errorf("rate-limited")
+	}
+
+	session, err := s.getSession(event.PubKey, connected)
+	if err != nil {
+		return req, resp, eventResponse, err
+	}
+
+	req, err = session.ParseRequest(event)
+	if err != nil {
+		return req, resp, eventResponse, fmt.Errorf("error parsing request: %w", err)
+	}
+
+	if !allowed {
+		resp, eventResponse, err = s.respond(session, event, Response{ID: req.ID, Error: "rate-limited: slow down"})
+		return req, resp, eventResponse, err
+	}
+
+	var result string
+	var resultErr error
+
+	switch req.Method {
+	case "connect":
+		if connected {
+			result = "ack"
+			break
+		}
+
+		var requested Permissions
+		if len(req.Params) >= 3 {
+			requested = ParsePermissions(req.Params[2])
+		}
+		if len(req.Params) >= 2 && s.useSecret(req.Params[1]) {
+			if s.AuthorizeConnect != nil {
+				requested = s.AuthorizeConnect(event.PubKey, requested)
+			}
+			if err := s.grant(event.PubKey, requested); err != nil {
+				return req, resp, eventResponse, err
+			}
+			result = "ack"
+			break
+		}
+
+		return s.challenge(session, event, req, "invalid secret")
+	case "ping":
+		result = "pong"
+	default:
+		if !connected {
+			return s.challenge(session, event, req, "not connected")
+		}
+		perms := ParsePermissions(ss.Permissions)
+
+		switch req.Method {
+		case "get_public_key":
+			result, resultErr = s.user.GetPublicKey(ctx)
+		case "get_relays":
+			relays := make(map[string]RelayReadWrite, len(s.relays))
+			for _, url := range s.relays {
+				relays[url] = RelayReadWrite{Read: true, Write: true}
+			}
+			jrelays, _ := json.Marshal(relays)
+			result = string(jrelays)
+		case "sign_event":
+			if len(req.Params) != 1 {
+				resultErr = fmt.Errorf("wrong number of arguments to 'sign_event'")
+				break
+			}
+			evt := nostr.Event{}
+			if err := easyjson.Unmarshal([]byte(req.Params[0]), &evt); err != nil {
+				resultErr = fmt.Errorf("failed to decode event/2: %w", err)
+				break
+			}
+			if !perms.Allows("sign_event", strconv.Itoa(evt.Kind)) {
+				return s.challenge(session, event, req, fmt.Sprintf("not allowed to sign kind %d", evt.Kind))
+			}
+			if err := s.user.SignEvent(ctx, &evt); err != nil {
+				resultErr = fmt.Errorf("failed to sign event: %w", err)
+				break
+			}
+			if s.OnEventSigned != nil {
+				s.OnEventSigned(event.PubKey, evt)
+			}
+			jrevt, _ := easyjson.Marshal(evt)
+			result = string(jrevt)
+		case "nip44_encrypt", "nip44_decrypt":
+			if len(req.Params) != 2 {
+				resultErr = fmt.Errorf("wrong number of arguments to '%s'", req.Method)
+				break
+			}
+			if !nostr.IsValidPublicKey(req.Params[0]) {
+				resultErr = fmt.Errorf("first argument to '%s' is not a pubkey string", req.Method)
+				break
+			}
+			if !perms.Allows(req.Method, "") {
+				return s.challenge(session, event, req, "not allowed to "+req.Method)
+			}
+			if req.Method == "nip44_encrypt" {
+				result, resultErr = s.user.Encrypt(ctx, req.Params[1], req.Params[0])
+			} else {
+				result, resultErr = s.user.Decrypt(ctx, req.Params[1], req.Params[0])
+			}
+		default:
+			resultErr = fmt.Errorf("unsupported method '%s'", req.Method)
+		}
+	}
+
+	resp = Response{ID: req.ID, Result: result}
+	if resultErr != nil {
+		resp = Response{ID: req.ID, Error: resultErr.Error()}
+	}
+	resp, eventResponse, err = s.respond(session, event, resp)
+	return req, resp, eventResponse, err
+}
+
+// challenge answers with an auth_url and holds the request until Approve or Deny are called, or refuses
+// it right away if there is no AuthURL or too many challenges are going on.
+func (s *Server) challenge(session Session, event *nostr.Event, req Request, reason string) (
+	Request,
+	Response,
+	nostr.Event,
+	error,
+) {
+	s.mu.Lock()
+	if s.AuthURL == nil || s.npending >= maxPendingRequests || !s.challenges.take(challengeRate, challengeBurst) {
+		s.mu.Unlock()
+		resp, evt, err := s.respond(session, event, Response{ID: req.ID, Error: reason})
+		return req, resp, evt, err
+	}
+
+	pr := &pendingRequest{event: event, req: req, session: session}
+	pr.timer = time.AfterFunc(s.AuthTimeout, func() {
+		s.mu.Lock()
+		pending := s.pending[event.PubKey]
+		idx := slices.Index(pending, pr)
+		if idx != -1 {
+			if len(pending) == 1 {
+				delete(s.pending, event.PubKey)
+			} else {
+				s.pending[event.PubKey] = slices.Delete(pending, idx, idx+1)
+			}
+			s.npending--
+		}
+		s.mu.Unlock()
+
+		if idx != -1 {
+			s.refuse(pr, "timed out waiting for authorization")
+		}
+	})
+	s.pending[event.PubKey] = append(s.pending[event.PubKey], pr)
+	s.npending++
+	s.mu.Unlock()
+
+	resp, evt, err := s.respond(session, event, Response{ID: req.ID, Result: "auth_url", Error: s.AuthURL(event.PubKey, req)})
+	return req, resp, evt, err
+}
+
+func (s *Server) refuse(pr *pendingRequest, reason string) {
+	s.mu.Lock()
+	ctx := s.ctx
+	s.mu.Unlock()
+	if ctx == nil {
+		return
+	}
+
+	if _, evt, err := s.respond(pr.session, pr.event, Response{ID: pr.req.ID, Error: reason}); err == nil {
+		s.publish(ctx, evt)
+	}
+}
+
+// respond is like session.MakeResponse, but it can send both a result and an error, as needed for auth_url,
+// and it encrypts the response with the same scheme as the request.
+func (s *Server) respond(session Session, request *nostr.Event, resp Response) (Response, nostr.Event, error) {
+	jresp, _ := json.Marshal(resp)
+
+	var ciphertext string
+	var err error
+	if isNIP04(request.Content) {
+		ciphertext, err = nip04.Encrypt(string(jresp), session.SharedKey)
+	} else {
+		ciphertext, err = nip44.Encrypt(string(jresp), session.ConversationKey)
+	}
+	if err != nil {
+		return resp, nostr.Event{}, fmt.Errorf("failed to encrypt result: %w", err)
+	}
+
+	evt := nostr.Event{
+		Content:   ciphertext,
+		CreatedAt: nostr.Now(),
+		Kind:      nostr.KindNostrConnect,
+		Tags:      nostr.Tags{{"p", request.PubKey}},
+	}
+	return resp, evt, evt.Sign(s.secretKey)
+}
+
+// isNIP04 tells if a ciphertext is NIP-04 ("<base64>?iv=<base64>"), NIP-44 payloads never have a "?".
+func isNIP04(ciphertext string) bool {
+	return strings.Contains(ciphertext, "?iv=")
+}
+
+// getSession computes the encryption state for a client, which is only kept for the ones that are
+// connected so strangers can't make us hold on to anything.
+func (s *Server) getSession(clientPubkey string, connected bool) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, ok := s.sessions[clientPubkey]; ok {
+		return session, nil
+	}
+
+	shared, err := nip04.ComputeSharedSecret(clientPubkey, s.secretKey)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+	ck, err := nip44.GenerateConversationKey(clientPubkey, s.secretKey)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+
+	session := Session{
+		PublicKey:       s.publicKey,
+		SharedKey:       shared,
+		ConversationKey: ck,
+	}
+	if connected {
+		s.sessions[clientPubkey] = session
+	}
+	return session, nil
+}
+
+func (s *Server) useSecret(secret string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := slices.Index(s.secrets, secret)
+	if secret == "" || idx == -1 {
+		return false
+	}
+	s.secrets = slices.Delete(s.secrets, idx, idx+1)
+	return true
+}
+
+func (s *Server) allowRate(clientPubkey string, connected bool) bool {
+	if s.RateLimit <= 0 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket := &s.strangers
+	if connected {
+		bucket = s.buckets[clientPubkey]
+		if bucket == nil {
+			bucket = &serverBucket{}
+			s.buckets[clientPubkey] = bucket
+		}
+	}
+	return bucket.take(s.RateLimit, float64(max(s.RateBurst, 1)))
+}
+
+func sessionKey(clientPubkey string) []byte {
+	return []byte("nip46:session:" + clientPubkey)
+}
@@ -0,0 +1,250 @@
+package nip46_test
+
+import (
+	"context"
+	"encoding/json"
+	netURL "net/url"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/keyer"
+	"github.com/nbd-wtf/go-nostr/nip04"
+	"github.com/nbd-wtf/go-nostr/nip44"
+	"github.com/nbd-wtf/go-nostr/nip46"
+	"github.com/nbd-wtf/go-nostr/nostrtest"
+	"github.com/nbd-wtf/go-nostr/sdk/kvstore/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePermissions(t *testing.T) {
+	perms := nip46.ParsePermissions("sign_event:1, nip44_encrypt,,sign_event:1,sign_event")
+	assert.Equal(t, "sign_event:1,nip44_encrypt,sign_event", perms.String())
+	assert.True(t, perms.Allows("sign_event", "7"))
+	assert.True(t, perms.Allows("nip44_encrypt", ""))
+	assert.False(t, perms.Allows("nip44_decrypt", ""))
+
+	perms = nip46.ParsePermissions("sign_event:1").Add(nip46.Permission{Method: "sign_event", Param: "7"})
+	assert.True(t, perms.Allows("sign_event", "7"))
+	assert.False(t, perms.Allows("sign_event", "3"))
+}
+
+func TestServer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	relay := nostrtest.NewRelay()
+	url := relay.Start()
+	defer relay.Close()
+
+	pool := nostr.NewSimplePool(ctx)
+	user, _ := keyer.NewPlainKeySigner(nostr.GeneratePrivateKey())
+	userPk, _ := user.GetPublicKey(ctx)
+	bunkerSk := nostr.GeneratePrivateKey()
+	store := memory.NewStore()
+
+	start := func(configure func(*nip46.Server)) (*nip46.Server, context.CancelFunc) {
+		server, err := nip46.NewServer(pool, bunkerSk, user, []string{url})
+		require.NoError(t, err)
+		server.Store = store
+		configure(server)
+
+		ctx, cancel := context.WithCancel(ctx)
+		go server.Run(ctx)
+		time.Sleep(200 * time.Millisecond)
+		return server, cancel
+	}
+
+	signed := make(chan nostr.Event, 10)
+	server, stop := start(func(server *nip46.Server) {
+		server.AuthURL = func(client string, req nip46.Request) string {
+			return "https://bunker.example.com/approve/" + req.ID
+		}
+		server.OnEventSigned = func(client string, event nostr.Event) { signed <- event }
+	})
+
+	// connect with a secret and some permissions
+	authURLs := make(chan string, 10)
+	clientSk := nostr.GeneratePrivateKey()
+	clientPk, _ := nostr.GetPublicKey(clientSk)
+	client := nip46.NewBunker(ctx, clientSk, server.PublicKey(), []string{url}, pool, func(url string) { authURLs <- url })
+	secret := secretFrom(server.BunkerURL())
+	_, err := client.RPC(ctx, "connect", []string{server.PublicKey(), secret, "sign_event:1,nip44_encrypt"})
+	require.NoError(t, err)
+
+	session, ok := server.GetServerSession(clientPk)
+	require.True(t, ok)
+	assert.Equal(t, "sign_event:1,nip44_encrypt", session.Permissions)
+
+	pk, err := client.GetPublicKey(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, userPk, pk)
+
+	evt := nostr.Event{Kind: 1, Content: "hello", CreatedAt: nostr.Now()}
+	require.NoError(t, client.SignEvent(ctx, &evt))
+	assert.Equal(t, userPk, evt.PubKey)
+	ok, _ = evt.CheckSignature()
+	assert.True(t, ok)
+	assert.Equal(t, evt.ID, (<-signed).ID)
+
+	_, err = client.NIP44Encrypt(ctx, userPk, "secret")
+	require.NoError(t, err)
+
+	// kind 7 isn't allowed, so the user is asked to approve it
+	reaction := nostr.Event{Kind: 7, Content: "+", CreatedAt: nostr.Now()}
+	done := make(chan error)
+	go func() { done <- client.SignEvent(ctx, &reaction) }()
+	select {
+	case authURL := <-authURLs:
+		assert.Contains(t, authURL, "https://bunker.example.com/approve/")
+	case <-ctx.Done():
+		t.Fatal("didn't get an auth_url")
+	}
+	require.NoError(t, server.Approve(clientPk, nip46.Permissions{{Method: "sign_event", Param: "7"}}))
+	require.NoError(t, <-done)
+	assert.Equal(t, userPk, reaction.PubKey)
+
+	// reusing the secret doesn't work, and the user says no
+	otherSk := nostr.GeneratePrivateKey()
+	otherPk, _ := nostr.GetPublicKey(otherSk)
+	other := nip46.NewBunker(ctx, otherSk, server.PublicKey(), []string{url}, pool, func(url string) { authURLs <- url })
+	go func() {
+		_, err := other.RPC(ctx, "connect", []string{server.PublicKey(), secret})
+		done <- err
+	}()
+	<-authURLs
+	server.Deny(otherPk)
+	assert.ErrorContains(t, <-done, "denied")
+	_, ok = server.GetServerSession(otherPk)
+	assert.False(t, ok)
+
+	// a new server sees the same sessions
+	stop()
+	server, stop = start(func(*nip46.Server) {})
+	defer stop()
+
+	evt = nostr.Event{Kind: 7, Content: "-", CreatedAt: nostr.Now()}
+	require.NoError(t, client.SignEvent(ctx, &evt))
+	_, err = client.NIP44Decrypt(ctx, userPk, "whatever")
+	assert.ErrorContains(t, err, "not allowed")
+
+	require.NoError(t, server.Revoke(clientPk))
+	evt = nostr.Event{Kind: 1, Content: "bye", CreatedAt: nostr.Now()}
+	assert.ErrorContains(t, client.SignEvent(ctx, &evt), "not connected")
+}
+
+func TestServerRateLimit(t *testing.T) {
+	ctx := context.Background()
+	user, _ := keyer.NewPlainKeySigner(nostr.GeneratePrivateKey())
+	server, err := nip46.NewServer(nostr.NewSimplePool(ctx), nostr.GeneratePrivateKey(), user, nil)
+	require.NoError(t, err)
+	server.RateLimit = 0.1
+	server.RateBurst = 2
+
+	request := func(clientSk string, method string, params ...string) (nip46.Response, error) {
+		ck, _ := nip44.GenerateConversationKey(server.PublicKey(), clientSk)
+		jreq, _ := json.Marshal(nip46.Request{ID: "x", Method: method, Params: params})
+		content, _ := nip44.Encrypt(string(jreq), ck)
+		evt := nostr.Event{Kind: nostr.KindNostrConnect, CreatedAt: nostr.Now(), Content: content, Tags: nostr.Tags{{"p", server.PublicKey()}}}
+		evt.Sign(clientSk)
+		_, resp, _, err := server.HandleRequest(ctx, &evt)
+		return resp, err
+	}
+
+	// known clients are told to slow down
+	clientSk := nostr.GeneratePrivateKey()
+	resp, err := request(clientSk, "connect", server.PublicKey(), secretFrom(server.BunkerURL()))
+	require.NoError(t, err)
+	assert.Equal(t, "ack", resp.Result)
+	for range 2 {
+		resp, _ = request(clientSk, "ping")
+		assert.Equal(t, "pong", resp.Result)
+	}
+	resp, err = request(clientSk, "ping")
+	require.NoError(t, err)
+	assert.Contains(t, resp.Error, "rate-limited")
+
+	// strangers (including that client before it connected) share a single limit and are ignored
+	_, err = request(nostr.GeneratePrivateKey(), "ping")
+	require.NoError(t, err)
+	stranger := nostr.GeneratePrivateKey()
+	_, err = request(stranger, "ping")
+	assert.ErrorContains(t, err, "rate-limited")
+	strangerPk, _ := nostr.GetPublicKey(stranger)
+	_, ok := server.GetSession(strangerPk)
+	assert.False(t, ok, "nothing should be kept for strangers")
+}
+
+func TestServerChallengeLimit(t *testing.T) {
+	ctx := context.Background()
+	user, _ := keyer.NewPlainKeySigner(nostr.GeneratePrivateKey())
+	server, err := nip46.NewServer(nostr.NewSimplePool(ctx), nostr.GeneratePrivateKey(), user, nil)
+	require.NoError(t, err)
+	prompts := 0
+	server.AuthURL = func(client string, req nip46.Request) string {
+		prompts++
+		return "https://bunker.example.com/approve/" + req.ID
+	}
+
+	// lots of strangers trying to connect without a secret can't flood the user with prompts
+	var resp nip46.Response
+	for range 50 {
+		clientSk := nostr.GeneratePrivateKey()
+		ck, _ := nip44.GenerateConversationKey(server.PublicKey(), clientSk)
+		jreq, _ := json.Marshal(nip46.Request{ID: "x", Method: "connect", Params: []string{server.PublicKey()}})
+		content, _ := nip44.Encrypt(string(jreq), ck)
+		evt := nostr.Event{Kind: nostr.KindNostrConnect, CreatedAt: nostr.Now(), Content: content, Tags: nostr.Tags{{"p", server.PublicKey()}}}
+		evt.Sign(clientSk)
+		_, resp, _, err = server.HandleRequest(ctx, &evt)
+		require.NoError(t, err)
+
+		clientPk, _ := nostr.GetPublicKey(clientSk)
+		_, ok := server.GetSession(clientPk)
+		assert.False(t, ok)
+	}
+	assert.Equal(t, 10, prompts)
+	assert.Empty(t, resp.Result)
+	assert.Equal(t, "invalid secret", resp.Error)
+}
+
+func TestServerRepliesWithRequestEncryption(t *testing.T) {
+	ctx := context.Background()
+	user, _ := keyer.NewPlainKeySigner(nostr.GeneratePrivateKey())
+	server, err := nip46.NewServer(nostr.NewSimplePool(ctx), nostr.GeneratePrivateKey(), user, nil)
+	require.NoError(t, err)
+
+	clientSk := nostr.GeneratePrivateKey()
+	shared, _ := nip04.ComputeSharedSecret(server.PublicKey(), clientSk)
+	ck, _ := nip44.GenerateConversationKey(server.PublicKey(), clientSk)
+
+	for _, useNIP04 := range []bool{true, false} {
+		jreq, _ := json.Marshal(nip46.Request{ID: "x", Method: "ping"})
+		var content string
+		if useNIP04 {
+			content, _ = nip04.Encrypt(string(jreq), shared)
+		} else {
+			content, _ = nip44.Encrypt(string(jreq), ck)
+		}
+		evt := nostr.Event{Kind: nostr.KindNostrConnect, CreatedAt: nostr.Now(), Content: content, Tags: nostr.Tags{{"p", server.PublicKey()}}}
+		evt.Sign(clientSk)
+		_, _, reply, err := server.HandleRequest(ctx, &evt)
+		require.NoError(t, err)
+
+		var plain string
+		if useNIP04 {
+			plain, err = nip04.Decrypt(reply.Content, shared)
+		} else {
+			plain, err = nip44.Decrypt(reply.Content, ck)
+		}
+		require.NoError(t, err, "nip04: %v", useNIP04)
+		var resp nip46.Response
+		require.NoError(t, json.Unmarshal([]byte(plain), &resp))
+		assert.Equal(t, nip46.Response{ID: "x", Result: "pong"}, resp)
+	}
+}
+
+func secretFrom(bunkerURL string) string {
+	parsed, _ := netURL.Parse(bunkerURL)
+	return parsed.Query().Get("secret")
+}
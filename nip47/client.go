@@ -0,0 +1,264 @@
+package nip47
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+	"github.com/nbd-wtf/go-nostr/nip44"
+)
+
+// Client talks to a NIP-47 wallet service.
+type Client struct {
+	pool            *nostr.SimplePool
+	secretKey       string
+	walletPubKey    string
+	relays          []string
+	sharedSecret    []byte   // nip04
+	conversationKey [32]byte // nip44
+	useNIP44        bool
+
+	// Info is the wallet service info event (kind 13194), if one was found.
+	Info *nostr.Event
+}
+
+// NewClient parses a nostr+walletconnect:// URI and fetches the wallet service info event to
+// determine which encryption scheme to use (NIP-44 if the service supports it, NIP-04 otherwise).
+// pool can be passed to reuse an existing pool, otherwise a new pool will be created.
+func NewClient(ctx context.Context, uri string, pool *nostr.SimplePool) (*Client, error) {
+	conn, err := ParseConnectionURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if pool == nil {
+		pool = nostr.NewSimplePool(ctx)
+	}
+
+	sharedSecret, err := nip04.ComputeSharedSecret(conn.WalletPubKey, conn.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+	conversationKey, err := nip44.GenerateConversationKey(conn.WalletPubKey, conn.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+
+	c := &Client{
+		pool:            pool,
+		secretKey:       conn.Secret,
+		walletPubKey:    conn.WalletPubKey,
+		relays:          conn.Relays,
+		sharedSecret:    sharedSecret,
+		conversationKey: conversationKey,
+	}
+
+	if ie := pool.QuerySingle(ctx, conn.Relays, nostr.Filter{
+		Kinds:   []int{nostr.KindNWCWalletInfo},
+		Authors: []string{conn.WalletPubKey},
+	}, nostr.WithLabel("nwcinfo")); ie != nil {
+		c.Info = ie.Event
+		if tag := ie.Tags.Find("encryption"); tag != nil {
+			c.useNIP44 = slices.Contains(strings.Fields(tag[1]), "nip44_v2")
+		}
+	}
+
+	return c, nil
+}
+
+// SupportsMethod tells if the wallet service advertises support for the given method in its info event.
+// If no info event was found it always returns true.
+func (c *Client) SupportsMethod(method string) bool {
+	if c.Info == nil {
+		return true
+	}
+	return slices.Contains(strings.Fields(c.Info.Content), method)
+}
+
+func (c *Client) PayInvoice(ctx context.Context, invoice string, amount uint64) (PayInvoiceResult, error) {
+	var result PayInvoiceResult
+	err := c.RPC(ctx, MethodPayInvoice, PayInvoiceParams{Invoice: invoice, Amount: amount}, &result)
+	return result, err
+}
+
+// MultiPayInvoice asks the wallet to pay many invoices at once. The results are returned in the same
+// order as the given invoices, the ones for which we didn't get a response will have an error.
+func (c *Client) MultiPayInvoice(ctx context.Context, invoices []MultiPayInvoiceItem) ([]MultiPayInvoiceResult, error) {
+	invoices = slices.Clone(invoices)
+	results := make([]MultiPayInvoiceResult, len(invoices))
+	for i := range invoices {
+		if invoices[i].ID == "" {
+			invoices[i].ID = strconv.Itoa(i)
+		}
+		results[i].ID = invoices[i].ID
+		results[i].Error = fmt.Errorf("no response")
+	}
+
+	responses, err := c.request(ctx, MethodMultiPayInvoice, MultiPayInvoiceParams{Invoices: invoices}, len(invoices))
+	for id, resp := range responses {
+		idx := slices.IndexFunc(results, func(r MultiPayInvoiceResult) bool { return r.ID == id })
+		if idx == -1 {
+			continue
+		}
+		if resp.Error != nil {
+			results[idx].Error = resp.Error
+		} else if err := json.Unmarshal(resp.Result, &results[idx].PayInvoiceResult); err != nil {
+			results[idx].Error = fmt.Errorf("failed to decode result: %w", err)
+		} else {
+			results[idx].Error = nil
+		}
+	}
+
+	return results, err
+}
+
+func (c *Client) MakeInvoice(ctx context.Context, params MakeInvoiceParams) (Transaction, error) {
+	var result Transaction
+	err := c.RPC(ctx, MethodMakeInvoice, params, &result)
+	return result, err
+}
+
+func (c *Client) LookupInvoice(ctx context.Context, params LookupInvoiceParams) (Transaction, error) {
+	var result Transaction
+	err := c.RPC(ctx, MethodLookupInvoice, params, &result)
+	return result, err
+}
+
+func (c *Client) ListTransactions(ctx context.Context, params ListTransactionsParams) ([]Transaction, error) {
+	var result struct {
+		Transactions []Transaction `json:"transactions"`
+	}
+	err := c.RPC(ctx, MethodListTransactions, params, &result)
+	return result.Transactions, err
+}
+
+// GetBalance returns the wallet balance in msats.
+func (c *Client) GetBalance(ctx context.Context) (uint64, error) {
+	var result GetBalanceResult
+	err := c.RPC(ctx, MethodGetBalance, struct{}{}, &result)
+	return result.Balance, err
+}
+
+func (c *Client) GetInfo(ctx context.Context) (GetInfoResult, error) {
+	var result GetInfoResult
+	err := c.RPC(ctx, MethodGetInfo, struct{}{}, &result)
+	return result, err
+}
+
+// RPC sends a request with the given method and params and decodes the response into result.
+// If the wallet service responds with an error that will be returned as an *Error.
+func (c *Client) RPC(ctx context.Context, method string, params any, result any) error {
+	responses, err := c.request(ctx, method, params, 1)
+	if err != nil {
+		return err
+	}
+
+	for _, resp := range responses {
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("failed to decode result: %w", err)
+		}
+	}
+	return nil
+}
+
+// request publishes a request and waits for n responses, which are returned keyed by their "d" tag.
+func (c *Client) request(ctx context.Context, method string, params any, n int) (map[string]Response, error) {
+	jparams, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode params: %w", err)
+	}
+	jreq, err := json.Marshal(Request{Method: method, Params: jsoniter.RawMessage(jparams)})
+	if err != nil {
+		return nil, err
+	}
+
+	evt := nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      nostr.KindNWCWalletRequest,
+		Tags:      nostr.Tags{{"p", c.walletPubKey}},
+	}
+	if c.useNIP44 {
+		evt.Content, err = nip44.Encrypt(string(jreq), c.conversationKey)
+		evt.Tags = append(evt.Tags, nostr.Tag{"encryption", "nip44_v2"})
+	} else {
+		evt.Content, err = nip04.Encrypt(string(jreq), c.sharedSecret)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting request: %w", err)
+	}
+	if err := evt.Sign(c.secretKey); err != nil {
+		return nil, fmt.Errorf("failed to sign request event: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// responses are ephemeral, so we must be listening before the request goes out
+	eosed := make(chan struct{})
+	events := c.pool.SubscribeManyNotifyEOSE(ctx, c.relays, nostr.Filter{
+		Kinds:   []int{nostr.KindNWCWalletResponse},
+		Authors: []string{c.walletPubKey},
+		Tags:    nostr.TagMap{"e": []string{evt.ID}},
+	}, eosed, nostr.WithLabel("nwc"))
+	select {
+	case <-eosed:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("couldn't subscribe to any relay: %w", context.Cause(ctx))
+	}
+
+	published := false
+	var publishErr error
+	for res := range c.pool.PublishMany(ctx, c.relays, evt) {
+		if res.Error == nil {
+			published = true
+		} else {
+			publishErr = res.Error
+		}
+	}
+	if !published {
+		return nil, fmt.Errorf("failed to publish request: %w", publishErr)
+	}
+
+	responses := make(map[string]Response, n)
+	for {
+		select {
+		case ie, ok := <-events:
+			if !ok {
+				return responses, fmt.Errorf("subscription closed before all responses arrived")
+			}
+
+			plain, err := c.decrypt(ie.Content)
+			if err != nil {
+				continue
+			}
+			var resp Response
+			if err := json.Unmarshal([]byte(plain), &resp); err != nil {
+				continue
+			}
+
+			responses[ie.Tags.GetD()] = resp
+			if len(responses) == n {
+				return responses, nil
+			}
+		case <-ctx.Done():
+			return responses, fmt.Errorf("context canceled: %w", context.Cause(ctx))
+		}
+	}
+}
+
+func (c *Client) decrypt(content string) (string, error) {
+	if c.useNIP44 {
+		if plain, err := nip44.Decrypt(content, c.conversationKey); err == nil {
+			return plain, nil
+		}
+	}
+	return nip04.Decrypt(content, c.sharedSecret)
+}
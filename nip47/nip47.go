@@ -0,0 +1,209 @@
+package nip47
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var json = jsoniter.ConfigFastest
+
+const (
+	MethodPayInvoice       = "pay_invoice"
+	MethodMultiPayInvoice  = "multi_pay_invoice"
+	MethodMakeInvoice      = "make_invoice"
+	MethodLookupInvoice    = "lookup_invoice"
+	MethodListTransactions = "list_transactions"
+	MethodGetBalance       = "get_balance"
+	MethodGetInfo          = "get_info"
+)
+
+// error codes defined by NIP-47
+const (
+	CodeRateLimited         = "RATE_LIMITED"
+	CodeNotImplemented      = "NOT_IMPLEMENTED"
+	CodeInsufficientBalance = "INSUFFICIENT_BALANCE"
+	CodeQuotaExceeded       = "QUOTA_EXCEEDED"
+	CodeRestricted          = "RESTRICTED"
+	CodeUnauthorized        = "UNAUTHORIZED"
+	CodeInternal            = "INTERNAL"
+	CodeOther               = "OTHER"
+	CodePaymentFailed       = "PAYMENT_FAILED"
+	CodeNotFound            = "NOT_FOUND"
+)
+
+type Request struct {
+	Method string              `json:"method"`
+	Params jsoniter.RawMessage `json:"params"`
+}
+
+func (r Request) String() string {
+	j, _ := json.Marshal(r)
+	return string(j)
+}
+
+type Response struct {
+	ResultType string              `json:"result_type"`
+	Error      *Error              `json:"error,omitempty"`
+	Result     jsoniter.RawMessage `json:"result,omitempty"`
+}
+
+func (r Response) String() string {
+	j, _ := json.Marshal(r)
+	return string(j)
+}
+
+// Error is the error object returned by wallet services. A WalletService can return these from its
+// methods to specify the error code that will be sent to the client.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string { return e.Code + ": " + e.Message }
+
+// ErrNotImplemented can be returned by a WalletService for methods it doesn't support.
+var ErrNotImplemented = &Error{Code: CodeNotImplemented, Message: "method not implemented"}
+
+type PayInvoiceParams struct {
+	Invoice string `json:"invoice"`
+	Amount  uint64 `json:"amount,omitempty"` // msats, only for invoices without an amount
+}
+
+type PayInvoiceResult struct {
+	Preimage string `json:"preimage"`
+	FeesPaid uint64 `json:"fees_paid,omitempty"` // msats
+}
+
+type MultiPayInvoiceItem struct {
+	ID      string `json:"id,omitempty"`
+	Invoice string `json:"invoice"`
+	Amount  uint64 `json:"amount,omitempty"` // msats
+}
+
+type MultiPayInvoiceParams struct {
+	Invoices []MultiPayInvoiceItem `json:"invoices"`
+}
+
+// MultiPayInvoiceResult is the outcome of paying one of the invoices of a multi_pay_invoice request,
+// either Error or PayInvoiceResult will be set.
+type MultiPayInvoiceResult struct {
+	ID string
+	PayInvoiceResult
+	Error error
+}
+
+type MakeInvoiceParams struct {
+	Amount          uint64 `json:"amount"` // msats
+	Description     string `json:"description,omitempty"`
+	DescriptionHash string `json:"description_hash,omitempty"`
+	Expiry          int64  `json:"expiry,omitempty"` // seconds
+}
+
+type LookupInvoiceParams struct {
+	PaymentHash string `json:"payment_hash,omitempty"`
+	Invoice     string `json:"invoice,omitempty"`
+}
+
+type ListTransactionsParams struct {
+	From   nostr.Timestamp `json:"from,omitempty"`
+	Until  nostr.Timestamp `json:"until,omitempty"`
+	Limit  int             `json:"limit,omitempty"`
+	Offset int             `json:"offset,omitempty"`
+	Unpaid bool            `json:"unpaid,omitempty"`
+	Type   string          `json:"type,omitempty"` // "incoming" or "outgoing", empty for both
+}
+
+type Transaction struct {
+	Type            string          `json:"type"` // "incoming" or "outgoing"
+	Invoice         string          `json:"invoice,omitempty"`
+	Description     string          `json:"description,omitempty"`
+	DescriptionHash string          `json:"description_hash,omitempty"`
+	Preimage        string          `json:"preimage,omitempty"`
+	PaymentHash     string          `json:"payment_hash"`
+	Amount          uint64          `json:"amount"`    // msats
+	FeesPaid        uint64          `json:"fees_paid"` // msats
+	CreatedAt       nostr.Timestamp `json:"created_at"`
+	ExpiresAt       nostr.Timestamp `json:"expires_at,omitempty"`
+	SettledAt       nostr.Timestamp `json:"settled_at,omitempty"`
+	Metadata        map[string]any  `json:"metadata,omitempty"`
+}
+
+type GetBalanceResult struct {
+	Balance uint64 `json:"balance"` // msats
+}
+
+type GetInfoResult struct {
+	Alias         string   `json:"alias,omitempty"`
+	Color         string   `json:"color,omitempty"`
+	PubKey        string   `json:"pubkey,omitempty"`
+	Network       string   `json:"network,omitempty"`
+	BlockHeight   uint64   `json:"block_height,omitempty"`
+	BlockHash     string   `json:"block_hash,omitempty"`
+	Methods       []string `json:"methods"`
+	Notifications []string `json:"notifications,omitempty"`
+}
+
+// ConnectionURI is what is encoded in a nostr+walletconnect:// URI.
+type ConnectionURI struct {
+	WalletPubKey string
+	Relays       []string
+	Secret       string
+	LUD16        string
+}
+
+// ParseConnectionURI parses a nostr+walletconnect:// URI. Since some wallets are known to emit the
+// "nostrconnect+walletconnect" scheme that is also accepted.
+func ParseConnectionURI(uri string) (ConnectionURI, error) {
+	p, err := url.Parse(uri)
+	if err != nil {
+		return ConnectionURI{}, fmt.Errorf("invalid uri: %w", err)
+	}
+	if p.Scheme != "nostr+walletconnect" && p.Scheme != "nostrconnect+walletconnect" {
+		return ConnectionURI{}, fmt.Errorf("wrong scheme '%s', must be nostr+walletconnect://", p.Scheme)
+	}
+
+	// some wallets emit nostr+walletconnect:<pubkey> without the slashes
+	pubkey := p.Host
+	if pubkey == "" {
+		pubkey = strings.TrimPrefix(p.Opaque, "//")
+	}
+	if !nostr.IsValidPublicKey(pubkey) {
+		return ConnectionURI{}, fmt.Errorf("'%s' is not a valid public key hex", pubkey)
+	}
+
+	q := p.Query()
+	c := ConnectionURI{
+		WalletPubKey: pubkey,
+		Relays:       make([]string, 0, len(q["relay"])),
+		Secret:       q.Get("secret"),
+		LUD16:        q.Get("lud16"),
+	}
+	for _, relay := range q["relay"] {
+		relay = nostr.NormalizeURL(relay)
+		if !slices.Contains(c.Relays, relay) {
+			c.Relays = append(c.Relays, relay)
+		}
+	}
+
+	if len(c.Relays) == 0 {
+		return ConnectionURI{}, fmt.Errorf("no relays in uri")
+	}
+	if !nostr.IsValid32ByteHex(c.Secret) {
+		return ConnectionURI{}, fmt.Errorf("secret is missing or invalid")
+	}
+
+	return c, nil
+}
+
+func (c ConnectionURI) String() string {
+	q := url.Values{"relay": c.Relays, "secret": {c.Secret}}
+	if c.LUD16 != "" {
+		q.Set("lud16", c.LUD16)
+	}
+	return "nostr+walletconnect://" + c.WalletPubKey + "?" + q.Encode()
+}
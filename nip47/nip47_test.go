@@ -0,0 +1,174 @@
+package nip47
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nostrtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConnectionURI(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	secret := nostr.GeneratePrivateKey()
+
+	conn, err := ParseConnectionURI("nostr+walletconnect://" + pk +
+		"?relay=wss%3A%2F%2Frelay.one&relay=wss://relay.two/&secret=" + secret + "&lud16=someone@example.com")
+	require.NoError(t, err)
+	require.Equal(t, pk, conn.WalletPubKey)
+	require.Equal(t, []string{"wss://relay.one", "wss://relay.two"}, conn.Relays)
+	require.Equal(t, secret, conn.Secret)
+	require.Equal(t, "someone@example.com", conn.LUD16)
+
+	again, err := ParseConnectionURI(conn.String())
+	require.NoError(t, err)
+	require.Equal(t, conn, again)
+
+	_, err = ParseConnectionURI("nostr+walletconnect:" + pk + "?relay=wss://relay.one&secret=" + secret)
+	require.NoError(t, err)
+
+	_, err = ParseConnectionURI("bunker://" + pk + "?relay=wss://relay.one&secret=" + secret)
+	require.Error(t, err)
+	_, err = ParseConnectionURI("nostr+walletconnect://" + pk + "?relay=wss://relay.one")
+	require.Error(t, err)
+	_, err = ParseConnectionURI("nostr+walletconnect://" + pk + "?secret=" + secret)
+	require.Error(t, err)
+}
+
+type fakeWallet struct {
+	balance uint64
+	paid    []string
+}
+
+func (fw *fakeWallet) PayInvoice(ctx context.Context, params PayInvoiceParams) (PayInvoiceResult, error) {
+	if params.Invoice == "lnbcbad" {
+		return PayInvoiceResult{}, &Error{Code: CodePaymentFailed, Message: "no route"}
+	}
+	fw.paid = append(fw.paid, params.Invoice)
+	fw.balance -= 1000
+	return PayInvoiceResult{Preimage: fmt.Sprintf("preimage-%s", params.Invoice), FeesPaid: 10}, nil
+}
+
+func (fw *fakeWallet) MakeInvoice(ctx context.Context, params MakeInvoiceParams) (Transaction, error) {
+	return Transaction{}, ErrNotImplemented
+}
+
+func (fw *fakeWallet) LookupInvoice(ctx context.Context, params LookupInvoiceParams) (Transaction, error) {
+	return Transaction{}, errors.New("database exploded")
+}
+
+func (fw *fakeWallet) ListTransactions(ctx context.Context, params ListTransactionsParams) ([]Transaction, error) {
+	txs := make([]Transaction, 0, len(fw.paid))
+	for _, inv := range fw.paid {
+		txs = append(txs, Transaction{Type: "outgoing", Invoice: inv, Amount: 1000})
+	}
+	return txs, nil
+}
+
+func (fw *fakeWallet) GetBalance(ctx context.Context) (uint64, error) {
+	return fw.balance, nil
+}
+
+func (fw *fakeWallet) GetInfo(ctx context.Context) (GetInfoResult, error) {
+	return GetInfoResult{
+		Alias:   "fake",
+		Methods: []string{MethodPayInvoice, MethodMultiPayInvoice, MethodGetBalance, MethodGetInfo, MethodListTransactions},
+	}, nil
+}
+
+func TestClientAndService(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	relay := nostrtest.NewRelay()
+	url := relay.Start()
+	defer relay.Close()
+	pool := nostr.NewSimplePool(ctx)
+
+	clientSecret := nostr.GeneratePrivateKey()
+	clientPubkey, _ := nostr.GetPublicKey(clientSecret)
+
+	wallet := &fakeWallet{balance: 50000}
+	service, err := NewService(nostr.GeneratePrivateKey(), wallet)
+	require.NoError(t, err)
+	service.AuthorizeRequest = func(pubkey string, method string) bool { return pubkey == clientPubkey }
+
+	info, err := service.InfoEvent(ctx)
+	require.NoError(t, err)
+	for res := range pool.PublishMany(ctx, []string{url}, info) {
+		require.NoError(t, res.Error)
+	}
+
+	// the service loop
+	go func() {
+		for ie := range pool.SubscribeMany(ctx, []string{url}, nostr.Filter{
+			Kinds: []int{nostr.KindNWCWalletRequest},
+			Tags:  nostr.TagMap{"p": []string{service.PublicKey}},
+		}) {
+			_, responses, err := service.HandleRequest(ctx, ie.Event)
+			if err != nil {
+				continue
+			}
+			for _, resp := range responses {
+				pool.PublishMany(ctx, []string{url}, resp)
+			}
+		}
+	}()
+
+	client, err := NewClient(ctx, service.ConnectionURI([]string{url}, clientSecret), pool)
+	require.NoError(t, err)
+	require.True(t, client.useNIP44)
+	require.True(t, client.SupportsMethod(MethodPayInvoice))
+	require.False(t, client.SupportsMethod(MethodMakeInvoice))
+
+	balance, err := client.GetBalance(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(50000), balance)
+
+	gotInfo, err := client.GetInfo(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "fake", gotInfo.Alias)
+
+	paid, err := client.PayInvoice(ctx, "lnbc1", 0)
+	require.NoError(t, err)
+	require.Equal(t, "preimage-lnbc1", paid.Preimage)
+	require.Equal(t, uint64(10), paid.FeesPaid)
+
+	results, err := client.MultiPayInvoice(ctx, []MultiPayInvoiceItem{{Invoice: "lnbc2"}, {ID: "x", Invoice: "lnbcbad"}})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.NoError(t, results[0].Error)
+	require.Equal(t, "preimage-lnbc2", results[0].Preimage)
+	require.Equal(t, "x", results[1].ID)
+	var nerr *Error
+	require.ErrorAs(t, results[1].Error, &nerr)
+	require.Equal(t, CodePaymentFailed, nerr.Code)
+
+	// now with nip04
+	client.useNIP44 = false
+
+	txs, err := client.ListTransactions(ctx, ListTransactionsParams{})
+	require.NoError(t, err)
+	require.Len(t, txs, 2)
+	require.Equal(t, "lnbc1", txs[0].Invoice)
+
+	_, err = client.MakeInvoice(ctx, MakeInvoiceParams{Amount: 1000})
+	require.ErrorAs(t, err, &nerr)
+	require.Equal(t, CodeNotImplemented, nerr.Code)
+
+	_, err = client.LookupInvoice(ctx, LookupInvoiceParams{PaymentHash: "abc"})
+	require.ErrorAs(t, err, &nerr)
+	require.Equal(t, CodeInternal, nerr.Code)
+
+	// someone else
+	other, err := NewClient(ctx, service.ConnectionURI([]string{url}, nostr.GeneratePrivateKey()), pool)
+	require.NoError(t, err)
+	_, err = other.GetBalance(ctx)
+	require.ErrorAs(t, err, &nerr)
+	require.Equal(t, CodeUnauthorized, nerr.Code)
+}
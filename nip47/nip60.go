@@ -0,0 +1,151 @@
+package nip47
+
+import (
+	"context"
+	"slices"
+
+	"github.com/nbd-wtf/go-nostr/nip60"
+)
+
+var _ WalletService = (*NIP60Wallet)(nil)
+
+// NIP60Wallet exposes a nip60.Wallet as a WalletService so it can be controlled through NWC.
+// make_invoice requests a mint quote from the first mint of the wallet and mints the tokens in the
+// background once it is paid. lookup_invoice only knows about these invoices (while they are pending
+// or recently settled) and list_transactions only knows about amounts and dates.
+type NIP60Wallet struct {
+	Wallet *nip60.Wallet
+	Alias  string
+}
+
+func (nw NIP60Wallet) PayInvoice(ctx context.Context, params PayInvoiceParams) (PayInvoiceResult, error) {
+	amount, err := nip60.GetSatoshisAmountFromBolt11(params.Invoice)
+	if err != nil {
+		return PayInvoiceResult{}, &Error{Code: CodeOther, Message: err.Error()}
+	}
+	if amount == 0 {
+		return PayInvoiceResult{}, &Error{Code: CodeOther, Message: "invoices without an amount are not supported"}
+	}
+	if amount > nw.Wallet.Balance() {
+		return PayInvoiceResult{}, &Error{Code: CodeInsufficientBalance, Message: "not enough funds in the wallet"}
+	}
+
+	before := nw.Wallet.Balance()
+	preimage, err := nw.Wallet.PayBolt11(ctx, params.Invoice)
+	if err != nil {
+		return PayInvoiceResult{}, &Error{Code: CodePaymentFailed, Message: err.Error()}
+	}
+
+	result := PayInvoiceResult{Preimage: preimage}
+	if spent := before - nw.Wallet.Balance(); spent > amount {
+		result.FeesPaid = (spent - amount) * 1000
+	}
+	return result, nil
+}
+
+func (nw NIP60Wallet) MakeInvoice(ctx context.Context, params MakeInvoiceParams) (Transaction, error) {
+	if len(nw.Wallet.Mints) == 0 {
+		return Transaction{}, &Error{Code: CodeInternal, Message: "wallet has no mints"}
+	}
+	if params.Amount < 1000 {
+		return Transaction{}, &Error{Code: CodeOther, Message: "amount must be at least 1 sat"}
+	}
+
+	quote, err := nw.Wallet.CreateMintQuote(ctx, nw.Wallet.Mints[0], params.Amount/1000)
+	if err != nil {
+		return Transaction{}, &Error{Code: CodeInternal, Message: err.Error()}
+	}
+
+	tx := quoteTransaction(*quote)
+	go quote.Wait(context.Background())
+
+	return tx, nil
+}
+
+func (nw NIP60Wallet) LookupInvoice(ctx context.Context, params LookupInvoiceParams) (Transaction, error) {
+	if params.Invoice == "" && params.PaymentHash == "" {
+		return Transaction{}, &Error{Code: CodeOther, Message: "either invoice or payment_hash must be given"}
+	}
+
+	quote, ok := nw.Wallet.FindMintQuote(params.Invoice, params.PaymentHash)
+	if !ok {
+		return Transaction{}, &Error{Code: CodeNotFound, Message: "invoice not found among our mint quotes"}
+	}
+
+	return quoteTransaction(quote), nil
+}
+
+func quoteTransaction(quote nip60.MintQuote) Transaction {
+	return Transaction{
+		Type:        "incoming",
+		Invoice:     quote.Invoice,
+		PaymentHash: quote.PaymentHash,
+		Amount:      quote.Amount * 1000,
+		CreatedAt:   quote.CreatedAt,
+		ExpiresAt:   quote.Expiry,
+		SettledAt:   quote.SettledAt,
+	}
+}
+
+func (nw NIP60Wallet) ListTransactions(ctx context.Context, params ListTransactionsParams) ([]Transaction, error) {
+	nw.Wallet.Lock()
+	history := slices.Clone(nw.Wallet.History)
+	nw.Wallet.Unlock()
+
+	slices.SortFunc(history, func(a, b nip60.HistoryEntry) int { return int(b.CreatedAt() - a.CreatedAt()) })
+
+	txs := make([]Transaction, 0, len(history))
+	for _, he := range history {
+		createdAt := he.CreatedAt()
+		if params.From != 0 && createdAt < params.From {
+			continue
+		}
+		if params.Until != 0 && createdAt > params.Until {
+			continue
+		}
+
+		tx := Transaction{
+			Type:      "outgoing",
+			Amount:    he.Amount * 1000,
+			CreatedAt: createdAt,
+			SettledAt: createdAt,
+		}
+		if he.In {
+			tx.Type = "incoming"
+		}
+		if params.Type != "" && params.Type != tx.Type {
+			continue
+		}
+
+		txs = append(txs, tx)
+	}
+
+	if params.Offset > 0 {
+		txs = txs[min(params.Offset, len(txs)):]
+	}
+	if params.Limit > 0 && len(txs) > params.Limit {
+		txs = txs[0:params.Limit]
+	}
+
+	return txs, nil
+}
+
+func (nw NIP60Wallet) GetBalance(ctx context.Context) (uint64, error) {
+	return nw.Wallet.Balance() * 1000, nil
+}
+
+func (nw NIP60Wallet) GetInfo(ctx context.Context) (GetInfoResult, error) {
+	return GetInfoResult{
+		Alias:   nw.Alias,
+		Network: "mainnet",
+		Methods: []string{
+			MethodPayInvoice,
+			MethodMultiPayInvoice,
+			MethodMakeInvoice,
+			MethodLookupInvoice,
+			MethodListTransactions,
+			MethodGetBalance,
+			MethodGetInfo,
+		},
+	}, nil
+}
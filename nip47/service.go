@@ -0,0 +1,270 @@
+package nip47
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+	"github.com/nbd-wtf/go-nostr/nip44"
+)
+
+// WalletService is what actually performs the requests received by a Service. Methods can return an
+// *Error (like ErrNotImplemented) to specify which error code the client will get, other errors are
+// reported as INTERNAL.
+type WalletService interface {
+	PayInvoice(ctx context.Context, params PayInvoiceParams) (PayInvoiceResult, error)
+	MakeInvoice(ctx context.Context, params MakeInvoiceParams) (Transaction, error)
+	LookupInvoice(ctx context.Context, params LookupInvoiceParams) (Transaction, error)
+	ListTransactions(ctx context.Context, params ListTransactionsParams) ([]Transaction, error)
+	GetBalance(ctx context.Context) (uint64, error)
+	GetInfo(ctx context.Context) (GetInfoResult, error)
+}
+
+type serviceSession struct {
+	sharedSecret    []byte
+	conversationKey [32]byte
+}
+
+// Service handles NIP-47 requests on behalf of a WalletService. It doesn't talk to relays, the caller
+// should subscribe to kind 23194 events tagging PublicKey, call HandleRequest for each and publish the
+// resulting events.
+type Service struct {
+	secretKey string
+	PublicKey string
+
+	Wallet WalletService
+
+	// AuthorizeRequest, if set, is called for every request. Returning false makes it fail with UNAUTHORIZED.
+	AuthorizeRequest func(clientPubkey string, method string) bool
+
+	mu       sync.Mutex
+	sessions map[string]serviceSession
+}
+
+func NewService(secretKey string, wallet WalletService) (*Service, error) {
+	pubkey, err := nostr.GetPublicKey(secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive public key: %w", err)
+	}
+
+	return &Service{
+		secretKey: secretKey,
+		PublicKey: pubkey,
+		Wallet:    wallet,
+		sessions:  make(map[string]serviceSession),
+	}, nil
+}
+
+// ConnectionURI returns a nostr+walletconnect:// URI that can be given to a client that will use the
+// given secret key. AuthorizeRequest should be set to only accept requests from its pubkey.
+func (s *Service) ConnectionURI(relays []string, clientSecretKey string) string {
+	return ConnectionURI{
+		WalletPubKey: s.PublicKey,
+		Relays:       relays,
+		Secret:       clientSecretKey,
+	}.String()
+}
+
+// InfoEvent returns a signed kind 13194 event announcing the methods supported by the wallet (as
+// returned by its GetInfo method) and the encryption schemes we support.
+func (s *Service) InfoEvent(ctx context.Context) (nostr.Event, error) {
+	info, err := s.Wallet.GetInfo(ctx)
+	if err != nil {
+		return nostr.Event{}, fmt.Errorf("failed to get wallet info: %w", err)
+	}
+
+	evt := nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      nostr.KindNWCWalletInfo,
+		Tags:      nostr.Tags{{"encryption", "nip44_v2 nip04"}},
+		Content:   strings.Join(info.Methods, " "),
+	}
+	if len(info.Notifications) > 0 {
+		evt.Tags = append(evt.Tags, nostr.Tag{"notifications", strings.Join(info.Notifications, " ")})
+	}
+
+	err = evt.Sign(s.secretKey)
+	return evt, err
+}
+
+func (s *Service) getOrCreateSession(clientPubkey string) (serviceSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, ok := s.sessions[clientPubkey]; ok {
+		return session, nil
+	}
+
+	shared, err := nip04.ComputeSharedSecret(clientPubkey, s.secretKey)
+	if err != nil {
+		return serviceSession{}, fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+	ck, err := nip44.GenerateConversationKey(clientPubkey, s.secretKey)
+	if err != nil {
+		return serviceSession{}, fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+
+	session := serviceSession{sharedSecret: shared, conversationKey: ck}
+	s.sessions[clientPubkey] = session
+	return session, nil
+}
+
+// HandleRequest decrypts and performs a request, then returns the events that should be published in
+// response to it -- a single one for all methods except multi_pay_invoice, which gets one per invoice.
+func (s *Service) HandleRequest(ctx context.Context, event *nostr.Event) (
+	req Request,
+	eventResponses []nostr.Event,
+	err error,
+) {
+	if event.Kind != nostr.KindNWCWalletRequest {
+		return req, nil, fmt.Errorf("event kind is %d, but we expected %d", event.Kind, nostr.KindNWCWalletRequest)
+	}
+
+	if tag := event.Tags.Find("expiration"); tag != nil {
+		if exp, err := strconv.ParseInt(tag[1], 10, 64); err == nil && nostr.Timestamp(exp) < nostr.Now() {
+			return req, nil, fmt.Errorf("request has expired")
+		}
+	}
+
+	session, err := s.getOrCreateSession(event.PubKey)
+	if err != nil {
+		return req, nil, err
+	}
+
+	useNIP44 := false
+	if tag := event.Tags.Find("encryption"); tag != nil && tag[1] == "nip44_v2" {
+		useNIP44 = true
+	}
+
+	var plain string
+	if useNIP44 {
+		plain, err = nip44.Decrypt(event.Content, session.conversationKey)
+	} else {
+		plain, err = nip04.Decrypt(event.Content, session.sharedSecret)
+	}
+	if err != nil {
+		return req, nil, fmt.Errorf("failed to decrypt request: %w", err)
+	}
+	if err := json.Unmarshal([]byte(plain), &req); err != nil {
+		return req, nil, fmt.Errorf("error parsing request: %w", err)
+	}
+
+	respond := func(d string, result any, resultErr error) error {
+		resp := Response{ResultType: req.Method}
+		if resultErr != nil {
+			var nerr *Error
+			if !errors.As(resultErr, &nerr) {
+				nerr = &Error{Code: CodeInternal, Message: resultErr.Error()}
+			}
+			resp.Error = nerr
+		} else {
+			resp.Result, _ = json.Marshal(result)
+		}
+
+		jresp, _ := json.Marshal(resp)
+		evt := nostr.Event{
+			CreatedAt: nostr.Now(),
+			Kind:      nostr.KindNWCWalletResponse,
+			Tags:      nostr.Tags{{"p", event.PubKey}, {"e", event.ID}},
+		}
+		if d != "" {
+			evt.Tags = append(evt.Tags, nostr.Tag{"d", d})
+		}
+		var err error
+		if useNIP44 {
+			evt.Content, err = nip44.Encrypt(string(jresp), session.conversationKey)
+			evt.Tags = append(evt.Tags, nostr.Tag{"encryption", "nip44_v2"})
+		} else {
+			evt.Content, err = nip04.Encrypt(string(jresp), session.sharedSecret)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encrypt response: %w", err)
+		}
+		if err := evt.Sign(s.secretKey); err != nil {
+			return err
+		}
+
+		eventResponses = append(eventResponses, evt)
+		return nil
+	}
+
+	if s.AuthorizeRequest != nil && !s.AuthorizeRequest(event.PubKey, req.Method) {
+		err = respond("", nil, &Error{Code: CodeUnauthorized, Message: "unauthorized"})
+		return req, eventResponses, err
+	}
+
+	var result any
+	var resultErr error
+
+	switch req.Method {
+	case MethodPayInvoice:
+		var params PayInvoiceParams
+		if resultErr = s.decodeParams(req, &params); resultErr == nil {
+			result, resultErr = s.Wallet.PayInvoice(ctx, params)
+		}
+	case MethodMultiPayInvoice:
+		var params MultiPayInvoiceParams
+		if resultErr = s.decodeParams(req, &params); resultErr != nil {
+			break
+		}
+		for _, item := range params.Invoices {
+			res, err := s.Wallet.PayInvoice(ctx, PayInvoiceParams{Invoice: item.Invoice, Amount: item.Amount})
+			d := item.ID
+			if d == "" {
+				d = item.Invoice
+			}
+			if err := respond(d, res, err); err != nil {
+				return req, eventResponses, err
+			}
+		}
+		return req, eventResponses, nil
+	case MethodMakeInvoice:
+		var params MakeInvoiceParams
+		if resultErr = s.decodeParams(req, &params); resultErr == nil {
+			result, resultErr = s.Wallet.MakeInvoice(ctx, params)
+		}
+	case MethodLookupInvoice:
+		var params LookupInvoiceParams
+		if resultErr = s.decodeParams(req, &params); resultErr == nil {
+			result, resultErr = s.Wallet.LookupInvoice(ctx, params)
+		}
+	case MethodListTransactions:
+		var params ListTransactionsParams
+		if resultErr = s.decodeParams(req, &params); resultErr == nil {
+			var txs []Transaction
+			txs, resultErr = s.Wallet.ListTransactions(ctx, params)
+			if txs == nil {
+				txs = []Transaction{}
+			}
+			result = struct {
+				Transactions []Transaction `json:"transactions"`
+			}{txs}
+		}
+	case MethodGetBalance:
+		var balance uint64
+		balance, resultErr = s.Wallet.GetBalance(ctx)
+		result = GetBalanceResult{Balance: balance}
+	case MethodGetInfo:
+		result, resultErr = s.Wallet.GetInfo(ctx)
+	default:
+		resultErr = ErrNotImplemented
+	}
+
+	err = respond("", result, resultErr)
+	return req, eventResponses, err
+}
+
+func (s *Service) decodeParams(req Request, params any) error {
+	if len(req.Params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(req.Params, params); err != nil {
+		return &Error{Code: CodeOther, Message: "invalid params: " + err.Error()}
+	}
+	return nil
+}
@@ -120,3 +120,24 @@ func getKey(password string, salt []byte, n int) ([]byte, error) {
 	}
 	return key, nil
 }
+
+// GetKeySecurityByte reads the key security byte from an ncryptsec without decrypting it.
+func GetKeySecurityByte(bech32string string) (KeySecurityByte, error) {
+	prefix, bits5, err := bech32.DecodeNoLimit(bech32string)
+	if err != nil {
+		return 0, err
+	}
+	if prefix != "ncryptsec" {
+		return 0, fmt.Errorf("expected prefix ncryptsec1")
+	}
+
+	data, err := bech32.ConvertBits(bits5, 5, 8, false)
+	if err != nil {
+		return 0, fmt.Errorf("failed translating data into 8 bits: %s", err.Error())
+	}
+	if len(data) < 2+16+24+1 {
+		return 0, fmt.Errorf("ncryptsec is too short")
+	}
+
+	return KeySecurityByte(data[2+16+24]), nil
+}
@@ -46,6 +46,24 @@ func TestEncryptAndDecrypt(t *testing.T) {
 	}
 }
 
+func TestGetKeySecurityByte(t *testing.T) {
+	for _, ksb := range []KeySecurityByte{0x00, 0x01, 0x02} {
+		bech32code, err := Encrypt("14c226dbdd865d5e1645e72c7470fd0a17feb42cc87b750bab6538171b3a3f8a", "nostr", 1, ksb)
+		assert.NoError(t, err)
+
+		got, err := GetKeySecurityByte(bech32code)
+		assert.NoError(t, err)
+		assert.Equal(t, ksb, got)
+	}
+
+	ksb, err := GetKeySecurityByte("ncryptsec1qgg9947rlpvqu76pj5ecreduf9jxhselq2nae2kghhvd5g7dgjtcxfqtd67p9m0w57lspw8gsq6yphnm8623nsl8xn9j4jdzz84zm3frztj3z7s35vpzmqf6ksu8r89qk5z2zxfmu5gv8th8wclt0h4p")
+	assert.NoError(t, err)
+	assert.Equal(t, KeySecurityByte(0x00), ksb)
+
+	_, err = GetKeySecurityByte("npub180cvv07tjdrrgpa0j7j7tmnyl2yr6yr7l8j4s3evf6u64th6gkwsyjh6w6")
+	assert.Error(t, err)
+}
+
 func TestNormalization(t *testing.T) {
 	nonce := []byte{1, 2, 3, 4}
 	n := 8
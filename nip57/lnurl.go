@@ -0,0 +1,197 @@
+package nip57
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/bolt11"
+	"github.com/nbd-wtf/go-nostr/sdk"
+)
+
+var httpClient = &http.Client{}
+
+// PayParams is what an LNURL-pay endpoint (LUD-06) returns, with the NIP-57 extensions.
+type PayParams struct {
+	Callback       string `json:"callback"`
+	MinSendable    uint64 `json:"minSendable"` // msats
+	MaxSendable    uint64 `json:"maxSendable"` // msats
+	Metadata       string `json:"metadata"`
+	Tag            string `json:"tag"`
+	CommentAllowed int    `json:"commentAllowed,omitempty"`
+	AllowsNostr    bool   `json:"allowsNostr,omitempty"`
+	NostrPubkey    string `json:"nostrPubkey,omitempty"`
+
+	// LNURL is the bech32-encoded URL these params were fetched from.
+	LNURL string `json:"-"`
+}
+
+// SupportsZaps tells if the LNURL provider will publish zap receipts.
+func (pp PayParams) SupportsZaps() bool {
+	return pp.AllowsNostr && nostr.IsValidPublicKey(pp.NostrPubkey)
+}
+
+// EncodeLNURL encodes an URL as a bech32 "lnurl1..." string.
+func EncodeLNURL(u string) (string, error) {
+	bits5, err := bech32.ConvertBits([]byte(u), 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	return bech32.Encode("lnurl", bits5)
+}
+
+// DecodeLNURL decodes a bech32 "lnurl1..." string (with or without a "lightning:" prefix) into an URL.
+func DecodeLNURL(lnurl string) (string, error) {
+	lnurl = strings.TrimPrefix(strings.ToLower(lnurl), "lightning:")
+	prefix, bits5, err := bech32.DecodeNoLimit(lnurl)
+	if err != nil {
+		return "", fmt.Errorf("invalid lnurl: %w", err)
+	}
+	if prefix != "lnurl" {
+		return "", fmt.Errorf("invalid lnurl prefix '%s'", prefix)
+	}
+	data, err := bech32.ConvertBits(bits5, 5, 8, false)
+	if err != nil {
+		return "", fmt.Errorf("invalid lnurl: %w", err)
+	}
+	return string(data), nil
+}
+
+// LightningAddressURL returns the LNURL-pay endpoint for a lightning address (LUD-16) like "name@domain".
+func LightningAddressURL(address string) (string, error) {
+	name, domain, ok := strings.Cut(address, "@")
+	if !ok || name == "" || domain == "" {
+		return "", fmt.Errorf("invalid lightning address '%s'", address)
+	}
+
+	scheme := "https"
+	if strings.HasSuffix(domain, ".onion") {
+		scheme = "http"
+	}
+	return scheme + "://" + domain + "/.well-known/lnurlp/" + url.PathEscape(name), nil
+}
+
+// FetchPayParams resolves the lud16 or lud06 (in this order) of a profile to the LNURL-pay endpoint
+// and fetches its params.
+func FetchPayParams(ctx context.Context, profile sdk.ProfileMetadata) (*PayParams, error) {
+	var endpoint string
+	var err error
+	switch {
+	case profile.LUD16 != "":
+		endpoint, err = LightningAddressURL(profile.LUD16)
+	case profile.LUD06 != "":
+		endpoint, err = DecodeLNURL(profile.LUD06)
+	default:
+		return nil, fmt.Errorf("profile has no lud16 or lud06")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return FetchPayParamsFromURL(ctx, endpoint)
+}
+
+// FetchPayParamsFromURL fetches the params from an LNURL-pay endpoint.
+func FetchPayParamsFromURL(ctx context.Context, endpoint string) (*PayParams, error) {
+	var params PayParams
+	if err := getJSON(ctx, endpoint, &params); err != nil {
+		return nil, err
+	}
+
+	if params.Tag != "payRequest" {
+		return nil, fmt.Errorf("'%s' is not an lnurl-pay endpoint (tag is '%s')", endpoint, params.Tag)
+	}
+	if params.Callback == "" {
+		return nil, fmt.Errorf("lnurl-pay endpoint '%s' has no callback", endpoint)
+	}
+
+	lnurl, err := EncodeLNURL(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode lnurl: %w", err)
+	}
+	params.LNURL = lnurl
+
+	return &params, nil
+}
+
+// FetchInvoice calls the LNURL-pay callback with the given zap request and returns the bolt11 invoice,
+// after checking it is for the amount in the request.
+func FetchInvoice(ctx context.Context, params *PayParams, zapRequest nostr.Event) (string, error) {
+	amount, err := getAmount(&zapRequest)
+	if err != nil {
+		return "", err
+	}
+	if amount < params.MinSendable || (params.MaxSendable != 0 && amount > params.MaxSendable) {
+		return "", fmt.Errorf("amount %d is outside of the allowed range [%d, %d]", amount, params.MinSendable, params.MaxSendable)
+	}
+
+	callback, err := url.Parse(params.Callback)
+	if err != nil {
+		return "", fmt.Errorf("invalid callback url: %w", err)
+	}
+	q := callback.Query()
+	q.Set("amount", strconv.FormatUint(amount, 10))
+	q.Set("nostr", zapRequest.String())
+	if params.LNURL != "" {
+		q.Set("lnurl", params.LNURL)
+	}
+	callback.RawQuery = q.Encode()
+
+	var resp struct {
+		PR string `json:"pr"`
+	}
+	if err := getJSON(ctx, callback.String(), &resp); err != nil {
+		return "", err
+	}
+
+	invoice, err := bolt11.Decode(resp.PR)
+	if err != nil {
+		return "", fmt.Errorf("got an invalid invoice: %w", err)
+	}
+	if invoice.Amount != amount {
+		return "", fmt.Errorf("got an invoice for %d msats, but we asked for %d", invoice.Amount, amount)
+	}
+
+	return resp.PR, nil
+}
+
+func getJSON(ctx context.Context, u string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create a request: %w", err)
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// LUD-06 errors come as {"status": "ERROR", "reason": "..."}
+	var lnurlErr struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	if json.Unmarshal(body, &lnurlErr) == nil && lnurlErr.Status == "ERROR" {
+		return fmt.Errorf("lnurl error: %s", lnurlErr.Reason)
+	}
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("got status %d from %s", res.StatusCode, u)
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("failed to decode response from %s: %w", u, err)
+	}
+	return nil
+}
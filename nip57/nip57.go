@@ -0,0 +1,226 @@
+package nip57
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/mailru/easyjson"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/bolt11"
+	"github.com/nbd-wtf/go-nostr/sdk"
+)
+
+var json = jsoniter.ConfigFastest
+
+// ZapOptions is what goes into a zap request.
+type ZapOptions struct {
+	Recipient string   // pubkey of who is being zapped
+	Amount    uint64   // msats
+	Relays    []string // relays where the zap receipt should be published
+	LNURL     string   // bech32-encoded lnurl of the recipient, optional but recommended
+	Comment   string
+
+	// Event, if set, is the event being zapped. It will be referenced with an "e" tag (plus an "a" tag
+	// if it is addressable) and a "k" tag.
+	Event *nostr.Event
+}
+
+// Zap is a validated zap receipt along with the zap request embedded in it.
+type Zap struct {
+	Receipt *nostr.Event
+	Request *nostr.Event
+
+	Amount    uint64 // msats
+	Sender    string
+	Recipient string
+	EventID   string // empty if a profile was zapped
+	Address   string // only set if an addressable event was zapped
+	Comment   string
+	Preimage  string // not all providers include this
+}
+
+// MakeZapRequest builds a kind 9734 zap request and signs it with the given signer.
+func MakeZapRequest(ctx context.Context, signer nostr.Signer, opts ZapOptions) (nostr.Event, error) {
+	if !nostr.IsValidPublicKey(opts.Recipient) {
+		return nostr.Event{}, fmt.Errorf("invalid recipient '%s'", opts.Recipient)
+	}
+	if opts.Amount == 0 {
+		return nostr.Event{}, fmt.Errorf("amount can't be zero")
+	}
+	if len(opts.Relays) == 0 {
+		return nostr.Event{}, fmt.Errorf("at least one relay is needed for the zap receipt")
+	}
+
+	evt := nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      nostr.KindZapRequest,
+		Content:   opts.Comment,
+		Tags: nostr.Tags{
+			append(nostr.Tag{"relays"}, opts.Relays...),
+			{"amount", strconv.FormatUint(opts.Amount, 10)},
+		},
+	}
+	if opts.LNURL != "" {
+		evt.Tags = append(evt.Tags, nostr.Tag{"lnurl", opts.LNURL})
+	}
+	evt.Tags = append(evt.Tags, nostr.Tag{"p", opts.Recipient})
+
+	if opts.Event != nil {
+		evt.Tags = append(evt.Tags, nostr.Tag{"e", opts.Event.ID})
+		if nostr.IsAddressableKind(opts.Event.Kind) {
+			evt.Tags = append(evt.Tags, nostr.EntityPointer{
+				PublicKey:  opts.Event.PubKey,
+				Kind:       opts.Event.Kind,
+				Identifier: opts.Event.Tags.GetD(),
+			}.AsTag())
+		}
+		evt.Tags = append(evt.Tags, nostr.Tag{"k", strconv.Itoa(opts.Event.Kind)})
+	}
+
+	if err := signer.SignEvent(ctx, &evt); err != nil {
+		return nostr.Event{}, fmt.Errorf("failed to sign zap request: %w", err)
+	}
+	return evt, nil
+}
+
+// GetZapInvoice goes through the entire flow of zapping someone: it resolves the LNURL-pay endpoint
+// from the profile, builds and signs a zap request and calls the callback to get an invoice.
+// opts.Recipient and opts.LNURL are filled automatically.
+func GetZapInvoice(
+	ctx context.Context,
+	signer nostr.Signer,
+	profile sdk.ProfileMetadata,
+	opts ZapOptions,
+) (invoice string, params *PayParams, err error) {
+	params, err = FetchPayParams(ctx, profile)
+	if err != nil {
+		return "", nil, err
+	}
+	if !params.SupportsZaps() {
+		return "", params, fmt.Errorf("lnurl provider for %s doesn't support zaps", profile.ShortName())
+	}
+
+	opts.Recipient = profile.PubKey
+	opts.LNURL = params.LNURL
+	zapRequest, err := MakeZapRequest(ctx, signer, opts)
+	if err != nil {
+		return "", params, err
+	}
+
+	invoice, err = FetchInvoice(ctx, params, zapRequest)
+	return invoice, params, err
+}
+
+// ValidateZapReceipt checks that a kind 9735 zap receipt was published by the LNURL provider described
+// in params (as returned by FetchPayParams for the recipient), that the invoice it contains was made
+// for the zap request embedded in it and that the amounts match.
+func ValidateZapReceipt(receipt *nostr.Event, params *PayParams) (*Zap, error) {
+	if receipt.Kind != nostr.KindZap {
+		return nil, fmt.Errorf("event kind is %d, but we expected %d", receipt.Kind, nostr.KindZap)
+	}
+	if !params.SupportsZaps() {
+		return nil, fmt.Errorf("lnurl provider doesn't support zaps")
+	}
+	if receipt.PubKey != params.NostrPubkey {
+		return nil, fmt.Errorf("receipt was published by %s, not by the lnurl provider %s", receipt.PubKey, params.NostrPubkey)
+	}
+	if ok, _ := receipt.CheckSignature(); !ok {
+		return nil, fmt.Errorf("receipt has an invalid signature")
+	}
+
+	bolt11Tag := receipt.Tags.Find("bolt11")
+	if bolt11Tag == nil {
+		return nil, fmt.Errorf("receipt has no bolt11 tag")
+	}
+	descriptionTag := receipt.Tags.Find("description")
+	if descriptionTag == nil {
+		return nil, fmt.Errorf("receipt has no description tag")
+	}
+
+	invoice, err := bolt11.Decode(bolt11Tag[1])
+	if err != nil {
+		return nil, fmt.Errorf("receipt has an invalid invoice: %w", err)
+	}
+	hash := sha256.Sum256([]byte(descriptionTag[1]))
+	if invoice.DescriptionHash != hex.EncodeToString(hash[:]) {
+		return nil, fmt.Errorf("invoice description hash doesn't match the zap request")
+	}
+
+	request := &nostr.Event{}
+	if err := easyjson.Unmarshal([]byte(descriptionTag[1]), request); err != nil {
+		return nil, fmt.Errorf("failed to decode zap request: %w", err)
+	}
+	if request.Kind != nostr.KindZapRequest {
+		return nil, fmt.Errorf("embedded zap request has kind %d", request.Kind)
+	}
+	if !request.CheckID() {
+		return nil, fmt.Errorf("embedded zap request has an invalid id")
+	}
+	if ok, _ := request.CheckSignature(); !ok {
+		return nil, fmt.Errorf("embedded zap request has an invalid signature")
+	}
+
+	if invoice.Amount == 0 {
+		return nil, fmt.Errorf("invoice has no amount")
+	}
+	if request.Tags.Find("amount") != nil {
+		requested, err := getAmount(request)
+		if err != nil {
+			return nil, err
+		}
+		if requested != invoice.Amount {
+			return nil, fmt.Errorf("invoice amount %d doesn't match the requested %d", invoice.Amount, requested)
+		}
+	}
+
+	if lnurlTag := request.Tags.Find("lnurl"); lnurlTag != nil && params.LNURL != "" {
+		if !strings.EqualFold(lnurlTag[1], params.LNURL) {
+			return nil, fmt.Errorf("zap request was for a different lnurl")
+		}
+	}
+
+	pTag := request.Tags.Find("p")
+	if pTag == nil {
+		return nil, fmt.Errorf("zap request has no recipient")
+	}
+	if receipt.Tags.FindWithValue("p", pTag[1]) == nil {
+		return nil, fmt.Errorf("receipt and zap request have different recipients")
+	}
+
+	zap := &Zap{
+		Receipt:   receipt,
+		Request:   request,
+		Amount:    invoice.Amount,
+		Sender:    request.PubKey,
+		Recipient: pTag[1],
+		Comment:   request.Content,
+	}
+	if tag := request.Tags.Find("e"); tag != nil {
+		zap.EventID = tag[1]
+	}
+	if tag := request.Tags.Find("a"); tag != nil {
+		zap.Address = tag[1]
+	}
+	if tag := receipt.Tags.Find("preimage"); tag != nil {
+		zap.Preimage = tag[1]
+	}
+
+	return zap, nil
+}
+
+func getAmount(zapRequest *nostr.Event) (uint64, error) {
+	tag := zapRequest.Tags.Find("amount")
+	if tag == nil {
+		return 0, fmt.Errorf("zap request has no amount")
+	}
+	amount, err := strconv.ParseUint(tag[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("zap request has an invalid amount: %w", err)
+	}
+	return amount, nil
+}
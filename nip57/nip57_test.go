@@ -0,0 +1,169 @@
+package nip57
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/bolt11"
+	"github.com/nbd-wtf/go-nostr/keyer"
+	"github.com/nbd-wtf/go-nostr/sdk"
+	"github.com/stretchr/testify/require"
+)
+
+// makeInvoice creates a fake (unsigned) bolt11 invoice with the given amount and description hash.
+func makeInvoice(t *testing.T, msats uint64, descriptionHash []byte) string {
+	t.Helper()
+
+	words := make([]byte, 0, 250)
+	ts := uint64(time.Now().Unix())
+	for i := 6; i >= 0; i-- {
+		words = append(words, byte(ts>>(5*i))&31)
+	}
+	addField := func(typ byte, data []byte) {
+		conv, err := bech32.ConvertBits(data, 8, 5, true)
+		require.NoError(t, err)
+		words = append(words, typ, byte(len(conv)>>5), byte(len(conv)&31))
+		words = append(words, conv...)
+	}
+
+	paymentHash := make([]byte, 32)
+	rand.Read(paymentHash)
+	addField(1, paymentHash)
+	addField(23, descriptionHash)
+	words = append(words, make([]byte, 104)...) // signature
+
+	invoice, err := bech32.Encode("lnbc"+strconv.FormatUint(msats*10, 10)+"p", words)
+	require.NoError(t, err)
+	return invoice
+}
+
+// startLNURLServer starts an LNURL-pay server for "alice" that makes an invoice for every zap request
+// it gets and sends the request to the given channel.
+func startLNURLServer(t *testing.T, providerPubkey string, requests chan string) *httptest.Server {
+	t.Helper()
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/lnurlp/alice":
+			json.NewEncoder(w).Encode(PayParams{
+				Callback:    server.URL + "/callback",
+				MinSendable: 1000,
+				MaxSendable: 100_000_000,
+				Metadata:    `[["text/plain","alice"]]`,
+				Tag:         "payRequest",
+				AllowsNostr: true,
+				NostrPubkey: providerPubkey,
+			})
+		case "/callback":
+			amount, _ := strconv.ParseUint(r.URL.Query().Get("amount"), 10, 64)
+			zapRequest := r.URL.Query().Get("nostr")
+			if amount == 0 || zapRequest == "" {
+				w.Write([]byte(`{"status":"ERROR","reason":"missing params"}`))
+				return
+			}
+			hash := sha256.Sum256([]byte(zapRequest))
+			json.NewEncoder(w).Encode(map[string]any{"pr": makeInvoice(t, amount, hash[:]), "routes": []string{}})
+			requests <- zapRequest
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	httpClient = server.Client()
+	return server
+}
+
+func TestZapFlow(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	providerSecret := nostr.GeneratePrivateKey()
+	providerPubkey, _ := nostr.GetPublicKey(providerSecret)
+
+	requests := make(chan string, 1)
+	server := startLNURLServer(t, providerPubkey, requests)
+
+	sender, _ := keyer.NewPlainKeySigner(nostr.GeneratePrivateKey())
+	alicePubkey, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	alice := sdk.ProfileMetadata{
+		PubKey: alicePubkey,
+		LUD16:  "alice@" + strings.TrimPrefix(server.URL, "https://"),
+	}
+	note := &nostr.Event{Kind: 1, Content: "hello", CreatedAt: nostr.Now()}
+	note.Sign(nostr.GeneratePrivateKey())
+
+	invoice, params, err := GetZapInvoice(ctx, sender, alice, ZapOptions{
+		Amount:  21000,
+		Relays:  []string{"wss://relay.example.com"},
+		Comment: "great post",
+		Event:   note,
+	})
+	require.NoError(t, err)
+	require.Equal(t, providerPubkey, params.NostrPubkey)
+
+	decoded, err := bolt11.Decode(invoice)
+	require.NoError(t, err)
+	require.Equal(t, uint64(21000), decoded.Amount)
+
+	zapRequest := <-requests
+
+	// the same params can be found through lud06
+	lud06, err := EncodeLNURL(server.URL + "/.well-known/lnurlp/alice")
+	require.NoError(t, err)
+	require.Equal(t, params.LNURL, lud06)
+	params06, err := FetchPayParams(ctx, sdk.ProfileMetadata{PubKey: alice.PubKey, LUD06: strings.ToUpper(lud06)})
+	require.NoError(t, err)
+	require.Equal(t, params.Callback, params06.Callback)
+
+	// the provider publishes the receipt once the invoice is paid
+	makeReceipt := func(bolt11 string, secret string) *nostr.Event {
+		receipt := &nostr.Event{
+			Kind:      nostr.KindZap,
+			CreatedAt: nostr.Now(),
+			Tags: nostr.Tags{
+				{"p", alice.PubKey},
+				{"e", note.ID},
+				{"bolt11", bolt11},
+				{"description", zapRequest},
+				{"preimage", "0000"},
+			},
+		}
+		require.NoError(t, receipt.Sign(secret))
+		return receipt
+	}
+
+	zap, err := ValidateZapReceipt(makeReceipt(invoice, providerSecret), params)
+	require.NoError(t, err)
+	require.Equal(t, uint64(21000), zap.Amount)
+	require.Equal(t, alice.PubKey, zap.Recipient)
+	require.Equal(t, note.ID, zap.EventID)
+	require.Equal(t, "great post", zap.Comment)
+	require.Equal(t, "0000", zap.Preimage)
+	senderPubkey, _ := sender.GetPublicKey(ctx)
+	require.Equal(t, senderPubkey, zap.Sender)
+
+	// published by someone else
+	_, err = ValidateZapReceipt(makeReceipt(invoice, nostr.GeneratePrivateKey()), params)
+	require.ErrorContains(t, err, "not by the lnurl provider")
+
+	// invoice for a different amount
+	hash := sha256.Sum256([]byte(zapRequest))
+	_, err = ValidateZapReceipt(makeReceipt(makeInvoice(t, 1000, hash[:]), providerSecret), params)
+	require.ErrorContains(t, err, "doesn't match the requested")
+
+	// invoice for something else
+	other := sha256.Sum256([]byte("something else"))
+	_, err = ValidateZapReceipt(makeReceipt(makeInvoice(t, 21000, other[:]), providerSecret), params)
+	require.ErrorContains(t, err, "description hash")
+}
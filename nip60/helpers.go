@@ -7,8 +7,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strconv"
-	"strings"
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcec/v2/schnorr"
@@ -20,6 +18,7 @@ import (
 	"github.com/elnosh/gonuts/cashu/nuts/nut11"
 	"github.com/elnosh/gonuts/cashu/nuts/nut12"
 	"github.com/elnosh/gonuts/crypto"
+	"github.com/nbd-wtf/go-nostr/bolt11"
 )
 
 func calculateFee(inputs cashu.Proofs, keysets []nut02.Keyset) uint64 {
@@ -200,56 +199,23 @@ func ParseKeysetKeys(keys nut01.KeysMap) (map[uint64]*btcec.PublicKey, error) {
 	return parsedKeys, nil
 }
 
-func GetSatoshisAmountFromBolt11(bolt11 string) (uint64, error) {
-	if len(bolt11) < 50 {
-		return 0, fmt.Errorf("invalid invoice, too short")
-	}
-	bolt11 = bolt11[0:50]
-	idx := strings.LastIndex(bolt11, "1")
-	if idx == -1 {
-		return 0, fmt.Errorf("invalid invoice")
-	}
-	hrp := bolt11[0:idx]
-	amount, ok := strings.CutPrefix(hrp, "lnbc")
-	if !ok {
-		return 0, fmt.Errorf("invalid invoice")
-	}
-	if len(amount) < 1 {
-		return 0, nil
-	}
-
-	// if last character is a digit, then the amount can just be interpreted as BTC
-	char := amount[len(amount)-1]
-	digit := char - '0'
-	isDigit := digit >= 0 && digit <= 9
-
-	cutPoint := len(amount) - 1
-	if isDigit {
-		cutPoint++
-	}
-
-	// if not a digit, it must be part of the known units
-	num := amount[:cutPoint]
-	if len(num) < 1 {
-		return 0, nil
-	}
-
-	am, err := strconv.ParseUint(num, 10, 64)
+// GetSatoshisAmountFromBolt11 returns the amount of a bolt11 invoice in satoshis, rounded down.
+func GetSatoshisAmountFromBolt11(invoice string) (uint64, error) {
+	msats, err := bolt11.DecodeAmount(invoice)
 	if err != nil {
 		return 0, err
 	}
+	return msats / 1000, nil
+}
 
-	switch char {
-	case 'm':
-		return am * 100000, nil
-	case 'u':
-		return am * 100, nil
-	case 'n':
-		return am / 10, nil
-	case 'p':
-		return am / 10000, nil
-	default:
-		// is BTC
-		return am * 100000000, nil
+// GetPaymentHashFromBolt11 returns the hex payment hash from the "p" field of a bolt11 invoice.
+func GetPaymentHashFromBolt11(invoice string) (string, error) {
+	inv, err := bolt11.Decode(invoice)
+	if err != nil {
+		return "", fmt.Errorf("invalid invoice: %w", err)
+	}
+	if inv.PaymentHash == "" {
+		return "", fmt.Errorf("invoice has no payment hash")
 	}
+	return inv.PaymentHash, nil
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/nbd-wtf/go-nostr/nip60/nip60test"
 	"github.com/stretchr/testify/require"
 )
 
@@ -35,3 +36,12 @@ func TestBolt11Parsing(t *testing.T) {
 		})
 	}
 }
+
+func TestBolt11PaymentHash(t *testing.T) {
+	hash, err := GetPaymentHashFromBolt11(nip60test.Invoice)
+	require.NoError(t, err)
+	require.Equal(t, "8bafd53ba9d20e2ee0f48f4958f2184eca6246da9ac4ffa57e533b224fa7d168", hash)
+
+	_, err = GetPaymentHashFromBolt11("lnbc1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqq")
+	require.Error(t, err)
+}
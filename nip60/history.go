@@ -23,8 +23,12 @@ type TokenRef struct {
 	EventID  string
 	Created  bool
 	IsNutzap bool
+	Sender   string // pubkey of who sent the nutzap, only for redeemed nutzaps
 }
 
+// CreatedAt is the time at which this entry was recorded.
+func (h HistoryEntry) CreatedAt() nostr.Timestamp { return h.createdAt }
+
 func (h HistoryEntry) toEvent(ctx context.Context, kr nostr.Keyer, evt *nostr.Event) error {
 	pk, err := kr.GetPublicKey(ctx)
 	if err != nil {
@@ -48,6 +52,9 @@ func (h HistoryEntry) toEvent(ctx context.Context, kr nostr.Keyer, evt *nostr.Ev
 	for _, tf := range h.TokenReferences {
 		if tf.IsNutzap {
 			evt.Tags = append(evt.Tags, nostr.Tag{"e", tf.EventID, "", "redeemed"})
+			if tf.Sender != "" {
+				evt.Tags = append(evt.Tags, nostr.Tag{"p", tf.Sender})
+			}
 			continue
 		}
 
@@ -102,6 +109,7 @@ func (h *HistoryEntry) parse(ctx context.Context, kr nostr.Keyer, evt *nostr.Eve
 	}
 
 	missingDirection := true
+	senders := make([]string, 0, 1)
 	for _, tag := range tags {
 		if len(tag) < 2 {
 			continue
@@ -146,6 +154,22 @@ func (h *HistoryEntry) parse(ctx context.Context, kr nostr.Keyer, evt *nostr.Eve
 				return fmt.Errorf("unsupported 'e' token marker: %s", tag[3])
 			}
 			h.TokenReferences = append(h.TokenReferences, tf)
+		case "p":
+			if !nostr.IsValid32ByteHex(tag[1]) {
+				return fmt.Errorf("'p' tag has invalid pubkey %s", tag[1])
+			}
+			senders = append(senders, tag[1])
+		}
+	}
+
+	// the "p" tags are the senders of the redeemed nutzaps, in the same order
+	for i := range h.TokenReferences {
+		if len(senders) == 0 {
+			break
+		}
+		if h.TokenReferences[i].IsNutzap {
+			h.TokenReferences[i].Sender = senders[0]
+			senders = senders[1:]
 		}
 	}
 
@@ -0,0 +1,377 @@
+// Package nip60test provides a fake cashu mint that runs on an httptest.Server so wallet code can
+// be tested offline.
+package nip60test
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut01"
+	"github.com/elnosh/gonuts/cashu/nuts/nut02"
+	"github.com/elnosh/gonuts/cashu/nuts/nut03"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/cashu/nuts/nut09"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/elnosh/gonuts/crypto"
+)
+
+// Invoice is what the mint gives for every mint quote, an invoice for 1050 sats.
+const Invoice = "lnbc10500n1pne5tn3pp53wha2waf6g8zac853ay43uscfm9xy3k6ntz0lft72vajyna8695qdq2f38xy6t5wvcqzpgxqrrssrzjq0nfr7qlprzkl2rke380tj0gkunm66pv7dtqt0396jrq02qz2fs98apyqqqqqqqqqgqqqqqqqqqqqzsqxgsp5vapxxnr2wd3780qwmexe24hfcd2m87hsnn8z9xt9u0kmlwq084aq9p4gqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqpqysgq7vljmxfwsxsmf773ad5fhghe4s840t4set4ypyan2tnzwsldxktquw9lzhtlzj3zldma79hgr6ftp7hst8jh0km3p63vtsfugadtmkgp8wtkzp"
+
+// Mint implements just enough of the cashu mint API for a wallet to mint, swap, check and restore
+// tokens. It has a single keyset and all signatures come with DLEQ proofs.
+//
+// Mint quotes are never paid by themselves, use SetQuoteState for that.
+type Mint struct {
+	*httptest.Server
+	sync.Mutex
+
+	KeysetID string
+	Keys     map[uint64]*secp256k1.PrivateKey
+
+	quotes map[string]nut04.State
+	signed map[string]cashu.BlindedSignature // by B_
+	spent  map[string]bool                   // by Y
+}
+
+// NewMint starts a mint that is closed when the test ends.
+func NewMint(t testing.TB) *Mint {
+	m := &Mint{
+		Keys:   make(map[uint64]*secp256k1.PrivateKey),
+		quotes: make(map[string]nut04.State),
+		signed: make(map[string]cashu.BlindedSignature),
+		spent:  make(map[string]bool),
+	}
+
+	for i := range 21 {
+		sk, _ := secp256k1.GeneratePrivateKey()
+		m.Keys[1<<i] = sk
+	}
+	m.KeysetID = crypto.DeriveKeysetId(m.PublicKeys())
+
+	keys := func(w http.ResponseWriter, r *http.Request) {
+		keys := make(nut01.KeysMap, len(m.Keys))
+		for amount, pk := range m.PublicKeys() {
+			keys[amount] = hex.EncodeToString(pk.SerializeCompressed())
+		}
+		json.NewEncoder(w).Encode(nut01.GetKeysResponse{
+			Keysets: []nut01.Keyset{{Id: m.KeysetID, Unit: cashu.Sat.String(), Keys: keys}},
+		})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/keys", keys)
+	mux.HandleFunc("GET /v1/keys/{id}", keys)
+	mux.HandleFunc("GET /v1/keysets", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(nut02.GetKeysetsResponse{
+			Keysets: []nut02.Keyset{{Id: m.KeysetID, Unit: cashu.Sat.String(), Active: true}},
+		})
+	})
+	mux.HandleFunc("POST /v1/checkstate", func(w http.ResponseWriter, r *http.Request) {
+		var req nut07.PostCheckStateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		m.Lock()
+		defer m.Unlock()
+		resp := nut07.PostCheckStateResponse{States: make([]nut07.ProofState, len(req.Ys))}
+		for i, y := range req.Ys {
+			resp.States[i] = nut07.ProofState{Y: y, State: nut07.Unspent}
+			if m.spent[y] {
+				resp.States[i].State = nut07.Spent
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("POST /v1/restore", func(w http.ResponseWriter, r *http.Request) {
+		var req nut09.PostRestoreRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		m.Lock()
+		defer m.Unlock()
+		resp := nut09.PostRestoreResponse{
+			Outputs:    cashu.BlindedMessages{},
+			Signatures: cashu.BlindedSignatures{},
+		}
+		for _, bm := range req.Outputs {
+			if sig, ok := m.signed[bm.B_]; ok {
+				bm.Amount = sig.Amount
+				resp.Outputs = append(resp.Outputs, bm)
+				resp.Signatures = append(resp.Signatures, sig)
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("POST /v1/mint/quote/bolt11", func(w http.ResponseWriter, r *http.Request) {
+		id := make([]byte, 16)
+		rand.Read(id)
+
+		m.Lock()
+		defer m.Unlock()
+		m.quotes[hex.EncodeToString(id)] = nut04.Unpaid
+		json.NewEncoder(w).Encode(&nut04.PostMintQuoteBolt11Response{
+			Quote:   hex.EncodeToString(id),
+			Request: Invoice,
+			State:   nut04.Unpaid,
+			Expiry:  uint64(time.Now().Add(time.Hour).Unix()),
+		})
+	})
+	mux.HandleFunc("GET /v1/mint/quote/bolt11/{id}", func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		state, ok := m.quotes[r.PathValue("id")]
+		if !ok {
+			http.Error(w, "unknown quote", 404)
+			return
+		}
+		json.NewEncoder(w).Encode(&nut04.PostMintQuoteBolt11Response{
+			Quote:   r.PathValue("id"),
+			Request: Invoice,
+			State:   state,
+			Expiry:  uint64(time.Now().Add(time.Hour).Unix()),
+		})
+	})
+	mux.HandleFunc("POST /v1/mint/bolt11", func(w http.ResponseWriter, r *http.Request) {
+		var req nut04.PostMintBolt11Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		m.Lock()
+		defer m.Unlock()
+		if m.quotes[req.Quote] != nut04.Paid {
+			http.Error(w, "quote not paid", 400)
+			return
+		}
+		sigs, err := m.sign(req.Outputs)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		m.quotes[req.Quote] = nut04.Issued
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(nut04.PostMintBolt11Response{Signatures: sigs})
+	})
+	mux.HandleFunc("POST /v1/swap", func(w http.ResponseWriter, r *http.Request) {
+		var req nut03.PostSwapRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		for _, proof := range req.Inputs {
+			if secret, err := nut10.DeserializeSecret(proof.Secret); err == nil && secret.Kind == nut10.P2PK && proof.Witness == "" {
+				http.Error(w, "locked proof without a signature", 400)
+				return
+			}
+		}
+		if req.Inputs.Amount() != req.Outputs.Amount() {
+			http.Error(w, "inputs and outputs don't match", 400)
+			return
+		}
+
+		m.Lock()
+		defer m.Unlock()
+		ys := make([]string, len(req.Inputs))
+		for i, proof := range req.Inputs {
+			y, err := proofY(proof)
+			if err != nil {
+				http.Error(w, err.Error(), 400)
+				return
+			}
+			if m.spent[y] {
+				http.Error(w, "proof already spent", 400)
+				return
+			}
+			ys[i] = y
+		}
+		sigs, err := m.sign(req.Outputs)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		for _, y := range ys {
+			m.spent[y] = true
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(nut03.PostSwapResponse{Signatures: sigs})
+	})
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// PublicKeys returns the public keys of the mint keyset, by amount.
+func (m *Mint) PublicKeys() map[uint64]*secp256k1.PublicKey {
+	pubkeys := make(map[uint64]*secp256k1.PublicKey, len(m.Keys))
+	for amount, sk := range m.Keys {
+		pubkeys[amount] = sk.PubKey()
+	}
+	return pubkeys
+}
+
+// SetQuoteState changes the state of a mint quote, for example to make it paid.
+func (m *Mint) SetQuoteState(id string, state nut04.State) {
+	m.Lock()
+	defer m.Unlock()
+	m.quotes[id] = state
+}
+
+// Sign signs the outputs as if they had been minted, so they can also be restored later.
+func (m *Mint) Sign(t testing.TB, outputs cashu.BlindedMessages) cashu.BlindedSignatures {
+	t.Helper()
+
+	m.Lock()
+	defer m.Unlock()
+	sigs, err := m.sign(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sigs
+}
+
+// sign must be called with the mint locked.
+func (m *Mint) sign(outputs cashu.BlindedMessages) (cashu.BlindedSignatures, error) {
+	sigs := make(cashu.BlindedSignatures, len(outputs))
+	for i, bm := range outputs {
+		b, err := hex.DecodeString(bm.B_)
+		if err != nil {
+			return nil, err
+		}
+		B_, err := secp256k1.ParsePubKey(b)
+		if err != nil {
+			return nil, err
+		}
+		sigs[i] = m.signOne(bm.Amount, B_)
+		m.signed[bm.B_] = sigs[i]
+	}
+	return sigs, nil
+}
+
+func (m *Mint) signOne(amount uint64, B_ *secp256k1.PublicKey) cashu.BlindedSignature {
+	C_ := crypto.SignBlindedMessage(B_, m.Keys[amount])
+	e, s := crypto.GenerateDLEQ(m.Keys[amount], B_, C_)
+	return cashu.BlindedSignature{
+		Amount: amount,
+		C_:     hex.EncodeToString(C_.SerializeCompressed()),
+		Id:     m.KeysetID,
+		DLEQ: &cashu.DLEQProof{
+			E: hex.EncodeToString(e.Serialize()),
+			S: hex.EncodeToString(s.Serialize()),
+		},
+	}
+}
+
+// Issue makes new proofs for the given amount, as if they had been minted.
+func (m *Mint) Issue(t testing.TB, amount uint64) cashu.Proofs {
+	t.Helper()
+	return m.issue(t, amount, nil)
+}
+
+// IssueLocked makes new proofs locked to the given pubkey, as a nutzap sender would.
+func (m *Mint) IssueLocked(t testing.TB, amount uint64, pubkey string) cashu.Proofs {
+	t.Helper()
+	return m.issue(t, amount, &nut10.SpendingCondition{Kind: nut10.P2PK, Data: "02" + pubkey})
+}
+
+func (m *Mint) issue(t testing.TB, amount uint64, condition *nut10.SpendingCondition) cashu.Proofs {
+	t.Helper()
+
+	proofs := make(cashu.Proofs, 0, 2)
+	for _, amt := range cashu.AmountSplit(amount) {
+		var secret string
+		if condition != nil {
+			var err error
+			if secret, err = nut10.NewSecretFromSpendingCondition(*condition); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			b := make([]byte, 32)
+			rand.Read(b)
+			secret = hex.EncodeToString(b)
+		}
+
+		r, _ := secp256k1.GeneratePrivateKey()
+		B_, r, err := crypto.BlindMessage(secret, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sig := m.Sign(t, cashu.BlindedMessages{cashu.NewBlindedMessage(m.KeysetID, amt, B_)})[0]
+		sig.DLEQ.R = hex.EncodeToString(r.Serialize())
+		C_, _ := hex.DecodeString(sig.C_)
+		C_key, err := secp256k1.ParsePubKey(C_)
+		if err != nil {
+			t.Fatal(err)
+		}
+		C := crypto.UnblindSignature(C_key, r, m.Keys[amt].PubKey())
+
+		proofs = append(proofs, cashu.Proof{
+			Amount: amt,
+			Id:     m.KeysetID,
+			Secret: secret,
+			C:      hex.EncodeToString(C.SerializeCompressed()),
+			DLEQ:   sig.DLEQ,
+		})
+	}
+	return proofs
+}
+
+// Spend marks the proofs as spent.
+func (m *Mint) Spend(t testing.TB, proofs ...cashu.Proof) {
+	t.Helper()
+
+	m.Lock()
+	defer m.Unlock()
+	for _, proof := range proofs {
+		y, err := proofY(proof)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.spent[y] = true
+	}
+}
+
+// Verify fails the test if any of the proofs wasn't signed by this mint.
+func (m *Mint) Verify(t testing.TB, proofs cashu.Proofs) {
+	t.Helper()
+
+	for _, proof := range proofs {
+		c, err := hex.DecodeString(proof.C)
+		if err != nil {
+			t.Fatal(err)
+		}
+		C, err := secp256k1.ParsePubKey(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !crypto.Verify(proof.Secret, m.Keys[proof.Amount], C) {
+			t.Fatalf("proof %s wasn't signed by the mint", proof.Secret)
+		}
+	}
+}
+
+func proofY(proof cashu.Proof) (string, error) {
+	Y, err := crypto.HashToCurve([]byte(proof.Secret))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(Y.SerializeCompressed()), nil
+}
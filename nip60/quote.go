@@ -0,0 +1,286 @@
+package nip60
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip60/client"
+)
+
+// quoteEventExpiration is how long relays are asked to keep a quote event around.
+const quoteEventExpiration = 14 * 24 * 60 * 60
+
+// maxSettledQuotes is how many paid quotes are kept in memory so they can still be looked up.
+const maxSettledQuotes = 100
+
+// MintQuote is a pending request to mint new tokens at a mint, which happens once its lightning
+// invoice is paid. It is kept in a kind 7374 event so it survives restarts.
+type MintQuote struct {
+	ID          string // the quote id given by the mint
+	Mint        string
+	Amount      uint64
+	Invoice     string
+	PaymentHash string          // from the invoice
+	Expiry      nostr.Timestamp // when the invoice expires, zero if not known
+	CreatedAt   nostr.Timestamp // when the quote was created, the created_at of its event
+	SettledAt   nostr.Timestamp // when the tokens were minted, zero while pending
+
+	event *nostr.Event
+	w     *Wallet
+}
+
+// CreateMintQuote asks the mint for a lightning invoice of the given amount (in sats) that, once paid,
+// will be turned into new tokens in this wallet. The invoice is in the Invoice field of the returned
+// quote; after it is paid call Wait or Check to get the tokens.
+func (w *Wallet) CreateMintQuote(ctx context.Context, mint string, amount uint64) (*MintQuote, error) {
+	if w.PublishUpdate == nil {
+		return nil, fmt.Errorf("can't do write operations: missing PublishUpdate function")
+	}
+	if amount == 0 {
+		return nil, fmt.Errorf("amount must be greater than zero")
+	}
+
+	mint, err := nostr.NormalizeHTTPURL(mint)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.PostMintQuoteBolt11(ctx, mint, nut04.PostMintQuoteBolt11Request{
+		Amount: amount,
+		Unit:   cashu.Sat.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error requesting mint quote from %s: %w", mint, err)
+	}
+
+	q := &MintQuote{
+		ID:      resp.Quote,
+		Mint:    mint,
+		Amount:  amount,
+		Invoice: resp.Request,
+		Expiry:  nostr.Timestamp(resp.Expiry),
+		event:   &nostr.Event{},
+		w:       w,
+	}
+	q.PaymentHash, _ = GetPaymentHashFromBolt11(q.Invoice)
+	if err := q.toEvent(ctx, w.kr, q.event); err != nil {
+		return nil, fmt.Errorf("failed to make quote event: %w", err)
+	}
+	q.CreatedAt = q.event.CreatedAt
+
+	w.Lock()
+	w.PublishUpdate(*q.event, nil, nil, nil, false)
+	w.MintQuotes = append(w.MintQuotes, q)
+	w.Unlock()
+
+	return q, nil
+}
+
+// Wait polls the mint until the invoice is paid and the tokens are minted, the quote expires or
+// the context is canceled.
+func (q *MintQuote) Wait(ctx context.Context) error {
+	delay := time.Second
+	for {
+		done, err := q.Check(ctx)
+		if err != nil || done {
+			return err
+		}
+
+		q.w.Lock()
+		expiry := q.Expiry
+		q.w.Unlock()
+		if expiry != 0 && nostr.Now() > expiry {
+			return fmt.Errorf("quote %s has expired without being paid", q.ID)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay < 30*time.Second {
+			delay += delay / 2
+		}
+	}
+}
+
+// Check asks the mint if the invoice was paid. If it was, the tokens are minted and saved to the wallet,
+// the quote is deleted and it returns true.
+func (q *MintQuote) Check(ctx context.Context) (bool, error) {
+	state, err := client.GetMintQuoteState(ctx, q.Mint, q.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check quote %s at %s: %w", q.ID, q.Mint, err)
+	}
+
+	// quotes loaded from events only have the id, the rest we get from the mint
+	q.w.Lock()
+	if q.Invoice == "" {
+		q.Invoice = state.Request
+	}
+	if q.PaymentHash == "" {
+		q.PaymentHash, _ = GetPaymentHashFromBolt11(q.Invoice)
+	}
+	if q.Expiry == 0 {
+		q.Expiry = nostr.Timestamp(state.Expiry)
+	}
+	if q.Amount == 0 {
+		q.Amount, err = GetSatoshisAmountFromBolt11(q.Invoice)
+		if err != nil || q.Amount == 0 {
+			q.w.Unlock()
+			return false, fmt.Errorf("mint gave us an invalid invoice for quote %s: %s", q.ID, q.Invoice)
+		}
+	}
+	amount := q.Amount
+	q.w.Unlock()
+
+	switch state.State {
+	case nut04.Paid:
+	case nut04.Issued:
+		// someone else (probably another client of this same wallet) has already minted this
+		q.delete(ctx)
+		return false, fmt.Errorf("quote %s was already issued", q.ID)
+	default:
+		return false, nil
+	}
+
+	proofs, err := redeemMinted(ctx, q.Mint, q.ID, amount)
+	if err != nil {
+		return false, err
+	}
+
+	w := q.w
+	newToken := Token{
+		Mint:     q.Mint,
+		Proofs:   proofs,
+		mintedAt: nostr.Now(),
+		event:    &nostr.Event{},
+	}
+	if err := newToken.toEvent(ctx, w.kr, newToken.event); err != nil {
+		return false, fmt.Errorf("failed to make new token: %w", err)
+	}
+
+	he := HistoryEntry{
+		event: &nostr.Event{},
+		TokenReferences: []TokenRef{
+			{EventID: newToken.event.ID, Created: true},
+		},
+		createdAt: nostr.Now(),
+		In:        true,
+		Amount:    proofs.Amount(),
+	}
+
+	w.Lock()
+	w.PublishUpdate(*newToken.event, nil, &newToken, nil, false)
+	if err := he.toEvent(ctx, w.kr, he.event); err == nil {
+		w.PublishUpdate(*he.event, nil, nil, nil, true)
+	}
+	w.Unlock()
+
+	w.tokensMu.Lock()
+	w.Tokens = append(w.Tokens, newToken)
+	w.tokensMu.Unlock()
+
+	// keep it around for a while so it can still be found by FindMintQuote
+	w.Lock()
+	q.SettledAt = nostr.Now()
+	w.settledQuotes = append(w.settledQuotes, q)
+	if len(w.settledQuotes) > maxSettledQuotes {
+		w.settledQuotes = w.settledQuotes[len(w.settledQuotes)-maxSettledQuotes:]
+	}
+	w.Unlock()
+
+	q.delete(ctx)
+	return true, nil
+}
+
+// FindMintQuote looks for a quote, pending or recently settled, by its invoice or payment hash.
+func (w *Wallet) FindMintQuote(invoice string, paymentHash string) (MintQuote, bool) {
+	w.Lock()
+	defer w.Unlock()
+
+	for _, quotes := range [][]*MintQuote{w.MintQuotes, w.settledQuotes} {
+		for _, q := range quotes {
+			if (invoice != "" && q.Invoice == invoice) || (paymentHash != "" && q.PaymentHash == paymentHash) {
+				return *q, true
+			}
+		}
+	}
+	return MintQuote{}, false
+}
+
+// delete publishes a deletion for the quote event and removes it from the wallet.
+func (q *MintQuote) delete(ctx context.Context) {
+	w := q.w
+
+	w.Lock()
+	defer w.Unlock()
+
+	if q.event != nil && q.event.ID != "" {
+		deleteEvent := nostr.Event{
+			CreatedAt: nostr.Now(),
+			Kind:      5,
+			Tags:      nostr.Tags{{"e", q.event.ID}, {"k", "7374"}},
+		}
+		if err := w.kr.SignEvent(ctx, &deleteEvent); err == nil {
+			w.PublishUpdate(deleteEvent, nil, nil, nil, false)
+		}
+	}
+
+	w.MintQuotes = slices.DeleteFunc(w.MintQuotes, func(c *MintQuote) bool { return c.ID == q.ID })
+}
+
+func (q MintQuote) toEvent(ctx context.Context, kr nostr.Keyer, evt *nostr.Event) error {
+	pk, err := kr.GetPublicKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	evt.CreatedAt = nostr.Now()
+	evt.Kind = 7374
+	evt.Tags = nostr.Tags{
+		{"expiration", strconv.FormatInt(int64(evt.CreatedAt)+quoteEventExpiration, 10)},
+		{"mint", q.Mint},
+	}
+
+	evt.Content, err = kr.Encrypt(ctx, q.ID, pk)
+	if err != nil {
+		return err
+	}
+
+	return kr.SignEvent(ctx, evt)
+}
+
+func (q *MintQuote) parse(ctx context.Context, kr nostr.Keyer, evt *nostr.Event) error {
+	q.event = evt
+	q.CreatedAt = evt.CreatedAt
+
+	pk, err := kr.GetPublicKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	tag := evt.Tags.Find("mint")
+	if tag == nil {
+		return fmt.Errorf("missing 'mint' tag")
+	}
+	q.Mint, err = nostr.NormalizeHTTPURL(tag[1])
+	if err != nil {
+		return fmt.Errorf("invalid 'mint' tag %s: %w", tag[1], err)
+	}
+
+	q.ID, err = kr.Decrypt(ctx, evt.Content, pk)
+	if err != nil {
+		return err
+	}
+	if q.ID == "" {
+		return fmt.Errorf("empty quote id")
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package nip60
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/keyer"
+	"github.com/nbd-wtf/go-nostr/nip60/nip60test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMintQuote(t *testing.T) {
+	ctx := context.Background()
+	kr, err := keyer.NewPlainKeySigner("040cbf11f24b080ad9d8669d7514d9f3b7b1f58e5a6dcb75549352b041656537")
+	require.NoError(t, err)
+
+	mint := nip60test.NewMint(t)
+
+	var mu sync.Mutex
+	published := make([]*nostr.Event, 0, 5)
+	publish := func(event nostr.Event, deleted *Token, received *Token, change *Token, isHistory bool) {
+		mu.Lock()
+		published = append(published, &event)
+		mu.Unlock()
+	}
+
+	w := &Wallet{kr: kr, PublishUpdate: publish}
+	q, err := w.CreateMintQuote(ctx, mint.URL, 1050)
+	require.NoError(t, err)
+	require.Equal(t, nip60test.Invoice, q.Invoice)
+	require.Equal(t, "8bafd53ba9d20e2ee0f48f4958f2184eca6246da9ac4ffa57e533b224fa7d168", q.PaymentHash)
+	require.NotZero(t, q.CreatedAt)
+	require.Len(t, w.MintQuotes, 1)
+	require.Len(t, published, 1)
+	require.Equal(t, 7374, published[0].Kind)
+	require.NotContains(t, published[0].Content, q.ID)
+
+	done, err := q.Check(ctx)
+	require.NoError(t, err)
+	require.False(t, done)
+
+	// load it again from the events as if we had restarted
+	evtChan := make(chan nostr.RelayEvent)
+	eoseChan := make(chan struct{})
+	go func() {
+		for _, evt := range published {
+			evtChan <- nostr.RelayEvent{Event: evt}
+		}
+		close(eoseChan)
+		close(evtChan)
+	}()
+	loaded := loadWallet(ctx, kr, evtChan, make(chan nostr.RelayEvent), eoseChan)
+	loaded.PublishUpdate = publish
+	<-loaded.Stable
+
+	loaded.Lock()
+	require.Len(t, loaded.MintQuotes, 1)
+	restored := loaded.MintQuotes[0]
+	loaded.Unlock()
+	require.Equal(t, q.ID, restored.ID)
+	require.Equal(t, q.Mint, restored.Mint)
+	require.Equal(t, q.CreatedAt, restored.CreatedAt)
+
+	// the invoice and payment hash come from the mint
+	_, found := loaded.FindMintQuote(nip60test.Invoice, "")
+	require.False(t, found)
+	done, err = restored.Check(ctx)
+	require.NoError(t, err)
+	require.False(t, done)
+	pending, found := loaded.FindMintQuote("", q.PaymentHash)
+	require.True(t, found)
+	require.Equal(t, nip60test.Invoice, pending.Invoice)
+	require.Zero(t, pending.SettledAt)
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		mint.SetQuoteState(q.ID, nut04.Paid)
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	require.NoError(t, restored.Wait(ctx))
+
+	require.Equal(t, uint64(1050), restored.Amount)
+	require.Equal(t, uint64(1050), loaded.Balance())
+	loaded.Lock()
+	require.Empty(t, loaded.MintQuotes)
+	loaded.Unlock()
+
+	// it can still be found after it is paid
+	settled, found := loaded.FindMintQuote("", q.PaymentHash)
+	require.True(t, found)
+	require.NotZero(t, settled.SettledAt)
+	require.Equal(t, q.CreatedAt, settled.CreatedAt)
+	mint.Verify(t, loaded.Tokens[0].Proofs)
+	require.Equal(t, strings.TrimSuffix(mint.URL, "/"), loaded.Tokens[0].Mint)
+
+	kinds := make([]int, 0, len(published))
+	for _, evt := range published {
+		kinds = append(kinds, evt.Kind)
+	}
+	require.Equal(t, []int{7374, 7375, 7376, 5}, kinds)
+	require.Equal(t, "7374", published[3].Tags.GetFirst([]string{"k", ""}).Value())
+	require.Equal(t, published[0].ID, published[3].Tags.GetFirst([]string{"e", ""}).Value())
+
+	// checking again says the quote was already used
+	_, err = q.Check(ctx)
+	require.ErrorContains(t, err, "already issued")
+}
@@ -12,8 +12,10 @@ import (
 )
 
 type receiveSettings struct {
-	intoMint []string
-	isNutzap bool
+	intoMint     []string
+	isNutzap     bool
+	nutzapEvent  string
+	nutzapSender string
 }
 
 type ReceiveOption func(*receiveSettings)
@@ -30,6 +32,16 @@ func WithNutzap() ReceiveOption {
 	}
 }
 
+// WithNutzapEvent is like WithNutzap, but also references the kind 9321 event being redeemed and its
+// sender in the history entry, which is how other clients know it was already redeemed.
+func WithNutzapEvent(id string, sender string) ReceiveOption {
+	return func(rs *receiveSettings) {
+		rs.isNutzap = true
+		rs.nutzapEvent = id
+		rs.nutzapSender = sender
+	}
+}
+
 func (w *Wallet) Receive(
 	ctx context.Context,
 	proofs cashu.Proofs,
@@ -138,13 +150,21 @@ saveproofs:
 			{
 				EventID:  newToken.event.ID,
 				Created:  true,
-				IsNutzap: rs.isNutzap,
+				IsNutzap: rs.isNutzap && rs.nutzapEvent == "",
 			},
 		},
 		createdAt: nostr.Now(),
 		In:        true,
 		Amount:    newToken.Proofs.Amount(),
 	}
+	if rs.nutzapEvent != "" {
+		he.TokenReferences = append(he.TokenReferences, TokenRef{
+			EventID:  rs.nutzapEvent,
+			Created:  true,
+			IsNutzap: true,
+			Sender:   rs.nutzapSender,
+		})
+	}
 
 	w.Lock()
 	w.PublishUpdate(*newToken.event, nil, &newToken, nil, false)
@@ -0,0 +1,168 @@
+package nip60
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip60/client"
+)
+
+// Reconcile checks the state of all the proofs in the wallet against their mints and drops those that
+// were already spent (by another client or because some operation failed halfway), publishing deletions
+// for the affected token events and new token events with what remains of them.
+//
+// It returns the amount that was dropped. Mints that fail to answer are skipped and their errors returned.
+func (w *Wallet) Reconcile(ctx context.Context) (uint64, error) {
+	if w.PublishUpdate == nil {
+		return 0, fmt.Errorf("can't do write operations: missing PublishUpdate function")
+	}
+
+	w.tokensMu.Lock()
+	defer w.tokensMu.Unlock()
+
+	// find out which proofs are spent, mint by mint
+	spent := make(map[string]struct{})
+	var errs []error
+	mints := make([]string, 0, len(w.Mints))
+	for _, token := range w.Tokens {
+		if !slices.Contains(mints, token.Mint) {
+			mints = append(mints, token.Mint)
+		}
+	}
+	for _, mint := range mints {
+		ys := make([]string, 0, 64)
+		for _, token := range w.Tokens {
+			if token.Mint != mint {
+				continue
+			}
+			for _, proof := range token.Proofs {
+				y, err := proofY(proof)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("invalid proof in token %s: %w", token.ID(), err))
+					continue
+				}
+				ys = append(ys, y)
+			}
+		}
+
+		for chunk := range slices.Chunk(ys, 100) {
+			resp, err := client.PostCheckProofState(ctx, mint, nut07.PostCheckStateRequest{Ys: chunk})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to check proofs at %s: %w", mint, err))
+				break
+			}
+			for _, state := range resp.States {
+				if state.State == nut07.Spent {
+					spent[state.Y] = struct{}{}
+				}
+			}
+		}
+	}
+
+	if len(spent) == 0 {
+		return 0, errors.Join(errs...)
+	}
+
+	// now replace the tokens that have spent proofs in them
+	he := HistoryEntry{
+		event:           &nostr.Event{},
+		TokenReferences: make([]TokenRef, 0, 4),
+		createdAt:       nostr.Now(),
+		In:              false,
+	}
+
+	updatedTokens := make([]Token, 0, len(w.Tokens))
+	for i, token := range w.Tokens {
+		unspent := slices.DeleteFunc(slices.Clone(token.Proofs), func(proof cashu.Proof) bool {
+			y, _ := proofY(proof)
+			_, isSpent := spent[y]
+			return isSpent
+		})
+		if len(unspent) == len(token.Proofs) {
+			updatedTokens = append(updatedTokens, token)
+			continue
+		}
+
+		// the replacement must be out before the old token is deleted, otherwise if anything fails in
+		// between the unspent proofs would be lost
+		if len(unspent) > 0 {
+			newToken := Token{
+				Mint:     token.Mint,
+				Proofs:   unspent,
+				Deleted:  []string{},
+				mintedAt: nostr.Now(),
+				event:    &nostr.Event{},
+			}
+			if token.event != nil {
+				newToken.Deleted = append(newToken.Deleted, token.event.ID)
+			}
+
+			if err := newToken.toEvent(ctx, w.kr, newToken.event); err != nil {
+				errs = append(errs, fmt.Errorf("failed to make new token: %w", err))
+				updatedTokens = append(updatedTokens, w.Tokens[i:]...)
+				break
+			}
+
+			w.Lock()
+			w.PublishUpdate(*newToken.event, nil, nil, &newToken, false)
+			w.Unlock()
+
+			updatedTokens = append(updatedTokens, newToken)
+			he.TokenReferences = append(he.TokenReferences, TokenRef{
+				EventID: newToken.event.ID,
+				Created: true,
+			})
+		}
+		he.Amount += token.Proofs.Amount() - unspent.Amount()
+
+		if token.event != nil {
+			deleteEvent := nostr.Event{
+				CreatedAt: nostr.Now(),
+				Kind:      5,
+				Tags:      nostr.Tags{{"e", token.event.ID}, {"k", "7375"}},
+			}
+			if err := w.kr.SignEvent(ctx, &deleteEvent); err != nil {
+				// the replacement is already out, so this token is gone from our side anyway
+				errs = append(errs, fmt.Errorf("failed to sign deletion of token %s: %w", token.event.ID, err))
+				updatedTokens = append(updatedTokens, w.Tokens[i+1:]...)
+				break
+			}
+
+			w.Lock()
+			w.PublishUpdate(deleteEvent, &token, nil, nil, false)
+			w.Unlock()
+
+			he.TokenReferences = append(he.TokenReferences, TokenRef{
+				EventID: token.event.ID,
+				Created: false,
+			})
+		}
+	}
+	w.Tokens = updatedTokens
+
+	if he.Amount > 0 {
+		w.Lock()
+		if err := he.toEvent(ctx, w.kr, he.event); err == nil {
+			w.PublishUpdate(*he.event, nil, nil, nil, true)
+		}
+		w.Unlock()
+	}
+
+	return he.Amount, errors.Join(errs...)
+}
+
+// proofY is the hash_to_curve(secret) by which mints identify proofs.
+func proofY(proof cashu.Proof) (string, error) {
+	Y, err := crypto.HashToCurve([]byte(proof.Secret))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(Y.SerializeCompressed()), nil
+}
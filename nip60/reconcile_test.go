@@ -0,0 +1,122 @@
+package nip60
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/keyer"
+	"github.com/nbd-wtf/go-nostr/nip60/nip60test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	kr, err := keyer.NewPlainKeySigner("040cbf11f24b080ad9d8669d7514d9f3b7b1f58e5a6dcb75549352b041656537")
+	require.NoError(t, err)
+
+	mint := nip60test.NewMint(t)
+
+	published := make([]nostr.Event, 0, 5)
+	w := &Wallet{
+		kr: kr,
+		PublishUpdate: func(event nostr.Event, deleted *Token, received *Token, change *Token, isHistory bool) {
+			published = append(published, event)
+		},
+		Mints: []string{mint.URL},
+	}
+
+	for _, amount := range []uint64{7, 12, 30} {
+		token := Token{Mint: mint.URL, Proofs: mint.Issue(t, amount), event: &nostr.Event{}}
+		require.NoError(t, token.toEvent(ctx, kr, token.event))
+		w.Tokens = append(w.Tokens, token)
+	}
+	untouched := w.Tokens[0]
+	partial := w.Tokens[1] // 4 + 8
+	gone := w.Tokens[2]    // 2 + 4 + 8 + 16
+
+	// nothing spent, nothing changes
+	dropped, err := w.Reconcile(ctx)
+	require.NoError(t, err)
+	require.Zero(t, dropped)
+	require.Empty(t, published)
+
+	mint.Spend(t, partial.Proofs[0])
+	mint.Spend(t, gone.Proofs...)
+
+	dropped, err = w.Reconcile(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4+30), dropped)
+	require.Equal(t, uint64(7+8), w.Balance())
+	require.Len(t, w.Tokens, 2)
+	require.Equal(t, untouched.ID(), w.Tokens[0].ID())
+	require.Equal(t, partial.Proofs[1:], w.Tokens[1].Proofs)
+	require.Equal(t, []string{partial.ID()}, w.Tokens[1].Deleted)
+
+	// replacement and deletion of the partial token, deletion of the other, then history
+	kinds := make([]int, len(published))
+	for i, evt := range published {
+		kinds[i] = evt.Kind
+	}
+	require.Equal(t, []int{7375, 5, 5, 7376}, kinds)
+	require.Equal(t, partial.ID(), published[1].Tags.GetFirst([]string{"e", ""}).Value())
+	require.Equal(t, gone.ID(), published[2].Tags.GetFirst([]string{"e", ""}).Value())
+
+	he := HistoryEntry{}
+	require.NoError(t, he.parse(ctx, kr, &published[3]))
+	require.False(t, he.In)
+	require.Equal(t, uint64(34), he.Amount)
+	require.Len(t, he.TokenReferences, 3)
+}
+
+type failingKeyer struct {
+	nostr.Keyer
+	fail bool
+}
+
+func (fk *failingKeyer) Encrypt(ctx context.Context, plaintext string, recipient string) (string, error) {
+	if fk.fail {
+		return "", fmt.Errorf("keyer is broken")
+	}
+	return fk.Keyer.Encrypt(ctx, plaintext, recipient)
+}
+
+func TestReconcileFailedReplacement(t *testing.T) {
+	ctx := context.Background()
+	plain, err := keyer.NewPlainKeySigner("040cbf11f24b080ad9d8669d7514d9f3b7b1f58e5a6dcb75549352b041656537")
+	require.NoError(t, err)
+	kr := &failingKeyer{Keyer: plain}
+
+	mint := nip60test.NewMint(t)
+
+	published := make([]nostr.Event, 0, 5)
+	w := &Wallet{
+		kr: kr,
+		PublishUpdate: func(event nostr.Event, deleted *Token, received *Token, change *Token, isHistory bool) {
+			published = append(published, event)
+		},
+		Mints: []string{mint.URL},
+	}
+
+	token := Token{Mint: mint.URL, Proofs: mint.Issue(t, 12), event: &nostr.Event{}}
+	require.NoError(t, token.toEvent(ctx, kr, token.event))
+	w.Tokens = append(w.Tokens, token)
+	mint.Spend(t, token.Proofs[0])
+
+	// the replacement can't be made, so the old token must stay
+	kr.fail = true
+	dropped, err := w.Reconcile(ctx)
+	require.ErrorContains(t, err, "keyer is broken")
+	require.Zero(t, dropped)
+	require.Empty(t, published)
+	require.Len(t, w.Tokens, 1)
+	require.Equal(t, token.ID(), w.Tokens[0].ID())
+
+	// and it works once the keyer is back
+	kr.fail = false
+	dropped, err = w.Reconcile(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), dropped)
+	require.Equal(t, uint64(8), w.Balance())
+}
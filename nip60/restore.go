@@ -0,0 +1,249 @@
+package nip60
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut01"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/cashu/nuts/nut09"
+	"github.com/elnosh/gonuts/cashu/nuts/nut13"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip60/client"
+)
+
+const (
+	restoreBatchSize  = 100
+	restoreEmptyLimit = 3 // stop after this many batches in a row without any signatures
+)
+
+// RestoreFromSeed recovers the unspent proofs that were created with NUT-13 deterministic secrets derived
+// from Seed at the given mints (for example, from a regular cashu wallet that was backed up with a
+// mnemonic) and saves them to this wallet as new tokens. Proofs the wallet already has are ignored.
+//
+// It returns the amount that was recovered. Mints that fail are skipped and their errors returned.
+func (w *Wallet) RestoreFromSeed(ctx context.Context, mints []string) (uint64, error) {
+	if w.PublishUpdate == nil {
+		return 0, fmt.Errorf("can't do write operations: missing PublishUpdate function")
+	}
+	if len(w.Seed) == 0 {
+		return 0, fmt.Errorf("wallet has no seed to restore from")
+	}
+
+	master, err := hdkeychain.NewMaster(w.Seed, &chaincfg.MainNetParams)
+	if err != nil {
+		return 0, fmt.Errorf("invalid seed: %w", err)
+	}
+
+	var total uint64
+	var errs []error
+	for _, mint := range mints {
+		mint, err := nostr.NormalizeHTTPURL(mint)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		proofs, err := restoreFromMint(ctx, master, mint)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore from %s: %w", mint, err))
+		}
+
+		// skip what we already have
+		w.tokensMu.Lock()
+		for _, token := range w.Tokens {
+			for _, proof := range token.Proofs {
+				proofs = slices.DeleteFunc(proofs, func(p cashu.Proof) bool { return p.Secret == proof.Secret })
+			}
+		}
+		w.tokensMu.Unlock()
+
+		if len(proofs) == 0 {
+			continue
+		}
+
+		newToken := Token{
+			Mint:     mint,
+			Proofs:   proofs,
+			mintedAt: nostr.Now(),
+			event:    &nostr.Event{},
+		}
+		if err := newToken.toEvent(ctx, w.kr, newToken.event); err != nil {
+			errs = append(errs, fmt.Errorf("failed to make new token: %w", err))
+			continue
+		}
+
+		he := HistoryEntry{
+			event: &nostr.Event{},
+			TokenReferences: []TokenRef{
+				{EventID: newToken.event.ID, Created: true},
+			},
+			createdAt: nostr.Now(),
+			In:        true,
+			Amount:    proofs.Amount(),
+		}
+
+		w.Lock()
+		w.PublishUpdate(*newToken.event, nil, &newToken, nil, false)
+		if err := he.toEvent(ctx, w.kr, he.event); err == nil {
+			w.PublishUpdate(*he.event, nil, nil, nil, true)
+		}
+		w.Unlock()
+
+		w.tokensMu.Lock()
+		w.Tokens = append(w.Tokens, newToken)
+		w.tokensMu.Unlock()
+
+		total += proofs.Amount()
+	}
+
+	return total, errors.Join(errs...)
+}
+
+// restoreFromMint goes through all the sat keysets of a mint asking it for the signatures of our
+// deterministic outputs (NUT-09), then returns the resulting proofs that are still unspent.
+func restoreFromMint(ctx context.Context, master *hdkeychain.ExtendedKey, mint string) (cashu.Proofs, error) {
+	keysets, err := client.GetAllKeysets(ctx, mint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get keysets: %w", err)
+	}
+
+	restored := make(cashu.Proofs, 0, 32)
+	for _, keyset := range keysets {
+		if keyset.Unit != cashu.Sat.String() {
+			continue
+		}
+
+		keys, err := client.GetKeysetById(ctx, mint, keyset.Id)
+		if err != nil {
+			return restored, fmt.Errorf("failed to get keys for keyset %s: %w", keyset.Id, err)
+		}
+		keysetKeys, err := ParseKeysetKeys(nut01.KeysMap(keys))
+		if err != nil {
+			return restored, fmt.Errorf("mint sent us an invalid keyset %s: %w", keyset.Id, err)
+		}
+
+		keysetPath, err := nut13.DeriveKeysetPath(master, keyset.Id)
+		if err != nil {
+			return restored, fmt.Errorf("failed to derive path for keyset %s: %w", keyset.Id, err)
+		}
+
+		empty := 0
+		for counter := uint32(0); empty < restoreEmptyLimit; counter += restoreBatchSize {
+			prep, err := createDeterministicBlindedMessages(keysetPath, keyset.Id, counter, restoreBatchSize)
+			if err != nil {
+				return restored, err
+			}
+
+			resp, err := client.PostRestore(ctx, mint, nut09.PostRestoreRequest{Outputs: prep.bm})
+			if err != nil {
+				return restored, fmt.Errorf("restore request: %w", err)
+			}
+			if len(resp.Signatures) == 0 {
+				empty++
+				continue
+			}
+			empty = 0
+
+			// the mint only returns the outputs it knows about, so match them with ours
+			matched := preparedOutputs{
+				bm:      make(cashu.BlindedMessages, 0, len(resp.Outputs)),
+				rs:      make([]*btcec.PrivateKey, 0, len(resp.Outputs)),
+				secrets: make([]string, 0, len(resp.Outputs)),
+			}
+			for _, output := range resp.Outputs {
+				idx := slices.IndexFunc(prep.bm, func(bm cashu.BlindedMessage) bool { return bm.B_ == output.B_ })
+				if idx == -1 {
+					return restored, fmt.Errorf("mint returned an output we didn't ask for")
+				}
+				matched.bm = append(matched.bm, prep.bm[idx])
+				matched.rs = append(matched.rs, prep.rs[idx])
+				matched.secrets = append(matched.secrets, prep.secrets[idx])
+			}
+
+			proofs, err := constructProofs(matched, resp.Signatures, keysetKeys)
+			if err != nil {
+				return restored, fmt.Errorf("error constructing proofs: %w", err)
+			}
+
+			unspent, err := filterUnspent(ctx, mint, proofs)
+			if err != nil {
+				return restored, err
+			}
+			restored = append(restored, unspent...)
+		}
+	}
+
+	return restored, nil
+}
+
+// createDeterministicBlindedMessages derives n NUT-13 secrets and blinding factors starting at counter.
+func createDeterministicBlindedMessages(
+	keysetPath *hdkeychain.ExtendedKey,
+	keysetId string,
+	counter uint32,
+	n uint32,
+) (preparedOutputs, error) {
+	prep := preparedOutputs{
+		bm:      make(cashu.BlindedMessages, n),
+		rs:      make([]*btcec.PrivateKey, n),
+		secrets: make([]string, n),
+	}
+
+	for i := range n {
+		secret, err := nut13.DeriveSecret(keysetPath, counter+i)
+		if err != nil {
+			return prep, fmt.Errorf("failed to derive secret %d: %w", counter+i, err)
+		}
+		r, err := nut13.DeriveBlindingFactor(keysetPath, counter+i)
+		if err != nil {
+			return prep, fmt.Errorf("failed to derive blinding factor %d: %w", counter+i, err)
+		}
+
+		B_, r, err := crypto.BlindMessage(secret, r)
+		if err != nil {
+			return prep, err
+		}
+
+		// the amount doesn't matter here, the mint will tell us the amount it has signed
+		prep.bm[i] = cashu.NewBlindedMessage(keysetId, 1, B_)
+		prep.rs[i] = r
+		prep.secrets[i] = secret
+	}
+
+	return prep, nil
+}
+
+func filterUnspent(ctx context.Context, mint string, proofs cashu.Proofs) (cashu.Proofs, error) {
+	ys := make([]string, len(proofs))
+	for i, proof := range proofs {
+		y, err := proofY(proof)
+		if err != nil {
+			return nil, err
+		}
+		ys[i] = y
+	}
+
+	resp, err := client.PostCheckProofState(ctx, mint, nut07.PostCheckStateRequest{Ys: ys})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check proofs: %w", err)
+	}
+
+	unspent := make(cashu.Proofs, 0, len(proofs))
+	for _, state := range resp.States {
+		if state.State != nut07.Unspent {
+			continue
+		}
+		if idx := slices.Index(ys, state.Y); idx != -1 {
+			unspent = append(unspent, proofs[idx])
+		}
+	}
+	return unspent, nil
+}
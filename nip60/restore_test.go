@@ -0,0 +1,83 @@
+package nip60
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut13"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/keyer"
+	"github.com/nbd-wtf/go-nostr/nip60/nip60test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreFromSeed(t *testing.T) {
+	ctx := context.Background()
+	kr, err := keyer.NewPlainKeySigner("040cbf11f24b080ad9d8669d7514d9f3b7b1f58e5a6dcb75549352b041656537")
+	require.NoError(t, err)
+
+	mint := nip60test.NewMint(t)
+	seed := make([]byte, 32)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+
+	// some other wallet has minted deterministic outputs with this seed, with gaps
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	require.NoError(t, err)
+	keysetPath, err := nut13.DeriveKeysetPath(master, mint.KeysetID)
+	require.NoError(t, err)
+	prep, err := createDeterministicBlindedMessages(keysetPath, mint.KeysetID, 0, 250)
+	require.NoError(t, err)
+
+	amounts := map[int]uint64{0: 1, 1: 2, 2: 8, 150: 16, 249: 64}
+	issued := preparedOutputs{}
+	for _, i := range []int{0, 1, 2, 150, 249} {
+		prep.bm[i].Amount = amounts[i]
+		issued.bm = append(issued.bm, prep.bm[i])
+		issued.rs = append(issued.rs, prep.rs[i])
+		issued.secrets = append(issued.secrets, prep.secrets[i])
+	}
+	proofs := issue(t, mint, issued)
+	mint.Spend(t, proofs[1]) // 2 was spent
+
+	published := make([]nostr.Event, 0, 2)
+	w := &Wallet{
+		kr: kr,
+		PublishUpdate: func(event nostr.Event, deleted *Token, received *Token, change *Token, isHistory bool) {
+			published = append(published, event)
+		},
+		// we already have the 1
+		Tokens: []Token{{Mint: mint.URL, Proofs: proofs[0:1]}},
+	}
+
+	_, err = w.RestoreFromSeed(ctx, []string{mint.URL})
+	require.ErrorContains(t, err, "no seed")
+
+	w.Seed = seed
+	restored, err := w.RestoreFromSeed(ctx, []string{mint.URL})
+	require.NoError(t, err)
+	require.Equal(t, uint64(8+16+64), restored)
+	require.Equal(t, uint64(1+8+16+64), w.Balance())
+	mint.Verify(t, w.Tokens[1].Proofs)
+
+	require.Len(t, published, 2)
+	require.Equal(t, 7375, published[0].Kind)
+	require.Equal(t, 7376, published[1].Kind)
+
+	// doing it again finds nothing new
+	restored, err = w.RestoreFromSeed(ctx, []string{mint.URL})
+	require.NoError(t, err)
+	require.Zero(t, restored)
+	require.Len(t, published, 2)
+}
+
+// issue signs the outputs as if they had been minted and returns the resulting proofs.
+func issue(t *testing.T, mint *nip60test.Mint, prep preparedOutputs) cashu.Proofs {
+	proofs, err := constructProofs(prep, mint.Sign(t, prep.bm), mint.PublicKeys())
+	require.NoError(t, err)
+	return proofs
+}
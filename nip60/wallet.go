@@ -26,7 +26,8 @@ type Wallet struct {
 	kr nostr.Keyer
 
 	// PublishUpdate must be set to a function that publishes event to the user relays
-	// (if all arguments are their zero values that means it is a wallet update event).
+	// (if all arguments are their zero values that means it is a wallet update event, a mint quote
+	// event or the deletion of one).
 	PublishUpdate func(
 		event nostr.Event,
 		deleted *Token,
@@ -41,12 +42,18 @@ type Wallet struct {
 	// Stable is closed when we have gotten an EOSE from all relays
 	Stable chan struct{}
 
+	// Seed, if set, is the BIP39 seed of a NUT-13 deterministic cashu wallet, used by RestoreFromSeed.
+	// It is not stored anywhere.
+	Seed []byte
+
 	// properties that come in events
-	PrivateKey *btcec.PrivateKey
-	PublicKey  *btcec.PublicKey
-	Mints      []string
-	Tokens     []Token
-	History    []HistoryEntry
+	PrivateKey    *btcec.PrivateKey
+	PublicKey     *btcec.PublicKey
+	Mints         []string
+	Tokens        []Token
+	History       []HistoryEntry
+	MintQuotes    []*MintQuote // pending, see CreateMintQuote
+	settledQuotes []*MintQuote // recently paid, see FindMintQuote
 }
 
 func LoadWallet(
@@ -79,7 +86,7 @@ func loadWalletFromPool(
 		return nil
 	}
 
-	kinds := []int{17375, 7375}
+	kinds := []int{17375, 7375, 7374}
 	if withHistory {
 		kinds = append(kinds, 7376)
 	}
@@ -96,7 +103,7 @@ func loadWalletFromPool(
 	deletions := pool.SubscribeManyNotifyEOSE(
 		ctx,
 		relays,
-		nostr.Filter{Kinds: []int{5}, Tags: nostr.TagMap{"k": []string{"7375"}}, Authors: []string{pk}},
+		nostr.Filter{Kinds: []int{5}, Tags: nostr.TagMap{"k": []string{"7375", "7374"}}, Authors: []string{pk}},
 		eoseChanD,
 	)
 
@@ -123,6 +130,7 @@ func loadWallet(
 		Stable:           make(chan struct{}),
 		Tokens:           make([]Token, 0, 128),
 		History:          make([]HistoryEntry, 0, 128),
+		MintQuotes:       make([]*MintQuote, 0, 4),
 	}
 
 	eosed := false
@@ -200,6 +208,20 @@ func loadWallet(
 					}
 				}
 
+			case 7374: // mint quote
+				q := &MintQuote{w: w}
+				if err := q.parse(ctx, kr, ie.Event); err != nil {
+					if w.Processed != nil {
+						w.Processed(ie.Event, err)
+					}
+					w.Unlock()
+					continue
+				}
+
+				if !slices.ContainsFunc(w.MintQuotes, func(c *MintQuote) bool { return c.ID == q.ID }) {
+					w.MintQuotes = append(w.MintQuotes, q)
+				}
+
 			case 7376: // history
 				he := HistoryEntry{}
 				if err := he.parse(ctx, kr, ie.Event); err != nil {
@@ -241,6 +263,10 @@ func (w *Wallet) removeDeletedToken(eventId string) {
 			w.Tokens = w.Tokens[0 : len(w.Tokens)-1]
 		}
 	}
+
+	w.MintQuotes = slices.DeleteFunc(w.MintQuotes, func(q *MintQuote) bool {
+		return q.event != nil && q.event.ID == eventId
+	})
 }
 
 func (w *Wallet) Balance() uint64 {
@@ -0,0 +1,206 @@
+package nip61
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut01"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip60"
+	"github.com/nbd-wtf/go-nostr/nip60/client"
+)
+
+// Receiver watches for nutzaps sent to a user and redeems them into their wallet, publishing the kind 7376
+// history entries that mark them as redeemed.
+type Receiver struct {
+	Wallet    *nip60.Wallet
+	Pool      *nostr.SimplePool
+	PublicKey string // the user receiving the nutzaps
+	Info      Info   // the kind 10019 of that user, nutzaps are only accepted on its relays and mints
+
+	// HistoryRelays are where the user's history events are, to find out which nutzaps were already
+	// redeemed. Defaults to Info.Relays.
+	HistoryRelays []string
+
+	// Since, if set, causes older nutzaps to be ignored.
+	Since nostr.Timestamp
+
+	// OnNutzap, if not nil, is called after each nutzap is processed, with the amount that was
+	// redeemed or the reason why it wasn't.
+	OnNutzap func(nutzap *nostr.Event, amount uint64, err error)
+
+	redeemed map[string]struct{}
+	keysets  map[string]map[uint64]*btcec.PublicKey // keyed by mint + keyset id
+}
+
+func NewReceiver(w *nip60.Wallet, pool *nostr.SimplePool, pubkey string, info Info) *Receiver {
+	return &Receiver{
+		Wallet:    w,
+		Pool:      pool,
+		PublicKey: pubkey,
+		Info:      info,
+	}
+}
+
+// Run subscribes to nutzaps on the Info relays and redeems them until the context is canceled.
+//
+// Nutzaps that fail to be redeemed are not tried again until the next time it runs.
+func (r *Receiver) Run(ctx context.Context) error {
+	if len(r.Info.Relays) == 0 {
+		return fmt.Errorf("no relays to receive nutzaps on")
+	}
+	if len(r.Info.Mints) == 0 {
+		return fmt.Errorf("no mints to receive nutzaps from")
+	}
+	if r.Info.PublicKey == "" {
+		return fmt.Errorf("no public key for nutzaps to be locked to")
+	}
+
+	r.loadRedeemed(ctx)
+
+	filter := nostr.Filter{
+		Kinds: []int{nostr.KindNutZap},
+		Tags:  nostr.TagMap{"p": []string{r.PublicKey}},
+	}
+	if r.Since != 0 {
+		filter.Since = &r.Since
+	}
+
+	for ie := range r.Pool.SubscribeMany(ctx, r.Info.Relays, filter) {
+		if _, ok := r.redeemed[ie.Event.ID]; ok {
+			continue
+		}
+		r.redeemed[ie.Event.ID] = struct{}{}
+
+		amount, err := r.Redeem(ctx, ie.Event)
+		if r.OnNutzap != nil {
+			r.OnNutzap(ie.Event, amount, err)
+		}
+	}
+
+	return ctx.Err()
+}
+
+// Redeem verifies a single nutzap and receives its proofs into the wallet.
+func (r *Receiver) Redeem(ctx context.Context, nutzap *nostr.Event) (uint64, error) {
+	mint, proofs, err := r.Verify(ctx, nutzap)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := r.Wallet.Receive(ctx, proofs, mint, nip60.WithNutzapEvent(nutzap.ID, nutzap.PubKey)); err != nil {
+		return 0, fmt.Errorf("failed to redeem: %w", err)
+	}
+
+	return proofs.Amount(), nil
+}
+
+// Verify checks that a nutzap is addressed to us, comes from one of our mints, is locked to our
+// public key and has valid DLEQ proofs, then returns its mint and proofs.
+func (r *Receiver) Verify(ctx context.Context, nutzap *nostr.Event) (string, cashu.Proofs, error) {
+	if nutzap.Kind != nostr.KindNutZap {
+		return "", nil, fmt.Errorf("not a nutzap")
+	}
+	if nutzap.Tags.FindWithValue("p", r.PublicKey) == nil {
+		return "", nil, fmt.Errorf("nutzap is not for us")
+	}
+	if r.Info.PublicKey == "" {
+		return "", nil, fmt.Errorf("no public key for nutzaps to be locked to")
+	}
+
+	tag := nutzap.Tags.Find("u")
+	if tag == nil {
+		return "", nil, fmt.Errorf("missing 'u' tag")
+	}
+	mint, err := nostr.NormalizeHTTPURL(tag[1])
+	if err != nil || !slices.Contains(r.Info.Mints, mint) {
+		return "", nil, fmt.Errorf("mint %s is not accepted", tag[1])
+	}
+
+	proofs := make(cashu.Proofs, 0, 4)
+	for tag := range nutzap.Tags.FindAll("proof") {
+		var proof cashu.Proof
+		if err := json.Unmarshal([]byte(tag[1]), &proof); err != nil {
+			return "", nil, fmt.Errorf("invalid proof: %w", err)
+		}
+
+		secret, err := nut10.DeserializeSecret(proof.Secret)
+		if err != nil || secret.Kind != nut10.P2PK ||
+			len(secret.Data.Data) != 66 || secret.Data.Data[2:] != r.Info.PublicKey {
+			return "", nil, fmt.Errorf("proof is not locked to %s", r.Info.PublicKey)
+		}
+
+		keyset, err := r.getKeyset(ctx, mint, proof.Id)
+		if err != nil {
+			return "", nil, err
+		}
+		if !verifyProofDLEQ(proof, keyset[proof.Amount]) {
+			return "", nil, fmt.Errorf("invalid DLEQ proof")
+		}
+
+		proofs = append(proofs, proof)
+	}
+	if len(proofs) == 0 {
+		return "", nil, fmt.Errorf("nutzap has no proofs")
+	}
+
+	return mint, proofs, nil
+}
+
+func (r *Receiver) getKeyset(ctx context.Context, mint string, id string) (map[uint64]*btcec.PublicKey, error) {
+	if keyset, ok := r.keysets[mint+id]; ok {
+		return keyset, nil
+	}
+
+	keys, err := client.GetKeysetById(ctx, mint, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get keyset %s from %s: %w", id, mint, err)
+	}
+	keyset, err := nip60.ParseKeysetKeys(nut01.KeysMap(keys))
+	if err != nil {
+		return nil, fmt.Errorf("mint %s sent an invalid keyset %s: %w", mint, id, err)
+	}
+
+	if r.keysets == nil {
+		r.keysets = make(map[string]map[uint64]*btcec.PublicKey)
+	}
+	r.keysets[mint+id] = keyset
+	return keyset, nil
+}
+
+// loadRedeemed fills the set of redeemed nutzaps from the wallet history and from the history
+// events on relays (their "redeemed" tags are not encrypted, so we don't have to decrypt them).
+func (r *Receiver) loadRedeemed(ctx context.Context) {
+	r.redeemed = make(map[string]struct{})
+
+	r.Wallet.Lock()
+	for _, he := range r.Wallet.History {
+		for _, ref := range he.TokenReferences {
+			if ref.IsNutzap {
+				r.redeemed[ref.EventID] = struct{}{}
+			}
+		}
+	}
+	r.Wallet.Unlock()
+
+	relays := r.HistoryRelays
+	if len(relays) == 0 {
+		relays = r.Info.Relays
+	}
+
+	for ie := range r.Pool.FetchMany(ctx, relays, nostr.Filter{
+		Kinds:   []int{7376},
+		Authors: []string{r.PublicKey},
+	}) {
+		for tag := range ie.Event.Tags.FindAll("e") {
+			if len(tag) >= 4 && tag[3] == "redeemed" {
+				r.redeemed[tag[1]] = struct{}{}
+			}
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package nip61
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/keyer"
+	"github.com/nbd-wtf/go-nostr/nip60"
+	"github.com/nbd-wtf/go-nostr/nip60/nip60test"
+	"github.com/nbd-wtf/go-nostr/nostrtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceiver(t *testing.T) {
+	ctx := context.Background()
+
+	relay := nostrtest.NewRelay()
+	url := relay.Start()
+	defer relay.Close()
+
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	senderSk := nostr.GeneratePrivateKey()
+
+	publish := func(sk string, evt nostr.Event) *nostr.Event {
+		evt.CreatedAt = nostr.Now()
+		require.NoError(t, evt.Sign(sk))
+		r, err := nostr.RelayConnect(ctx, url)
+		require.NoError(t, err)
+		require.NoError(t, r.Publish(ctx, evt))
+		r.Close()
+		return &evt
+	}
+
+	// a nutzap we have already redeemed and its history entry
+	redeemed := publish(senderSk, nostr.Event{
+		Kind: nostr.KindNutZap,
+		Tags: nostr.Tags{{"p", pk}, {"u", "https://mint.example.com"}, {"proof", "{}"}},
+	})
+	publish(sk, nostr.Event{
+		Kind: 7376,
+		Tags: nostr.Tags{{"e", redeemed.ID, "", "redeemed"}},
+	})
+
+	// a nutzap from a mint we don't accept
+	untrusted := publish(senderSk, nostr.Event{
+		Kind: nostr.KindNutZap,
+		Tags: nostr.Tags{{"p", pk}, {"u", "https://evil.example.com"}, {"proof", "{}"}},
+	})
+
+	// a nutzap with proofs not locked to us
+	unlocked := publish(senderSk, nostr.Event{
+		Kind: nostr.KindNutZap,
+		Tags: nostr.Tags{{"p", pk}, {"u", "https://mint.example.com"}, {"proof", `{"amount":1,"secret":"abc","C":"02","id":"00"}`}},
+	})
+
+	var mu sync.Mutex
+	processed := make(map[string]error)
+	receiver := NewReceiver(&nip60.Wallet{}, nostr.NewSimplePool(ctx), pk, Info{
+		PublicKey: "fb8b9c8a3b4d79e4b0a97a8c1d5e4ca3bd4f9b1e5c2a6d3f7e8b9a0c1d2e3f4a",
+		Mints:     []string{"https://mint.example.com"},
+		Relays:    []string{url},
+	})
+	receiver.OnNutzap = func(nutzap *nostr.Event, amount uint64, err error) {
+		mu.Lock()
+		processed[nutzap.ID] = err
+		mu.Unlock()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	require.ErrorIs(t, receiver.Run(ctx), context.DeadlineExceeded)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, processed, 2)
+	require.NotContains(t, processed, redeemed.ID)
+	require.ErrorContains(t, processed[untrusted.ID], "not accepted")
+	require.ErrorContains(t, processed[unlocked.ID], "not locked")
+
+	// without a public key to check against nothing is accepted
+	receiver.Info.PublicKey = ""
+	_, _, err := receiver.Verify(ctx, unlocked)
+	require.ErrorContains(t, err, "no public key")
+}
+
+func TestReceiverRedeem(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	relay := nostrtest.NewRelay()
+	url := relay.Start()
+	defer relay.Close()
+
+	mint := nip60test.NewMint(t)
+	mintURL, _ := nostr.NormalizeHTTPURL(mint.URL)
+
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	kr, err := keyer.NewPlainKeySigner(sk)
+	require.NoError(t, err)
+	senderSk := nostr.GeneratePrivateKey()
+
+	// the key nutzaps are locked to
+	p2pkSk := nostr.GeneratePrivateKey()
+	p2pkPk, _ := nostr.GetPublicKey(p2pkSk)
+
+	pool := nostr.NewSimplePool(ctx)
+	defer pool.Close("test ended")
+
+	var mu sync.Mutex
+	published := make([]nostr.Event, 0, 4)
+	w := nip60.LoadWallet(ctx, kr, pool, []string{url})
+	w.PublishUpdate = func(event nostr.Event, deleted *nip60.Token, received *nip60.Token, change *nip60.Token, isHistory bool) {
+		mu.Lock()
+		published = append(published, event)
+		mu.Unlock()
+		for range pool.PublishMany(ctx, []string{url}, event) {
+		}
+	}
+	<-w.Stable
+	require.NoError(t, w.SetPrivateKey(ctx, p2pkSk))
+
+	nutzap := func(proofs cashu.Proofs) *nostr.Event {
+		evt := nostr.Event{
+			CreatedAt: nostr.Now(),
+			Kind:      nostr.KindNutZap,
+			Tags:      nostr.Tags{{"p", pk}, {"u", mint.URL}},
+		}
+		for _, proof := range proofs {
+			j, _ := json.Marshal(proof)
+			evt.Tags = append(evt.Tags, nostr.Tag{"proof", string(j)})
+		}
+		require.NoError(t, evt.Sign(senderSk))
+		for res := range pool.PublishMany(ctx, []string{url}, evt) {
+			require.NoError(t, res.Error)
+		}
+		return &evt
+	}
+
+	good := nutzap(mint.IssueLocked(t, 3, p2pkPk))
+
+	forged := mint.IssueLocked(t, 4, p2pkPk)
+	forged[0].DLEQ.S = mint.IssueLocked(t, 4, p2pkPk)[0].DLEQ.S
+	bad := nutzap(forged)
+
+	run := func() map[string]uint64 {
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+
+		processed := make(map[string]uint64)
+		receiver := NewReceiver(w, pool, pk, Info{
+			PublicKey: p2pkPk,
+			Mints:     []string{mintURL},
+			Relays:    []string{url},
+		})
+		receiver.OnNutzap = func(nutzap *nostr.Event, amount uint64, err error) {
+			if nutzap.ID == bad.ID {
+				require.ErrorContains(t, err, "invalid DLEQ")
+			} else {
+				require.NoError(t, err)
+			}
+			processed[nutzap.ID] = amount
+		}
+		require.ErrorIs(t, receiver.Run(ctx), context.DeadlineExceeded)
+		return processed
+	}
+
+	processed := run()
+	require.Equal(t, map[string]uint64{good.ID: 3, bad.ID: 0}, processed)
+	require.Equal(t, uint64(3), w.Balance())
+
+	mu.Lock()
+	history := published[slices.IndexFunc(published, func(evt nostr.Event) bool { return evt.Kind == 7376 })]
+	mu.Unlock()
+	require.Contains(t, history.Tags, nostr.Tag{"e", good.ID, "", "redeemed"})
+	require.Contains(t, history.Tags, nostr.Tag{"p", good.PubKey})
+
+	// the next time the redeemed nutzap is skipped because of the history event on the relay
+	processed = run()
+	require.Equal(t, map[string]uint64{bad.ID: 0}, processed)
+	require.Equal(t, uint64(3), w.Balance())
+}
@@ -42,6 +42,10 @@ func verifyProofDLEQ(
 	proof cashu.Proof,
 	A *btcec.PublicKey,
 ) bool {
+	if proof.DLEQ == nil || A == nil {
+		return false
+	}
+
 	e, s, r, err := parseDLEQ(*proof.DLEQ)
 	if err != nil || r == nil {
 		return false
@@ -36,6 +36,9 @@ func (ilp *idlistpool) grab() []string {
 }
 
 func (ilp *idlistpool) giveback(idlist []string) {
+	ilp.Lock()
+	defer ilp.Unlock()
+
 	idlist = idlist[:0]
 	ilp.pool = append(ilp.pool, idlist)
 }
@@ -2,68 +2,86 @@ package nip77
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/nbd-wtf/go-nostr/nip77/negentropy"
 	"github.com/nbd-wtf/go-nostr/nip77/negentropy/storage/empty"
 )
 
+// FetchIDsOnly opens a new connection to the relay at url and returns the ids of all events that
+// match the given filter, without downloading them.
 func FetchIDsOnly(
 	ctx context.Context,
 	url string,
 	filter nostr.Filter,
 ) (<-chan string, error) {
-	id := "go-nostr-tmp" // for now we can't have more than one subscription in the same connection
+	r, err := nostr.RelayConnect(ctx, url)
+	if err != nil {
+		return nil, err
+	}
 
-	neg := negentropy.New(empty.Empty{}, 1024*1024)
-	result := make(chan error)
+	ch, err := FetchIDsOnlyRelay(ctx, r, filter)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
 
-	var r *nostr.Relay
-	r, err := nostr.RelayConnect(ctx, url, nostr.WithCustomHandler(func(data string) {
-		envelope := ParseNegMessage(data)
-		if envelope == nil {
-			return
+	out := make(chan string)
+	go func() {
+		for id := range ch {
+			out <- id
 		}
-		switch env := envelope.(type) {
-		case *OpenEnvelope, *CloseEnvelope:
-			result <- fmt.Errorf("unexpected %s received from relay", env.Label())
-			return
-		case *ErrorEnvelope:
-			result <- fmt.Errorf("relay returned a %s: %s", env.Label(), env.Reason)
-			return
-		case *MessageEnvelope:
-			nextmsg, err := neg.Reconcile(env.Message)
+		r.Close()
+		close(out)
+	}()
+
+	return out, nil
+}
+
+// FetchIDsOnlyRelay is like FetchIDsOnly, but uses an existing relay connection.
+func FetchIDsOnlyRelay(
+	ctx context.Context,
+	r *nostr.Relay,
+	filter nostr.Filter,
+) (<-chan string, error) {
+	neg := negentropy.New(empty.Empty{}, 1024*1024)
+
+	session, err := r.OpenNegentropy(ctx, filter, neg.Start())
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for msg := range session.Messages {
+			nextmsg, err := neg.Reconcile(msg)
 			if err != nil {
-				result <- fmt.Errorf("failed to reconcile: %w", err)
-				return
+				break
 			}
 
 			if nextmsg != "" {
-				msgb, _ := MessageEnvelope{id, nextmsg}.MarshalJSON()
-				r.Write(msgb)
+				if err := session.Send(nextmsg); err != nil {
+					break
+				}
 			}
 		}
-	}))
-	if err != nil {
-		return nil, err
-	}
-
-	msg := neg.Start()
-	open, _ := OpenEnvelope{id, filter, msg}.MarshalJSON()
-	err = <-r.Write(open)
-	if err != nil {
-		return nil, fmt.Errorf("failed to write to relay: %w", err)
-	}
+	}()
 
 	ch := make(chan string)
 	go func() {
-		for id := range neg.HaveNots {
-			ch <- id
+		defer close(ch)
+		defer session.Close()
+
+		for {
+			select {
+			case id, more := <-neg.HaveNots:
+				if !more {
+					return
+				}
+				ch <- id
+			case <-session.Context.Done():
+				return
+			}
 		}
-		clse, _ := CloseEnvelope{id}.MarshalJSON()
-		r.Write(clse)
-		close(ch)
 	}()
 
 	return ch, nil
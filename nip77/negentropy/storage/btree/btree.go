@@ -0,0 +1,474 @@
+// Package btree implements a negentropy.Storage that is kept on disk (or wherever the given
+// kvstore.KVStore keeps its data) as a B+tree in which every branch caches the item count and the
+// fingerprint accumulator of each of its children.
+//
+// Unlike the vector storage it doesn't have to be rebuilt before each sync: items can be inserted
+// and deleted incrementally as events are stored, and the same tree can be used for any number of
+// reconciliation sessions. Fingerprint() only has to descend to the two edges of the requested
+// range, so its cost is logarithmic on the number of items.
+package btree
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"iter"
+	"slices"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip77/negentropy"
+	"github.com/nbd-wtf/go-nostr/nip77/negentropy/storage"
+	"github.com/nbd-wtf/go-nostr/sdk/kvstore"
+)
+
+var _ negentropy.Storage = (*BTree)(nil)
+
+var metaKey = []byte("meta")
+
+// BTree is a negentropy.Storage backed by a kvstore.KVStore.
+//
+// A KVStore must not be shared between multiple trees. Items must not be inserted or deleted while
+// a reconciliation that uses the tree is in progress, as that would shift the positions negentropy
+// is working with.
+//
+// Since the negentropy.Storage interface has no way of reporting errors, its methods will panic if
+// the underlying KVStore fails or contains corrupted data.
+type BTree struct {
+	kv kvstore.KVStore
+
+	mu     sync.RWMutex
+	root   uint64
+	nextID uint64
+	count  int
+
+	leafCapacity   int
+	branchCapacity int
+}
+
+// New opens the tree stored in the given KVStore, or initializes an empty one if there is nothing there.
+func New(kv kvstore.KVStore) (*BTree, error) {
+	bt := &BTree{
+		kv:             kv,
+		leafCapacity:   128,
+		branchCapacity: 64,
+	}
+
+	meta, err := kv.Get(metaKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree metadata: %w", err)
+	}
+
+	if meta == nil {
+		bt.root = 1
+		bt.nextID = 2
+		if err := bt.save(&node{id: bt.root, leaf: true}); err != nil {
+			return nil, err
+		}
+		if err := bt.saveMeta(); err != nil {
+			return nil, err
+		}
+		return bt, nil
+	}
+
+	if len(meta) != 24 {
+		return nil, fmt.Errorf("tree metadata is corrupted")
+	}
+	bt.root = binary.BigEndian.Uint64(meta[0:8])
+	bt.nextID = binary.BigEndian.Uint64(meta[8:16])
+	bt.count = int(binary.BigEndian.Uint64(meta[16:24]))
+
+	return bt, nil
+}
+
+// Insert adds an item to the tree. Inserting an item that is already there is a no-op.
+func (bt *BTree) Insert(createdAt nostr.Timestamp, id string) error {
+	if !nostr.IsValid32ByteHex(id) {
+		return fmt.Errorf("bad id for added item: %q", id)
+	}
+
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	item := negentropy.Item{Timestamp: createdAt, ID: id}
+	sum, sibling, inserted, err := bt.insert(bt.root, item)
+	if err != nil {
+		return err
+	}
+	if !inserted {
+		return nil
+	}
+
+	if sibling != nil {
+		// the root was split, so the tree grows one level
+		root := &node{id: bt.allocate(), children: []child{sum, *sibling}}
+		if err := bt.save(root); err != nil {
+			return err
+		}
+		bt.root = root.id
+	}
+
+	bt.count++
+	return bt.saveMeta()
+}
+
+// Delete removes an item from the tree. Deleting an item that isn't there is a no-op.
+func (bt *BTree) Delete(createdAt nostr.Timestamp, id string) error {
+	if !nostr.IsValid32ByteHex(id) {
+		return fmt.Errorf("bad id for deleted item: %q", id)
+	}
+
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	item := negentropy.Item{Timestamp: createdAt, ID: id}
+	root, removed, err := bt.delete(bt.root, item)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return nil
+	}
+
+	// shrink the tree while the root is a branch with a single child
+	for !root.leaf && len(root.children) <= 1 {
+		if len(root.children) == 0 {
+			root = &node{id: root.id, leaf: true}
+			if err := bt.save(root); err != nil {
+				return err
+			}
+			break
+		}
+
+		if err := bt.kv.Delete(nodeKey(root.id)); err != nil {
+			return fmt.Errorf("failed to delete node %d: %w", root.id, err)
+		}
+		bt.root = root.children[0].id
+		if root, err = bt.load(bt.root); err != nil {
+			return err
+		}
+	}
+
+	bt.count--
+	return bt.saveMeta()
+}
+
+func (bt *BTree) Size() int {
+	bt.mu.RLock()
+	defer bt.mu.RUnlock()
+	return bt.count
+}
+
+func (bt *BTree) GetBound(idx int) negentropy.Bound {
+	bt.mu.RLock()
+	defer bt.mu.RUnlock()
+
+	if idx >= bt.count {
+		return negentropy.InfiniteBound
+	}
+	leaf, offset := bt.findRank(idx)
+	return negentropy.Bound{Item: leaf.items[offset]}
+}
+
+func (bt *BTree) Range(begin, end int) iter.Seq2[int, negentropy.Item] {
+	return func(yield func(int, negentropy.Item) bool) {
+		for i := begin; i < end; {
+			// only hold the lock while fetching each leaf so the consumer is free to call other methods
+			bt.mu.RLock()
+			leaf, offset := bt.findRank(i)
+			bt.mu.RUnlock()
+
+			for _, item := range leaf.items[offset:] {
+				if i >= end || !yield(i, item) {
+					return
+				}
+				i++
+			}
+		}
+	}
+}
+
+func (bt *BTree) FindLowerBound(begin, end int, bound negentropy.Bound) int {
+	bt.mu.RLock()
+	defer bt.mu.RUnlock()
+
+	n := bt.mustLoad(bt.root)
+	rank := 0
+	for !n.leaf {
+		i := n.route(bound.Item)
+		for _, c := range n.children[0:i] {
+			rank += c.count
+		}
+		n = bt.mustLoad(n.children[i].id)
+	}
+	idx, _ := slices.BinarySearchFunc(n.items, bound.Item, negentropy.ItemCompare)
+	rank += idx
+
+	return min(max(rank, begin), end)
+}
+
+func (bt *BTree) Fingerprint(begin, end int) string {
+	bt.mu.RLock()
+	defer bt.mu.RUnlock()
+
+	var acc storage.Accumulator
+	bt.accumulate(bt.root, begin, end, &acc)
+	return acc.GetFingerprint(end - begin)
+}
+
+// accumulate adds the ids of all items in the given range (relative to the node) to acc, using the
+// cached accumulators for all children that are entirely inside the range.
+func (bt *BTree) accumulate(id uint64, begin, end int, acc *storage.Accumulator) {
+	n := bt.mustLoad(id)
+
+	if n.leaf {
+		tmp := make([]byte, 32)
+		for _, item := range n.items[begin:end] {
+			hex.Decode(tmp, []byte(item.ID))
+			acc.AddBytes(tmp)
+		}
+		return
+	}
+
+	offset := 0
+	for _, c := range n.children {
+		cbegin, cend := offset, offset+c.count
+		offset = cend
+
+		if cend <= begin {
+			continue
+		}
+		if cbegin >= end {
+			break
+		}
+
+		if begin <= cbegin && cend <= end {
+			acc.AddAccumulator(c.acc)
+		} else {
+			bt.accumulate(c.id, max(begin, cbegin)-cbegin, min(end, cend)-cbegin, acc)
+		}
+	}
+}
+
+// findRank returns the leaf that contains the item at the given position and its offset in that leaf.
+func (bt *BTree) findRank(idx int) (*node, int) {
+	n := bt.mustLoad(bt.root)
+
+descend:
+	for !n.leaf {
+		for _, c := range n.children {
+			if idx < c.count {
+				n = bt.mustLoad(c.id)
+				continue descend
+			}
+			idx -= c.count
+		}
+		panic(fmt.Errorf("node %d is corrupted: position out of bounds", n.id))
+	}
+
+	if idx >= len(n.items) {
+		panic(fmt.Errorf("node %d is corrupted: position out of bounds", n.id))
+	}
+	return n, idx
+}
+
+func (bt *BTree) insert(id uint64, item negentropy.Item) (sum child, sibling *child, inserted bool, err error) {
+	n, err := bt.load(id)
+	if err != nil {
+		return child{}, nil, false, err
+	}
+
+	if n.leaf {
+		pos, found := slices.BinarySearchFunc(n.items, item, negentropy.ItemCompare)
+		if found {
+			return child{}, nil, false, nil
+		}
+		n.items = slices.Insert(n.items, pos, item)
+	} else {
+		i := n.route(item)
+		csum, csibling, inserted, err := bt.insert(n.children[i].id, item)
+		if err != nil || !inserted {
+			return child{}, nil, inserted, err
+		}
+		n.children[i] = csum
+		if csibling != nil {
+			n.children = slices.Insert(n.children, i+1, *csibling)
+		}
+	}
+
+	if n.size() > bt.capacity(n) {
+		right := bt.split(n)
+		if err := bt.save(right); err != nil {
+			return child{}, nil, false, err
+		}
+		rsum := right.summary()
+		sibling = &rsum
+	}
+
+	if err := bt.save(n); err != nil {
+		return child{}, nil, false, err
+	}
+	return n.summary(), sibling, true, nil
+}
+
+func (bt *BTree) delete(id uint64, item negentropy.Item) (*node, bool, error) {
+	n, err := bt.load(id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if n.leaf {
+		pos, found := slices.BinarySearchFunc(n.items, item, negentropy.ItemCompare)
+		if !found {
+			return n, false, nil
+		}
+		n.items = slices.Delete(n.items, pos, pos+1)
+	} else {
+		i := n.route(item)
+		c, removed, err := bt.delete(n.children[i].id, item)
+		if err != nil || !removed {
+			return n, removed, err
+		}
+		n.children[i] = c.summary()
+		if err := bt.rebalance(n, i, c); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := bt.save(n); err != nil {
+		return nil, false, err
+	}
+	return n, true, nil
+}
+
+// rebalance gets rid of the child at position i of the given branch if it became empty or merges it
+// with one of its neighbours if it became too small.
+func (bt *BTree) rebalance(parent *node, i int, c *node) error {
+	if c.size() == 0 {
+		if err := bt.kv.Delete(nodeKey(c.id)); err != nil {
+			return fmt.Errorf("failed to delete node %d: %w", c.id, err)
+		}
+		parent.children = slices.Delete(parent.children, i, i+1)
+		return nil
+	}
+
+	capacity := bt.capacity(c)
+	if c.size() >= capacity/4 || len(parent.children) == 1 {
+		return nil
+	}
+
+	li, ri := i, i+1
+	if ri == len(parent.children) {
+		li, ri = i-1, i
+	}
+	left, right := c, c
+	var err error
+	if li == i {
+		right, err = bt.load(parent.children[ri].id)
+	} else {
+		left, err = bt.load(parent.children[li].id)
+	}
+	if err != nil {
+		return err
+	}
+
+	if left.size()+right.size() > capacity {
+		return nil
+	}
+
+	left.items = append(left.items, right.items...)
+	left.children = append(left.children, right.children...)
+	if err := bt.save(left); err != nil {
+		return err
+	}
+	if err := bt.kv.Delete(nodeKey(right.id)); err != nil {
+		return fmt.Errorf("failed to delete node %d: %w", right.id, err)
+	}
+
+	parent.children[li] = left.summary()
+	parent.children = slices.Delete(parent.children, ri, ri+1)
+	return nil
+}
+
+// split moves the upper half of a node to a new node and returns it.
+func (bt *BTree) split(n *node) *node {
+	right := &node{id: bt.allocate(), leaf: n.leaf}
+	if n.leaf {
+		half := len(n.items) / 2
+		right.items = slices.Clone(n.items[half:])
+		n.items = slices.Clip(n.items[0:half])
+	} else {
+		half := len(n.children) / 2
+		right.children = slices.Clone(n.children[half:])
+		n.children = slices.Clip(n.children[0:half])
+	}
+	return right
+}
+
+// route returns the position of the child in which the given item is or should be.
+func (n *node) route(item negentropy.Item) int {
+	i, found := slices.BinarySearchFunc(n.children, item, func(c child, item negentropy.Item) int {
+		return negentropy.ItemCompare(c.min, item)
+	})
+	if !found && i > 0 {
+		i--
+	}
+	return i
+}
+
+func (bt *BTree) capacity(n *node) int {
+	if n.leaf {
+		return bt.leafCapacity
+	}
+	return bt.branchCapacity
+}
+
+func (bt *BTree) allocate() uint64 {
+	id := bt.nextID
+	bt.nextID++
+	return id
+}
+
+func (bt *BTree) load(id uint64) (*node, error) {
+	data, err := bt.kv.Get(nodeKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read node %d: %w", id, err)
+	}
+	if data == nil {
+		return nil, fmt.Errorf("node %d not found", id)
+	}
+	return decodeNode(id, data)
+}
+
+func (bt *BTree) mustLoad(id uint64) *node {
+	n, err := bt.load(id)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func (bt *BTree) save(n *node) error {
+	if err := bt.kv.Set(nodeKey(n.id), n.encode()); err != nil {
+		return fmt.Errorf("failed to write node %d: %w", n.id, err)
+	}
+	return nil
+}
+
+func (bt *BTree) saveMeta() error {
+	meta := make([]byte, 24)
+	binary.BigEndian.PutUint64(meta[0:8], bt.root)
+	binary.BigEndian.PutUint64(meta[8:16], bt.nextID)
+	binary.BigEndian.PutUint64(meta[16:24], uint64(bt.count))
+	if err := bt.kv.Set(metaKey, meta); err != nil {
+		return fmt.Errorf("failed to write tree metadata: %w", err)
+	}
+	return nil
+}
+
+func nodeKey(id uint64) []byte {
+	key := make([]byte, 9)
+	key[0] = 'n'
+	binary.BigEndian.PutUint64(key[1:], id)
+	return key
+}
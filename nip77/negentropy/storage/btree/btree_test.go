@@ -0,0 +1,182 @@
+package btree
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip77/negentropy"
+	"github.com/nbd-wtf/go-nostr/nip77/negentropy/storage/vector"
+	"github.com/nbd-wtf/go-nostr/sdk/kvstore/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func randomItems(n int) []negentropy.Item {
+	items := make([]negentropy.Item, n)
+	for i := range items {
+		items[i] = negentropy.Item{
+			// few distinct timestamps so ids also get to be compared
+			Timestamp: nostr.Timestamp(rand.IntN(n / 4)),
+			ID:        fmt.Sprintf("%016x%016x%016x%016x", rand.Uint64(), rand.Uint64(), rand.Uint64(), rand.Uint64()),
+		}
+	}
+	return items
+}
+
+func requireSameAsVector(t *testing.T, bt *BTree, items []negentropy.Item) {
+	t.Helper()
+
+	vec := vector.New()
+	for _, item := range items {
+		vec.Insert(item.Timestamp, item.ID)
+	}
+	vec.Seal()
+
+	size := vec.Size()
+	require.Equal(t, size, bt.Size())
+
+	for i := 0; i <= size; i++ {
+		require.Equal(t, vec.GetBound(i), bt.GetBound(i), "bound %d", i)
+	}
+
+	for range 200 {
+		begin := rand.IntN(size + 1)
+		end := begin + rand.IntN(size-begin+1)
+
+		require.Equal(t, vec.Fingerprint(begin, end), bt.Fingerprint(begin, end), "fingerprint %d-%d", begin, end)
+		require.Equal(t,
+			slices.Collect(func(yield func(negentropy.Item) bool) {
+				for _, item := range vec.Range(begin, end) {
+					yield(item)
+				}
+			}),
+			slices.Collect(func(yield func(negentropy.Item) bool) {
+				for _, item := range bt.Range(begin, end) {
+					yield(item)
+				}
+			}),
+		)
+
+		bound := negentropy.Bound{Item: negentropy.Item{Timestamp: nostr.Timestamp(rand.IntN(size/4 + 1))}}
+		if rand.IntN(2) == 0 && size > 0 {
+			bound = vec.GetBound(rand.IntN(size))
+		}
+		require.Equal(t, vec.FindLowerBound(begin, end, bound), bt.FindLowerBound(begin, end, bound), "lower bound %s", bound)
+	}
+}
+
+func TestMatchesVector(t *testing.T) {
+	kv := memory.NewStore()
+	bt, err := New(kv)
+	require.NoError(t, err)
+	bt.leafCapacity = 4
+	bt.branchCapacity = 4
+
+	items := randomItems(1000)
+	for _, item := range items {
+		require.NoError(t, bt.Insert(item.Timestamp, item.ID))
+	}
+	// duplicates are ignored
+	for _, item := range items[0:100] {
+		require.NoError(t, bt.Insert(item.Timestamp, item.ID))
+	}
+	requireSameAsVector(t, bt, items)
+
+	// delete some in random order, including some that aren't there
+	rand.Shuffle(len(items), func(i, j int) { items[i], items[j] = items[j], items[i] })
+	for _, item := range items[0:700] {
+		require.NoError(t, bt.Delete(item.Timestamp, item.ID))
+	}
+	require.NoError(t, bt.Delete(items[0].Timestamp, items[0].ID))
+	items = items[700:]
+	requireSameAsVector(t, bt, items)
+
+	// reopen from the same store
+	bt, err = New(kv)
+	require.NoError(t, err)
+	bt.leafCapacity = 4
+	bt.branchCapacity = 4
+	requireSameAsVector(t, bt, items)
+
+	more := randomItems(500)
+	for _, item := range more {
+		require.NoError(t, bt.Insert(item.Timestamp, item.ID))
+	}
+	items = append(items, more...)
+	requireSameAsVector(t, bt, items)
+
+	// delete everything
+	for _, item := range items {
+		require.NoError(t, bt.Delete(item.Timestamp, item.ID))
+	}
+	requireSameAsVector(t, bt, nil)
+
+	require.Error(t, bt.Insert(1, "abc"))
+}
+
+func TestReconcileAgainstVector(t *testing.T) {
+	items := randomItems(5000)
+
+	bt, err := New(memory.NewStore())
+	require.NoError(t, err)
+	for _, item := range items[0:4000] {
+		require.NoError(t, bt.Insert(item.Timestamp, item.ID))
+	}
+
+	vec := vector.New()
+	for _, item := range items[1000:5000] {
+		vec.Insert(item.Timestamp, item.ID)
+	}
+	vec.Seal()
+
+	// run it twice to ensure the tree is reusable
+	for range 2 {
+		n1 := negentropy.New(bt, 1<<16)
+		n2 := negentropy.New(vec, 1<<16)
+
+		haves := make(chan []string)
+		go func() { haves <- slices.Collect(chanSeq(n1.Haves)) }()
+		havenots := make(chan []string)
+		go func() { havenots <- slices.Collect(chanSeq(n1.HaveNots)) }()
+
+		q := n1.Start()
+		for n := n2; q != ""; {
+			q, err = n.Reconcile(q)
+			require.NoError(t, err)
+			if n == n1 {
+				n = n2
+			} else {
+				n = n1
+			}
+		}
+
+		expectedHaves := make([]string, 0, 1000)
+		for _, item := range items[0:1000] {
+			expectedHaves = append(expectedHaves, item.ID)
+		}
+		expectedHaveNots := make([]string, 0, 1000)
+		for _, item := range items[4000:5000] {
+			expectedHaveNots = append(expectedHaveNots, item.ID)
+		}
+
+		require.ElementsMatch(t, expectedHaves, unique(<-haves))
+		require.ElementsMatch(t, expectedHaveNots, unique(<-havenots))
+	}
+}
+
+func chanSeq(ch chan string) func(yield func(string) bool) {
+	return func(yield func(string) bool) {
+		for v := range ch {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+func unique(ids []string) []string {
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
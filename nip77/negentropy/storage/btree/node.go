@@ -0,0 +1,133 @@
+package btree
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip77/negentropy"
+	"github.com/nbd-wtf/go-nostr/nip77/negentropy/storage"
+)
+
+const (
+	itemSize  = 8 + 32
+	childSize = 8 + 8 + itemSize + 32
+)
+
+// node is either a leaf, holding sorted items, or a branch, holding a summary of each of its children.
+type node struct {
+	id       uint64
+	leaf     bool
+	items    []negentropy.Item
+	children []child
+}
+
+// child is what a branch knows about each of its children: enough to locate items by rank,
+// to route searches by value and to compute fingerprints without descending.
+type child struct {
+	id    uint64
+	count int
+	min   negentropy.Item
+	acc   storage.Accumulator
+}
+
+func (n *node) size() int {
+	if n.leaf {
+		return len(n.items)
+	}
+	return len(n.children)
+}
+
+// summary computes the entry that should represent this node in its parent.
+func (n *node) summary() child {
+	c := child{id: n.id}
+	if n.leaf {
+		c.count = len(n.items)
+		if len(n.items) > 0 {
+			c.min = n.items[0]
+		}
+		tmp := make([]byte, 32)
+		for _, item := range n.items {
+			hex.Decode(tmp, []byte(item.ID))
+			c.acc.AddBytes(tmp)
+		}
+	} else {
+		if len(n.children) > 0 {
+			c.min = n.children[0].min
+		}
+		for _, ch := range n.children {
+			c.count += ch.count
+			c.acc.AddAccumulator(ch.acc)
+		}
+	}
+	return c
+}
+
+func (n *node) encode() []byte {
+	if n.leaf {
+		buf := make([]byte, 1+4, 1+4+len(n.items)*itemSize)
+		buf[0] = 'l'
+		binary.BigEndian.PutUint32(buf[1:], uint32(len(n.items)))
+		for _, item := range n.items {
+			buf = appendItem(buf, item)
+		}
+		return buf
+	}
+
+	buf := make([]byte, 1+4, 1+4+len(n.children)*childSize)
+	buf[0] = 'b'
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(n.children)))
+	for _, ch := range n.children {
+		buf = binary.BigEndian.AppendUint64(buf, ch.id)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(ch.count))
+		buf = appendItem(buf, ch.min)
+		buf = append(buf, ch.acc.Buf[0:32]...)
+	}
+	return buf
+}
+
+func decodeNode(id uint64, buf []byte) (*node, error) {
+	if len(buf) < 5 {
+		return nil, fmt.Errorf("node %d is too short", id)
+	}
+	n := &node{id: id}
+	kind := buf[0]
+	size := int(binary.BigEndian.Uint32(buf[1:]))
+	buf = buf[5:]
+
+	switch {
+	case kind == 'l' && len(buf) == size*itemSize:
+		n.leaf = true
+		n.items = make([]negentropy.Item, size)
+		for i := range n.items {
+			n.items[i] = decodeItem(buf[i*itemSize:])
+		}
+	case kind == 'b' && len(buf) == size*childSize:
+		n.children = make([]child, size)
+		for i := range n.children {
+			b := buf[i*childSize:]
+			n.children[i].id = binary.BigEndian.Uint64(b[0:8])
+			n.children[i].count = int(binary.BigEndian.Uint64(b[8:16]))
+			n.children[i].min = decodeItem(b[16:])
+			copy(n.children[i].acc.Buf[0:32], b[16+itemSize:16+itemSize+32])
+		}
+	default:
+		return nil, fmt.Errorf("node %d is corrupted", id)
+	}
+
+	return n, nil
+}
+
+func appendItem(buf []byte, item negentropy.Item) []byte {
+	buf = binary.BigEndian.AppendUint64(buf, uint64(item.Timestamp))
+	buf, _ = hex.AppendDecode(buf, []byte(item.ID))
+	return buf
+}
+
+func decodeItem(b []byte) negentropy.Item {
+	return negentropy.Item{
+		Timestamp: nostr.Timestamp(binary.BigEndian.Uint64(b[0:8])),
+		ID:        hex.EncodeToString(b[8:40]),
+	}
+}
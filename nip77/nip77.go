@@ -2,6 +2,7 @@ package nip77
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 
@@ -25,6 +26,8 @@ const (
 	Both = 2
 )
 
+// NegentropySync opens a new connection to the relay at url and reconciles the events matching filter
+// between it and the local store, in the given direction.
 func NegentropySync(
 	ctx context.Context,
 	store nostr.RelayStore,
@@ -32,62 +35,159 @@ func NegentropySync(
 	filter nostr.Filter,
 	dir Direction,
 ) error {
-	id := "go-nostr-tmp" // for now we can't have more than one subscription in the same connection
+	r, err := nostr.RelayConnect(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return NegentropySyncRelay(ctx, store, r, filter, dir)
+}
 
+// NegentropySyncRelay is like NegentropySync, but uses an existing relay connection, which can be
+// shared with other syncs and normal subscriptions at the same time.
+func NegentropySyncRelay(
+	ctx context.Context,
+	store nostr.RelayStore,
+	r *nostr.Relay,
+	filter nostr.Filter,
+	dir Direction,
+) error {
 	data, err := store.QuerySync(ctx, filter)
 	if err != nil {
 		return fmt.Errorf("failed to query our local store: %w", err)
 	}
 
+	return syncWithData(ctx, store, r, filter, dir, data)
+}
+
+// NegentropySyncMany reconciles the local store against all the given relays concurrently, using
+// (and reusing) the relay connections managed by pool.
+func NegentropySyncMany(
+	ctx context.Context,
+	pool *nostr.SimplePool,
+	urls []string,
+	filter nostr.Filter,
+	store nostr.RelayStore,
+	dir Direction,
+) error {
+	data, err := store.QuerySync(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to query our local store: %w", err)
+	}
+
+	errs := make([]error, len(urls))
+	wg := sync.WaitGroup{}
+	wg.Add(len(urls))
+	for i, url := range urls {
+		go func() {
+			defer wg.Done()
+
+			r, err := pool.EnsureRelay(url)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", url, err)
+				return
+			}
+
+			if err := syncWithData(ctx, store, r, filter, dir, data); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", url, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func syncWithData(
+	ctx context.Context,
+	store nostr.RelayStore,
+	r *nostr.Relay,
+	filter nostr.Filter,
+	dir Direction,
+	data []*nostr.Event,
+) error {
 	vec := vector.New()
-	neg := negentropy.New(vec, 1024*1024)
 	for _, evt := range data {
 		vec.Insert(evt.CreatedAt, evt.ID)
 	}
 	vec.Seal()
 
-	result := make(chan error)
+	return syncWithStorage(ctx, store, r, filter, dir, vec)
+}
+
+// NegentropySyncStorage is like NegentropySyncRelay, but instead of loading the ids of all local events
+// matching filter into memory it uses the given storage, which must contain exactly these, like a
+// btree.BTree that is kept up-to-date as events are saved.
+//
+// If the storage has an Insert(nostr.Timestamp, string) error method (as btree.BTree does), the events
+// downloaded during the sync will be inserted into it at the end.
+func NegentropySyncStorage(
+	ctx context.Context,
+	store nostr.RelayStore,
+	storage negentropy.Storage,
+	r *nostr.Relay,
+	filter nostr.Filter,
+	dir Direction,
+) error {
+	return syncWithStorage(ctx, store, r, filter, dir, storage)
+}
+
+type insertableStorage interface {
+	Insert(createdAt nostr.Timestamp, id string) error
+}
 
-	var r *nostr.Relay
-	r, err = nostr.RelayConnect(ctx, url, nostr.WithCustomHandler(func(data string) {
-		envelope := ParseNegMessage(data)
-		if envelope == nil {
-			return
+func syncWithStorage(
+	ctx context.Context,
+	store nostr.RelayStore,
+	r *nostr.Relay,
+	filter nostr.Filter,
+	dir Direction,
+	storage negentropy.Storage,
+) error {
+	neg := negentropy.New(storage, 1024*1024)
+
+	// items downloaded can only be added to the storage after the reconciliation is done
+	insertable, _ := storage.(insertableStorage)
+	downloaded := make([]negentropy.Item, 0, 50)
+	downloadedMu := sync.Mutex{}
+
+	// there may be more than one sender here but we only care about the first
+	result := make(chan error, 1)
+	report := func(err error) {
+		select {
+		case result <- err:
+		default:
 		}
-		switch env := envelope.(type) {
-		case *OpenEnvelope, *CloseEnvelope:
-			result <- fmt.Errorf("unexpected %s received from relay", env.Label())
-			return
-		case *ErrorEnvelope:
-			result <- fmt.Errorf("relay returned a %s: %s", env.Label(), env.Reason)
-			return
-		case *MessageEnvelope:
-			nextmsg, err := neg.Reconcile(env.Message)
+	}
+
+	session, err := r.OpenNegentropy(ctx, filter, neg.Start())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	go func() {
+		for msg := range session.Messages {
+			nextmsg, err := neg.Reconcile(msg)
 			if err != nil {
-				result <- fmt.Errorf("failed to reconcile: %w", err)
+				report(fmt.Errorf("failed to reconcile: %w", err))
 				return
 			}
 
 			if nextmsg != "" {
-				msgb, _ := MessageEnvelope{id, nextmsg}.MarshalJSON()
-				r.Write(msgb)
+				if err := session.Send(nextmsg); err != nil {
+					report(fmt.Errorf("failed to write to relay: %w", err))
+					return
+				}
 			}
 		}
-	}))
-	if err != nil {
-		return err
-	}
-
-	msg := neg.Start()
-	open, _ := OpenEnvelope{id, filter, msg}.MarshalJSON()
-	err = <-r.Write(open)
-	if err != nil {
-		return fmt.Errorf("failed to write to relay: %w", err)
-	}
+	}()
 
-	defer func() {
-		clse, _ := CloseEnvelope{id}.MarshalJSON()
-		r.Write(clse)
+	go func() {
+		// this will only happen before the end of the sync if the relay sends a NEG-ERR or disconnects
+		<-session.Context.Done()
+		report(context.Cause(session.Context))
 	}()
 
 	wg := sync.WaitGroup{}
@@ -116,11 +216,18 @@ func NegentropySync(
 				}
 				evtch, err := dir.source.QueryEvents(ctx, nostr.Filter{IDs: ids})
 				if err != nil {
-					result <- fmt.Errorf("error querying source on %s: %w", dir.label, err)
+					report(fmt.Errorf("error querying source on %s: %w", dir.label, err))
 					return
 				}
 				for evt := range evtch {
-					dir.target.Publish(ctx, *evt)
+					if err := dir.target.Publish(ctx, *evt); err != nil {
+						continue
+					}
+					if insertable != nil && dir.label == "down" {
+						downloadedMu.Lock()
+						downloaded = append(downloaded, negentropy.Item{Timestamp: evt.CreatedAt, ID: evt.ID})
+						downloadedMu.Unlock()
+					}
 				}
 			}
 
@@ -145,13 +252,20 @@ func NegentropySync(
 
 	go func() {
 		wg.Wait()
-		result <- nil
+		report(nil)
 	}()
 
-	err = <-result
-	if err != nil {
+	if err := <-result; err != nil {
 		return err
 	}
 
+	downloadedMu.Lock()
+	defer downloadedMu.Unlock()
+	for _, item := range downloaded {
+		if err := insertable.Insert(item.Timestamp, item.ID); err != nil {
+			return fmt.Errorf("failed to add %s to storage: %w", item.ID, err)
+		}
+	}
+
 	return nil
 }
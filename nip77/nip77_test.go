@@ -0,0 +1,231 @@
+package nip77_test
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fiatjaf/eventstore/slicestore"
+	"github.com/fiatjaf/khatru"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip77"
+	"github.com/nbd-wtf/go-nostr/nip77/negentropy/storage/btree"
+	"github.com/nbd-wtf/go-nostr/sdk/kvstore/memory"
+	"github.com/stretchr/testify/require"
+)
+
+// lockedStore wraps a slicestore so it can be safely used from many goroutines at the same time
+type lockedStore struct {
+	sync.Mutex
+	db *slicestore.SliceStore
+}
+
+func newLockedStore() *lockedStore {
+	db := &slicestore.SliceStore{}
+	db.Init()
+	return &lockedStore{db: db}
+}
+
+func (ls *lockedStore) SaveEvent(ctx context.Context, evt *nostr.Event) error {
+	ls.Lock()
+	defer ls.Unlock()
+	return ls.db.SaveEvent(ctx, evt)
+}
+
+func (ls *lockedStore) QueryEvents(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error) {
+	results, err := ls.QuerySync(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *nostr.Event, len(results))
+	for _, evt := range results {
+		ch <- evt
+	}
+	close(ch)
+	return ch, nil
+}
+
+func (ls *lockedStore) QuerySync(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error) {
+	ls.Lock()
+	defer ls.Unlock()
+	ch, err := ls.db.QueryEvents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*nostr.Event, 0, 30)
+	for evt := range ch {
+		results = append(results, evt)
+	}
+	return results, nil
+}
+
+func (ls *lockedStore) Publish(ctx context.Context, evt nostr.Event) error {
+	return ls.SaveEvent(ctx, &evt)
+}
+
+func startRelay(t *testing.T) (string, *lockedStore) {
+	t.Helper()
+
+	db := newLockedStore()
+	relay := khatru.NewRelay()
+	relay.Negentropy = true
+	relay.QueryEvents = append(relay.QueryEvents, db.QueryEvents)
+	relay.StoreEvent = append(relay.StoreEvent, db.SaveEvent)
+	server := httptest.NewServer(relay)
+	t.Cleanup(server.Close)
+
+	return "ws" + strings.TrimPrefix(server.URL, "http"), db
+}
+
+func makeEvents(t *testing.T, kind int, n int) []*nostr.Event {
+	t.Helper()
+
+	sk := nostr.GeneratePrivateKey()
+	events := make([]*nostr.Event, n)
+	for i := range events {
+		evt := &nostr.Event{
+			Kind:      kind,
+			Content:   fmt.Sprintf("hello %d", i),
+			CreatedAt: nostr.Timestamp(1700000000 + i),
+		}
+		require.NoError(t, evt.Sign(sk))
+		events[i] = evt
+	}
+	return events
+}
+
+func countEvents(t *testing.T, store nostr.RelayStore, filter nostr.Filter) int {
+	t.Helper()
+	events, err := store.QuerySync(context.Background(), filter)
+	require.NoError(t, err)
+	return len(events)
+}
+
+func TestConcurrentSessionsOnSameConnection(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	url, remote := startRelay(t)
+	local := newLockedStore()
+
+	notes := makeEvents(t, 1, 30)
+	reactions := makeEvents(t, 7, 30)
+	for i := range 30 {
+		if i%2 == 0 {
+			remote.SaveEvent(ctx, notes[i])
+			local.SaveEvent(ctx, reactions[i])
+		} else {
+			local.SaveEvent(ctx, notes[i])
+			remote.SaveEvent(ctx, reactions[i])
+		}
+	}
+
+	r, err := nostr.RelayConnect(ctx, url)
+	require.NoError(t, err)
+	defer r.Close()
+
+	// a normal subscription running alongside the syncs
+	sub, err := r.Subscribe(ctx, nostr.Filters{{Kinds: []int{1}}})
+	require.NoError(t, err)
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		err := nip77.NegentropySyncRelay(ctx, local, r, nostr.Filter{Kinds: []int{1}}, nip77.Down)
+		require.NoError(t, err)
+	}()
+	go func() {
+		defer wg.Done()
+		err := nip77.NegentropySyncRelay(ctx, local, r, nostr.Filter{Kinds: []int{7}}, nip77.Up)
+		require.NoError(t, err)
+	}()
+
+	received := 0
+	for range sub.Events {
+		received++
+		if received == 15 {
+			break
+		}
+	}
+	wg.Wait()
+
+	require.Equal(t, 30, countEvents(t, local, nostr.Filter{Kinds: []int{1}}))
+	require.Equal(t, 15, countEvents(t, local, nostr.Filter{Kinds: []int{7}}))
+	require.Equal(t, 30, countEvents(t, remote, nostr.Filter{Kinds: []int{7}}))
+}
+
+func TestNegentropySyncMany(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	url1, remote1 := startRelay(t)
+	url2, remote2 := startRelay(t)
+
+	local := newLockedStore()
+
+	events := makeEvents(t, 1, 30)
+	for i, evt := range events {
+		switch i % 3 {
+		case 0:
+			local.SaveEvent(ctx, evt)
+		case 1:
+			remote1.SaveEvent(ctx, evt)
+		case 2:
+			remote2.SaveEvent(ctx, evt)
+		}
+	}
+
+	pool := nostr.NewSimplePool(ctx)
+	err := nip77.NegentropySyncMany(ctx, pool, []string{url1, url2}, nostr.Filter{Kinds: []int{1}}, local, nip77.Both)
+	require.NoError(t, err)
+
+	require.Equal(t, 30, countEvents(t, local, nostr.Filter{}))
+
+	ids, err := nip77.FetchIDsOnly(ctx, url1, nostr.Filter{Kinds: []int{1}})
+	require.NoError(t, err)
+	n := 0
+	for range ids {
+		n++
+	}
+	require.Equal(t, 20, n, "relay 1 should have its own events plus our local ones")
+}
+
+func TestNegentropySyncStorage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	url, remote := startRelay(t)
+	local := newLockedStore()
+	tree, err := btree.New(memory.NewStore())
+	require.NoError(t, err)
+
+	events := makeEvents(t, 1, 40)
+	for i, evt := range events {
+		if i < 25 {
+			local.SaveEvent(ctx, evt)
+			require.NoError(t, tree.Insert(evt.CreatedAt, evt.ID))
+		}
+		if i >= 15 {
+			remote.SaveEvent(ctx, evt)
+		}
+	}
+
+	r, err := nostr.RelayConnect(ctx, url)
+	require.NoError(t, err)
+	defer r.Close()
+
+	filter := nostr.Filter{Kinds: []int{1}}
+	require.NoError(t, nip77.NegentropySyncStorage(ctx, local, tree, r, filter, nip77.Both))
+	require.Equal(t, 40, countEvents(t, local, filter))
+	require.Equal(t, 40, countEvents(t, remote, filter))
+	require.Equal(t, 40, tree.Size(), "downloaded events should have been added to the tree")
+
+	// a second sync with the same tree has nothing to do
+	require.NoError(t, nip77.NegentropySyncStorage(ctx, local, tree, r, filter, nip77.Both))
+	require.Equal(t, 40, tree.Size())
+}
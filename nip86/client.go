@@ -0,0 +1,192 @@
+package nip86
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip98"
+)
+
+var json = jsoniter.ConfigFastest
+
+// Client calls the NIP-86 management API of a relay, authenticating every request with NIP-98.
+type Client struct {
+	URL        string
+	Signer     nostr.Signer
+	HTTPClient *http.Client
+}
+
+// NewClient takes the relay URL (ws:// or wss:// URLs are converted to http:// or https://).
+func NewClient(relayURL string, signer nostr.Signer) *Client {
+	url := nostr.NormalizeURL(relayURL)
+	url = strings.Replace(url, "ws://", "http://", 1)
+	url = strings.Replace(url, "wss://", "https://", 1)
+
+	return &Client{
+		URL:        url,
+		Signer:     signer,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// Call performs any request and decodes its result into the given pointer, which can be nil if the
+// result is not needed.
+func (c *Client) Call(ctx context.Context, params MethodParams, result any) error {
+	body, err := json.Marshal(EncodeRequest(params))
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	hash := sha256.Sum256(body)
+	auth, err := nip98.MakeAuthHeader(ctx, c.Signer, c.URL, "POST", hash[:])
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/nostr+json+rpc")
+	req.Header.Set("Authorization", auth)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %w", c.URL, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<24))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var response struct {
+		Result jsoniter.RawMessage `json:"result"`
+		Error  string              `json:"error"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("got status %d from %s", resp.StatusCode, c.URL)
+		}
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if response.Error != "" {
+		return fmt.Errorf("%s: %s", params.MethodName(), response.Error)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("got status %d from %s", resp.StatusCode, c.URL)
+	}
+
+	if result != nil && len(response.Result) > 0 {
+		if err := json.Unmarshal(response.Result, result); err != nil {
+			return fmt.Errorf("failed to decode result: %w", err)
+		}
+	}
+	return nil
+}
+
+func call[T any](ctx context.Context, c *Client, params MethodParams) (T, error) {
+	var result T
+	err := c.Call(ctx, params, &result)
+	return result, err
+}
+
+func (c *Client) SupportedMethods(ctx context.Context) ([]string, error) {
+	return call[[]string](ctx, c, SupportedMethods{})
+}
+
+func (c *Client) BanPubKey(ctx context.Context, pubkey string, reason string) error {
+	return c.Call(ctx, BanPubKey{pubkey, reason}, nil)
+}
+
+func (c *Client) ListBannedPubKeys(ctx context.Context) ([]PubKeyReason, error) {
+	return call[[]PubKeyReason](ctx, c, ListBannedPubKeys{})
+}
+
+func (c *Client) AllowPubKey(ctx context.Context, pubkey string, reason string) error {
+	return c.Call(ctx, AllowPubKey{pubkey, reason}, nil)
+}
+
+func (c *Client) ListAllowedPubKeys(ctx context.Context) ([]PubKeyReason, error) {
+	return call[[]PubKeyReason](ctx, c, ListAllowedPubKeys{})
+}
+
+func (c *Client) ListEventsNeedingModeration(ctx context.Context) ([]IDReason, error) {
+	return call[[]IDReason](ctx, c, ListEventsNeedingModeration{})
+}
+
+func (c *Client) AllowEvent(ctx context.Context, id string, reason string) error {
+	return c.Call(ctx, AllowEvent{id, reason}, nil)
+}
+
+func (c *Client) BanEvent(ctx context.Context, id string, reason string) error {
+	return c.Call(ctx, BanEvent{id, reason}, nil)
+}
+
+func (c *Client) ListBannedEvents(ctx context.Context) ([]IDReason, error) {
+	return call[[]IDReason](ctx, c, ListBannedEvents{})
+}
+
+func (c *Client) ListAllowedEvents(ctx context.Context) ([]IDReason, error) {
+	return call[[]IDReason](ctx, c, ListAllowedEvents{})
+}
+
+func (c *Client) ChangeRelayName(ctx context.Context, name string) error {
+	return c.Call(ctx, ChangeRelayName{name}, nil)
+}
+
+func (c *Client) ChangeRelayDescription(ctx context.Context, description string) error {
+	return c.Call(ctx, ChangeRelayDescription{description}, nil)
+}
+
+func (c *Client) ChangeRelayIcon(ctx context.Context, iconURL string) error {
+	return c.Call(ctx, ChangeRelayIcon{iconURL}, nil)
+}
+
+func (c *Client) AllowKind(ctx context.Context, kind int) error {
+	return c.Call(ctx, AllowKind{kind}, nil)
+}
+
+func (c *Client) DisallowKind(ctx context.Context, kind int) error {
+	return c.Call(ctx, DisallowKind{kind}, nil)
+}
+
+func (c *Client) ListAllowedKinds(ctx context.Context) ([]int, error) {
+	return call[[]int](ctx, c, ListAllowedKinds{})
+}
+
+func (c *Client) ListDisallowedKinds(ctx context.Context) ([]int, error) {
+	return call[[]int](ctx, c, ListDisallowedKinds{})
+}
+
+func (c *Client) BlockIP(ctx context.Context, ip net.IP, reason string) error {
+	return c.Call(ctx, BlockIP{ip, reason}, nil)
+}
+
+func (c *Client) UnblockIP(ctx context.Context, ip net.IP, reason string) error {
+	return c.Call(ctx, UnblockIP{ip, reason}, nil)
+}
+
+func (c *Client) ListBlockedIPs(ctx context.Context) ([]IPReason, error) {
+	return call[[]IPReason](ctx, c, ListBlockedIPs{})
+}
+
+func (c *Client) GrantAdmin(ctx context.Context, pubkey string, methods []string) error {
+	return c.Call(ctx, GrantAdmin{pubkey, methods}, nil)
+}
+
+func (c *Client) RevokeAdmin(ctx context.Context, pubkey string, methods []string) error {
+	return c.Call(ctx, RevokeAdmin{pubkey, methods}, nil)
+}
+
+func (c *Client) Stats(ctx context.Context) (map[string]any, error) {
+	return call[map[string]any](ctx, c, Stats{})
+}
@@ -0,0 +1,279 @@
+package nip86
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr/nip98"
+)
+
+// Management is implemented by relays that want to be managed through NIP-86. There is one method for
+// each MethodParams. Embed UnimplementedManagement to implement only some of them.
+type Management interface {
+	SupportedMethods(ctx context.Context) ([]string, error)
+	BanPubKey(ctx context.Context, params BanPubKey) error
+	ListBannedPubKeys(ctx context.Context) ([]PubKeyReason, error)
+	AllowPubKey(ctx context.Context, params AllowPubKey) error
+	ListAllowedPubKeys(ctx context.Context) ([]PubKeyReason, error)
+	ListEventsNeedingModeration(ctx context.Context) ([]IDReason, error)
+	AllowEvent(ctx context.Context, params AllowEvent) error
+	BanEvent(ctx context.Context, params BanEvent) error
+	ListBannedEvents(ctx context.Context) ([]IDReason, error)
+	ListAllowedEvents(ctx context.Context) ([]IDReason, error)
+	ChangeRelayName(ctx context.Context, params ChangeRelayName) error
+	ChangeRelayDescription(ctx context.Context, params ChangeRelayDescription) error
+	ChangeRelayIcon(ctx context.Context, params ChangeRelayIcon) error
+	AllowKind(ctx context.Context, params AllowKind) error
+	DisallowKind(ctx context.Context, params DisallowKind) error
+	ListAllowedKinds(ctx context.Context) ([]int, error)
+	ListDisallowedKinds(ctx context.Context) ([]int, error)
+	BlockIP(ctx context.Context, params BlockIP) error
+	UnblockIP(ctx context.Context, params UnblockIP) error
+	ListBlockedIPs(ctx context.Context) ([]IPReason, error)
+	GrantAdmin(ctx context.Context, params GrantAdmin) error
+	RevokeAdmin(ctx context.Context, params RevokeAdmin) error
+	Stats(ctx context.Context) (map[string]any, error)
+}
+
+var ErrNotImplemented = errors.New("method not implemented")
+
+var _ Management = UnimplementedManagement{}
+
+// UnimplementedManagement returns ErrNotImplemented for everything.
+type UnimplementedManagement struct{}
+
+func (UnimplementedManagement) SupportedMethods(context.Context) ([]string, error) {
+	return []string{}, nil
+}
+
+func (UnimplementedManagement) BanPubKey(context.Context, BanPubKey) error {
+	return ErrNotImplemented
+}
+
+func (UnimplementedManagement) ListBannedPubKeys(context.Context) ([]PubKeyReason, error) {
+	return nil, ErrNotImplemented
+}
+
+func (UnimplementedManagement) AllowPubKey(context.Context, AllowPubKey) error {
+	return ErrNotImplemented
+}
+
+func (UnimplementedManagement) ListAllowedPubKeys(context.Context) ([]PubKeyReason, error) {
+	return nil, ErrNotImplemented
+}
+
+func (UnimplementedManagement) ListEventsNeedingModeration(context.Context) ([]IDReason, error) {
+	return nil, ErrNotImplemented
+}
+
+func (UnimplementedManagement) AllowEvent(context.Context, AllowEvent) error {
+	return ErrNotImplemented
+}
+
+func (UnimplementedManagement) BanEvent(context.Context, BanEvent) error {
+	return ErrNotImplemented
+}
+
+func (UnimplementedManagement) ListBannedEvents(context.Context) ([]IDReason, error) {
+	return nil, ErrNotImplemented
+}
+
+func (UnimplementedManagement) ListAllowedEvents(context.Context) ([]IDReason, error) {
+	return nil, ErrNotImplemented
+}
+
+func (UnimplementedManagement) ChangeRelayName(context.Context, ChangeRelayName) error {
+	return ErrNotImplemented
+}
+
+func (UnimplementedManagement) ChangeRelayDescription(context.Context, ChangeRelayDescription) error {
+	return ErrNotImplemented
+}
+
+func (UnimplementedManagement) ChangeRelayIcon(context.Context, ChangeRelayIcon) error {
+	return ErrNotImplemented
+}
+
+func (UnimplementedManagement) AllowKind(context.Context, AllowKind) error {
+	return ErrNotImplemented
+}
+
+func (UnimplementedManagement) DisallowKind(context.Context, DisallowKind) error {
+	return ErrNotImplemented
+}
+
+func (UnimplementedManagement) ListAllowedKinds(context.Context) ([]int, error) {
+	return nil, ErrNotImplemented
+}
+
+func (UnimplementedManagement) ListDisallowedKinds(context.Context) ([]int, error) {
+	return nil, ErrNotImplemented
+}
+
+func (UnimplementedManagement) BlockIP(context.Context, BlockIP) error {
+	return ErrNotImplemented
+}
+
+func (UnimplementedManagement) UnblockIP(context.Context, UnblockIP) error {
+	return ErrNotImplemented
+}
+
+func (UnimplementedManagement) ListBlockedIPs(context.Context) ([]IPReason, error) {
+	return nil, ErrNotImplemented
+}
+
+func (UnimplementedManagement) GrantAdmin(context.Context, GrantAdmin) error {
+	return ErrNotImplemented
+}
+
+func (UnimplementedManagement) RevokeAdmin(context.Context, RevokeAdmin) error {
+	return ErrNotImplemented
+}
+
+func (UnimplementedManagement) Stats(context.Context) (map[string]any, error) {
+	return nil, ErrNotImplemented
+}
+
+type authedKey struct{}
+
+// GetAuthedPubKey returns the pubkey that has signed the request, to be used inside Management methods.
+func GetAuthedPubKey(ctx context.Context) string {
+	pubkey, _ := ctx.Value(authedKey{}).(string)
+	return pubkey
+}
+
+// Handler is an http.Handler that serves NIP-86 requests by dispatching them to a Management.
+type Handler struct {
+	Management Management
+
+	// Authorize is called for every request with the pubkey that signed it. Requests are only
+	// performed when it returns true, so if it's nil everything is rejected.
+	Authorize func(ctx context.Context, pubkey string, params MethodParams) bool
+
+	// URL is the public URL of the relay that clients are expected to sign. When empty it is taken from
+	// the request (which may be wrong behind some reverse proxies).
+	URL string
+}
+
+func NewHandler(management Management, authorize func(ctx context.Context, pubkey string, params MethodParams) bool) *Handler {
+	return &Handler{Management: management, Authorize: authorize}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/nostr+json+rpc") {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	url := h.URL
+	if url == "" {
+		url = nip98.RequestURL(r)
+	}
+	authEvent, err := nip98.VerifyURL(r, url, nip98.DefaultMaxSkew)
+	if err == nil && authEvent.Tags.Find("payload") == nil {
+		err = fmt.Errorf("missing 'payload' tag")
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/nostr+json+rpc")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Response{Error: "unauthorized: " + err.Error()})
+		return
+	}
+	pubkey := authEvent.PubKey
+
+	var req Request
+	var resp Response
+	status := http.StatusOK
+	if err := json.Unmarshal(body, &req); err != nil {
+		resp.Error = "invalid request: " + err.Error()
+		status = http.StatusBadRequest
+	} else if params, err := DecodeRequest(req); err != nil {
+		resp.Error = err.Error()
+		status = http.StatusBadRequest
+	} else if h.Authorize == nil || !h.Authorize(r.Context(), pubkey, params) {
+		resp.Error = "unauthorized"
+		status = http.StatusUnauthorized
+	} else {
+		ctx := context.WithValue(r.Context(), authedKey{}, pubkey)
+		resp.Result, err = h.dispatch(ctx, params)
+		if err != nil {
+			resp.Error = err.Error()
+		} else if resp.Result == nil {
+			resp.Result = true
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/nostr+json+rpc")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *Handler) dispatch(ctx context.Context, params MethodParams) (any, error) {
+	m := h.Management
+	switch p := params.(type) {
+	case SupportedMethods:
+		return m.SupportedMethods(ctx)
+	case BanPubKey:
+		return nil, m.BanPubKey(ctx, p)
+	case ListBannedPubKeys:
+		return m.ListBannedPubKeys(ctx)
+	case AllowPubKey:
+		return nil, m.AllowPubKey(ctx, p)
+	case ListAllowedPubKeys:
+		return m.ListAllowedPubKeys(ctx)
+	case ListEventsNeedingModeration:
+		return m.ListEventsNeedingModeration(ctx)
+	case AllowEvent:
+		return nil, m.AllowEvent(ctx, p)
+	case BanEvent:
+		return nil, m.BanEvent(ctx, p)
+	case ListBannedEvents:
+		return m.ListBannedEvents(ctx)
+	case ListAllowedEvents:
+		return m.ListAllowedEvents(ctx)
+	case ChangeRelayName:
+		return nil, m.ChangeRelayName(ctx, p)
+	case ChangeRelayDescription:
+		return nil, m.ChangeRelayDescription(ctx, p)
+	case ChangeRelayIcon:
+		return nil, m.ChangeRelayIcon(ctx, p)
+	case AllowKind:
+		return nil, m.AllowKind(ctx, p)
+	case DisallowKind:
+		return nil, m.DisallowKind(ctx, p)
+	case ListAllowedKinds:
+		return m.ListAllowedKinds(ctx)
+	case ListDisallowedKinds:
+		return m.ListDisallowedKinds(ctx)
+	case BlockIP:
+		return nil, m.BlockIP(ctx, p)
+	case UnblockIP:
+		return nil, m.UnblockIP(ctx, p)
+	case ListBlockedIPs:
+		return m.ListBlockedIPs(ctx)
+	case GrantAdmin:
+		return nil, m.GrantAdmin(ctx, p)
+	case RevokeAdmin:
+		return nil, m.RevokeAdmin(ctx, p)
+	case Stats:
+		return m.Stats(ctx)
+	default:
+		return nil, ErrNotImplemented
+	}
+}
@@ -149,8 +149,14 @@ func DecodeRequest(req Request) (MethodParams, error) {
 			return nil, fmt.Errorf("invalid number of params for '%s'", req.Method)
 		}
 
-		pubkey := req.Params[0].(string)
-		allowedMethods := req.Params[1].([]string)
+		pubkey, ok := req.Params[0].(string)
+		if !ok || !nostr.IsValidPublicKey(pubkey) {
+			return nil, fmt.Errorf("invalid pubkey param for '%s'", req.Method)
+		}
+		allowedMethods, ok := stringList(req.Params[1])
+		if !ok {
+			return nil, fmt.Errorf("invalid methods param for '%s'", req.Method)
+		}
 
 		return GrantAdmin{
 			Pubkey:       pubkey,
@@ -161,8 +167,14 @@ func DecodeRequest(req Request) (MethodParams, error) {
 			return nil, fmt.Errorf("invalid number of params for '%s'", req.Method)
 		}
 
-		pubkey := req.Params[0].(string)
-		disallowedMethods := req.Params[1].([]string)
+		pubkey, ok := req.Params[0].(string)
+		if !ok || !nostr.IsValidPublicKey(pubkey) {
+			return nil, fmt.Errorf("invalid pubkey param for '%s'", req.Method)
+		}
+		disallowedMethods, ok := stringList(req.Params[1])
+		if !ok {
+			return nil, fmt.Errorf("invalid methods param for '%s'", req.Method)
+		}
 
 		return RevokeAdmin{
 			Pubkey:          pubkey,
@@ -175,6 +187,60 @@ func DecodeRequest(req Request) (MethodParams, error) {
 	}
 }
 
+// stringList accepts both a []string and the []any that comes from decoding JSON.
+func stringList(param any) ([]string, bool) {
+	switch v := param.(type) {
+	case []string:
+		return v, true
+	case []any:
+		list := make([]string, len(v))
+		for i, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			list[i] = str
+		}
+		return list, true
+	default:
+		return nil, false
+	}
+}
+
+// EncodeRequest is the opposite of DecodeRequest.
+func EncodeRequest(mp MethodParams) Request {
+	req := Request{Method: mp.MethodName(), Params: []any{}}
+	switch p := mp.(type) {
+	case BanPubKey:
+		req.Params = []any{p.PubKey, p.Reason}
+	case AllowPubKey:
+		req.Params = []any{p.PubKey, p.Reason}
+	case AllowEvent:
+		req.Params = []any{p.ID, p.Reason}
+	case BanEvent:
+		req.Params = []any{p.ID, p.Reason}
+	case ChangeRelayName:
+		req.Params = []any{p.Name}
+	case ChangeRelayDescription:
+		req.Params = []any{p.Description}
+	case ChangeRelayIcon:
+		req.Params = []any{p.IconURL}
+	case AllowKind:
+		req.Params = []any{p.Kind}
+	case DisallowKind:
+		req.Params = []any{p.Kind}
+	case BlockIP:
+		req.Params = []any{p.IP.String(), p.Reason}
+	case UnblockIP:
+		req.Params = []any{p.IP.String(), p.Reason}
+	case GrantAdmin:
+		req.Params = []any{p.Pubkey, p.AllowMethods}
+	case RevokeAdmin:
+		req.Params = []any{p.Pubkey, p.DisallowMethods}
+	}
+	return req
+}
+
 type MethodParams interface {
 	MethodName() string
 }
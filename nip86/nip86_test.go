@@ -0,0 +1,113 @@
+package nip86
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/keyer"
+	"github.com/stretchr/testify/require"
+)
+
+type testManagement struct {
+	UnimplementedManagement
+	banned []PubKeyReason
+	name   string
+}
+
+func (tm *testManagement) SupportedMethods(ctx context.Context) ([]string, error) {
+	return []string{"banpubkey", "listbannedpubkeys", "changerelayname"}, nil
+}
+
+func (tm *testManagement) BanPubKey(ctx context.Context, params BanPubKey) error {
+	tm.banned = append(tm.banned, PubKeyReason{params.PubKey, params.Reason + " (by " + GetAuthedPubKey(ctx)[0:4] + ")"})
+	return nil
+}
+
+func (tm *testManagement) ListBannedPubKeys(ctx context.Context) ([]PubKeyReason, error) {
+	return tm.banned, nil
+}
+
+func (tm *testManagement) ChangeRelayName(ctx context.Context, params ChangeRelayName) error {
+	tm.name = params.Name
+	return nil
+}
+
+func TestClientAndHandler(t *testing.T) {
+	ctx := context.Background()
+
+	adminSecret := nostr.GeneratePrivateKey()
+	adminPubkey, _ := nostr.GetPublicKey(adminSecret)
+	admin, _ := keyer.NewPlainKeySigner(adminSecret)
+
+	mgmt := &testManagement{}
+	handler := NewHandler(mgmt, func(ctx context.Context, pubkey string, params MethodParams) bool {
+		return pubkey == adminPubkey
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := NewClient("ws"+strings.TrimPrefix(server.URL, "http"), admin)
+	require.Equal(t, server.URL, client.URL)
+
+	methods, err := client.SupportedMethods(ctx)
+	require.NoError(t, err)
+	require.Contains(t, methods, "banpubkey")
+
+	target, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	require.NoError(t, client.BanPubKey(ctx, target, "spam"))
+	banned, err := client.ListBannedPubKeys(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []PubKeyReason{{target, "spam (by " + adminPubkey[0:4] + ")"}}, banned)
+
+	require.NoError(t, client.ChangeRelayName(ctx, "new name"))
+	require.Equal(t, "new name", mgmt.name)
+
+	err = client.BlockIP(ctx, net.ParseIP("1.2.3.4"), "")
+	require.ErrorContains(t, err, ErrNotImplemented.Error())
+
+	// invalid params
+	err = client.BanPubKey(ctx, "xyz", "")
+	require.ErrorContains(t, err, "invalid pubkey")
+
+	// someone else
+	other, _ := keyer.NewPlainKeySigner(nostr.GeneratePrivateKey())
+	_, err = NewClient(server.URL, other).ListBannedPubKeys(ctx)
+	require.ErrorContains(t, err, "unauthorized")
+
+	// signed for another url
+	handler.URL = "https://relay.example.com"
+	_, err = client.ListBannedPubKeys(ctx)
+	require.ErrorContains(t, err, "wrong 'u' tag")
+
+	// no auth at all
+	resp, err := http.Post(server.URL, "application/nostr+json+rpc", strings.NewReader(`{"method":"stats","params":[]}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestEncodeDecodeRequest(t *testing.T) {
+	pk, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	for _, params := range []MethodParams{
+		BanPubKey{pk, "x"},
+		AllowKind{30023},
+		BlockIP{net.ParseIP("10.0.0.1"), "y"},
+		GrantAdmin{pk, []string{"banpubkey", "allowpubkey"}},
+		RevokeAdmin{pk, []string{"banpubkey"}},
+		ListBlockedIPs{},
+	} {
+		j, err := json.Marshal(EncodeRequest(params))
+		require.NoError(t, err)
+
+		var req Request
+		require.NoError(t, json.Unmarshal(j, &req))
+		decoded, err := DecodeRequest(req)
+		require.NoError(t, err)
+		require.Equal(t, params, decoded)
+	}
+}
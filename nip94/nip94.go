@@ -7,7 +7,7 @@ import (
 )
 
 func ParseFileMetadata(event nostr.Event) FileMetadata {
-	fm := FileMetadata{}
+	fm := FileMetadata{Content: event.Content}
 	for _, tag := range event.Tags {
 		if len(tag) < 2 {
 			continue
@@ -15,6 +15,8 @@ func ParseFileMetadata(event nostr.Event) FileMetadata {
 		switch tag[0] {
 		case "url":
 			fm.URL = tag[1]
+		case "m":
+			fm.M = tag[1]
 		case "x":
 			fm.X = tag[1]
 		case "ox":
@@ -30,6 +32,11 @@ func ParseFileMetadata(event nostr.Event) FileMetadata {
 		case "blurhash":
 			fm.Blurhash = tag[1]
 		case "thumb":
+			fm.Thumb = tag[1]
+			if fm.Image == "" {
+				fm.Image = tag[1]
+			}
+		case "image":
 			fm.Image = tag[1]
 		case "summary":
 			fm.Summary = tag[1]
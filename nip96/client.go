@@ -0,0 +1,423 @@
+package nip96
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"iter"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip94"
+	"github.com/nbd-wtf/go-nostr/nip98"
+)
+
+// Client talks to a NIP-96 server. It discovers the server's API URL from its
+// /.well-known/nostr/nip96.json (following delegated_to_url) the first time it is needed.
+type Client struct {
+	// Server is the base URL of the server, like "https://nostr.build".
+	Server string
+
+	// Signer, if set, is used to sign NIP-98 auth headers. It is required for Delete and List.
+	Signer nostr.Signer
+
+	HTTPClient *http.Client
+
+	infoMu sync.Mutex
+	info   *ServerInfo
+}
+
+func NewClient(server string, signer nostr.Signer) *Client {
+	if !strings.HasPrefix(server, "http") {
+		server = "https://" + server
+	}
+
+	return &Client{
+		Server:     strings.TrimSuffix(server, "/"),
+		Signer:     signer,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// Info returns the server information, fetching it only on the first call. When a server delegates to
+// another the information of that one is returned instead.
+func (c *Client) Info(ctx context.Context) (*ServerInfo, error) {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	if c.info != nil {
+		return c.info, nil
+	}
+
+	server := c.Server
+	for range 3 {
+		info := &ServerInfo{}
+		if err := c.getJSON(ctx, server+"/.well-known/nostr/nip96.json", info); err != nil {
+			return nil, fmt.Errorf("failed to get server info from %s: %w", server, err)
+		}
+
+		if info.DelegatedToURL != "" && info.APIURL == "" {
+			server = strings.TrimSuffix(info.DelegatedToURL, "/")
+			continue
+		}
+
+		if info.APIURL == "" {
+			return nil, fmt.Errorf("%s has no api_url", server)
+		}
+		c.info = info
+		return info, nil
+	}
+
+	return nil, fmt.Errorf("too many delegations starting at %s", c.Server)
+}
+
+// UploadParams are the parameters for Client.Upload, see UploadRequest for the meaning of the fields
+// that are sent to the server.
+type UploadParams struct {
+	File        io.Reader
+	Filename    string
+	Caption     string
+	Alt         string
+	MediaType   string
+	ContentType string
+	NoTransform bool
+	Expiration  nostr.Timestamp
+
+	// Size is the size of the file, used for reporting progress and for checking the plan limits
+	// before uploading. It can be zero if not known.
+	Size int64
+
+	// SignPayload adds the sha256 of the file to the auth header, this requires File to be an
+	// io.ReadSeeker since the file has to be read twice.
+	SignPayload bool
+
+	// Progress, if set, is called as the file is sent with the number of bytes sent so far.
+	Progress func(sent int64, total int64)
+
+	// Processing, if set, is called with the percentage reported by the server while it is processing
+	// the file after the upload.
+	Processing func(percentage int)
+}
+
+// Upload sends a file to the server and, if the server processes it asynchronously, waits until that
+// is done. Use FileMetadata on the response to get the resulting file tags.
+func (c *Client) Upload(ctx context.Context, params UploadParams) (*UploadResponse, error) {
+	info, err := c.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if plan, ok := info.Plans["free"]; ok {
+		if plan.MaxByteSize > 0 && params.Size > plan.MaxByteSize {
+			return nil, fmt.Errorf("file is larger than the maximum of %d bytes", plan.MaxByteSize)
+		}
+		if plan.IsNIP98Required && c.Signer == nil {
+			return nil, fmt.Errorf("server requires authentication but there is no signer")
+		}
+	}
+
+	var payloadHash []byte
+	if params.SignPayload {
+		rs, ok := params.File.(io.ReadSeeker)
+		if !ok {
+			return nil, fmt.Errorf("SignPayload requires File to be an io.ReadSeeker")
+		}
+		hash := sha256.New()
+		if _, err := io.Copy(hash, rs); err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to reset file position: %w", err)
+		}
+		payloadHash = hash.Sum(nil)
+	}
+
+	// stream the multipart body instead of buffering it
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		fileWriter, err := writer.CreateFormFile("file", params.Filename)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		var file io.Reader = params.File
+		if params.Progress != nil {
+			file = &progressReader{r: params.File, total: params.Size, progress: params.Progress}
+		}
+		if _, err := io.Copy(fileWriter, file); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		writer.WriteField("caption", params.Caption)
+		writer.WriteField("alt", params.Alt)
+		writer.WriteField("media_type", params.MediaType)
+		writer.WriteField("content_type", params.ContentType)
+		writer.WriteField("no_transform", strconv.FormatBool(params.NoTransform))
+		if params.Expiration == 0 {
+			writer.WriteField("expiration", "")
+		} else {
+			writer.WriteField("expiration", strconv.FormatInt(int64(params.Expiration), 10))
+		}
+		if params.Size > 0 {
+			writer.WriteField("size", strconv.FormatInt(params.Size, 10))
+		}
+		pw.CloseWithError(writer.Close())
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", info.APIURL, pr)
+	if err != nil {
+		pr.Close()
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if err := c.authorize(ctx, req, payloadHash); err != nil {
+		pr.Close()
+		return nil, err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("upload to %s failed: %w", info.APIURL, err)
+	}
+	defer resp.Body.Close()
+
+	uploadResp := &UploadResponse{}
+	if err := decodeResponse(resp, uploadResp); err != nil {
+		return nil, err
+	}
+	if uploadResp.Status == "error" {
+		return nil, fmt.Errorf("upload failed: %s", uploadResp.Message)
+	}
+
+	if resp.StatusCode == http.StatusAccepted && uploadResp.ProcessingURL != "" {
+		return c.waitProcessing(ctx, uploadResp.ProcessingURL, params.Processing)
+	}
+
+	return uploadResp, nil
+}
+
+// waitProcessing polls the processing_url until the server says the file is ready.
+func (c *Client) waitProcessing(ctx context.Context, processingURL string, progress func(int)) (*UploadResponse, error) {
+	delay := 500 * time.Millisecond
+	for {
+		req, err := http.NewRequestWithContext(ctx, "GET", processingURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		resp, err := c.HTTPClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check processing status: %w", err)
+		}
+
+		var status struct {
+			UploadResponse
+			Percentage int `json:"percentage"`
+		}
+		err = decodeResponse(resp, &status)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case status.Status == "error":
+			return nil, fmt.Errorf("processing failed: %s", status.Message)
+		case resp.StatusCode == http.StatusCreated || status.Status == "success":
+			return &status.UploadResponse, nil
+		}
+
+		if progress != nil {
+			progress(status.Percentage)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay < 5*time.Second {
+			delay *= 2
+		}
+	}
+}
+
+// Delete deletes a file from the server given its sha256 (the "ox" tag of the upload).
+func (c *Client) Delete(ctx context.Context, hash string) error {
+	if c.Signer == nil {
+		return fmt.Errorf("a signer is required for deleting")
+	}
+
+	info, err := c.Info(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", strings.TrimSuffix(info.APIURL, "/")+"/"+hash, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if err := c.authorize(ctx, req, nil); err != nil {
+		return err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("delete request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	if err := decodeResponse(resp, &result); err != nil {
+		return err
+	}
+	if result.Status != "success" {
+		return fmt.Errorf("failed to delete %s: %s", hash, result.Message)
+	}
+
+	return nil
+}
+
+// List returns one page (starting at zero) of the files uploaded by the signer.
+func (c *Client) List(ctx context.Context, page int, count int) (*ListResponse, error) {
+	if c.Signer == nil {
+		return nil, fmt.Errorf("a signer is required for listing")
+	}
+
+	info, err := c.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(info.APIURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api_url %s: %w", info.APIURL, err)
+	}
+	query := u.Query()
+	query.Set("page", strconv.Itoa(page))
+	query.Set("count", strconv.Itoa(count))
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if err := c.authorize(ctx, req, nil); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("list request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	list := &ListResponse{}
+	if err := decodeResponse(resp, list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// ListAll goes through all the pages of files uploaded by the signer, count at a time.
+func (c *Client) ListAll(ctx context.Context, count int) iter.Seq2[nip94.FileMetadata, error] {
+	return func(yield func(nip94.FileMetadata, error) bool) {
+		seen := 0
+		for page := 0; ; page++ {
+			list, err := c.List(ctx, page, count)
+			if err != nil {
+				yield(nip94.FileMetadata{}, err)
+				return
+			}
+
+			for _, file := range list.Files {
+				if !yield(file.FileMetadata(), nil) {
+					return
+				}
+			}
+
+			seen += len(list.Files)
+			if len(list.Files) == 0 || seen >= list.Total {
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) authorize(ctx context.Context, req *http.Request, payloadHash []byte) error {
+	if c.Signer == nil {
+		return nil
+	}
+
+	auth, err := nip98.MakeAuthHeader(ctx, c.Signer, req.URL.String(), req.Method, payloadHash)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth)
+	return nil
+}
+
+func (c *Client) getJSON(ctx context.Context, url string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(resp, result)
+}
+
+func decodeResponse(resp *http.Response, result any) error {
+	switch resp.StatusCode {
+	case http.StatusRequestEntityTooLarge:
+		return fmt.Errorf("File is too large")
+	case http.StatusBadRequest:
+		return fmt.Errorf("Bad request")
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("Unauthorized")
+	case http.StatusPaymentRequired:
+		return fmt.Errorf("Payment required")
+	case http.StatusOK, http.StatusCreated, http.StatusAccepted:
+		if err := jsoniter.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("Error decoding JSON: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("Unexpected error %v", resp.Status)
+	}
+}
+
+type progressReader struct {
+	r        io.Reader
+	sent     int64
+	total    int64
+	progress func(int64, int64)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.sent += int64(n)
+		pr.progress(pr.sent, pr.total)
+	}
+	return n, err
+}
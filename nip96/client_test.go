@@ -0,0 +1,131 @@
+//go:build !js
+
+package nip96
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/keyer"
+	"github.com/nbd-wtf/go-nostr/nip98"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	signer, err := keyer.NewPlainKeySigner(nostr.GeneratePrivateKey())
+	require.NoError(t, err)
+
+	files := make([]ListEntry, 0, 3)
+	var polls atomic.Int32
+
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/nostr/nip96.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ServerInfo{
+			APIURL: server.URL + "/api",
+			Plans:  map[string]Plan{"free": {Name: "free", IsNIP98Required: true, MaxByteSize: 1000}},
+		})
+	})
+	mux.HandleFunc("POST /api", func(w http.ResponseWriter, r *http.Request) {
+		// the payload tag here is the hash of the file, not of the request body
+		auth, err := nip98.ParseHeader(r)
+		require.NoError(t, err)
+
+		file, _, err := r.FormFile("file")
+		require.NoError(t, err)
+		data, _ := io.ReadAll(file)
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])
+		require.Equal(t, hash, auth.Tags.Find("payload")[1])
+		require.Equal(t, "a caption", r.FormValue("caption"))
+
+		files = append(files, ListEntry{Tags: nostr.Tags{{"url", server.URL + "/" + hash + ".txt"}, {"ox", hash}, {"m", "text/plain"}}})
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(UploadResponse{Status: "processing", ProcessingURL: server.URL + "/processing/" + hash})
+	})
+	mux.HandleFunc("GET /processing/{hash}", func(w http.ResponseWriter, r *http.Request) {
+		if polls.Add(1) < 2 {
+			json.NewEncoder(w).Encode(map[string]any{"status": "processing", "percentage": 50})
+			return
+		}
+		resp := UploadResponse{Status: "success"}
+		resp.Nip94Event.Tags = files[len(files)-1].Tags
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("DELETE /api/{hash}", func(w http.ResponseWriter, r *http.Request) {
+		_, err := nip98.Verify(r, nip98.DefaultMaxSkew)
+		require.NoError(t, err)
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	})
+	mux.HandleFunc("GET /api", func(w http.ResponseWriter, r *http.Request) {
+		_, err := nip98.Verify(r, nip98.DefaultMaxSkew)
+		require.NoError(t, err)
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+		start := min(page*count, len(files))
+		end := min(start+count, len(files))
+		json.NewEncoder(w).Encode(ListResponse{Count: end - start, Total: len(files), Page: page, Files: files[start:end]})
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	// this one just delegates to the other
+	delegator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ServerInfo{DelegatedToURL: server.URL})
+	}))
+	defer delegator.Close()
+
+	c := NewClient(delegator.URL, signer)
+	info, err := c.Info(ctx)
+	require.NoError(t, err)
+	require.Equal(t, server.URL+"/api", info.APIURL)
+
+	_, err = c.Upload(ctx, UploadParams{File: bytes.NewReader(make([]byte, 2000)), Size: 2000})
+	require.ErrorContains(t, err, "larger than")
+
+	var sent int64
+	var percentages []int
+	for i := range 3 {
+		data := []byte("file number " + strconv.Itoa(i))
+		resp, err := c.Upload(ctx, UploadParams{
+			File:        bytes.NewReader(data),
+			Filename:    "file.txt",
+			Caption:     "a caption",
+			Size:        int64(len(data)),
+			SignPayload: true,
+			Progress:    func(s int64, total int64) { sent = s },
+			Processing:  func(p int) { percentages = append(percentages, p) },
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(len(data)), sent)
+
+		fm := resp.FileMetadata()
+		sum := sha256.Sum256(data)
+		require.Equal(t, hex.EncodeToString(sum[:]), fm.OX)
+		require.Equal(t, "text/plain", fm.M)
+	}
+	require.Equal(t, []int{50}, percentages)
+
+	all := make([]string, 0, 3)
+	for fm, err := range c.ListAll(ctx, 2) {
+		require.NoError(t, err)
+		all = append(all, fm.OX)
+	}
+	require.Len(t, all, 3)
+	require.Equal(t, files[2].Tags.Find("ox")[1], all[2])
+
+	require.NoError(t, c.Delete(ctx, all[0]))
+}
@@ -4,17 +4,15 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
-	"encoding/base64"
-	"encoding/hex"
 	"fmt"
-	"hash"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"strconv"
 
 	jsoniter "github.com/json-iterator/go"
-	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/keyer"
+	"github.com/nbd-wtf/go-nostr/nip98"
 )
 
 // Upload uploads a file to the provided req.Host.
@@ -68,9 +66,17 @@ func Upload(ctx context.Context, req UploadRequest) (*UploadResponse, error) {
 		if !req.SignPayload {
 			fileHash = nil
 		}
-		auth, err := generateAuthHeader(req.SK, req.Host, fileHash)
+		var payloadHash []byte
+		if fileHash != nil {
+			payloadHash = fileHash.Sum(nil)
+		}
+		signer, err := keyer.NewPlainKeySigner(req.SK)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret key: %w", err)
+		}
+		auth, err := nip98.MakeAuthHeader(ctx, signer, req.Host, "POST", payloadHash)
 		if err != nil {
-			return nil, fmt.Errorf("generateAuthHeader: %w", err)
+			return nil, fmt.Errorf("nip98.MakeAuthHeader: %w", err)
 		}
 		uploadReq.Header.Set("Authorization", auth)
 	}
@@ -105,33 +111,3 @@ func Upload(ctx context.Context, req UploadRequest) (*UploadResponse, error) {
 		return nil, fmt.Errorf("Unexpected error %v", resp.Status)
 	}
 }
-
-func generateAuthHeader(sk, host string, fileHash hash.Hash) (string, error) {
-	pk, err := nostr.GetPublicKey(sk)
-	if err != nil {
-		return "", fmt.Errorf("nostr.GetPublicKey: %w", err)
-	}
-
-	event := nostr.Event{
-		Kind:      27235,
-		PubKey:    pk,
-		CreatedAt: nostr.Now(),
-		Tags: nostr.Tags{
-			nostr.Tag{"u", host},
-			nostr.Tag{"method", "POST"},
-		},
-	}
-	if fileHash != nil {
-		event.Tags = append(event.Tags, nostr.Tag{"payload", hex.EncodeToString(fileHash.Sum(nil))})
-	}
-	event.Sign(sk)
-
-	b, err := jsoniter.ConfigFastest.Marshal(event)
-	if err != nil {
-		return "", fmt.Errorf("json.Marshal: %w", err)
-	}
-
-	payload := base64.StdEncoding.EncodeToString(b)
-
-	return fmt.Sprintf("Nostr %s", payload), nil
-}
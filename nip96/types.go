@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip94"
 )
 
 // UploadRequest is a NIP96 upload request.
@@ -71,3 +72,47 @@ type UploadResponse struct {
 		Content string     `json:"content"`
 	} `json:"nip94_event"`
 }
+
+// FileMetadata turns the nip94_event of the response into a nip94.FileMetadata.
+func (r UploadResponse) FileMetadata() nip94.FileMetadata {
+	return nip94.ParseFileMetadata(nostr.Event{Tags: r.Nip94Event.Tags, Content: r.Nip94Event.Content})
+}
+
+// ServerInfo is what a server publishes at /.well-known/nostr/nip96.json.
+type ServerInfo struct {
+	APIURL         string          `json:"api_url"`
+	DownloadURL    string          `json:"download_url,omitempty"`
+	DelegatedToURL string          `json:"delegated_to_url,omitempty"`
+	SupportedNIPs  []int           `json:"supported_nips,omitempty"`
+	TOSURL         string          `json:"tos_url,omitempty"`
+	ContentTypes   []string        `json:"content_types,omitempty"`
+	Plans          map[string]Plan `json:"plans,omitempty"`
+}
+
+// Plan describes the limits of one of the plans offered by a server, "free" being the default.
+type Plan struct {
+	Name                 string              `json:"name"`
+	IsNIP98Required      bool                `json:"is_nip98_required"`
+	URL                  string              `json:"url,omitempty"`
+	MaxByteSize          int64               `json:"max_byte_size,omitempty"`
+	FileExpiration       []int               `json:"file_expiration,omitempty"` // min and max days
+	MediaTransformations map[string][]string `json:"media_transformations,omitempty"`
+}
+
+// ListResponse is one page of the files of a user.
+type ListResponse struct {
+	Count int         `json:"count"`
+	Total int         `json:"total"`
+	Page  int         `json:"page"`
+	Files []ListEntry `json:"files"`
+}
+
+type ListEntry struct {
+	Tags      nostr.Tags      `json:"tags"`
+	Content   string          `json:"content"`
+	CreatedAt nostr.Timestamp `json:"created_at"`
+}
+
+func (e ListEntry) FileMetadata() nip94.FileMetadata {
+	return nip94.ParseFileMetadata(nostr.Event{Tags: e.Tags, Content: e.Content, CreatedAt: e.CreatedAt})
+}
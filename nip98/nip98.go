@@ -0,0 +1,201 @@
+package nip98
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mailru/easyjson"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DefaultMaxSkew is how far from the current time an auth event can be by default.
+const DefaultMaxSkew = time.Minute
+
+// MakeAuthHeader signs a kind 27235 event for the given url and method and returns it encoded as the
+// value of an "Authorization" header. payloadHash is the sha256 of the body, if given it is added as a
+// "payload" tag.
+func MakeAuthHeader(
+	ctx context.Context,
+	signer nostr.Signer,
+	url string,
+	method string,
+	payloadHash []byte,
+) (string, error) {
+	evt := nostr.Event{
+		Kind:      nostr.KindHTTPAuth,
+		CreatedAt: nostr.Now(),
+		Tags: nostr.Tags{
+			{"u", url},
+			{"method", strings.ToUpper(method)},
+		},
+	}
+	if payloadHash != nil {
+		evt.Tags = append(evt.Tags, nostr.Tag{"payload", hex.EncodeToString(payloadHash)})
+	}
+	if err := signer.SignEvent(ctx, &evt); err != nil {
+		return "", fmt.Errorf("failed to sign auth event: %w", err)
+	}
+
+	j, _ := easyjson.Marshal(evt)
+	return "Nostr " + base64.StdEncoding.EncodeToString(j), nil
+}
+
+// SignRequest sets the "Authorization" header of an outgoing request. When withPayload is true the
+// request body is read (and restored) so its hash can be included.
+func SignRequest(ctx context.Context, r *http.Request, signer nostr.Signer, withPayload bool) error {
+	var payloadHash []byte
+	if withPayload {
+		body, err := readBody(r)
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(body)
+		payloadHash = hash[:]
+	}
+
+	header, err := MakeAuthHeader(ctx, signer, r.URL.String(), r.Method, payloadHash)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", header)
+	return nil
+}
+
+// ParseHeader decodes the event in the "Authorization" header of a request without checking anything
+// other than its kind.
+func ParseHeader(r *http.Request) (*nostr.Event, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Nostr ") {
+		return nil, fmt.Errorf("missing authorization header")
+	}
+	j, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header[6:]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 in authorization header")
+	}
+
+	evt := &nostr.Event{}
+	if err := easyjson.Unmarshal(j, evt); err != nil {
+		return nil, fmt.Errorf("invalid event in authorization header")
+	}
+	if evt.Kind != nostr.KindHTTPAuth {
+		return nil, fmt.Errorf("wrong kind %d", evt.Kind)
+	}
+	return evt, nil
+}
+
+// Verify checks the "Authorization" header of an incoming request: the signature, the timestamp (which
+// can't be farther than maxSkew from now), the "u" and "method" tags and the "payload" tag, if present,
+// against the request body (which is restored afterwards). It returns the auth event.
+//
+// The URL is taken from the request, use VerifyURL when that isn't reliable (like behind reverse proxies).
+func Verify(r *http.Request, maxSkew time.Duration) (*nostr.Event, error) {
+	return VerifyURL(r, RequestURL(r), maxSkew)
+}
+
+// VerifyURL is like Verify, but checks the "u" tag against the given URL.
+func VerifyURL(r *http.Request, url string, maxSkew time.Duration) (*nostr.Event, error) {
+	evt, err := ParseHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if skew := time.Since(evt.CreatedAt.Time()); skew > maxSkew || skew < -maxSkew {
+		return nil, fmt.Errorf("event is too old or too new")
+	}
+	if tag := evt.Tags.Find("u"); tag == nil || strings.TrimSuffix(tag[1], "/") != strings.TrimSuffix(url, "/") {
+		return nil, fmt.Errorf("wrong 'u' tag, expected '%s'", url)
+	}
+	if tag := evt.Tags.Find("method"); tag == nil || !strings.EqualFold(tag[1], r.Method) {
+		return nil, fmt.Errorf("wrong 'method' tag, expected '%s'", r.Method)
+	}
+	if tag := evt.Tags.Find("payload"); tag != nil {
+		body, err := readBody(r)
+		if err != nil {
+			return nil, err
+		}
+		hash := sha256.Sum256(body)
+		if tag[1] != hex.EncodeToString(hash[:]) {
+			return nil, fmt.Errorf("wrong 'payload' tag")
+		}
+	}
+	if ok, _ := evt.CheckSignature(); !ok {
+		return nil, fmt.Errorf("invalid signature")
+	}
+
+	return evt, nil
+}
+
+// RequestURL reconstructs the absolute URL of an incoming request.
+func RequestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	url := scheme + "://" + r.Host + r.URL.Path
+	if r.URL.RawQuery != "" {
+		url += "?" + r.URL.RawQuery
+	}
+	return url
+}
+
+type pubkeyKey struct{}
+
+// GetPubKey returns the pubkey authenticated by Middleware, or an empty string.
+func GetPubKey(ctx context.Context) string {
+	pubkey, _ := ctx.Value(pubkeyKey{}).(string)
+	return pubkey
+}
+
+// Middleware verifies the "Authorization" header of requests and puts the authenticated pubkey in their
+// context (to be read with GetPubKey). Requests without the header are passed on unauthenticated, requests
+// with an invalid header are rejected with 401.
+func Middleware(maxSkew time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			evt, err := Verify(r, maxSkew)
+			if err != nil {
+				http.Error(w, "unauthorized: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), pubkeyKey{}, evt.PubKey)))
+		})
+	}
+}
+
+// readBody reads the entire body of a request and puts it back so it can be read again.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return []byte{}, nil
+	}
+	if r.GetBody != nil {
+		rc, err := r.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get body: %w", err)
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	return body, nil
+}
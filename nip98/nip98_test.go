@@ -0,0 +1,96 @@
+package nip98
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/keyer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	ctx := context.Background()
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	signer, _ := keyer.NewPlainKeySigner(sk)
+
+	var gotBody string
+	server := httptest.NewServer(Middleware(DefaultMaxSkew)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.Write([]byte(GetPubKey(r.Context())))
+	})))
+	defer server.Close()
+
+	do := func(req *http.Request) (int, string) {
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	// with payload
+	req, _ := http.NewRequest("POST", server.URL+"/upload?x=1", strings.NewReader("hello"))
+	require.NoError(t, SignRequest(ctx, req, signer, true))
+	status, body := do(req)
+	require.Equal(t, 200, status)
+	require.Equal(t, pk, body)
+	require.Equal(t, "hello", gotBody, "body must still be readable after verification")
+
+	// without payload
+	req, _ = http.NewRequest("GET", server.URL+"/file", nil)
+	require.NoError(t, SignRequest(ctx, req, signer, false))
+	status, body = do(req)
+	require.Equal(t, 200, status)
+	require.Equal(t, pk, body)
+
+	// no auth at all
+	req, _ = http.NewRequest("GET", server.URL+"/file", nil)
+	status, body = do(req)
+	require.Equal(t, 200, status)
+	require.Equal(t, "", body)
+
+	// body changed after signing
+	req, _ = http.NewRequest("POST", server.URL+"/upload", strings.NewReader("hello"))
+	require.NoError(t, SignRequest(ctx, req, signer, true))
+	signed := req.Header.Get("Authorization")
+	req, _ = http.NewRequest("POST", server.URL+"/upload", strings.NewReader("goodbye"))
+	req.Header.Set("Authorization", signed)
+	status, body = do(req)
+	require.Equal(t, 401, status)
+	require.Contains(t, body, "payload")
+
+	// wrong url and method
+	req, _ = http.NewRequest("POST", server.URL+"/other", strings.NewReader("hello"))
+	req.Header.Set("Authorization", signed)
+	status, body = do(req)
+	require.Equal(t, 401, status)
+	require.Contains(t, body, "'u' tag")
+	req, _ = http.NewRequest("PUT", server.URL+"/upload", strings.NewReader("hello"))
+	req.Header.Set("Authorization", signed)
+	status, body = do(req)
+	require.Equal(t, 401, status)
+	require.Contains(t, body, "'method' tag")
+
+	// too old
+	req, _ = http.NewRequest("GET", server.URL+"/file", nil)
+	old := nostr.Event{
+		Kind:      nostr.KindHTTPAuth,
+		CreatedAt: nostr.Now() - 120,
+		Tags:      nostr.Tags{{"u", req.URL.String()}, {"method", "GET"}},
+	}
+	old.Sign(sk)
+	req.Header.Set("Authorization", "Nostr "+base64.StdEncoding.EncodeToString([]byte(old.String())))
+	_, err := VerifyURL(req, req.URL.String(), time.Minute)
+	require.ErrorContains(t, err, "too old")
+	_, err = VerifyURL(req, req.URL.String(), 5*time.Minute)
+	require.NoError(t, err)
+}
@@ -0,0 +1,123 @@
+package blossom
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/keyer"
+	"github.com/stretchr/testify/require"
+)
+
+type testServer struct {
+	*httptest.Server
+	sync.Mutex
+
+	blobs   map[string][]byte
+	maxSize int
+	corrupt bool
+}
+
+func newTestServer(t *testing.T) *testServer {
+	s := &testServer{blobs: make(map[string][]byte), maxSize: 1 << 20}
+
+	store := func(w http.ResponseWriter, data []byte) {
+		hash := sha256.Sum256(data)
+		h := hex.EncodeToString(hash[:])
+		s.Lock()
+		s.blobs[h] = data
+		s.Unlock()
+		json.NewEncoder(w).Encode(BlobDescriptor{URL: s.URL + "/" + h, SHA256: h, Size: len(data)})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("HEAD /upload", func(w http.ResponseWriter, r *http.Request) {
+		if size, _ := strconv.Atoi(r.Header.Get("X-Content-Length")); size > s.maxSize {
+			w.Header().Set("X-Reason", "too large")
+			w.WriteHeader(413)
+		}
+	})
+	mux.HandleFunc("PUT /upload", func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		store(w, data)
+	})
+	mux.HandleFunc("PUT /mirror", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			URL string `json:"url"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		resp, err := http.Get(body.URL)
+		if err != nil || resp.StatusCode != 200 {
+			w.WriteHeader(502)
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		store(w, data)
+	})
+	mux.HandleFunc("GET /{hash}", func(w http.ResponseWriter, r *http.Request) {
+		s.Lock()
+		data, ok := s.blobs[r.PathValue("hash")]
+		s.Unlock()
+		if !ok {
+			w.WriteHeader(404)
+			return
+		}
+		if s.corrupt {
+			data = append([]byte{'x'}, data...)
+		}
+		w.Write(data)
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestMultiClient(t *testing.T) {
+	ctx := context.Background()
+	signer, err := keyer.NewPlainKeySigner(nostr.GeneratePrivateKey())
+	require.NoError(t, err)
+
+	primary := newTestServer(t)
+	secondary := newTestServer(t)
+	bad := newTestServer(t)
+	bad.corrupt = true
+
+	data := []byte("hello blossom")
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	mc := NewMultiClient([]string{primary.URL, bad.URL, secondary.URL}, signer)
+	require.NoError(t, mc.Clients[0].CheckUpload(ctx, hash, int64(len(data)), "text/plain"))
+	require.ErrorContains(t, mc.Clients[0].CheckUpload(ctx, hash, 1<<21, ""), "too large")
+
+	bd, err := mc.Upload(ctx, bytes.NewReader(data), int64(len(data)), hash)
+	require.NoError(t, err)
+	require.Equal(t, hash, bd.SHA256)
+	for _, s := range []*testServer{primary, secondary, bad} {
+		require.Equal(t, data, s.blobs[hash])
+	}
+
+	// the corrupt server is detected
+	_, err = mc.Clients[1].Download(ctx, hash)
+	require.ErrorContains(t, err, "wrong hash")
+
+	// and skipped
+	delete(primary.blobs, hash)
+	got, err := mc.Download(ctx, hash)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	_, err = mc.Clients[0].Mirror(ctx, "https://example.com/not-a-blob")
+	require.ErrorContains(t, err, "doesn't contain")
+}
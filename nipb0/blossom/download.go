@@ -1,7 +1,10 @@
 package blossom
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,41 +15,41 @@ import (
 
 // Download downloads a file from the media server by its hash
 func (c *Client) Download(ctx context.Context, hash string) ([]byte, error) {
-	if !nostr.IsValid32ByteHex(hash) {
-		return nil, fmt.Errorf("%s is not a valid 32-byte hex string", hash)
+	buf := &bytes.Buffer{}
+	if err := c.DownloadTo(ctx, hash, buf); err != nil {
+		return nil, err
 	}
+	return buf.Bytes(), nil
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", c.mediaserver+"/"+hash, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// DownloadToFile downloads a file from the media server and saves it to the specified path
+func (c *Client) DownloadToFile(ctx context.Context, hash string, filePath string) error {
+	if !nostr.IsValid32ByteHex(hash) {
+		return fmt.Errorf("%s is not a valid 32-byte hex string", hash)
 	}
 
-	authHeader := c.authorizationHeader(ctx, func(evt *nostr.Event) {
-		evt.Tags = append(evt.Tags, nostr.Tag{"t", "get"})
-		evt.Tags = append(evt.Tags, nostr.Tag{"x", hash})
-	})
-	req.Header.Add("Authorization", authHeader)
-
-	resp, err := http.DefaultClient.Do(req)
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
 	if err != nil {
-		return nil, fmt.Errorf("failed to call %s for %s: %w", c.mediaserver, hash, err)
+		return fmt.Errorf("failed to create file %s for %s: %w", filePath, hash, err)
 	}
-	defer resp.Body.Close()
+	defer file.Close()
 
-	if resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("%s is not present in %s: %d", hash, c.mediaserver, resp.StatusCode)
+	if err := c.DownloadTo(ctx, hash, file); err != nil {
+		os.Remove(filePath)
+		return err
 	}
 
-	return io.ReadAll(resp.Body)
+	return nil
 }
 
-// DownloadToFile downloads a file from the media server and saves it to the specified path
-func (c *Client) DownloadToFile(ctx context.Context, hash string, filePath string) error {
+// DownloadTo streams a blob from the media server into w while computing its sha256. If the hash
+// doesn't match an error is returned, but w will already have received the contents by then.
+func (c *Client) DownloadTo(ctx context.Context, hash string, w io.Writer) error {
 	if !nostr.IsValid32ByteHex(hash) {
 		return fmt.Errorf("%s is not a valid 32-byte hex string", hash)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", c.mediaserver+"/"+hash, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", c.mediaserver+hash, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -67,15 +70,12 @@ func (c *Client) DownloadToFile(ctx context.Context, hash string, filePath strin
 		return fmt.Errorf("%s is not present in %s: %d", hash, c.mediaserver, resp.StatusCode)
 	}
 
-	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
-	if err != nil {
-		return fmt.Errorf("failed to create file %s for %s: %w", filePath, hash, err)
+	sha := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, sha), resp.Body); err != nil {
+		return fmt.Errorf("failed to download %s: %w", hash, err)
 	}
-	defer file.Close()
-
-	_, err = io.Copy(file, resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to write to file %s for %s: %w", filePath, hash, err)
+	if got := hex.EncodeToString(sha.Sum(nil)); got != hash {
+		return fmt.Errorf("%s returned a blob with the wrong hash %s for %s", c.mediaserver, got, hash)
 	}
 
 	return nil
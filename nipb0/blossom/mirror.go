@@ -0,0 +1,57 @@
+package blossom
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Mirror asks the media server to download a blob from another server (BUD-04). The blob URL must
+// contain its hash, as is the case for URLs of other Blossom servers.
+func (c *Client) Mirror(ctx context.Context, blobURL string) (*BlobDescriptor, error) {
+	hash := hashFromURL(blobURL)
+	if hash == "" {
+		return nil, fmt.Errorf("%s doesn't contain a sha256 hash", blobURL)
+	}
+
+	body, _ := json.Marshal(struct {
+		URL string `json:"url"`
+	}{blobURL})
+
+	bd := BlobDescriptor{}
+	err := c.httpCall(ctx, "PUT", "mirror", "application/json", func() string {
+		return c.authorizationHeader(ctx, func(evt *nostr.Event) {
+			evt.Tags = append(evt.Tags, nostr.Tag{"t", "upload"})
+			evt.Tags = append(evt.Tags, nostr.Tag{"x", hash})
+		})
+	}, bytes.NewReader(body), int64(len(body)), &bd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mirror %s: %w", blobURL, err)
+	}
+
+	return &bd, nil
+}
+
+// hashFromURL takes the hash from the last path segment of a blob URL, ignoring the extension.
+func hashFromURL(blobURL string) string {
+	u, err := url.Parse(blobURL)
+	if err != nil {
+		return ""
+	}
+
+	name := path.Base(u.Path)
+	if idx := strings.IndexByte(name, '.'); idx != -1 {
+		name = name[0:idx]
+	}
+	if !nostr.IsValid32ByteHex(name) {
+		return ""
+	}
+
+	return name
+}
@@ -0,0 +1,123 @@
+package blossom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// MultiClient talks to all the media servers of a user, as listed in their kind 10063 event. The first
+// server is the primary one: uploads go to it and the others are asked to mirror from it.
+type MultiClient struct {
+	Clients []*Client
+}
+
+// NewMultiClient creates a MultiClient for the given servers, the first one is the primary.
+func NewMultiClient(servers []string, signer nostr.Signer) *MultiClient {
+	mc := &MultiClient{Clients: make([]*Client, len(servers))}
+	for i, server := range servers {
+		mc.Clients[i] = NewClient(server, signer)
+	}
+	return mc
+}
+
+// LoadMultiClient fetches the kind 10063 server list of the signer's pubkey from the given relays and
+// creates a MultiClient with its servers.
+func LoadMultiClient(
+	ctx context.Context,
+	pool *nostr.SimplePool,
+	relays []string,
+	signer nostr.Signer,
+) (*MultiClient, error) {
+	pubkey, err := signer.GetPublicKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ie := pool.QuerySingle(ctx, relays, nostr.Filter{Kinds: []int{nostr.KindUserServerList}, Authors: []string{pubkey}})
+	if ie == nil {
+		return nil, fmt.Errorf("no server list found for %s", pubkey)
+	}
+
+	servers := ServersFromEvent(ie.Event)
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("server list of %s is empty", pubkey)
+	}
+
+	return NewMultiClient(servers, signer), nil
+}
+
+// ServersFromEvent returns the servers listed in a kind 10063 event, in order.
+func ServersFromEvent(evt *nostr.Event) []string {
+	servers := make([]string, 0, len(evt.Tags))
+	for tag := range evt.Tags.FindAll("server") {
+		servers = append(servers, tag[1])
+	}
+	return servers
+}
+
+// Upload uploads a blob to the primary server and then asks the other servers to mirror it from there.
+//
+// It returns the descriptor given by the primary server. The upload is successful if that is not nil,
+// even if some mirrors have failed, in which case the error will say which.
+func (mc *MultiClient) Upload(ctx context.Context, body io.Reader, size int64, hash string) (*BlobDescriptor, error) {
+	if len(mc.Clients) == 0 {
+		return nil, fmt.Errorf("no servers")
+	}
+
+	bd, err := mc.Clients[0].Upload(ctx, body, size, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return bd, mc.mirror(ctx, mc.Clients[1:], bd.URL)
+}
+
+// Mirror asks all the servers to mirror a blob from the given URL.
+func (mc *MultiClient) Mirror(ctx context.Context, blobURL string) error {
+	return mc.mirror(ctx, mc.Clients, blobURL)
+}
+
+func (mc *MultiClient) mirror(ctx context.Context, clients []*Client, blobURL string) error {
+	errs := make([]error, len(clients))
+	wg := sync.WaitGroup{}
+	for i, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Mirror(ctx, blobURL); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", client.mediaserver, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// Download tries each server in order until one of them has the blob with the right hash.
+func (mc *MultiClient) Download(ctx context.Context, hash string) ([]byte, error) {
+	errs := make([]error, 0, len(mc.Clients))
+	for _, client := range mc.Clients {
+		data, err := client.Download(ctx, hash)
+		if err == nil {
+			return data, nil
+		}
+		errs = append(errs, err)
+	}
+
+	return nil, fmt.Errorf("failed to download %s from all servers: %w", hash, errors.Join(errs...))
+}
+
+// Delete deletes a blob from all the servers.
+func (mc *MultiClient) Delete(ctx context.Context, hash string) error {
+	errs := make([]error, len(mc.Clients))
+	for i, client := range mc.Clients {
+		errs[i] = client.Delete(ctx, hash)
+	}
+	return errors.Join(errs...)
+}
@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 
 	"github.com/nbd-wtf/go-nostr"
+	"github.com/valyala/fasthttp"
 )
 
 // UploadFile uploads a file to the media server
@@ -35,15 +36,94 @@ func (c *Client) UploadFile(ctx context.Context, filePath string) (*BlobDescript
 
 	contentType := mime.TypeByExtension(filepath.Ext(filePath))
 
+	bd, err := c.upload(ctx, "upload", file, size, hex.EncodeToString(hash), contentType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload %s: %w", filePath, err)
+	}
+
+	return bd, nil
+}
+
+// Upload streams a blob to the media server without buffering it. size and hash (the hex sha256 of
+// the contents) must be known beforehand.
+func (c *Client) Upload(ctx context.Context, body io.Reader, size int64, hash string) (*BlobDescriptor, error) {
+	bd, err := c.upload(ctx, "upload", body, size, hash, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload %s: %w", hash, err)
+	}
+
+	return bd, nil
+}
+
+// Media is like Upload, but uses the BUD-05 /media endpoint, so the server may optimize the blob
+// (strip metadata, resize or reencode it). The returned descriptor is that of the resulting blob,
+// which will likely have a different hash.
+func (c *Client) Media(ctx context.Context, body io.Reader, size int64, hash string) (*BlobDescriptor, error) {
+	bd, err := c.upload(ctx, "media", body, size, hash, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload media %s: %w", hash, err)
+	}
+
+	return bd, nil
+}
+
+// CheckUpload asks the media server if it would accept an upload (BUD-06) so it can be rejected
+// before the contents are sent. contentType can be empty.
+func (c *Client) CheckUpload(ctx context.Context, hash string, size int64, contentType string) error {
+	if !nostr.IsValid32ByteHex(hash) {
+		return fmt.Errorf("%s is not a valid 32-byte hex string", hash)
+	}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI(c.mediaserver + "upload")
+	req.Header.SetMethod("HEAD")
+	req.Header.Set("X-SHA-256", hash)
+	req.Header.Set("X-Content-Length", fmt.Sprint(size))
+	if contentType != "" {
+		req.Header.Set("X-Content-Type", contentType)
+	}
+	if auth := c.authorizationHeader(ctx, func(evt *nostr.Event) {
+		evt.Tags = append(evt.Tags, nostr.Tag{"t", "upload"})
+		evt.Tags = append(evt.Tags, nostr.Tag{"x", hash})
+	}); auth != "" {
+		req.Header.Add("Authorization", auth)
+	}
+
+	if err := c.httpClient.Do(req, resp); err != nil {
+		return fmt.Errorf("failed to call upload preflight: %w", err)
+	}
+	if resp.StatusCode() >= 300 {
+		return fmt.Errorf("upload of %s rejected (%d): %s", hash, resp.StatusCode(), resp.Header.Peek("X-Reason"))
+	}
+
+	return nil
+}
+
+func (c *Client) upload(
+	ctx context.Context,
+	endpoint string,
+	body io.Reader,
+	size int64,
+	hash string,
+	contentType string,
+) (*BlobDescriptor, error) {
+	if !nostr.IsValid32ByteHex(hash) {
+		return nil, fmt.Errorf("%s is not a valid 32-byte hex string", hash)
+	}
+
 	bd := BlobDescriptor{}
-	err = c.httpCall(ctx, "PUT", "upload", contentType, func() string {
+	err := c.httpCall(ctx, "PUT", endpoint, contentType, func() string {
 		return c.authorizationHeader(ctx, func(evt *nostr.Event) {
-			evt.Tags = append(evt.Tags, nostr.Tag{"t", "upload"})
-			evt.Tags = append(evt.Tags, nostr.Tag{"x", hex.EncodeToString(hash[:])})
+			evt.Tags = append(evt.Tags, nostr.Tag{"t", endpoint})
+			evt.Tags = append(evt.Tags, nostr.Tag{"x", hash})
 		})
-	}, file, size, &bd)
+	}, body, size, &bd)
 	if err != nil {
-		return nil, fmt.Errorf("failed to upload %s: %w", filePath, err)
+		return nil, err
 	}
 
 	return &bd, nil
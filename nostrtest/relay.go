@@ -0,0 +1,335 @@
+// Package nostrtest provides an in-process NIP-01 relay that runs on an httptest.Server so code
+// that talks to relays can be tested deterministically and offline.
+package nostrtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	ws "github.com/coder/websocket"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip42"
+)
+
+// Relay is a configurable relay for tests. Create it with NewRelay, change whatever fields are
+// necessary and then call Start.
+type Relay struct {
+	// URL is the websocket URL of the relay, it is only set after Start is called.
+	URL string
+
+	// Store holds the events, defaults to a *MemoryStore.
+	Store Store
+
+	// RequireAuth makes the relay reject every REQ, COUNT and EVENT with an "auth-required:" message
+	// until the client performs NIP-42 authentication.
+	RequireAuth bool
+
+	// EOSEDelay is how long the relay will wait before sending an EOSE after the stored events.
+	EOSEDelay time.Duration
+
+	// RejectEvent, if set, is called for every EVENT received. When reject is true the relay answers
+	// with an OK false with the given message and the event is not saved.
+	RejectEvent func(ctx context.Context, evt *nostr.Event) (reject bool, msg string)
+
+	// RejectFilter, if set, is called for every filter in REQ and COUNT messages. When reject is true
+	// the relay answers with a CLOSED with the given message.
+	RejectFilter func(ctx context.Context, filter nostr.Filter) (reject bool, msg string)
+
+	// OnEvent, if set, is called for every event that gets accepted by the relay.
+	OnEvent func(evt *nostr.Event)
+
+	server *httptest.Server
+
+	mu          sync.Mutex
+	connections map[*connection]struct{}
+}
+
+// NewRelay returns a relay backed by a *MemoryStore. It is not listening yet, call Start for that.
+func NewRelay() *Relay {
+	return &Relay{
+		Store:       &MemoryStore{},
+		connections: make(map[*connection]struct{}),
+	}
+}
+
+// Start starts listening on a random local port and returns the relay websocket URL.
+func (r *Relay) Start() string {
+	r.server = httptest.NewServer(r)
+	r.URL = "ws" + strings.TrimPrefix(r.server.URL, "http")
+	return r.URL
+}
+
+// Close drops all connections and stops the server.
+func (r *Relay) Close() {
+	r.DropConnections()
+	if r.server != nil {
+		r.server.Close()
+	}
+}
+
+// DropConnections abruptly closes all websocket connections currently open, as if the relay crashed.
+// New connections are still accepted afterwards.
+func (r *Relay) DropConnections() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for conn := range r.connections {
+		conn.cancel(errors.New("connection dropped"))
+		conn.ws.CloseNow()
+		delete(r.connections, conn)
+	}
+}
+
+// ConnectionCount returns the number of clients currently connected.
+func (r *Relay) ConnectionCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.connections)
+}
+
+type authedKey struct{}
+
+// GetAuthed returns the pubkey that has authenticated on the connection, if any.
+// It can be used inside RejectEvent and RejectFilter.
+func GetAuthed(ctx context.Context) string {
+	if conn, ok := ctx.Value(authedKey{}).(*connection); ok {
+		conn.mu.Lock()
+		defer conn.mu.Unlock()
+		return conn.authed
+	}
+	return ""
+}
+
+type connection struct {
+	ws        *ws.Conn
+	ctx       context.Context
+	cancel    context.CancelCauseFunc
+	challenge string
+
+	mu            sync.Mutex
+	authed        string
+	subscriptions map[string]nostr.Filters
+}
+
+func (conn *connection) write(env nostr.Envelope) error {
+	b, err := env.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return conn.ws.Write(conn.ctx, ws.MessageText, b)
+}
+
+func (r *Relay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	c, err := ws.Accept(w, req, &ws.AcceptOptions{InsecureSkipVerify: true})
+	if err != nil {
+		return
+	}
+	c.SetReadLimit(2 << 24)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	random := make([]byte, 8)
+	rand.Read(random)
+
+	conn := &connection{
+		ws:            c,
+		cancel:        cancel,
+		challenge:     hex.EncodeToString(random),
+		subscriptions: make(map[string]nostr.Filters),
+	}
+	conn.ctx = context.WithValue(ctx, authedKey{}, conn)
+
+	r.mu.Lock()
+	r.connections[conn] = struct{}{}
+	r.mu.Unlock()
+
+	defer func() {
+		cancel(errors.New("connection ended"))
+		r.mu.Lock()
+		delete(r.connections, conn)
+		r.mu.Unlock()
+		c.CloseNow()
+	}()
+
+	conn.write(&nostr.AuthEnvelope{Challenge: &conn.challenge})
+
+	mp := nostr.NewMessageParser()
+	for {
+		_, message, err := c.Read(conn.ctx)
+		if err != nil {
+			return
+		}
+
+		envelope, err := mp.ParseMessage(string(message))
+		if err != nil {
+			notice := nostr.NoticeEnvelope(fmt.Sprintf("failed to parse message: %s", err))
+			conn.write(&notice)
+			continue
+		}
+
+		switch env := envelope.(type) {
+		case *nostr.EventEnvelope:
+			r.handleEvent(conn, &env.Event)
+		case *nostr.ReqEnvelope:
+			r.handleReq(conn, env.SubscriptionID, env.Filters)
+		case *nostr.CountEnvelope:
+			r.handleCount(conn, env.SubscriptionID, env.Filter)
+		case *nostr.CloseEnvelope:
+			conn.mu.Lock()
+			delete(conn.subscriptions, string(*env))
+			conn.mu.Unlock()
+		case *nostr.AuthEnvelope:
+			r.handleAuth(conn, &env.Event)
+		}
+	}
+}
+
+func (r *Relay) handleEvent(conn *connection, evt *nostr.Event) {
+	if !evt.CheckID() {
+		conn.write(&nostr.OKEnvelope{EventID: evt.ID, OK: false, Reason: "invalid: id is computed incorrectly"})
+		return
+	}
+	if ok, _ := evt.CheckSignature(); !ok {
+		conn.write(&nostr.OKEnvelope{EventID: evt.ID, OK: false, Reason: "invalid: signature is invalid"})
+		return
+	}
+
+	if r.RequireAuth && GetAuthed(conn.ctx) == "" {
+		conn.write(&nostr.OKEnvelope{EventID: evt.ID, OK: false, Reason: "auth-required: this relay requires authentication"})
+		return
+	}
+
+	if r.RejectEvent != nil {
+		if reject, msg := r.RejectEvent(conn.ctx, evt); reject {
+			conn.write(&nostr.OKEnvelope{EventID: evt.ID, OK: false, Reason: msg})
+			return
+		}
+	}
+
+	if err := r.Store.SaveEvent(conn.ctx, evt); err != nil {
+		conn.write(&nostr.OKEnvelope{EventID: evt.ID, OK: false, Reason: "error: " + err.Error()})
+		return
+	}
+	conn.write(&nostr.OKEnvelope{EventID: evt.ID, OK: true})
+
+	if r.OnEvent != nil {
+		r.OnEvent(evt)
+	}
+
+	// broadcast to all live subscriptions
+	r.mu.Lock()
+	listeners := make([]*connection, 0, len(r.connections))
+	for other := range r.connections {
+		listeners = append(listeners, other)
+	}
+	r.mu.Unlock()
+
+	for _, other := range listeners {
+		other.mu.Lock()
+		matched := make([]string, 0, len(other.subscriptions))
+		for id, filters := range other.subscriptions {
+			if filters.Match(evt) {
+				matched = append(matched, id)
+			}
+		}
+		other.mu.Unlock()
+
+		for _, id := range matched {
+			other.write(&nostr.EventEnvelope{SubscriptionID: &id, Event: *evt})
+		}
+	}
+}
+
+func (r *Relay) handleReq(conn *connection, id string, filters nostr.Filters) {
+	if reason := r.checkFilters(conn, filters); reason != "" {
+		conn.write(&nostr.ClosedEnvelope{SubscriptionID: id, Reason: reason})
+		return
+	}
+
+	// register before querying so we don't miss anything that comes in the meantime
+	conn.mu.Lock()
+	conn.subscriptions[id] = filters
+	conn.mu.Unlock()
+
+	for _, filter := range filters {
+		events, err := r.Store.QueryEvents(conn.ctx, filter)
+		if err != nil {
+			conn.mu.Lock()
+			delete(conn.subscriptions, id)
+			conn.mu.Unlock()
+			conn.write(&nostr.ClosedEnvelope{SubscriptionID: id, Reason: "error: " + err.Error()})
+			return
+		}
+		for _, evt := range events {
+			conn.write(&nostr.EventEnvelope{SubscriptionID: &id, Event: *evt})
+		}
+	}
+
+	if r.EOSEDelay > 0 {
+		go func() {
+			select {
+			case <-time.After(r.EOSEDelay):
+				eose := nostr.EOSEEnvelope(id)
+				conn.write(&eose)
+			case <-conn.ctx.Done():
+			}
+		}()
+		return
+	}
+
+	eose := nostr.EOSEEnvelope(id)
+	conn.write(&eose)
+}
+
+func (r *Relay) handleCount(conn *connection, id string, filter nostr.Filter) {
+	if reason := r.checkFilters(conn, nostr.Filters{filter}); reason != "" {
+		conn.write(&nostr.ClosedEnvelope{SubscriptionID: id, Reason: reason})
+		return
+	}
+
+	filter.Limit = 0
+	events, err := r.Store.QueryEvents(conn.ctx, filter)
+	if err != nil {
+		conn.write(&nostr.ClosedEnvelope{SubscriptionID: id, Reason: "error: " + err.Error()})
+		return
+	}
+	count := int64(len(events))
+	conn.write(&nostr.CountEnvelope{SubscriptionID: id, Count: &count})
+}
+
+func (r *Relay) handleAuth(conn *connection, evt *nostr.Event) {
+	pubkey, ok := nip42.ValidateAuthEvent(evt, conn.challenge, r.URL)
+	if !ok {
+		conn.write(&nostr.OKEnvelope{EventID: evt.ID, OK: false, Reason: "error: failed to authenticate"})
+		return
+	}
+
+	conn.mu.Lock()
+	conn.authed = pubkey
+	conn.mu.Unlock()
+	conn.write(&nostr.OKEnvelope{EventID: evt.ID, OK: true})
+}
+
+// checkFilters returns a reason for closing the subscription or an empty string if it is fine.
+func (r *Relay) checkFilters(conn *connection, filters nostr.Filters) string {
+	if r.RequireAuth && GetAuthed(conn.ctx) == "" {
+		return "auth-required: this relay requires authentication"
+	}
+
+	if r.RejectFilter != nil {
+		for _, filter := range filters {
+			if reject, msg := r.RejectFilter(conn.ctx, filter); reject {
+				return msg
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,180 @@
+package nostrtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/require"
+)
+
+func makeEvent(t *testing.T, sk string, kind int, content string) nostr.Event {
+	t.Helper()
+	evt := nostr.Event{Kind: kind, Content: content, CreatedAt: nostr.Now()}
+	require.NoError(t, evt.Sign(sk))
+	return evt
+}
+
+func TestPublishAndQuery(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	relay := NewRelay()
+	url := relay.Start()
+	defer relay.Close()
+
+	sk := nostr.GeneratePrivateKey()
+	rl, err := nostr.RelayConnect(ctx, url)
+	require.NoError(t, err)
+	defer rl.Close()
+
+	note := makeEvent(t, sk, 1, "hello")
+	require.NoError(t, rl.Publish(ctx, note))
+	require.NoError(t, rl.Publish(ctx, makeEvent(t, sk, 7, "+")))
+
+	events, err := rl.QuerySync(ctx, nostr.Filter{Kinds: []int{1}})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, note.ID, events[0].ID)
+
+	count, _, err := rl.Count(ctx, nostr.Filters{{Authors: []string{note.PubKey}}})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+
+	// live events
+	sub, err := rl.Subscribe(ctx, nostr.Filters{{Kinds: []int{1}, Since: &note.CreatedAt}})
+	require.NoError(t, err)
+
+	other := makeEvent(t, sk, 1, "live")
+	pool := nostr.NewSimplePool(ctx)
+	for res := range pool.PublishMany(ctx, []string{url}, other) {
+		require.NoError(t, res.Error)
+	}
+
+	ids := make([]string, 0, 2)
+	for len(ids) < 2 {
+		select {
+		case evt := <-sub.Events:
+			ids = append(ids, evt.ID)
+		case <-ctx.Done():
+			t.Fatalf("timeout")
+		}
+	}
+	require.ElementsMatch(t, []string{note.ID, other.ID}, ids)
+}
+
+func TestReplaceable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	relay := NewRelay()
+	url := relay.Start()
+	defer relay.Close()
+
+	sk := nostr.GeneratePrivateKey()
+	rl, err := nostr.RelayConnect(ctx, url)
+	require.NoError(t, err)
+
+	first := makeEvent(t, sk, 0, `{"name":"a"}`)
+	second := nostr.Event{Kind: 0, Content: `{"name":"b"}`, CreatedAt: first.CreatedAt + 1}
+	second.Sign(sk)
+	require.NoError(t, rl.Publish(ctx, second))
+	require.NoError(t, rl.Publish(ctx, first))
+
+	events, err := rl.QuerySync(ctx, nostr.Filter{Kinds: []int{0}})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, second.ID, events[0].ID)
+}
+
+func TestAuthRequired(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	relay := NewRelay()
+	relay.RequireAuth = true
+	url := relay.Start()
+	defer relay.Close()
+
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+
+	rl, err := nostr.RelayConnect(ctx, url)
+	require.NoError(t, err)
+
+	err = rl.Publish(ctx, makeEvent(t, sk, 1, "hello"))
+	require.ErrorContains(t, err, "auth-required:")
+
+	authed := false
+	pool := nostr.NewSimplePool(ctx, nostr.WithAuthHandler(func(ctx context.Context, ie nostr.RelayEvent) error {
+		authed = true
+		return ie.Sign(sk)
+	}))
+	for res := range pool.PublishMany(ctx, []string{url}, makeEvent(t, sk, 1, "hello")) {
+		require.NoError(t, res.Error)
+	}
+	require.True(t, authed)
+
+	evt := pool.QuerySingle(ctx, []string{url}, nostr.Filter{Authors: []string{pk}})
+	require.NotNil(t, evt)
+}
+
+func TestRejections(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	relay := NewRelay()
+	relay.RejectEvent = func(ctx context.Context, evt *nostr.Event) (bool, string) {
+		return evt.Kind == 4, "blocked: no dms"
+	}
+	relay.RejectFilter = func(ctx context.Context, filter nostr.Filter) (bool, string) {
+		return len(filter.Kinds) == 0, "restricted: must specify kinds"
+	}
+	url := relay.Start()
+	defer relay.Close()
+
+	sk := nostr.GeneratePrivateKey()
+	rl, err := nostr.RelayConnect(ctx, url)
+	require.NoError(t, err)
+
+	err = rl.Publish(ctx, makeEvent(t, sk, 4, "secret"))
+	require.ErrorContains(t, err, "blocked: no dms")
+
+	sub, err := rl.Subscribe(ctx, nostr.Filters{{Limit: 10}})
+	require.NoError(t, err)
+	select {
+	case reason := <-sub.ClosedReason:
+		require.Equal(t, "restricted: must specify kinds", reason)
+	case <-ctx.Done():
+		t.Fatalf("timeout")
+	}
+}
+
+func TestEOSEDelayAndDrop(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	relay := NewRelay()
+	relay.EOSEDelay = 200 * time.Millisecond
+	url := relay.Start()
+	defer relay.Close()
+
+	rl, err := nostr.RelayConnect(ctx, url)
+	require.NoError(t, err)
+
+	start := time.Now()
+	sub, err := rl.Subscribe(ctx, nostr.Filters{{Kinds: []int{1}}})
+	require.NoError(t, err)
+	<-sub.EndOfStoredEvents
+	require.GreaterOrEqual(t, time.Since(start), relay.EOSEDelay)
+
+	require.Equal(t, 1, relay.ConnectionCount())
+	relay.DropConnections()
+
+	select {
+	case <-rl.Context().Done():
+	case <-ctx.Done():
+		t.Fatalf("relay connection should have been closed")
+	}
+}
@@ -0,0 +1,85 @@
+package nostrtest
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Store is what the test relay uses to save and query events, it can be replaced by anything.
+type Store interface {
+	SaveEvent(ctx context.Context, evt *nostr.Event) error
+	QueryEvents(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error)
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// MemoryStore keeps all events in a slice sorted from newest to oldest.
+// It handles replaceable and addressable events, ephemeral events are never stored.
+type MemoryStore struct {
+	mu     sync.Mutex
+	events []*nostr.Event
+}
+
+func (ms *MemoryStore) SaveEvent(_ context.Context, evt *nostr.Event) error {
+	if nostr.IsEphemeralKind(evt.Kind) {
+		return nil
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if nostr.IsReplaceableKind(evt.Kind) || nostr.IsAddressableKind(evt.Kind) {
+		d := evt.Tags.GetD()
+		for i, existing := range ms.events {
+			if existing.Kind == evt.Kind && existing.PubKey == evt.PubKey &&
+				(nostr.IsReplaceableKind(evt.Kind) || existing.Tags.GetD() == d) {
+				if existing.CreatedAt > evt.CreatedAt {
+					// we already have a newer version
+					return nil
+				}
+				ms.events = slices.Delete(ms.events, i, i+1)
+				break
+			}
+		}
+	} else {
+		for _, existing := range ms.events {
+			if existing.ID == evt.ID {
+				return nil
+			}
+		}
+	}
+
+	idx, _ := slices.BinarySearchFunc(ms.events, evt, nostr.CompareEventPtrReverse)
+	ms.events = slices.Insert(ms.events, idx, evt)
+	return nil
+}
+
+func (ms *MemoryStore) QueryEvents(_ context.Context, filter nostr.Filter) ([]*nostr.Event, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if filter.LimitZero {
+		return nil, nil
+	}
+
+	results := make([]*nostr.Event, 0, min(len(ms.events), max(filter.Limit, 10)))
+	for _, evt := range ms.events {
+		if filter.Matches(evt) {
+			results = append(results, evt)
+			if filter.Limit > 0 && len(results) == filter.Limit {
+				break
+			}
+		}
+	}
+	return results, nil
+}
+
+// Len returns the number of events currently stored.
+func (ms *MemoryStore) Len() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return len(ms.events)
+}
@@ -24,6 +24,7 @@ const (
 type SimplePool struct {
 	Relays  *xsync.MapOf[string, *Relay]
 	Context context.Context
+	Stats   *RelayStats // only set when WithRelayStats() is used
 
 	authHandler func(context.Context, RelayEvent) error
 	cancel      context.CancelCauseFunc
@@ -36,6 +37,16 @@ type SimplePool struct {
 	penaltyBoxMu sync.Mutex
 	penaltyBox   map[string][2]float64
 	relayOptions []RelayOption
+
+	// limits, see pool_limits.go
+	limits                  *xsync.MapOf[string, *relayLimits]
+	evictMu                 sync.Mutex
+	connecting              atomic.Int32
+	maxConnections          int
+	limitSubscriptions      bool
+	defaultMaxSubscriptions int
+	publishRate             float64
+	publishBurst            int
 }
 
 // DirectedFilter combines a Filter with a specific relay URL.
@@ -63,6 +74,7 @@ func NewSimplePool(ctx context.Context, opts ...PoolOption) *SimplePool {
 
 	pool := &SimplePool{
 		Relays: xsync.NewMapOf[string, *Relay](),
+		limits: xsync.NewMapOf[string, *relayLimits](),
 
 		Context: ctx,
 		cancel:  cancel,
@@ -161,11 +173,16 @@ var (
 )
 
 // EnsureRelay ensures that a relay connection exists and is active.
-// If the relay is not connected, it attempts to connect.
+// If the relay is not connected, it attempts to connect. Relays that are reconnecting (see WithReconnect)
+// are returned as they are, only relays that were closed are replaced.
 func (pool *SimplePool) EnsureRelay(url string) (*Relay, error) {
 	nm := NormalizeURL(url)
 	defer namedLock(nm)()
 
+	if pool.maxConnections > 0 {
+		pool.getLimits(nm).lastUsed.Store(time.Now().UnixNano())
+	}
+
 	relay, ok := pool.Relays.Load(nm)
 	if ok && relay == nil {
 		if pool.penaltyBox != nil {
@@ -176,11 +193,19 @@ func (pool *SimplePool) EnsureRelay(url string) (*Relay, error) {
 				return nil, fmt.Errorf("in penalty box, %fs remaining", v[1])
 			}
 		}
-	} else if ok && relay.IsConnected() {
-		// already connected, unlock and return
+	} else if ok && relay.connectionContext.Err() == nil {
+		// either connected or waiting to reconnect (and then its subscriptions will be resumed),
+		// in both cases we must keep it
 		return relay, nil
 	}
 
+	if pool.maxConnections > 0 {
+		if err := pool.reserveConnection(nm); err != nil {
+			return nil, err
+		}
+		defer pool.connecting.Add(-1)
+	}
+
 	// try to connect
 	// we use this ctx here so when the pool dies everything dies
 	ctx, cancel := context.WithTimeoutCause(
@@ -191,7 +216,9 @@ func (pool *SimplePool) EnsureRelay(url string) (*Relay, error) {
 	defer cancel()
 
 	relay = NewRelay(context.Background(), url, pool.relayOptions...)
-	if err := relay.Connect(ctx); err != nil {
+	err := relay.Connect(ctx)
+	pool.Stats.connected(nm, err)
+	if err != nil {
 		if pool.penaltyBox != nil {
 			// putting relay in penalty box
 			pool.penaltyBoxMu.Lock()
@@ -230,15 +257,31 @@ func (pool *SimplePool) PublishMany(ctx context.Context, urls []string, evt Even
 					return
 				}
 
-				if err := relay.Publish(ctx, evt); err == nil {
+				if err := pool.WaitPublish(ctx, url); err != nil {
+					ch <- PublishResult{err, url, relay}
+					return
+				}
+
+				err = relay.Publish(ctx, evt)
+				pool.Stats.RecordPublish(url, err)
+				if err == nil {
 					// success with no auth required
 					ch <- PublishResult{nil, url, relay}
 				} else if strings.HasPrefix(err.Error(), "msg: auth-required:") && pool.authHandler != nil {
+					pool.Stats.authChallenge(relay.URL)
+
 					// try to authenticate if we can
 					if authErr := relay.Auth(ctx, func(event *Event) error {
 						return pool.authHandler(ctx, RelayEvent{Event: event, Relay: relay})
 					}); authErr == nil {
-						if err := relay.Publish(ctx, evt); err == nil {
+						if err := pool.WaitPublish(ctx, url); err != nil {
+							ch <- PublishResult{err, url, relay}
+							return
+						}
+
+						err := relay.Publish(ctx, evt)
+						pool.Stats.RecordPublish(url, err)
+						if err == nil {
 							// success after auth
 							ch <- PublishResult{nil, url, relay}
 						} else {
@@ -314,6 +357,9 @@ type ReplaceableKey struct {
 
 // FetchManyReplaceable is like FetchMany, but deduplicates replaceable and addressable events and returns
 // only the latest for each "d" tag.
+//
+// When the pool has RelayStats the relays with the best scores are queried first and the others only
+// after these are done or a short head start has passed.
 func (pool *SimplePool) FetchManyReplaceable(
 	ctx context.Context,
 	urls []string,
@@ -323,9 +369,9 @@ func (pool *SimplePool) FetchManyReplaceable(
 	ctx, cancel := context.WithCancelCause(ctx)
 
 	results := xsync.NewMapOf[ReplaceableKey, *Event]()
+	best, rest := pool.Stats.headStart(urls)
 
 	wg := sync.WaitGroup{}
-	wg.Add(len(urls))
 
 	seenAlreadyLatest := xsync.NewMapOf[ReplaceableKey, Timestamp]()
 	opts = append(opts, WithCheckDuplicateReplaceable(func(rk ReplaceableKey, ts Timestamp) bool {
@@ -340,69 +386,88 @@ func (pool *SimplePool) FetchManyReplaceable(
 		return updated
 	}))
 
-	for _, url := range urls {
-		go func(nm string) {
-			defer wg.Done()
+	query := func(nm string) {
+		defer wg.Done()
 
-			if mh := pool.queryMiddleware; mh != nil {
-				if filter.Kinds != nil && filter.Authors != nil {
-					for _, kind := range filter.Kinds {
-						for _, author := range filter.Authors {
-							mh(nm, author, kind)
-						}
+		if mh := pool.queryMiddleware; mh != nil {
+			if filter.Kinds != nil && filter.Authors != nil {
+				for _, kind := range filter.Kinds {
+					for _, author := range filter.Authors {
+						mh(nm, author, kind)
 					}
 				}
 			}
+		}
 
-			relay, err := pool.EnsureRelay(nm)
-			if err != nil {
-				debugLogf("error connecting to %s with %v: %s", nm, filter, err)
-				return
-			}
+		relay, err := pool.EnsureRelay(nm)
+		if err != nil {
+			debugLogf("error connecting to %s with %v: %s", nm, filter, err)
+			return
+		}
 
-			hasAuthed := false
+		hasAuthed := false
 
-		subscribe:
-			sub, err := relay.Subscribe(ctx, Filters{filter}, opts...)
-			if err != nil {
-				debugLogf("error subscribing to %s with %v: %s", relay, filter, err)
+	subscribe:
+		sub, err := pool.subscribe(ctx, relay, Filters{filter}, opts...)
+		if err != nil {
+			debugLogf("error subscribing to %s with %v: %s", relay, filter, err)
+			return
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
 				return
-			}
+			case <-sub.EndOfStoredEvents:
+				return
+			case reason := <-sub.ClosedReason:
+				if strings.HasPrefix(reason, "auth-required:") && pool.authHandler != nil && !hasAuthed {
+					pool.Stats.authChallenge(relay.URL)
 
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case <-sub.EndOfStoredEvents:
-					return
-				case reason := <-sub.ClosedReason:
-					if strings.HasPrefix(reason, "auth-required:") && pool.authHandler != nil && !hasAuthed {
-						// relay is requesting auth. if we can we will perform auth and try again
-						err := relay.Auth(ctx, func(event *Event) error {
-							return pool.authHandler(ctx, RelayEvent{Event: event, Relay: relay})
-						})
-						if err == nil {
-							hasAuthed = true // so we don't keep doing AUTH again and again
-							goto subscribe
-						}
+					// relay is requesting auth. if we can we will perform auth and try again
+					err := relay.Auth(ctx, func(event *Event) error {
+						return pool.authHandler(ctx, RelayEvent{Event: event, Relay: relay})
+					})
+					if err == nil {
+						hasAuthed = true // so we don't keep doing AUTH again and again
+						goto subscribe
 					}
-					debugLogf("CLOSED from %s: '%s'\n", nm, reason)
+				}
+				debugLogf("CLOSED from %s: '%s'\n", nm, reason)
+				return
+			case evt, more := <-sub.Events:
+				if !more {
 					return
-				case evt, more := <-sub.Events:
-					if !more {
-						return
-					}
-
-					ie := RelayEvent{Event: evt, Relay: relay}
-					if mh := pool.eventMiddleware; mh != nil {
-						mh(ie)
-					}
+				}
 
-					results.Store(ReplaceableKey{evt.PubKey, evt.Tags.GetD()}, evt)
+				ie := RelayEvent{Event: evt, Relay: relay}
+				pool.Stats.event(relay.URL)
+				if mh := pool.eventMiddleware; mh != nil {
+					mh(ie)
 				}
+
+				results.Store(ReplaceableKey{evt.PubKey, evt.Tags.GetD()}, evt)
 			}
+		}
+	}
+
+	// the best relays go first, the others only after they're done or a while has passed
+	bestWg := sync.WaitGroup{}
+	wg.Add(len(best))
+	bestWg.Add(len(best))
+	for _, url := range best {
+		go func(nm string) {
+			defer bestWg.Done()
+			query(nm)
 		}(NormalizeURL(url))
 	}
+	if len(rest) > 0 {
+		waitHeadStart(ctx, &bestWg)
+		wg.Add(len(rest))
+		for _, url := range rest {
+			go query(NormalizeURL(url))
+		}
+	}
 
 	// this will happen when all subscriptions get an eose (or when they die)
 	wg.Wait()
@@ -490,10 +555,10 @@ func (pool *SimplePool) subMany(
 				hasAuthed = false
 
 			subscribe:
-				sub, err = relay.Subscribe(ctx, filters, append(opts, WithCheckDuplicate(func(id, relay string) bool {
+				sub, err = pool.subscribe(ctx, relay, filters, append(opts, WithCheckDuplicate(func(id, relay string) bool {
 					_, exists := seenAlready.LoadAndStore(id, Timestamp(time.Now().Unix()))
-					if exists && pool.duplicateMiddleware != nil {
-						pool.duplicateMiddleware(relay, id)
+					if exists {
+						pool.reportDuplicate(relay, id)
 					}
 					return exists
 				}))...)
@@ -530,6 +595,7 @@ func (pool *SimplePool) subMany(
 						}
 
 						ie := RelayEvent{Event: evt, Relay: relay}
+						pool.Stats.event(relay.URL)
 						if mh := pool.eventMiddleware; mh != nil {
 							mh(ie)
 						}
@@ -550,6 +616,8 @@ func (pool *SimplePool) subMany(
 						}
 					case reason := <-sub.ClosedReason:
 						if strings.HasPrefix(reason, "auth-required:") && pool.authHandler != nil && !hasAuthed {
+							pool.Stats.authChallenge(relay.URL)
+
 							// relay is requesting auth. if we can we will perform auth and try again
 							err := relay.Auth(ctx, func(event *Event) error {
 								return pool.authHandler(ctx, RelayEvent{Event: event, Relay: relay})
@@ -591,8 +659,8 @@ func (pool *SimplePool) SubManyEose(
 	return pool.subManyEoseNonOverwriteCheckDuplicate(ctx, urls, filters,
 		WithCheckDuplicate(func(id, relay string) bool {
 			_, exists := seenAlready.LoadOrStore(id, struct{}{})
-			if exists && pool.duplicateMiddleware != nil {
-				pool.duplicateMiddleware(relay, id)
+			if exists {
+				pool.reportDuplicate(relay, id)
 			}
 			return exists
 		}),
@@ -646,7 +714,7 @@ func (pool *SimplePool) subManyEoseNonOverwriteCheckDuplicate(
 			hasAuthed := false
 
 		subscribe:
-			sub, err := relay.Subscribe(ctx, filters, opts...)
+			sub, err := pool.subscribe(ctx, relay, filters, opts...)
 			if err != nil {
 				debugLogf("error subscribing to %s with %v: %s", relay, filters, err)
 				return
@@ -660,6 +728,8 @@ func (pool *SimplePool) subManyEoseNonOverwriteCheckDuplicate(
 					return
 				case reason := <-sub.ClosedReason:
 					if strings.HasPrefix(reason, "auth-required:") && pool.authHandler != nil && !hasAuthed {
+						pool.Stats.authChallenge(relay.URL)
+
 						// relay is requesting auth. if we can we will perform auth and try again
 						err := relay.Auth(ctx, func(event *Event) error {
 							return pool.authHandler(ctx, RelayEvent{Event: event, Relay: relay})
@@ -677,6 +747,7 @@ func (pool *SimplePool) subManyEoseNonOverwriteCheckDuplicate(
 					}
 
 					ie := RelayEvent{Event: evt, Relay: relay}
+					pool.Stats.event(relay.URL)
 					if mh := pool.eventMiddleware; mh != nil {
 						mh(ie)
 					}
@@ -712,7 +783,12 @@ func (pool *SimplePool) CountMany(
 			if err != nil {
 				return
 			}
+			release, err := pool.acquireSubscription(ctx, relay)
+			if err != nil {
+				return
+			}
 			ce, err := relay.countInternal(ctx, Filters{filter}, opts...)
+			release()
 			if err != nil {
 				return
 			}
@@ -728,6 +804,9 @@ func (pool *SimplePool) CountMany(
 }
 
 // QuerySingle returns the first event returned by the first relay, cancels everything else.
+//
+// When the pool has RelayStats the relays with the best scores are queried first and the others only
+// if these don't have the event or don't answer within a short head start.
 func (pool *SimplePool) QuerySingle(
 	ctx context.Context,
 	urls []string,
@@ -735,7 +814,30 @@ func (pool *SimplePool) QuerySingle(
 	opts ...SubscriptionOption,
 ) *RelayEvent {
 	ctx, cancel := context.WithCancelCause(ctx)
-	for ievt := range pool.SubManyEose(ctx, urls, Filters{filter}, opts...) {
+	best, rest := pool.Stats.headStart(urls)
+
+	// the best relays go first, the others are only asked if these don't have it or take too long
+	events := pool.SubManyEose(ctx, best, Filters{filter}, opts...)
+	if len(rest) > 0 {
+		timer := time.NewTimer(scoreHeadStart)
+		defer timer.Stop()
+
+		select {
+		case ievt, ok := <-events:
+			if ok {
+				cancel(errors.New("got the first event and ended successfully"))
+				return &ievt
+			}
+			events = pool.SubManyEose(ctx, rest, Filters{filter}, opts...)
+		case <-timer.C:
+			events = mergeRelayEvents(ctx, events, pool.SubManyEose(ctx, rest, Filters{filter}, opts...))
+		case <-ctx.Done():
+			cancel(errors.New("context done before any event"))
+			return nil
+		}
+	}
+
+	for ievt := range events {
 		cancel(errors.New("got the first event and ended successfully"))
 		return &ievt
 	}
@@ -743,6 +845,30 @@ func (pool *SimplePool) QuerySingle(
 	return nil
 }
 
+// mergeRelayEvents reads from all chans into a single one that is closed once they are all closed.
+func mergeRelayEvents(ctx context.Context, chans ...chan RelayEvent) chan RelayEvent {
+	res := make(chan RelayEvent)
+	wg := sync.WaitGroup{}
+	wg.Add(len(chans))
+	for _, ch := range chans {
+		go func() {
+			defer wg.Done()
+			for ievt := range ch {
+				select {
+				case res <- ievt:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(res)
+	}()
+	return res
+}
+
 // BatchedSubManyEose performs batched subscriptions to multiple relays with different filters.
 func (pool *SimplePool) BatchedSubManyEose(
 	ctx context.Context,
@@ -761,8 +887,8 @@ func (pool *SimplePool) BatchedSubManyEose(
 				Filters{df.Filter},
 				WithCheckDuplicate(func(id, relay string) bool {
 					_, exists := seenAlready.LoadOrStore(id, struct{}{})
-					if exists && pool.duplicateMiddleware != nil {
-						pool.duplicateMiddleware(relay, id)
+					if exists {
+						pool.reportDuplicate(relay, id)
 					}
 					return exists
 				}), opts...,
@@ -786,6 +912,13 @@ func (pool *SimplePool) BatchedSubManyEose(
 	return res
 }
 
+func (pool *SimplePool) reportDuplicate(relay string, id string) {
+	pool.Stats.duplicate(relay)
+	if pool.duplicateMiddleware != nil {
+		pool.duplicateMiddleware(relay, id)
+	}
+}
+
 // Close closes the pool with the given reason.
 func (pool *SimplePool) Close(reason string) {
 	pool.cancel(fmt.Errorf("pool closed with reason: '%s'", reason))
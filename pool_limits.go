@@ -0,0 +1,321 @@
+package nostr
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// relayLimits is the state the pool keeps for each relay in order to enforce the limits
+// set with WithMaxConnections, WithMaxSubscriptions and WithPublishRateLimit.
+type relayLimits struct {
+	lastUsed atomic.Int64 // unix nanoseconds of the last EnsureRelay() call for this relay
+
+	subsOnce sync.Once
+	subsMu   sync.Mutex
+	maxSubs  int             // from NIP-11 once we get it, the pool default until then, 0 means unlimited
+	openSubs int             // includes the ones that were given a slot but haven't sent their REQ yet
+	waiting  []chan struct{} // subscriptions waiting for a slot, each is closed when it gets one
+
+	bucketMu sync.Mutex
+	tokens   float64
+	refilled time.Time
+}
+
+// WithMaxConnections limits how many relay connections the pool keeps open at the same time.
+//
+// When the limit is reached and a connection to a new relay is needed, the least recently used relays
+// that have no open subscriptions and no publishes waiting for an OK are disconnected to make room. If
+// not enough of them are idle the connection fails (subscriptions will keep trying to reconnect with
+// backoff as usual).
+type WithMaxConnections int
+
+func (h WithMaxConnections) ApplyPoolOption(pool *SimplePool) {
+	pool.maxConnections = int(h)
+}
+
+// WithMaxSubscriptions makes the pool respect the "max_subscriptions" limitation advertised in the
+// NIP-11 document of each relay, the given value is used for relays that don't advertise anything and
+// while their NIP-11 document is still being fetched (0 means unlimited).
+//
+// REQs that would go over the limit are queued and sent, in order, as soon as previous subscriptions
+// to the same relay end.
+type WithMaxSubscriptions int
+
+func (h WithMaxSubscriptions) ApplyPoolOption(pool *SimplePool) {
+	pool.limitSubscriptions = true
+	pool.defaultMaxSubscriptions = int(h)
+}
+
+// WithPublishRateLimit sets a token-bucket limit on how many events per second can be published to
+// each relay, allowing bursts of up to burst events. Publishes over the limit wait for their turn.
+func WithPublishRateLimit(perSecond float64, burst int) withPublishRateLimitOpt {
+	return withPublishRateLimitOpt{perSecond, max(burst, 1)}
+}
+
+type withPublishRateLimitOpt struct {
+	rate  float64
+	burst int
+}
+
+func (h withPublishRateLimitOpt) ApplyPoolOption(pool *SimplePool) {
+	pool.publishRate = h.rate
+	pool.publishBurst = h.burst
+}
+
+var (
+	_ PoolOption = WithMaxConnections(0)
+	_ PoolOption = WithMaxSubscriptions(0)
+	_ PoolOption = WithPublishRateLimit(1, 1)
+)
+
+// getLimits returns the state for the given relay, creating it if needed. It must only be called
+// when one of the limits is set, so we don't keep anything around for every relay ever used.
+func (pool *SimplePool) getLimits(nm string) *relayLimits {
+	limits, _ := pool.limits.LoadOrCompute(nm, func() *relayLimits {
+		return &relayLimits{
+			tokens:   float64(pool.publishBurst),
+			refilled: time.Now(),
+		}
+	})
+	return limits
+}
+
+// reserveConnection makes sure there is room for one more connection, evicting the least recently used
+// idle relays if necessary. The caller must call pool.connecting.Add(-1) when it's done connecting.
+func (pool *SimplePool) reserveConnection(nm string) error {
+	pool.evictMu.Lock()
+	defer pool.evictMu.Unlock()
+
+	type candidate struct {
+		relay    *Relay
+		lastUsed int64
+	}
+
+	open := int(pool.connecting.Load())
+	idle := make([]candidate, 0, pool.maxConnections)
+	for url, relay := range pool.Relays.Range {
+		// relays waiting to reconnect still count, they will be connected again soon
+		if relay == nil || url == nm || (!relay.IsConnected() && !relay.IsReconnecting()) {
+			continue
+		}
+		open++
+
+		// don't kill subscriptions or publishes that are waiting for an OK
+		if relay.Subscriptions.Size() > 0 || relay.okCallbacks.Size() > 0 || relay.pendingPublishes.Size() > 0 {
+			continue
+		}
+		var lastUsed int64
+		if limits, ok := pool.limits.Load(url); ok {
+			lastUsed = limits.lastUsed.Load()
+		}
+		idle = append(idle, candidate{relay, lastUsed})
+	}
+
+	if excess := open - pool.maxConnections + 1; excess > 0 {
+		if excess > len(idle) {
+			return fmt.Errorf("too many connections (%d) and only %d of them are idle", open, len(idle))
+		}
+
+		slices.SortFunc(idle, func(a, b candidate) int { return cmp.Compare(a.lastUsed, b.lastUsed) })
+		for _, c := range idle[0:excess] {
+			debugLogf("disconnecting from %s to make room for %s\n", c.relay.URL, nm)
+			pool.Relays.Delete(c.relay.URL)
+			pool.limits.Delete(c.relay.URL)
+			c.relay.Close()
+		}
+	}
+
+	pool.connecting.Add(1)
+	return nil
+}
+
+// subscribe is like relay.Subscribe(), but it waits for a free slot first if the pool is
+// limiting the number of subscriptions per relay.
+func (pool *SimplePool) subscribe(
+	ctx context.Context,
+	relay *Relay,
+	filters Filters,
+	opts ...SubscriptionOption,
+) (*Subscription, error) {
+	release, err := pool.acquireSubscription(ctx, relay)
+	if err != nil {
+		return nil, err
+	}
+
+	if pool.Stats != nil {
+		start := time.Now()
+		opts = append(opts, withEOSEHook(func() { pool.Stats.eose(relay.URL, time.Since(start)) }))
+	}
+
+	sub, err := relay.Subscribe(ctx, filters, opts...)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	pool.Stats.subscribed(relay.URL)
+
+	go func() {
+		<-sub.Context.Done()
+		// this ensures the CLOSE was sent before the next REQ can go
+		sub.unsub(context.Cause(sub.Context))
+		release()
+	}()
+
+	return sub, nil
+}
+
+// acquireSubscription takes a subscription slot for the relay, waiting in line if all are taken.
+func (pool *SimplePool) acquireSubscription(ctx context.Context, relay *Relay) (release func(), err error) {
+	if !pool.limitSubscriptions {
+		return func() {}, nil
+	}
+
+	limits := pool.getLimits(relay.URL)
+	limits.subsOnce.Do(func() {
+		limits.subsMu.Lock()
+		limits.maxSubs = pool.defaultMaxSubscriptions
+		limits.subsMu.Unlock()
+
+		// we won't make anyone wait for this, the default is used until it arrives
+		go func() {
+			if n := fetchMaxSubscriptions(pool.Context, relay.URL); n > 0 {
+				limits.subsMu.Lock()
+				limits.maxSubs = n
+				limits.admitWaiting()
+				limits.subsMu.Unlock()
+			}
+		}()
+	})
+
+	limits.subsMu.Lock()
+	if len(limits.waiting) == 0 && limits.hasFreeSubscriptionSlot() {
+		limits.openSubs++
+		limits.subsMu.Unlock()
+		return limits.releaseSubscription, nil
+	}
+	turn := make(chan struct{})
+	limits.waiting = append(limits.waiting, turn)
+	limits.subsMu.Unlock()
+
+	select {
+	case <-turn:
+		return limits.releaseSubscription, nil
+	case <-ctx.Done():
+		err = fmt.Errorf("waiting for a subscription slot on %s: %w", relay.URL, context.Cause(ctx))
+	case <-relay.Context().Done():
+		err = fmt.Errorf("relay %s disconnected while waiting for a subscription slot", relay.URL)
+	}
+
+	limits.subsMu.Lock()
+	if idx := slices.Index(limits.waiting, turn); idx != -1 {
+		limits.waiting = slices.Delete(limits.waiting, idx, idx+1)
+		limits.subsMu.Unlock()
+	} else {
+		// we got a slot just as we were giving up, so pass it on
+		limits.subsMu.Unlock()
+		limits.releaseSubscription()
+	}
+	return nil, err
+}
+
+func (limits *relayLimits) releaseSubscription() {
+	limits.subsMu.Lock()
+	limits.openSubs--
+	limits.admitWaiting()
+	limits.subsMu.Unlock()
+}
+
+// admitWaiting gives the free slots to the subscriptions that are waiting, in order.
+// It must be called with subsMu locked.
+func (limits *relayLimits) admitWaiting() {
+	for len(limits.waiting) > 0 && limits.hasFreeSubscriptionSlot() {
+		close(limits.waiting[0])
+		limits.waiting = limits.waiting[1:]
+		limits.openSubs++
+	}
+}
+
+func (limits *relayLimits) hasFreeSubscriptionSlot() bool {
+	return limits.maxSubs <= 0 || limits.openSubs < limits.maxSubs
+}
+
+// WaitPublish blocks until the publish rate limit set with WithPublishRateLimit allows another event
+// to be sent to the given relay. It returns immediately if there is no limit.
+//
+// The pool calls this automatically, it's only needed when calling relay.Publish() directly.
+func (pool *SimplePool) WaitPublish(ctx context.Context, url string) error {
+	if pool.publishRate <= 0 {
+		return nil
+	}
+
+	limits := pool.getLimits(NormalizeURL(url))
+
+	// take a token now, even if it leaves the bucket negative, so whoever comes next has to wait longer
+	limits.bucketMu.Lock()
+	now := time.Now()
+	limits.tokens = min(
+		float64(pool.publishBurst),
+		limits.tokens+now.Sub(limits.refilled).Seconds()*pool.publishRate,
+	)
+	limits.refilled = now
+	limits.tokens--
+	wait := time.Duration(-limits.tokens / pool.publishRate * float64(time.Second))
+	limits.bucketMu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// give the token back since we didn't use it
+		limits.bucketMu.Lock()
+		limits.tokens++
+		limits.bucketMu.Unlock()
+		return context.Cause(ctx)
+	}
+}
+
+// fetchMaxSubscriptions gets the "max_subscriptions" limitation from the relay NIP-11 document,
+// returning 0 if it's not available.
+func fetchMaxSubscriptions(ctx context.Context, url string) int {
+	if len(url) < 8 {
+		return 0
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 7*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", "http"+url[2:], nil)
+	if err != nil {
+		return 0
+	}
+	req.Header.Add("Accept", "application/nostr+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0
+	}
+	defer resp.Body.Close()
+
+	var info struct {
+		Limitation struct {
+			MaxSubscriptions int `json:"max_subscriptions"`
+		} `json:"limitation"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return 0
+	}
+
+	return info.Limitation.MaxSubscriptions
+}
@@ -0,0 +1,243 @@
+//go:build !js
+
+package nostr
+
+import (
+	"context"
+	stdjson "encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func TestPoolMaxSubscriptions(t *testing.T) {
+	var mu sync.Mutex
+	open := 0
+	maxOpen := 0
+	reqs := make([]string, 0, 5) // the labels of the subscriptions in the order they arrive
+
+	ws := &websocket.Server{
+		Handshake: anyOriginHandshake,
+		Handler: func(conn *websocket.Conn) {
+			for {
+				var raw []stdjson.RawMessage
+				if err := websocket.JSON.Receive(conn, &raw); err != nil {
+					return
+				}
+				var typ, subid string
+				json.Unmarshal(raw[0], &typ)
+				json.Unmarshal(raw[1], &subid)
+
+				mu.Lock()
+				switch typ {
+				case "REQ":
+					reqs = append(reqs, subid[strings.Index(subid, ":")+1:])
+					open++
+					maxOpen = max(maxOpen, open)
+				case "CLOSE":
+					open--
+				}
+				mu.Unlock()
+
+				if typ == "REQ" {
+					websocket.JSON.Send(conn, []any{"EOSE", subid})
+				}
+			}
+		},
+	}
+	nip11 := make(chan struct{}) // the NIP-11 document only comes when this is closed
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") == "application/nostr+json" {
+			<-nip11
+			w.Write([]byte(`{"name":"test","limitation":{"max_subscriptions":2}}`))
+			return
+		}
+		ws.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	pool := NewSimplePool(context.Background(), WithMaxSubscriptions(1))
+	defer pool.Close("test ended")
+
+	requests := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(reqs)
+	}
+
+	cancels := make([]context.CancelFunc, 5)
+	subscribe := func(i int) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels[i] = cancel
+		pool.SubscribeMany(ctx, []string{srv.URL}, Filter{Kinds: []int{KindTextNote}}, WithLabel(strconv.Itoa(i)))
+	}
+	defer func() {
+		for _, cancel := range cancels {
+			if cancel != nil {
+				cancel()
+			}
+		}
+	}()
+
+	// the first REQ doesn't wait for the NIP-11 document
+	subscribe(0)
+	require.Eventually(t, func() bool { return len(requests()) == 1 }, 500*time.Millisecond, 10*time.Millisecond)
+
+	// until it arrives the default limit is used
+	for i := 1; i < len(cancels); i++ {
+		subscribe(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, requests(), 1, "the others should be queued")
+
+	close(nip11)
+	require.Eventually(t, func() bool { return len(requests()) == 2 }, 2*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, requests(), 2, "the others should still be queued")
+
+	// ending the oldest subscription lets the next queued one go
+	for n := 3; n <= 5; n++ {
+		oldest, _ := strconv.Atoi(requests()[n-3])
+		cancels[oldest]()
+		require.Eventually(t, func() bool { return len(requests()) == n }, 2*time.Second, 10*time.Millisecond)
+	}
+
+	mu.Lock()
+	assert.Equal(t, 2, maxOpen)
+	mu.Unlock()
+}
+
+func TestPoolMaxConnections(t *testing.T) {
+	servers := make([]*httptest.Server, 3)
+	for i := range servers {
+		servers[i] = newWebsocketServer(discardingHandler)
+		defer servers[i].Close()
+	}
+	a, b, c := servers[0].URL, servers[1].URL, servers[2].URL
+
+	pool := NewSimplePool(context.Background(), WithMaxConnections(2))
+	defer pool.Close("test ended")
+
+	ra, err := pool.EnsureRelay(a)
+	require.NoError(t, err)
+	rb, err := pool.EnsureRelay(b)
+	require.NoError(t, err)
+
+	// a is older, but it is busy
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = ra.Subscribe(ctx, Filters{{Kinds: []int{KindTextNote}}})
+	require.NoError(t, err)
+
+	rc, err := pool.EnsureRelay(c)
+	require.NoError(t, err)
+	assert.True(t, ra.IsConnected())
+	assert.False(t, rb.IsConnected(), "b should have been evicted")
+	_, ok := pool.Relays.Load(NormalizeURL(b))
+	assert.False(t, ok)
+
+	// now both are busy so there is no room for b
+	_, err = rc.Subscribe(ctx, Filters{{Kinds: []int{KindTextNote}}})
+	require.NoError(t, err)
+	_, err = pool.EnsureRelay(b)
+	assert.Error(t, err)
+
+	// using a relay again doesn't count as a new connection
+	same, err := pool.EnsureRelay(a)
+	require.NoError(t, err)
+	assert.Equal(t, ra, same)
+}
+
+func TestPoolMaxConnectionsEvictsEnough(t *testing.T) {
+	servers := make([]*httptest.Server, 4)
+	for i := range servers {
+		servers[i] = newWebsocketServer(discardingHandler) // never answers, so publishes hang
+		defer servers[i].Close()
+	}
+
+	pool := NewSimplePool(context.Background(), WithMaxConnections(3))
+	defer pool.Close("test ended")
+
+	relays := make([]*Relay, 3)
+	for i := range relays {
+		var err error
+		relays[i], err = pool.EnsureRelay(servers[i].URL)
+		require.NoError(t, err)
+	}
+
+	// the oldest one is waiting for an OK
+	priv, _ := makeKeyPair(t)
+	evt := Event{Kind: KindTextNote, CreatedAt: Now(), Content: "hello"}
+	require.NoError(t, evt.Sign(priv))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	go relays[0].Publish(ctx, evt)
+	require.Eventually(t, func() bool { return relays[0].okCallbacks.Size() > 0 }, time.Second, 10*time.Millisecond)
+
+	// with the limit lowered both idle relays must go to make room for the new one
+	pool.maxConnections = 2
+	_, err := pool.EnsureRelay(servers[3].URL)
+	require.NoError(t, err)
+	assert.True(t, relays[0].IsConnected(), "the relay with a pending publish should be kept")
+	assert.False(t, relays[1].IsConnected())
+	assert.False(t, relays[2].IsConnected())
+	assert.Equal(t, 2, pool.Relays.Size())
+
+	// the state of evicted relays is dropped
+	_, ok := pool.limits.Load(NormalizeURL(servers[1].URL))
+	assert.False(t, ok)
+	_, ok = pool.limits.Load(NormalizeURL(servers[2].URL))
+	assert.False(t, ok)
+}
+
+func TestPoolKeepsNoLimitsStateWithoutLimits(t *testing.T) {
+	server := newWebsocketServer(discardingHandler)
+	defer server.Close()
+
+	pool := NewSimplePool(context.Background())
+	defer pool.Close("test ended")
+
+	relay, err := pool.EnsureRelay(server.URL)
+	require.NoError(t, err)
+	_, err = pool.subscribe(context.Background(), relay, Filters{{Kinds: []int{KindTextNote}}})
+	require.NoError(t, err)
+	require.NoError(t, pool.WaitPublish(context.Background(), server.URL))
+
+	assert.Equal(t, 0, pool.limits.Size())
+}
+
+func TestPoolPublishRateLimit(t *testing.T) {
+	pool := NewSimplePool(context.Background(), WithPublishRateLimit(20, 2))
+	defer pool.Close("test ended")
+
+	url := "wss://relay.example.com"
+	start := time.Now()
+	for range 2 {
+		require.NoError(t, pool.WaitPublish(context.Background(), url))
+	}
+	assert.Less(t, time.Since(start), 40*time.Millisecond, "burst should go through immediately")
+
+	for range 2 {
+		require.NoError(t, pool.WaitPublish(context.Background(), url))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	// other relays have their own buckets
+	start = time.Now()
+	require.NoError(t, pool.WaitPublish(context.Background(), "wss://other.example.com"))
+	assert.Less(t, time.Since(start), 40*time.Millisecond)
+
+	// waiting can be canceled
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Error(t, pool.WaitPublish(ctx, url))
+}
@@ -0,0 +1,368 @@
+package nostr
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+// RelayStats keeps track of how well each relay used by a SimplePool is behaving. Enable it with
+// WithRelayStats() and read it from pool.Stats.
+//
+// All methods are safe to call on a nil *RelayStats, in which case they do nothing.
+type RelayStats struct {
+	relays *xsync.MapOf[string, *relayStatsEntry]
+}
+
+type relayStatsEntry struct {
+	mu sync.Mutex
+	RelayStat
+}
+
+// RelayStat is a snapshot of the stats of a single relay.
+type RelayStat struct {
+	URL string
+
+	ConnectSuccesses int
+	ConnectFailures  int
+	LastFailure      time.Time
+	LastError        string
+
+	Subscriptions int           // REQs sent
+	EOSEs         int           // EOSEs received for those
+	TotalEOSETime time.Duration // sum of the time from each REQ to its EOSE
+
+	Events         int // events received and delivered to the caller
+	Duplicates     int // events received that we had already got from another relay
+	AuthChallenges int // times the relay has required us to authenticate
+
+	PublishOK       int
+	PublishRejected map[string]int // by NIP-01 OK message prefix, "failed" when there was no OK at all
+}
+
+// WithRelayStats enables RelayStats on the pool, which will also use the relay scores in .QuerySingle()
+// and .FetchManyReplaceable(): the best relays are queried first and the others only after a short head
+// start, so in .QuerySingle() they aren't even asked if one of the best relays has the event.
+func WithRelayStats() withRelayStatsOpt { return withRelayStatsOpt{} }
+
+type withRelayStatsOpt struct{}
+
+func (h withRelayStatsOpt) ApplyPoolOption(pool *SimplePool) {
+	pool.Stats = NewRelayStats()
+}
+
+var (
+	_ PoolOption   = WithRelayStats()
+	_ http.Handler = (*RelayStats)(nil)
+)
+
+// NewRelayStats creates an empty RelayStats.
+func NewRelayStats() *RelayStats {
+	return &RelayStats{
+		relays: xsync.NewMapOf[string, *relayStatsEntry](),
+	}
+}
+
+func (rs *RelayStats) update(url string, fn func(stat *RelayStat)) {
+	if rs == nil {
+		return
+	}
+	entry, _ := rs.relays.LoadOrCompute(url, func() *relayStatsEntry {
+		return &relayStatsEntry{RelayStat: RelayStat{URL: url, PublishRejected: make(map[string]int)}}
+	})
+	entry.mu.Lock()
+	fn(&entry.RelayStat)
+	entry.mu.Unlock()
+}
+
+func (rs *RelayStats) connected(url string, err error) {
+	rs.update(url, func(stat *RelayStat) {
+		if err == nil {
+			stat.ConnectSuccesses++
+		} else {
+			stat.ConnectFailures++
+			stat.LastFailure = time.Now()
+			stat.LastError = err.Error()
+		}
+	})
+}
+
+func (rs *RelayStats) subscribed(url string) {
+	rs.update(url, func(stat *RelayStat) { stat.Subscriptions++ })
+}
+
+func (rs *RelayStats) eose(url string, elapsed time.Duration) {
+	rs.update(url, func(stat *RelayStat) {
+		stat.EOSEs++
+		stat.TotalEOSETime += elapsed
+	})
+}
+
+func (rs *RelayStats) event(url string) {
+	rs.update(url, func(stat *RelayStat) { stat.Events++ })
+}
+
+func (rs *RelayStats) duplicate(url string) {
+	rs.update(url, func(stat *RelayStat) { stat.Duplicates++ })
+}
+
+func (rs *RelayStats) authChallenge(url string) {
+	rs.update(url, func(stat *RelayStat) { stat.AuthChallenges++ })
+}
+
+// RecordPublish records the result of publishing an event to a relay. The pool does this by itself,
+// it's only needed when calling relay.Publish() directly.
+func (rs *RelayStats) RecordPublish(url string, err error) {
+	rs.update(NormalizeURL(url), func(stat *RelayStat) {
+		if err == nil {
+			stat.PublishOK++
+			return
+		}
+
+		prefix := "failed"
+		if reason, ok := strings.CutPrefix(err.Error(), "msg: "); ok {
+			reason = NormalizeOKMessage(reason, "error")
+			prefix = reason[0:strings.Index(reason, ": ")]
+		}
+		stat.PublishRejected[prefix]++
+	})
+}
+
+// Get returns the stats for a single relay.
+func (rs *RelayStats) Get(url string) (RelayStat, bool) {
+	if rs == nil {
+		return RelayStat{}, false
+	}
+	entry, ok := rs.relays.Load(NormalizeURL(url))
+	if !ok {
+		return RelayStat{}, false
+	}
+	return entry.snapshot(), true
+}
+
+// Snapshot returns the stats for all relays, sorted by URL.
+func (rs *RelayStats) Snapshot() []RelayStat {
+	if rs == nil {
+		return nil
+	}
+	stats := make([]RelayStat, 0, rs.relays.Size())
+	for _, entry := range rs.relays.Range {
+		stats = append(stats, entry.snapshot())
+	}
+	slices.SortFunc(stats, func(a, b RelayStat) int { return strings.Compare(a.URL, b.URL) })
+	return stats
+}
+
+func (entry *relayStatsEntry) snapshot() RelayStat {
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	stat := entry.RelayStat
+	stat.PublishRejected = make(map[string]int, len(entry.PublishRejected))
+	for prefix, n := range entry.PublishRejected {
+		stat.PublishRejected[prefix] = n
+	}
+	return stat
+}
+
+// AverageTimeToEOSE is how long, on average, the relay takes to send an EOSE.
+func (stat RelayStat) AverageTimeToEOSE() time.Duration {
+	if stat.EOSEs == 0 {
+		return 0
+	}
+	return stat.TotalEOSETime / time.Duration(stat.EOSEs)
+}
+
+// ConnectSuccessRate is the ratio of connection attempts that succeeded.
+func (stat RelayStat) ConnectSuccessRate() float64 {
+	if stat.ConnectSuccesses+stat.ConnectFailures == 0 {
+		return 0
+	}
+	return float64(stat.ConnectSuccesses) / float64(stat.ConnectSuccesses+stat.ConnectFailures)
+}
+
+// RejectionRate is the ratio of published events that weren't accepted.
+func (stat RelayStat) RejectionRate() float64 {
+	rejected := 0
+	for _, n := range stat.PublishRejected {
+		rejected += n
+	}
+	if stat.PublishOK+rejected == 0 {
+		return 0
+	}
+	return float64(rejected) / float64(stat.PublishOK+rejected)
+}
+
+// Score is a number between 0 and 1 that says how good the relay is, based on how often we can connect
+// to it, how fast it answers and how often it accepts our events. Relays we know nothing about get 0.5.
+func (stat RelayStat) Score() float64 {
+	// smoothed so a single success or failure doesn't count as much
+	connect := float64(stat.ConnectSuccesses+1) / float64(stat.ConnectSuccesses+stat.ConnectFailures+2)
+
+	speed := 1.0
+	if stat.EOSEs > 0 {
+		speed = 1 / (1 + stat.AverageTimeToEOSE().Seconds())
+	}
+
+	return connect * speed * (1 - stat.RejectionRate()/2)
+}
+
+// SortByScore returns a copy of urls sorted from the best to the worst scored relay.
+func (rs *RelayStats) SortByScore(urls []string) []string {
+	sorted := slices.Clone(urls)
+	if rs == nil {
+		return sorted
+	}
+
+	scores := make(map[string]float64, len(urls))
+	for _, url := range urls {
+		if stat, ok := rs.Get(url); ok {
+			scores[url] = stat.Score()
+		} else {
+			scores[url] = RelayStat{}.Score()
+		}
+	}
+
+	slices.SortStableFunc(sorted, func(a, b string) int {
+		switch {
+		case scores[a] > scores[b]:
+			return -1
+		case scores[a] < scores[b]:
+			return 1
+		default:
+			return 0
+		}
+	})
+	return sorted
+}
+
+// the relays with the best scores get a head start in QuerySingle and FetchManyReplaceable
+const (
+	scoreHeadStartRelays = 2
+	scoreHeadStart       = 400 * time.Millisecond
+)
+
+// headStart sorts urls by score and splits them into the best ones, which should be queried first, and
+// the others, which should only be queried after scoreHeadStart (or once the best are done). Relays tied
+// with the best go with them, so when we know nothing about the relays everybody goes at once.
+func (rs *RelayStats) headStart(urls []string) (best []string, rest []string) {
+	if rs == nil || len(urls) <= scoreHeadStartRelays {
+		return urls, nil
+	}
+
+	sorted := rs.SortByScore(urls)
+	score := func(url string) float64 {
+		stat, _ := rs.Get(url)
+		return stat.Score()
+	}
+
+	cut := scoreHeadStartRelays
+	worstBest := score(sorted[cut-1])
+	for cut < len(sorted) && score(sorted[cut]) >= worstBest {
+		cut++
+	}
+	return sorted[0:cut], sorted[cut:]
+}
+
+// waitHeadStart blocks until the goroutines in wg (querying the best relays) are done, the head start
+// is over or ctx is canceled.
+func waitHeadStart(ctx context.Context, wg *sync.WaitGroup) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(scoreHeadStart)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+type promSample struct {
+	suffix string // appended to the metric name, like "_count"
+	labels string // extra labels, like `,result="ok"`
+	value  float64
+}
+
+// WritePrometheus writes all the stats in the Prometheus text exposition format.
+func (rs *RelayStats) WritePrometheus(w io.Writer) error {
+	stats := rs.Snapshot()
+
+	var err error
+	metric := func(name, typ, help string, samples func(stat RelayStat) []promSample) {
+		if err != nil {
+			return
+		}
+		if _, err = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ); err != nil {
+			return
+		}
+		for _, stat := range stats {
+			for _, s := range samples(stat) {
+				if _, err = fmt.Fprintf(w, "%s%s{relay=%q%s} %g\n", name, s.suffix, stat.URL, s.labels, s.value); err != nil {
+					return
+				}
+			}
+		}
+	}
+
+	metric("nostr_relay_connections_total", "counter", "Connection attempts by result.",
+		func(stat RelayStat) []promSample {
+			return []promSample{
+				{labels: `,result="success"`, value: float64(stat.ConnectSuccesses)},
+				{labels: `,result="failure"`, value: float64(stat.ConnectFailures)},
+			}
+		})
+	metric("nostr_relay_subscriptions_total", "counter", "REQs sent.",
+		func(stat RelayStat) []promSample { return []promSample{{value: float64(stat.Subscriptions)}} })
+	metric("nostr_relay_eose_seconds", "summary", "Time from REQ to EOSE.",
+		func(stat RelayStat) []promSample {
+			return []promSample{
+				{suffix: "_sum", value: stat.TotalEOSETime.Seconds()},
+				{suffix: "_count", value: float64(stat.EOSEs)},
+			}
+		})
+	metric("nostr_relay_events_total", "counter", "Events received.",
+		func(stat RelayStat) []promSample { return []promSample{{value: float64(stat.Events)}} })
+	metric("nostr_relay_duplicates_total", "counter", "Events received that had already come from other relays.",
+		func(stat RelayStat) []promSample { return []promSample{{value: float64(stat.Duplicates)}} })
+	metric("nostr_relay_auth_challenges_total", "counter", "Times the relay required authentication.",
+		func(stat RelayStat) []promSample { return []promSample{{value: float64(stat.AuthChallenges)}} })
+	metric("nostr_relay_publish_total", "counter", "Events published by result.",
+		func(stat RelayStat) []promSample {
+			samples := []promSample{{labels: `,result="ok"`, value: float64(stat.PublishOK)}}
+			prefixes := make([]string, 0, len(stat.PublishRejected))
+			for prefix := range stat.PublishRejected {
+				prefixes = append(prefixes, prefix)
+			}
+			slices.Sort(prefixes)
+			for _, prefix := range prefixes {
+				samples = append(samples, promSample{
+					labels: fmt.Sprintf(",result=%q", prefix),
+					value:  float64(stat.PublishRejected[prefix]),
+				})
+			}
+			return samples
+		})
+	metric("nostr_relay_score", "gauge", "Relay health score between 0 and 1.",
+		func(stat RelayStat) []promSample { return []promSample{{value: stat.Score()}} })
+
+	return err
+}
+
+// ServeHTTP serves the stats in the Prometheus text exposition format, so this can be used directly as
+// a scraping endpoint.
+func (rs *RelayStats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	rs.WritePrometheus(w)
+}
@@ -0,0 +1,181 @@
+//go:build !js
+
+package nostr
+
+import (
+	"bytes"
+	"context"
+	stdjson "encoding/json"
+	"errors"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func TestPoolRelayStats(t *testing.T) {
+	priv, _ := makeKeyPair(t)
+	evt := Event{Kind: KindTextNote, Content: "hello", CreatedAt: Now()}
+	evt.Sign(priv)
+
+	// both relays return the same event, but only one accepts what we publish
+	makeRelay := func(accept bool) *httptest.Server {
+		return newWebsocketServer(func(conn *websocket.Conn) {
+			for {
+				var raw []stdjson.RawMessage
+				if err := websocket.JSON.Receive(conn, &raw); err != nil {
+					return
+				}
+				var typ string
+				json.Unmarshal(raw[0], &typ)
+
+				switch typ {
+				case "REQ":
+					var subid string
+					json.Unmarshal(raw[1], &subid)
+					websocket.JSON.Send(conn, []any{"EVENT", subid, evt})
+					websocket.JSON.Send(conn, []any{"EOSE", subid})
+				case "EVENT":
+					published := parseEventMessage(t, raw)
+					if accept {
+						websocket.JSON.Send(conn, []any{"OK", published.ID, true, ""})
+					} else {
+						websocket.JSON.Send(conn, []any{"OK", published.ID, false, "blocked: go away"})
+					}
+				}
+			}
+		})
+	}
+	good := makeRelay(true)
+	defer good.Close()
+	bad := makeRelay(false)
+	defer bad.Close()
+	dead := newWebsocketServer(discardingHandler)
+	dead.Close()
+
+	pool := NewSimplePool(context.Background(), WithRelayStats())
+	defer pool.Close("test ended")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	urls := []string{good.URL, bad.URL, dead.URL}
+	received := 0
+	for range pool.FetchMany(ctx, urls, Filter{Kinds: []int{KindTextNote}}) {
+		received++
+	}
+	assert.Equal(t, 1, received)
+
+	for range pool.PublishMany(ctx, urls, evt) {
+	}
+
+	stats := pool.Stats.Snapshot()
+	require.Len(t, stats, 3)
+
+	goodStat, ok := pool.Stats.Get(good.URL)
+	require.True(t, ok)
+	assert.Equal(t, 1, goodStat.ConnectSuccesses)
+	assert.Equal(t, 1, goodStat.Subscriptions)
+	assert.Equal(t, 1, goodStat.EOSEs)
+	assert.Equal(t, 1, goodStat.PublishOK)
+	assert.Zero(t, goodStat.RejectionRate())
+
+	badStat, _ := pool.Stats.Get(bad.URL)
+	assert.Equal(t, map[string]int{"blocked": 1}, badStat.PublishRejected)
+	assert.Equal(t, 1, goodStat.Events+badStat.Events)
+	assert.Equal(t, 1, goodStat.Duplicates+badStat.Duplicates)
+
+	deadStat, _ := pool.Stats.Get(dead.URL)
+	assert.Equal(t, 2, deadStat.ConnectFailures)
+	assert.Zero(t, deadStat.ConnectSuccessRate())
+	assert.NotEmpty(t, deadStat.LastError)
+
+	assert.Greater(t, goodStat.Score(), badStat.Score())
+	assert.Greater(t, badStat.Score(), deadStat.Score())
+	assert.Equal(t,
+		[]string{NormalizeURL(good.URL), "wss://unknown.example.com", NormalizeURL(bad.URL), NormalizeURL(dead.URL)},
+		pool.Stats.SortByScore([]string{
+			NormalizeURL(dead.URL), NormalizeURL(bad.URL), "wss://unknown.example.com", NormalizeURL(good.URL),
+		}),
+	)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, pool.Stats.WritePrometheus(buf))
+	metrics := buf.String()
+	assert.Contains(t, metrics, "# TYPE nostr_relay_connections_total counter\n")
+	assert.Contains(t, metrics, `nostr_relay_connections_total{relay="`+NormalizeURL(dead.URL)+`",result="failure"} 2`)
+	assert.Contains(t, metrics, `nostr_relay_publish_total{relay="`+NormalizeURL(bad.URL)+`",result="blocked"} 1`)
+	assert.Contains(t, metrics, `nostr_relay_eose_seconds_count{relay="`+NormalizeURL(good.URL)+`"} 1`)
+}
+
+func TestPoolQuerySingleHeadStart(t *testing.T) {
+	priv, _ := makeKeyPair(t)
+	evt := Event{Kind: KindTextNote, Content: "hello", CreatedAt: Now()}
+	evt.Sign(priv)
+
+	makeRelay := func(hasEvent bool, reqs *atomic.Int32) *httptest.Server {
+		return newWebsocketServer(func(conn *websocket.Conn) {
+			for {
+				var raw []stdjson.RawMessage
+				if err := websocket.JSON.Receive(conn, &raw); err != nil {
+					return
+				}
+				var typ string
+				json.Unmarshal(raw[0], &typ)
+				if typ != "REQ" {
+					continue
+				}
+
+				reqs.Add(1)
+				var subid string
+				json.Unmarshal(raw[1], &subid)
+				if hasEvent {
+					websocket.JSON.Send(conn, []any{"EVENT", subid, evt})
+				}
+				websocket.JSON.Send(conn, []any{"EOSE", subid})
+			}
+		})
+	}
+	var goodReqs, emptyReqs, otherEmptyReqs, badReqs atomic.Int32
+	good := makeRelay(true, &goodReqs)
+	defer good.Close()
+	empty := makeRelay(false, &emptyReqs)
+	defer empty.Close()
+	otherEmpty := makeRelay(false, &otherEmptyReqs)
+	defer otherEmpty.Close()
+	bad := makeRelay(true, &badReqs)
+	defer bad.Close()
+
+	pool := NewSimplePool(context.Background(), WithRelayStats())
+	defer pool.Close("test ended")
+	for range 3 {
+		pool.Stats.connected(NormalizeURL(good.URL), nil)
+		pool.Stats.connected(NormalizeURL(empty.URL), nil)
+		pool.Stats.connected(NormalizeURL(otherEmpty.URL), nil)
+		pool.Stats.connected(NormalizeURL(bad.URL), errors.New("connection refused"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	filter := Filter{Kinds: []int{KindTextNote}}
+
+	// one of the best relays has it, so the bad one isn't even asked
+	ievt := pool.QuerySingle(ctx, []string{bad.URL, empty.URL, good.URL}, filter)
+	require.NotNil(t, ievt)
+	assert.Equal(t, NormalizeURL(good.URL), ievt.Relay.URL)
+	time.Sleep(scoreHeadStart + 200*time.Millisecond)
+	assert.Equal(t, int32(1), goodReqs.Load())
+	assert.Zero(t, badReqs.Load())
+
+	// the best relays don't have it, so the bad one is asked right after they're done
+	start := time.Now()
+	ievt = pool.QuerySingle(ctx, []string{bad.URL, empty.URL, otherEmpty.URL}, filter)
+	require.NotNil(t, ievt)
+	assert.Equal(t, NormalizeURL(bad.URL), ievt.Relay.URL)
+	assert.Less(t, time.Since(start), scoreHeadStart)
+	assert.Equal(t, int32(1), badReqs.Load())
+}
@@ -7,11 +7,15 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math/rand/v2"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unsafe"
 
 	"github.com/puzpuzpuz/xsync/v3"
 )
@@ -28,17 +32,25 @@ type Relay struct {
 	Connection    *Connection
 	Subscriptions *xsync.MapOf[int64, *Subscription]
 
+	negentropySessions *xsync.MapOf[int64, *NegentropySession] // see OpenNegentropy
+
 	ConnectionError         error
 	connectionContext       context.Context // will be canceled when the connection closes
+	connected               atomic.Bool     // if the websocket is up, which may not be when we're reconnecting
+	reconnecting            atomic.Bool     // if we lost the websocket and reconnectLoop is running
 	connectionContextCancel context.CancelCauseFunc
 
 	challenge                     string       // NIP-42 challenge, we only keep the last
 	noticeHandler                 func(string) // NIP-01 NOTICEs
 	customHandler                 func(string) // nonstandard unparseable messages
 	okCallbacks                   *xsync.MapOf[string, func(bool, string)]
+	pendingPublishes              *xsync.MapOf[string, []byte] // only used when reconnecting is enabled
 	writeQueue                    chan writeRequest
 	subscriptionChannelCloseQueue chan *Subscription
 
+	reconnect              *WithReconnect               // when set we will try to reconnect instead of closing
+	connectionStateHandler func(ConnectionState, error) // see WithConnectionStateHandler
+
 	// custom things that aren't often used
 	//
 	AssumeValid bool // this will skip verifying signatures for events received from this relay
@@ -57,7 +69,9 @@ func NewRelay(ctx context.Context, url string, opts ...RelayOption) *Relay {
 		connectionContext:             ctx,
 		connectionContextCancel:       cancel,
 		Subscriptions:                 xsync.NewMapOf[int64, *Subscription](),
+		negentropySessions:            xsync.NewMapOf[int64, *NegentropySession](),
 		okCallbacks:                   xsync.NewMapOf[string, func(bool, string)](),
+		pendingPublishes:              xsync.NewMapOf[string, []byte](),
 		writeQueue:                    make(chan writeRequest),
 		subscriptionChannelCloseQueue: make(chan *Subscription),
 		requestHeader:                 nil,
@@ -91,6 +105,8 @@ var (
 	_ RelayOption = (WithNoticeHandler)(nil)
 	_ RelayOption = (WithCustomHandler)(nil)
 	_ RelayOption = (WithRequestHeader)(nil)
+	_ RelayOption = WithReconnect{}
+	_ RelayOption = (WithConnectionStateHandler)(nil)
 )
 
 // WithNoticeHandler just takes notices and is expected to do something with them.
@@ -116,6 +132,61 @@ func (ch WithRequestHeader) ApplyRelayOption(r *Relay) {
 	r.requestHeader = http.Header(ch)
 }
 
+// WithReconnect makes the relay try to reconnect when the connection is lost (instead of closing
+// and ending all subscriptions). Attempts are spaced with an exponential backoff with jitter.
+//
+// Once reconnected all live subscriptions are sent again (the ones that have already received an
+// EOSE will have their "since" moved to the timestamp of the last event seen) and all events that
+// were still waiting for an "OK" are published again.
+type WithReconnect struct {
+	MaxAttempts    int           // give up after this many failed attempts in a row, 0 means never give up
+	InitialBackoff time.Duration // defaults to 1 second
+	MaxBackoff     time.Duration // defaults to 5 minutes
+}
+
+func (wr WithReconnect) ApplyRelayOption(r *Relay) {
+	if wr.InitialBackoff <= 0 {
+		wr.InitialBackoff = time.Second
+	}
+	if wr.MaxBackoff <= 0 {
+		wr.MaxBackoff = time.Minute * 5
+	}
+	r.reconnect = &wr
+}
+
+// ConnectionState is passed to the handler given in WithConnectionStateHandler.
+type ConnectionState int
+
+const (
+	ConnectionStateConnecting ConnectionState = iota
+	ConnectionStateConnected
+	ConnectionStateBackoff
+	ConnectionStateGaveUp
+)
+
+func (cs ConnectionState) String() string {
+	switch cs {
+	case ConnectionStateConnecting:
+		return "connecting"
+	case ConnectionStateConnected:
+		return "connected"
+	case ConnectionStateBackoff:
+		return "backoff"
+	case ConnectionStateGaveUp:
+		return "gave up"
+	default:
+		return "unknown"
+	}
+}
+
+// WithConnectionStateHandler will be called whenever the connection state changes, err will contain
+// the reason for a failure when there is one. Mostly useful in combination with WithReconnect.
+type WithConnectionStateHandler func(state ConnectionState, err error)
+
+func (ch WithConnectionStateHandler) ApplyRelayOption(r *Relay) {
+	r.connectionStateHandler = ch
+}
+
 // String just returns the relay URL.
 func (r *Relay) String() string {
 	return r.URL
@@ -126,7 +197,11 @@ func (r *Relay) String() string {
 func (r *Relay) Context() context.Context { return r.connectionContext }
 
 // IsConnected returns true if the connection to this relay seems to be active.
-func (r *Relay) IsConnected() bool { return r.connectionContext.Err() == nil }
+// It is false while WithReconnect is waiting to connect again.
+func (r *Relay) IsConnected() bool { return r.connected.Load() && r.connectionContext.Err() == nil }
+
+// IsReconnecting returns true if the connection was lost and WithReconnect is trying to get it back.
+func (r *Relay) IsReconnecting() bool { return r.reconnecting.Load() }
 
 // Connect tries to establish a websocket connection to r.URL.
 // If the context expires before the connection is complete, an error is returned.
@@ -156,11 +231,20 @@ func (r *Relay) ConnectWithTLS(ctx context.Context, tlsConfig *tls.Config) error
 		defer cancel()
 	}
 
+	r.emitConnectionState(ConnectionStateConnecting, nil)
 	conn, err := NewConnection(ctx, r.URL, r.requestHeader, tlsConfig)
 	if err != nil {
 		return fmt.Errorf("error opening websocket to '%s': %w", r.URL, err)
 	}
+	r.closeMutex.Lock()
 	r.Connection = conn
+	r.closeMutex.Unlock()
+	r.connected.Store(true)
+	r.emitConnectionState(ConnectionStateConnected, nil)
+
+	// this is canceled when this specific websocket dies, which may not mean the end of the relay
+	// when we're reconnecting
+	connCtx, connCancel := context.WithCancelCause(r.connectionContext)
 
 	// ping every 29 seconds
 	ticker := time.NewTicker(29 * time.Second)
@@ -169,28 +253,37 @@ func (r *Relay) ConnectWithTLS(ctx context.Context, tlsConfig *tls.Config) error
 	go func() {
 		defer func() {
 			ticker.Stop()
-			r.Connection = nil
 
-			for _, sub := range r.Subscriptions.Range {
-				sub.unsub(fmt.Errorf("relay connection closed: %w / %w", context.Cause(r.connectionContext), r.ConnectionError))
+			if r.connectionContext.Err() != nil {
+				// the relay is really closed, not just reconnecting
+				r.closeMutex.Lock()
+				r.Connection = nil
+				r.closeMutex.Unlock()
+				r.closeSubscriptions()
 			}
 		}()
 
 		pingAttempt := 0
 		for {
 			select {
-			case <-r.connectionContext.Done():
+			case <-connCtx.Done():
 				return
 
 			case <-ticker.C:
 				debugLogf("{%s} pinging relay", r.URL)
-				err := r.Connection.Ping(r.connectionContext)
+				err := conn.Ping(connCtx)
 				if err != nil {
 					pingAttempt++
 					debugLogf("{%s} error writing ping (attempt %d): %v", r.URL, pingAttempt, err)
 
 					if pingAttempt >= 3 {
 						debugLogf("{%s} error writing ping after multiple attempts; closing websocket", r.URL)
+						if r.reconnect != nil {
+							// this will make the reader loop fail and trigger a reconnection
+							conn.Close()
+							return
+						}
+
 						err = r.Close() // this should trigger a context cancelation
 						if err != nil {
 							debugLogf("{%s} failed to close relay: %v", r.URL, err)
@@ -206,7 +299,7 @@ func (r *Relay) ConnectWithTLS(ctx context.Context, tlsConfig *tls.Config) error
 			case writeRequest := <-r.writeQueue:
 				// all write requests will go through this to prevent races
 				debugLogf("{%s} sending %v\n", r.URL, string(writeRequest.msg))
-				if err := r.Connection.WriteMessage(r.connectionContext, writeRequest.msg); err != nil {
+				if err := conn.WriteMessage(connCtx, writeRequest.msg); err != nil {
 					writeRequest.answer <- err
 				}
 				close(writeRequest.answer)
@@ -217,43 +310,81 @@ func (r *Relay) ConnectWithTLS(ctx context.Context, tlsConfig *tls.Config) error
 	// general message reader loop
 	go func() {
 		buf := new(bytes.Buffer)
-		mp := NewMessageParser()
+		var mp MessageParser = NewMessageParser()
+		bmp, _ := mp.(BytesMessageParser)
 
 		for {
 			buf.Reset()
 
-			if err := conn.ReadMessage(r.connectionContext, buf); err != nil {
+			if err := conn.ReadMessage(connCtx, buf); err != nil {
+				willReconnect := r.reconnect != nil && r.connectionContext.Err() == nil
+				if willReconnect {
+					// this must come first so publishes never see us neither connected nor reconnecting
+					r.reconnecting.Store(true)
+				}
+				r.connected.Store(false)
+
+				r.closeMutex.Lock()
 				r.ConnectionError = err
-				r.close(err)
+				r.closeMutex.Unlock()
+
+				connCancel(err)
+				if willReconnect {
+					conn.Close()
+
+					// relays forget negentropy sessions, so there is nothing to resume
+					for _, session := range r.negentropySessions.Range {
+						session.cancel(fmt.Errorf("relay connection lost: %w", err))
+					}
+
+					go r.reconnectLoop(tlsConfig, err)
+				} else {
+					r.close(err)
+				}
 				break
 			}
 
-			message := string(buf.Bytes())
-			debugLogf("{%s} received %v\n", r.URL, message)
+			// we don't copy the message, so everything parsed from it is only valid until the next
+			// iteration, which means anything that we keep must be cloned
+			message := buf.Bytes()
+			text := unsafe.String(unsafe.SliceData(message), len(message))
+			debugLogf("{%s} received %v\n", r.URL, text)
 
 			// if this is an "EVENT" we will have this preparser logic that should speed things up a little
 			// as we skip handling duplicate events
-			subid := extractSubID(message)
+			subid := extractSubID(text)
 			sub, ok := r.Subscriptions.Load(subIdToSerial(subid))
 			if ok {
+				// these callbacks may keep the strings around, so they must not point to our buffer
 				if sub.checkDuplicate != nil {
-					if sub.checkDuplicate(extractEventID(message[10+len(subid):]), r.URL) {
+					if sub.checkDuplicate(strings.Clone(extractEventID(text[10+len(subid):])), r.URL) {
 						continue
 					}
 				} else if sub.checkDuplicateReplaceable != nil {
 					if sub.checkDuplicateReplaceable(
-						ReplaceableKey{extractEventPubKey(message), extractDTag(message)},
-						extractTimestamp(message),
+						ReplaceableKey{strings.Clone(extractEventPubKey(text)), strings.Clone(extractDTag(text))},
+						extractTimestamp(text),
 					) {
 						continue
 					}
 				}
 			}
 
-			envelope, err := mp.ParseMessage(message)
+			var envelope Envelope
+			var err error
+			if bmp != nil {
+				envelope, err = bmp.ParseMessageBytes(message)
+			} else {
+				envelope, err = mp.ParseMessage(string(message))
+			}
 			if envelope == nil {
-				if r.customHandler != nil && err == UnknownLabel {
-					r.customHandler(message)
+				if err == UnknownLabel {
+					if r.handleNegentropyMessage(string(message)) {
+						continue
+					}
+					if r.customHandler != nil {
+						r.customHandler(string(message))
+					}
 				}
 				continue
 			}
@@ -262,7 +393,7 @@ func (r *Relay) ConnectWithTLS(ctx context.Context, tlsConfig *tls.Config) error
 			case *NoticeEnvelope:
 				// see WithNoticeHandler
 				if r.noticeHandler != nil {
-					r.noticeHandler(string(*env))
+					r.noticeHandler(strings.Clone(string(*env)))
 				} else {
 					log.Printf("NOTICE from %s: '%s'\n", r.URL, string(*env))
 				}
@@ -270,7 +401,7 @@ func (r *Relay) ConnectWithTLS(ctx context.Context, tlsConfig *tls.Config) error
 				if env.Challenge == nil {
 					continue
 				}
-				r.challenge = *env.Challenge
+				r.challenge = strings.Clone(*env.Challenge)
 			case *EventEnvelope:
 				// we already have the subscription from the pre-check above, so we can just reuse it
 				if sub == nil {
@@ -292,7 +423,8 @@ func (r *Relay) ConnectWithTLS(ctx context.Context, tlsConfig *tls.Config) error
 					}
 
 					// dispatch this to the internal .events channel of the subscription
-					sub.dispatchEvent(&env.Event)
+					evt := env.Event.Clone()
+					sub.dispatchEvent(&evt)
 				}
 			case *EOSEEnvelope:
 				if subscription, ok := r.Subscriptions.Load(subIdToSerial(string(*env))); ok {
@@ -300,15 +432,16 @@ func (r *Relay) ConnectWithTLS(ctx context.Context, tlsConfig *tls.Config) error
 				}
 			case *ClosedEnvelope:
 				if subscription, ok := r.Subscriptions.Load(subIdToSerial(env.SubscriptionID)); ok {
-					subscription.handleClosed(env.Reason)
+					subscription.handleClosed(strings.Clone(env.Reason))
 				}
 			case *CountEnvelope:
 				if subscription, ok := r.Subscriptions.Load(subIdToSerial(env.SubscriptionID)); ok && env.Count != nil && subscription.countResult != nil {
+					env.SubscriptionID = strings.Clone(env.SubscriptionID)
 					subscription.countResult <- *env
 				}
 			case *OKEnvelope:
 				if okCallback, exist := r.okCallbacks.Load(env.EventID); exist {
-					okCallback(env.OK, env.Reason)
+					okCallback(env.OK, strings.Clone(env.Reason))
 				} else {
 					InfoLogger.Printf("{%s} got an unexpected OK message for event %s", r.URL, env.EventID)
 				}
@@ -319,13 +452,126 @@ func (r *Relay) ConnectWithTLS(ctx context.Context, tlsConfig *tls.Config) error
 	return nil
 }
 
+// reconnectLoop keeps trying to reconnect with an exponential backoff until it succeeds, the relay is
+// closed or we reach WithReconnect.MaxAttempts.
+func (r *Relay) reconnectLoop(tlsConfig *tls.Config, cause error) {
+	defer r.reconnecting.Store(false)
+
+	backoff := r.reconnect.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		if r.reconnect.MaxAttempts > 0 && attempt > r.reconnect.MaxAttempts {
+			r.emitConnectionState(ConnectionStateGaveUp, cause)
+			r.close(fmt.Errorf("gave up reconnecting after %d attempts: %w", r.reconnect.MaxAttempts, cause))
+			r.closeSubscriptions()
+			return
+		}
+
+		// full jitter on the upper half of the interval so we never retry too quickly
+		wait := backoff/2 + rand.N(backoff/2+1)
+		debugLogf("{%s} reconnecting in %s (attempt %d): %s", r.URL, wait, attempt, cause)
+		r.emitConnectionState(ConnectionStateBackoff, cause)
+
+		select {
+		case <-time.After(wait):
+		case <-r.connectionContext.Done():
+			r.closeSubscriptions()
+			return
+		}
+
+		err := r.ConnectWithTLS(r.connectionContext, tlsConfig)
+		if err == nil {
+			// from now on new writes go straight to the relay, the ones queued before are sent here
+			r.reconnecting.Store(false)
+			r.resume()
+			return
+		}
+
+		cause = err
+		backoff = min(r.reconnect.MaxBackoff, backoff*2)
+	}
+}
+
+// resume sends again all the subscriptions and pending publishes after a reconnection.
+//
+// Events that were already dispatched are going to be sent again by the relay (all of them for
+// subscriptions that hadn't got an EOSE yet, the ones with the same timestamp as the last we've seen
+// for the others), but these are skipped by Subscription.dispatchEvent.
+func (r *Relay) resume() {
+	for _, sub := range r.Subscriptions.Range {
+		if !sub.live.Load() {
+			continue
+		}
+
+		filters := sub.Filters
+		if sub.eosed.Load() {
+			// we only want events we haven't seen yet
+			if last := sub.lastSeen.Load(); last > 0 {
+				since := Timestamp(last)
+				filters = slices.Clone(sub.Filters)
+				for i := range filters {
+					filters[i].Since = &since
+				}
+			}
+		}
+
+		if err := sub.fire(r.connectionContext, filters); err != nil {
+			debugLogf("{%s} failed to resubscribe %s: %s", r.URL, sub.id, err)
+		}
+	}
+
+	for id, msg := range r.pendingPublishes.Range {
+		if err := <-r.write(r.connectionContext, msg); err != nil {
+			debugLogf("{%s} failed to republish %s: %s", r.URL, id, err)
+		}
+	}
+}
+
+// closeSubscriptions ends all subscriptions once we know the relay is closed for good.
+func (r *Relay) closeSubscriptions() {
+	r.closeMutex.Lock()
+	connErr := r.ConnectionError
+	r.closeMutex.Unlock()
+
+	for _, sub := range r.Subscriptions.Range {
+		sub.unsub(fmt.Errorf("relay connection closed: %w / %w", context.Cause(r.connectionContext), connErr))
+	}
+	for _, session := range r.negentropySessions.Range {
+		session.cancel(fmt.Errorf("relay connection closed: %w / %w", context.Cause(r.connectionContext), connErr))
+	}
+}
+
+// hasConnection tells if a websocket was ever opened and the relay wasn't closed since.
+func (r *Relay) hasConnection() bool {
+	r.closeMutex.Lock()
+	defer r.closeMutex.Unlock()
+	return r.Connection != nil
+}
+
+func (r *Relay) emitConnectionState(state ConnectionState, err error) {
+	if r.connectionStateHandler != nil {
+		r.connectionStateHandler(state, err)
+	}
+}
+
 // Write queues an arbitrary message to be sent to the relay.
 func (r *Relay) Write(msg []byte) <-chan error {
-	ch := make(chan error)
+	return r.write(context.Background(), msg)
+}
+
+// write is like Write, but it gives up when ctx is canceled.
+func (r *Relay) write(ctx context.Context, msg []byte) <-chan error {
+	ch := make(chan error, 1)
+	if !r.connected.Load() {
+		ch <- fmt.Errorf("not connected")
+		return ch
+	}
+
 	select {
 	case r.writeQueue <- writeRequest{msg: msg, answer: ch}:
 	case <-r.connectionContext.Done():
-		go func() { ch <- fmt.Errorf("connection closed") }()
+		ch <- fmt.Errorf("connection closed")
+	case <-ctx.Done():
+		ch <- context.Cause(ctx)
 	}
 	return ch
 }
@@ -383,7 +629,17 @@ func (r *Relay) publish(ctx context.Context, id string, env Envelope) error {
 
 	// publish event
 	envb, _ := env.MarshalJSON()
-	if err := <-r.Write(envb); err != nil {
+	if r.reconnect != nil {
+		// keep this around so it can be sent again if we reconnect before getting an OK
+		r.pendingPublishes.Store(id, envb)
+		defer r.pendingPublishes.Delete(id)
+
+		if r.IsReconnecting() {
+			// it will be sent by resume()
+		} else if err := <-r.write(ctx, envb); err != nil && (ctx.Err() != nil || !r.IsReconnecting()) {
+			return err
+		}
+	} else if err := <-r.write(ctx, envb); err != nil {
 		return err
 	}
 
@@ -411,7 +667,7 @@ func (r *Relay) publish(ctx context.Context, id string, env Envelope) error {
 func (r *Relay) Subscribe(ctx context.Context, filters Filters, opts ...SubscriptionOption) (*Subscription, error) {
 	sub := r.PrepareSubscription(ctx, filters, opts...)
 
-	if r.Connection == nil {
+	if !r.hasConnection() {
 		return nil, fmt.Errorf("not connected to %s", r.URL)
 	}
 
@@ -451,6 +707,8 @@ func (r *Relay) PrepareSubscription(ctx context.Context, filters Filters, opts .
 			sub.checkDuplicate = o
 		case WithCheckDuplicateReplaceable:
 			sub.checkDuplicateReplaceable = o
+		case withEOSEHook:
+			sub.eoseHook = o
 		}
 	}
 
@@ -157,6 +157,321 @@ func TestConnectWithOrigin(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestReconnect(t *testing.T) {
+	priv, _ := makeKeyPair(t)
+	first := Event{Kind: KindTextNote, Content: "first", CreatedAt: Timestamp(1672068534)}
+	first.Sign(priv)
+	second := Event{Kind: KindTextNote, Content: "second", CreatedAt: Timestamp(1672068600)}
+	second.Sign(priv)
+
+	// fake relay server that drops the first connection after sending one event
+	var mu sync.Mutex
+	connections := 0
+	var resumedSince *Timestamp
+	ws := newWebsocketServer(func(conn *websocket.Conn) {
+		mu.Lock()
+		connections++
+		n := connections
+		mu.Unlock()
+
+		var raw []stdjson.RawMessage
+		err := websocket.JSON.Receive(conn, &raw)
+		assert.NoError(t, err)
+		subid, filters := parseSubscriptionMessage(t, append(raw, raw[2]))
+
+		if n == 1 {
+			websocket.JSON.Send(conn, []any{"EVENT", subid, first})
+			websocket.JSON.Send(conn, []any{"EOSE", subid})
+			time.Sleep(50 * time.Millisecond)
+			conn.Close()
+			return
+		}
+
+		mu.Lock()
+		resumedSince = filters[0].Since
+		mu.Unlock()
+		// since is inclusive so we get the first one again, but it shouldn't be dispatched twice
+		websocket.JSON.Send(conn, []any{"EVENT", subid, first})
+		websocket.JSON.Send(conn, []any{"EVENT", subid, second})
+		io.ReadAll(conn)
+	})
+	defer ws.Close()
+
+	var statesMu sync.Mutex
+	var states []ConnectionState
+	rl := NewRelay(context.Background(), ws.URL,
+		WithReconnect{InitialBackoff: 10 * time.Millisecond},
+		WithConnectionStateHandler(func(state ConnectionState, err error) {
+			statesMu.Lock()
+			states = append(states, state)
+			statesMu.Unlock()
+		}),
+	)
+	err := rl.Connect(context.Background())
+	require.NoError(t, err)
+	defer rl.Close()
+
+	sub, err := rl.Subscribe(context.Background(), Filters{{Kinds: []int{KindTextNote}}})
+	require.NoError(t, err)
+
+	timeout := time.After(5 * time.Second)
+	received := make([]string, 0, 2)
+	for len(received) < 2 {
+		select {
+		case evt, more := <-sub.Events:
+			require.True(t, more, "subscription should survive the reconnection")
+			received = append(received, evt.Content)
+		case <-timeout:
+			t.Fatalf("timeout, got only %v", received)
+		}
+	}
+
+	assert.Equal(t, []string{"first", "second"}, received)
+	assert.True(t, rl.IsConnected())
+
+	mu.Lock()
+	require.NotNil(t, resumedSince)
+	assert.Equal(t, first.CreatedAt, *resumedSince)
+	mu.Unlock()
+
+	statesMu.Lock()
+	assert.Equal(t, []ConnectionState{
+		ConnectionStateConnecting, ConnectionStateConnected,
+		ConnectionStateBackoff,
+		ConnectionStateConnecting, ConnectionStateConnected,
+	}, states)
+	statesMu.Unlock()
+}
+
+func TestPoolKeepsReconnectingRelay(t *testing.T) {
+	priv, _ := makeKeyPair(t)
+	evt := Event{Kind: KindTextNote, Content: "hello", CreatedAt: Now()}
+	evt.Sign(priv)
+
+	// the first connection dies right after the first REQ, the second one has the event
+	var mu sync.Mutex
+	connections := 0
+	ws := newWebsocketServer(func(conn *websocket.Conn) {
+		mu.Lock()
+		connections++
+		n := connections
+		mu.Unlock()
+
+		for {
+			var raw []stdjson.RawMessage
+			if err := websocket.JSON.Receive(conn, &raw); err != nil {
+				return
+			}
+			var typ, subid string
+			json.Unmarshal(raw[0], &typ)
+			json.Unmarshal(raw[1], &subid)
+			if typ != "REQ" {
+				continue
+			}
+			if n == 1 {
+				websocket.JSON.Send(conn, []any{"EOSE", subid})
+				conn.Close()
+				return
+			}
+			websocket.JSON.Send(conn, []any{"EVENT", subid, evt})
+			websocket.JSON.Send(conn, []any{"EOSE", subid})
+		}
+	})
+	defer ws.Close()
+
+	backoff := make(chan struct{}, 1)
+	pool := NewSimplePool(context.Background(), WithRelayOptions(
+		WithReconnect{InitialBackoff: 400 * time.Millisecond},
+		WithConnectionStateHandler(func(state ConnectionState, err error) {
+			if state == ConnectionStateBackoff {
+				select {
+				case backoff <- struct{}{}:
+				default:
+				}
+			}
+		}),
+	))
+	defer pool.Close("test ended")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rl, err := pool.EnsureRelay(ws.URL)
+	require.NoError(t, err)
+	sub, err := rl.Subscribe(ctx, Filters{{Kinds: []int{KindTextNote}}})
+	require.NoError(t, err)
+
+	select {
+	case <-backoff:
+	case <-ctx.Done():
+		t.Fatal("connection wasn't lost")
+	}
+
+	// while it is reconnecting we get the same relay, and its subscription is resumed later
+	same, err := pool.EnsureRelay(ws.URL)
+	require.NoError(t, err)
+	assert.Equal(t, rl, same)
+
+	select {
+	case received := <-sub.Events:
+		assert.Equal(t, evt.ID, received.ID)
+	case <-ctx.Done():
+		t.Fatal("subscription wasn't resumed")
+	}
+}
+
+func TestReconnectPublishDuringOutage(t *testing.T) {
+	priv, _ := makeKeyPair(t)
+	evt := Event{Kind: KindTextNote, Content: "hello", CreatedAt: Now()}
+	evt.Sign(priv)
+
+	// fake relay server that drops the first connection right away
+	var mu sync.Mutex
+	connections := 0
+	published := make(chan Event, 10)
+	ws := newWebsocketServer(func(conn *websocket.Conn) {
+		mu.Lock()
+		connections++
+		n := connections
+		mu.Unlock()
+
+		if n == 1 {
+			conn.Close()
+			return
+		}
+
+		for {
+			var raw []stdjson.RawMessage
+			if err := websocket.JSON.Receive(conn, &raw); err != nil {
+				return
+			}
+			var typ string
+			json.Unmarshal(raw[0], &typ)
+
+			switch typ {
+			case "EVENT":
+				event := parseEventMessage(t, raw)
+				published <- event
+				websocket.JSON.Send(conn, []any{"OK", event.ID, true, ""})
+			case "REQ":
+				var subid string
+				json.Unmarshal(raw[1], &subid)
+				websocket.JSON.Send(conn, []any{"EVENT", subid, evt})
+				websocket.JSON.Send(conn, []any{"EOSE", subid})
+			}
+		}
+	})
+	defer ws.Close()
+
+	backoff := make(chan struct{}, 1)
+	rl := NewRelay(context.Background(), ws.URL,
+		WithReconnect{InitialBackoff: 400 * time.Millisecond},
+		WithConnectionStateHandler(func(state ConnectionState, err error) {
+			if state == ConnectionStateBackoff {
+				select {
+				case backoff <- struct{}{}:
+				default:
+				}
+			}
+		}),
+	)
+	require.NoError(t, rl.Connect(context.Background()))
+	defer rl.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	select {
+	case <-backoff:
+	case <-ctx.Done():
+		t.Fatal("connection wasn't lost")
+	}
+	assert.False(t, rl.IsConnected())
+	assert.True(t, rl.IsReconnecting())
+
+	// we don't get stuck while there is no connection
+	shortCtx, shortCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	start := time.Now()
+	err := rl.Publish(shortCtx, evt)
+	shortCancel()
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 200*time.Millisecond)
+
+	// these are sent once we're back
+	sub, err := rl.Subscribe(ctx, Filters{{Kinds: []int{KindTextNote}}})
+	require.NoError(t, err)
+	require.NoError(t, rl.Publish(ctx, evt))
+	assert.Equal(t, evt.ID, (<-published).ID)
+	assert.True(t, rl.IsConnected())
+
+	select {
+	case received := <-sub.Events:
+		assert.Equal(t, evt.ID, received.ID)
+	case <-ctx.Done():
+		t.Fatal("subscription wasn't resumed")
+	}
+}
+
+func TestDuplicateCheckAcrossFrames(t *testing.T) {
+	priv, _ := makeKeyPair(t)
+	a := Event{Kind: KindTextNote, Content: "a", CreatedAt: Timestamp(1672068534)}
+	a.Sign(priv)
+	b := Event{Kind: KindTextNote, Content: "b", CreatedAt: Timestamp(1672068600)}
+	b.Sign(priv)
+
+	ws := newWebsocketServer(func(conn *websocket.Conn) {
+		var raw []stdjson.RawMessage
+		websocket.JSON.Receive(conn, &raw)
+		var subid string
+		json.Unmarshal(raw[1], &subid)
+
+		// all these are read through the same buffer
+		websocket.JSON.Send(conn, []any{"EVENT", subid, a})
+		websocket.JSON.Send(conn, []any{"EVENT", subid, b})
+		websocket.JSON.Send(conn, []any{"EVENT", subid, a})
+		websocket.JSON.Send(conn, []any{"EOSE", subid})
+		io.ReadAll(conn)
+	})
+	defer ws.Close()
+
+	rl := mustRelayConnect(t, ws.URL)
+	defer rl.Close()
+
+	var mu sync.Mutex
+	checked := make([]string, 0, 3)
+	seen := make(map[string]struct{})
+	sub, err := rl.Subscribe(context.Background(), Filters{{Kinds: []int{KindTextNote}}},
+		WithCheckDuplicate(func(id, relay string) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			checked = append(checked, id)
+			_, exists := seen[id]
+			seen[id] = struct{}{}
+			return exists
+		}),
+	)
+	require.NoError(t, err)
+
+	received := make([]string, 0, 2)
+	timeout := time.After(5 * time.Second)
+loop:
+	for {
+		select {
+		case evt := <-sub.Events:
+			received = append(received, evt.Content)
+		case <-sub.EndOfStoredEvents:
+			break loop
+		case <-timeout:
+			t.Fatalf("timeout, got only %v", received)
+		}
+	}
+
+	assert.Equal(t, []string{"a", "b"}, received)
+	mu.Lock()
+	assert.Equal(t, []string{a.ID, b.ID, a.ID}, checked)
+	mu.Unlock()
+}
+
 func discardingHandler(conn *websocket.Conn) {
 	io.ReadAll(conn) // discard all input
 }
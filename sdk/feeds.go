@@ -27,6 +27,8 @@ func makePubkeyStreamKey(prefix byte, pubkey string) []byte {
 // taking into account their outbox relays. It returns a channel that emits events
 // continuously. The events are fetched from the time of the last seen event for
 // each pubkey (stored in KVStore) onwards.
+//
+// Relays are chosen by sys.RelaySelector and a single subscription is opened on each.
 func (sys *System) StreamLiveFeed(
 	ctx context.Context,
 	pubkeys []string,
@@ -34,52 +36,72 @@ func (sys *System) StreamLiveFeed(
 ) (<-chan *nostr.Event, error) {
 	events := make(chan *nostr.Event)
 
-	active := atomic.Int32{}
-	active.Add(int32(len(pubkeys)))
+	type streamState struct {
+		latestKey []byte
+		latest    nostr.Timestamp
+		oldestKey []byte
+		oldest    nostr.Timestamp
+		serial    int
+	}
 
-	// start a subscription for each relay group
+	mu := sync.Mutex{}
+	states := make(map[string]*streamState, len(pubkeys))
 	for _, pubkey := range pubkeys {
-		relays := sys.FetchOutboxRelays(ctx, pubkey, 2)
-		if len(relays) == 0 {
-			if active.Add(-1) == 0 {
-				close(events)
-			}
-			continue
+		state := &streamState{
+			latestKey: makePubkeyStreamKey(pubkeyStreamLatestPrefix, pubkey),
+			oldestKey: makePubkeyStreamKey(pubkeyStreamOldestPrefix, pubkey),
 		}
+		if data, _ := sys.KVStore.Get(state.latestKey); data != nil {
+			state.latest = decodeTimestamp(data)
+		}
+		states[pubkey] = state
+	}
 
-		latestKey := makePubkeyStreamKey(pubkeyStreamLatestPrefix, pubkey)
-		latest := nostr.Timestamp(0)
-		oldestKey := makePubkeyStreamKey(pubkeyStreamOldestPrefix, pubkey)
-		oldest := nostr.Timestamp(0)
+	dfs := sys.RelaySelector.SelectRelays(ctx, pubkeys, kinds)
+	if len(dfs) == 0 {
+		close(events)
+		return events, nil
+	}
 
-		serial := 0
+	active := atomic.Int32{}
+	active.Add(int32(len(dfs)))
 
+	// start a subscription for each relay
+	for _, df := range dfs {
+		// we must start from the oldest "latest" among all the authors we'll query on this relay,
+		// if any of them has never been seen we can't use since at all
 		var since *nostr.Timestamp
-		if data, _ := sys.KVStore.Get(latestKey); data != nil {
-			latest = decodeTimestamp(data)
-			since = &latest
-		}
-
-		filter := nostr.Filter{
-			Authors: []string{pubkey},
-			Since:   since,
-			Kinds:   kinds,
+		for _, pubkey := range df.Authors {
+			latest := states[pubkey].latest
+			if latest == 0 {
+				since = nil
+				break
+			}
+			if since == nil || latest < *since {
+				since = &latest
+			}
 		}
+		df.Since = since
 
 		go func() {
-			sub := sys.Pool.SubscribeMany(ctx, relays, filter, nostr.WithLabel("livefeed"))
+			sub := sys.Pool.SubscribeMany(ctx, []string{df.Relay}, df.Filter, nostr.WithLabel("livefeed"))
 			for evt := range sub {
 				sys.StoreRelay.Publish(ctx, *evt.Event)
-				if latest < evt.CreatedAt {
-					latest = evt.CreatedAt
-					serial++
-					if serial%10 == 0 {
-						sys.KVStore.Set(latestKey, encodeTimestamp(latest))
+
+				mu.Lock()
+				if state, ok := states[evt.PubKey]; ok {
+					if state.latest < evt.CreatedAt {
+						state.latest = evt.CreatedAt
+						state.serial++
+						if state.serial%10 == 0 {
+							sys.KVStore.Set(state.latestKey, encodeTimestamp(state.latest))
+						}
+					} else if state.oldest > evt.CreatedAt {
+						state.oldest = evt.CreatedAt
+						sys.KVStore.Set(state.oldestKey, encodeTimestamp(state.oldest))
 					}
-				} else if oldest > evt.CreatedAt {
-					oldest = evt.CreatedAt
-					sys.KVStore.Set(oldestKey, encodeTimestamp(oldest))
 				}
+				mu.Unlock()
 
 				events <- evt.Event
 			}
@@ -98,7 +120,8 @@ func (sys *System) StreamLiveFeed(
 // it isn't guaranteed that this quantity of events will be returned -- it could be more or less.
 //
 // It relies on KVStore's latestKey and oldestKey in order to determine if we should go to relays to ask
-// for events or if we should just return what we have stored locally.
+// for events or if we should just return what we have stored locally. Relays are chosen by sys.RelaySelector
+// for all the pubkeys that need them at once.
 func (sys *System) FetchFeedPage(
 	ctx context.Context,
 	pubkeys []string,
@@ -109,9 +132,7 @@ func (sys *System) FetchFeedPage(
 	limitPerKey := PerQueryLimitInBatch(totalLimit, len(pubkeys))
 	events := make([]*nostr.Event, 0, len(pubkeys)*limitPerKey)
 
-	wg := sync.WaitGroup{}
-	wg.Add(len(pubkeys))
-
+	oldestTimestamps := make(map[string]nostr.Timestamp, len(pubkeys))
 	for _, pubkey := range pubkeys {
 		oldestKey := makePubkeyStreamKey(pubkeyStreamOldestPrefix, pubkey)
 		var oldestTimestamp nostr.Timestamp
@@ -123,11 +144,9 @@ func (sys *System) FetchFeedPage(
 			}
 		}
 
-		filter := nostr.Filter{Authors: []string{pubkey}, Kinds: kinds}
-
 		if until > oldestTimestamp {
 			// we can use our local database
-			filter.Until = &until
+			filter := nostr.Filter{Authors: []string{pubkey}, Kinds: kinds, Until: &until}
 			res, err := sys.StoreRelay.QuerySync(ctx, filter)
 			if err != nil {
 				return nil, fmt.Errorf("query failure at '%s': %w", pubkey, err)
@@ -136,43 +155,63 @@ func (sys *System) FetchFeedPage(
 			if len(res) >= limitPerKey {
 				// we got enough from the local store
 				events = append(events, res...)
-				wg.Done()
 				continue
 			}
 		}
 
 		// if we didn't get enough events from local database
 		// OR if we are requesting for very old stuff
-		// then we will query relays -- always with Until set to our oldestTimestamp+1
-		// (so we don't get events we already have)
-		relays := sys.FetchOutboxRelays(ctx, pubkey, 2)
-		if len(relays) == 0 {
-			wg.Done()
+		// then we will query relays
+		oldestTimestamps[pubkey] = oldestTimestamp
+	}
+
+	if len(oldestTimestamps) == 0 {
+		slices.SortFunc(events, nostr.CompareEventPtrReverse)
+		return events, nil
+	}
+
+	remaining := make([]string, 0, len(oldestTimestamps))
+	for pubkey := range oldestTimestamps {
+		remaining = append(remaining, pubkey)
+	}
+	dfs := sys.RelaySelector.SelectRelays(ctx, remaining, kinds)
+	for i, df := range dfs {
+		// always with Until set to oldestTimestamp+1 (so we don't get events we already have),
+		// but since each relay serves many pubkeys we have to use the newest of these
+		var fUntil nostr.Timestamp
+		for _, pubkey := range df.Authors {
+			fUntil = max(fUntil, oldestTimestamps[pubkey]+1)
+		}
+		dfs[i].Until = &fUntil
+		dfs[i].Since = nil
+	}
+
+	for ie := range sys.Pool.BatchedSubManyEose(ctx, dfs, nostr.WithLabel("feedpage")) {
+		sys.StoreRelay.Publish(ctx, *ie.Event)
+
+		oldestTimestamp, ok := oldestTimestamps[ie.Event.PubKey]
+		if !ok {
+			// not something we asked for
 			continue
 		}
-		fUntil := oldestTimestamp + 1
-		filter.Until = &fUntil
-		filter.Since = nil
-		for ie := range sys.Pool.FetchMany(ctx, relays, filter, nostr.WithLabel("feedpage")) {
-			sys.StoreRelay.Publish(ctx, *ie.Event)
-
-			// we shouldn't need this check here, but against rogue relays we'll do it
-			if ie.Event.CreatedAt < oldestTimestamp {
-				oldestTimestamp = ie.Event.CreatedAt
-			}
 
-			// we should check this because we might be just catching up to the point where the
-			// offset that was requested.
-			// so we don't add these events to our results, just to our local store (above)
-			if ie.Event.CreatedAt < until {
-				events = append(events, ie.Event)
-			}
+		// we shouldn't need this check here, but against rogue relays we'll do it
+		if ie.Event.CreatedAt < oldestTimestamp {
+			oldestTimestamps[ie.Event.PubKey] = ie.Event.CreatedAt
 		}
-		wg.Done()
-		sys.KVStore.Set(oldestKey, encodeTimestamp(oldestTimestamp))
+
+		// we should check this because we might be just catching up to the point where the
+		// offset that was requested.
+		// so we don't add these events to our results, just to our local store (above)
+		if ie.Event.CreatedAt < until {
+			events = append(events, ie.Event)
+		}
+	}
+
+	for pubkey, oldestTimestamp := range oldestTimestamps {
+		sys.KVStore.Set(makePubkeyStreamKey(pubkeyStreamOldestPrefix, pubkey), encodeTimestamp(oldestTimestamp))
 	}
 
-	wg.Wait()
 	slices.SortFunc(events, nostr.CompareEventPtrReverse)
 
 	return events, nil
@@ -0,0 +1,62 @@
+package sdk
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	cache_memory "github.com/nbd-wtf/go-nostr/sdk/cache/memory"
+)
+
+// Emoji is a NIP-30 custom emoji.
+type Emoji struct {
+	Shortcode string
+	URL       string
+}
+
+func (e Emoji) Value() string { return e.Shortcode }
+
+// FetchEmojiList fetches the emoji list (kind:10030) of the given pubkey, only the emojis listed
+// directly on it are included, for the ones from referenced emoji sets use FetchEmojis.
+func (sys *System) FetchEmojiList(ctx context.Context, pubkey string) GenericList[Emoji] {
+	if sys.EmojiListCache == nil {
+		sys.EmojiListCache = cache_memory.New32[GenericList[Emoji]](1000)
+	}
+
+	ml, _ := fetchGenericList(sys, ctx, pubkey, nostr.KindEmojiList, kind_10030, parseEmojiTag, sys.EmojiListCache)
+	return ml
+}
+
+// FetchEmojis returns all the emojis a user has chosen to use, from their emoji list and from all the
+// emoji sets (kind:30030) referenced in it.
+func (sys *System) FetchEmojis(ctx context.Context, pubkey string) []Emoji {
+	el := sys.FetchEmojiList(ctx, pubkey)
+	emojis := el.Items
+	if el.Event == nil {
+		return emojis
+	}
+
+	for _, tag := range el.Event.Tags {
+		if len(tag) < 2 || tag[0] != "a" || !strings.HasPrefix(tag[1], "30030:") {
+			continue
+		}
+		pointer, err := nostr.EntityPointerFromTag(tag)
+		if err != nil {
+			continue
+		}
+		set, _, err := sys.FetchSpecificEvent(ctx, pointer, FetchSpecificEventParameters{})
+		if err != nil {
+			continue
+		}
+		emojis = append(emojis, parseItemsFromEventTags(set, parseEmojiTag)...)
+	}
+
+	return emojis
+}
+
+func parseEmojiTag(tag nostr.Tag) (e Emoji, ok bool) {
+	if len(tag) < 3 || tag[0] != "emoji" || tag[1] == "" || tag[2] == "" {
+		return e, false
+	}
+	return Emoji{Shortcode: tag[1], URL: tag[2]}, true
+}
@@ -26,6 +26,7 @@ type ProfileMetadata struct {
 	Banner      string `json:"banner,omitempty"`
 	NIP05       string `json:"nip05,omitempty"`
 	LUD16       string `json:"lud16,omitempty"`
+	LUD06       string `json:"lud06,omitempty"`
 
 	nip05Valid       bool
 	nip05LastAttempt time.Time
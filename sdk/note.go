@@ -1,47 +1,229 @@
 package sdk
 
 import (
+	"context"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
 	"github.com/nbd-wtf/go-nostr/nip27"
+	"github.com/nbd-wtf/go-nostr/nip73"
+	"github.com/nbd-wtf/go-nostr/nip92"
+)
+
+var (
+	bareReference = regexp.MustCompile(`(?:npub|nprofile|nevent|naddr|note)1[023456789acdefghjklmnpqrstuvwxyz]+`)
+	bareDomain    = regexp.MustCompile(`(?i)[a-z0-9](?:[a-z0-9-]*[a-z0-9])?(?:\.[a-z0-9](?:[a-z0-9-]*[a-z0-9])?)*\.([a-z]{2,63})(?::[0-9]{1,5})?(?:/[^\s]*)?`)
+	hashtag       = regexp.MustCompile(`#([\p{L}\p{N}_]+)`)
+	emojiCode     = regexp.MustCompile(`:([a-zA-Z0-9_]+):`)
 )
 
+// mediaTypes are the file extensions for which we add imeta tags, along with their mime types.
+var mediaTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".avif": "image/avif",
+	".svg":  "image/svg+xml",
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+	".mov":  "video/quicktime",
+	".mp3":  "audio/mpeg",
+	".ogg":  "audio/ogg",
+	".wav":  "audio/wav",
+	".m4a":  "audio/mp4",
+	".flac": "audio/flac",
+}
+
 // PrepareNoteEvent takes an event with content that may include any number of URLs, partial URLs without the scheme, npub references with or without the "nostr:" prefix, tags and whatnot, then edits the content so it contains properly formatted URLs and references and adds the required tags based on these.
 //
+// Emoji shortcodes like :soapbox: are turned into NIP-30 "emoji" tags if they are found in the given emojis.
+// Tags that are already present are not added again, so calling this twice on the same event is harmless.
+//
 // This should only be used when dealing with "plaintext" style events such as kind:1 and kind:1111.
-func PrepareNoteEvent(evt *nostr.Event) {
+func PrepareNoteEvent(evt *nostr.Event, emojis ...Emoji) {
 	// iterate through the content and fix partial URLs based on the list of tlds
-	// TODO
-
-	// iterate through the content and fix nostr references missing the "nostr:" prefix
-	// TODO
-
-	// iterate through blocks in content and add missing tags
+	// and nostr references missing the "nostr:" prefix, skipping the parts that are already
+	// proper URLs or references
+	content := strings.Builder{}
+	content.Grow(len(evt.Content) + 32)
 	for block := range nip27.Parse(evt.Content) {
-		if block.Pointer == nil {
+		if block.Pointer != nil {
+			content.WriteString(block.Text)
 			continue
 		}
+		content.WriteString(fixPartialURLs(fixBareReferences(block.Text)))
+	}
+	evt.Content = content.String()
+
+	// iterate through blocks in content and add missing tags
+	for block := range nip27.Parse(evt.Content) {
 		switch b := block.Pointer.(type) {
 		case nostr.ProfilePointer:
-			// add b tag if not already present
-			if tag := evt.Tags.FindWithValue("b", b.PublicKey); tag == nil {
+			// add p tag if not already present
+			if tag := evt.Tags.FindWithValue("p", b.PublicKey); tag == nil {
 				evt.Tags = append(evt.Tags, b.AsTag())
 			}
 		case nostr.EventPointer:
-			// add e tag if not already present
+			// add q tag if not already present
 			if tag := evt.Tags.FindWithValue("q", b.ID); tag == nil {
-				evt.Tags = append(evt.Tags, b.AsTag())
+				tag := nostr.Tag{"q", b.ID, "", b.Author}
+				if len(b.Relays) > 0 {
+					tag[2] = b.Relays[0]
+				}
+				if b.Author == "" {
+					tag = tag[0:3]
+				}
+				evt.Tags = append(evt.Tags, tag)
 			}
 		case nostr.EntityPointer:
 			if tag := evt.Tags.FindWithValue("q", b.AsTagReference()); tag == nil {
-				evt.Tags = append(evt.Tags, b.AsTag())
+				tag := nostr.Tag{"q", b.AsTagReference()}
+				if len(b.Relays) > 0 {
+					tag = append(tag, b.Relays[0])
+				}
+				evt.Tags = append(evt.Tags, tag)
+			}
+		case nip73.ExternalPointer:
+			// add imeta tag for media if not already present
+			mimeType, ok := mediaType(b.Thing)
+			if !ok {
+				continue
+			}
+			if _, ok := nip92.ParseTags(evt.Tags).Get(b.Thing); !ok {
+				evt.Tags = append(evt.Tags, nostr.Tag{"imeta", "url " + b.Thing, "m " + mimeType})
+			}
+		case nil:
+			// iterate through the content and add hashtags and emojis to event tags
+			for _, match := range hashtag.FindAllStringSubmatchIndex(block.Text, -1) {
+				if !isBoundary(block.Text, match[0]) {
+					continue
+				}
+				t := strings.ToLower(block.Text[match[2]:match[3]])
+				if strings.IndexFunc(t, unicode.IsLetter) == -1 {
+					// things like #1 are not hashtags
+					continue
+				}
+				if tag := evt.Tags.FindWithValue("t", t); tag == nil {
+					evt.Tags = append(evt.Tags, nostr.Tag{"t", t})
+				}
+			}
+			for _, match := range emojiCode.FindAllStringSubmatch(block.Text, -1) {
+				idx := slices.IndexFunc(emojis, func(e Emoji) bool { return e.Shortcode == match[1] })
+				if idx == -1 {
+					continue
+				}
+				if tag := evt.Tags.FindWithValue("emoji", match[1]); tag == nil {
+					evt.Tags = append(evt.Tags, nostr.Tag{"emoji", emojis[idx].Shortcode, emojis[idx].URL})
+				}
+			}
+		}
+	}
+}
+
+// PrepareNoteEvent is like the package-level PrepareNoteEvent, but it also resolves emoji shortcodes
+// using the emoji list (kind:10030) of the event author, including the emoji sets referenced in it.
+//
+// evt.PubKey must be set.
+func (sys *System) PrepareNoteEvent(ctx context.Context, evt *nostr.Event) {
+	var emojis []Emoji
+	if emojiCode.MatchString(evt.Content) {
+		emojis = sys.FetchEmojis(ctx, evt.PubKey)
+	}
+	PrepareNoteEvent(evt, emojis...)
+}
+
+// fixBareReferences adds the "nostr:" prefix to NIP-19 codes that are missing it.
+func fixBareReferences(text string) string {
+	return replaceMatches(text, bareReference, func(match []int) string {
+		ref := text[match[0]:match[1]]
+		if match[0] > 0 && strings.ContainsAny(text[match[0]-1:match[0]], ":/.@_-") || !isBoundary(text, match[0]) {
+			return ref
+		}
+		if _, _, err := nip19.Decode(ref); err != nil {
+			return ref
+		}
+		return "nostr:" + ref
+	})
+}
+
+// fixPartialURLs adds the "https://" scheme to things that look like domain names with a known tld.
+func fixPartialURLs(text string) string {
+	return replaceMatches(text, bareDomain, func(match []int) string {
+		start, end := match[0], match[1]
+
+		// don't touch emails, parts of other words or paths
+		if start > 0 && strings.ContainsAny(text[start-1:start], ":/.@_-") || !isBoundary(text, start) {
+			return text[start:end]
+		}
+		if next, _ := utf8.DecodeRuneInString(text[end:]); isWordChar(next) || strings.ContainsRune("@_-", next) {
+			return text[start:end]
+		} else if next == '.' {
+			if after, _ := utf8.DecodeRuneInString(text[end+1:]); isWordChar(after) {
+				return text[start:end]
 			}
 		}
+
+		if _, found := slices.BinarySearch(tlds, strings.ToLower(text[match[2]:match[3]])); !found {
+			return text[start:end]
+		}
+
+		// punctuation at the end is most likely not part of the URL
+		trimmed := strings.TrimRight(text[start:end], ".,;:!?)]}'\"")
+		return "https://" + trimmed + text[start+len(trimmed):end]
+	})
+}
+
+// replaceMatches is like regexp.ReplaceAllStringFunc, but it gives the match indexes to the function.
+func replaceMatches(text string, re *regexp.Regexp, replace func(match []int) string) string {
+	matches := re.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+
+	result := strings.Builder{}
+	result.Grow(len(text) + len(matches)*8)
+	prev := 0
+	for _, match := range matches {
+		result.WriteString(text[prev:match[0]])
+		result.WriteString(replace(match))
+		prev = match[1]
+	}
+	result.WriteString(text[prev:])
+	return result.String()
+}
+
+// isBoundary tells if the character right before position i is not a letter or a digit.
+func isBoundary(text string, i int) bool {
+	if i == 0 {
+		return true
 	}
+	r, _ := utf8.DecodeLastRuneInString(text[0:i])
+	return !isWordChar(r)
+}
 
-	// iterate through the content and add hashtags to event tags
-	// TODO
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+func mediaType(thing string) (string, bool) {
+	u, err := url.Parse(thing)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", false
+	}
+	mimeType, ok := mediaTypes[strings.ToLower(path.Ext(u.Path))]
+	return mimeType, ok
 }
 
+// tlds must be kept sorted, we do binary searches on it.
 var tlds = []string{
 	"aaa",
 	"aarp",
@@ -11,6 +11,8 @@ func TestPrepareNoteEvent(t *testing.T) {
 	tests := []struct {
 		name     string
 		content  string
+		tags     nostr.Tags
+		emojis   []Emoji
 		wantTags nostr.Tags
 		want     string
 	}{
@@ -24,7 +26,8 @@ func TestPrepareNoteEvent(t *testing.T) {
 			name:    "with nostr: prefix, url and hashtag",
 			content: "hello nostr:npub180cvv07tjdrrgpa0j7j7tmnyl2yr6yr7l8j4s3evf6u64th6gkwsyjh6w6 please visit https://banana.com/ and get your free #banana",
 			wantTags: nostr.Tags{
-				{"p", "82341f882b6eabcd2ba7f1ef90aad961cf074af15b9ef44a09f9d2a8fbfbe6a2"},
+				{"p", "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d"},
+				{"t", "banana"},
 			},
 			want: "hello nostr:npub180cvv07tjdrrgpa0j7j7tmnyl2yr6yr7l8j4s3evf6u64th6gkwsyjh6w6 please visit https://banana.com/ and get your free #banana",
 		},
@@ -32,20 +35,78 @@ func TestPrepareNoteEvent(t *testing.T) {
 			name:    "with bare npub and bare url",
 			content: "hello npub180cvv07tjdrrgpa0j7j7tmnyl2yr6yr7l8j4s3evf6u64th6gkwsyjh6w6 please visit banana.com",
 			wantTags: nostr.Tags{
-				{"p", "82341f882b6eabcd2ba7f1ef90aad961cf074af15b9ef44a09f9d2a8fbfbe6a2"},
+				{"p", "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d"},
 			},
-			want: "hello nostr:npub180cvv07tjdrrgpa0j7j7tmnyl2yr6yr7l8j4s3evf6u64th6gkwsyjh6w6 please visit banana.com",
+			want: "hello nostr:npub180cvv07tjdrrgpa0j7j7tmnyl2yr6yr7l8j4s3evf6u64th6gkwsyjh6w6 please visit https://banana.com",
+		},
+		{
+			name:     "mixed-case hashtag",
+			content:  "get your free #Banana",
+			wantTags: nostr.Tags{{"t", "banana"}},
+			want:     "get your free #Banana",
+		},
+		{
+			name:     "same hashtag in different cases",
+			content:  "#banana #BANANA #Banana and #apple",
+			wantTags: nostr.Tags{{"t", "banana"}, {"t", "apple"}},
+			want:     "#banana #BANANA #Banana and #apple",
+		},
+		{
+			name:    "existing p tag is not duplicated",
+			content: "hi nostr:npub180cvv07tjdrrgpa0j7j7tmnyl2yr6yr7l8j4s3evf6u64th6gkwsyjh6w6",
+			tags: nostr.Tags{
+				{"p", "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d", "wss://relay.example.com"},
+			},
+			wantTags: nostr.Tags{
+				{"p", "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d", "wss://relay.example.com"},
+			},
+			want: "hi nostr:npub180cvv07tjdrrgpa0j7j7tmnyl2yr6yr7l8j4s3evf6u64th6gkwsyjh6w6",
+		},
+		{
+			name:    "quotes",
+			content: "look at this nevent1qqst8cujky046negxgwwm5ynqwn53t8aqjr6afd8g59nfqwxpdhylpcpzamhxue69uhhyetvv9ujuetcv9khqmr99e3k7mgzyqalp33lewf5vdq847t6te0wvnags0gs0mu72kz8938tn24wlfze6ge7aaw\nand nostr:naddr1qqrxyctwv9hxzq3q80cvv07tjdrrgpa0j7j7tmnyl2yr6yr7l8j4s3evf6u64th6gkwsxpqqqp65weyxdnl",
+			wantTags: nostr.Tags{
+				{"q", "b3e392b11f5d4f28321cedd09303a748acfd0487aea5a7450b3481c60b6e4f87", "wss://relay.example.com", "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d"},
+				{"q", "30023:3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d:banana"},
+			},
+			want: "look at this nostr:nevent1qqst8cujky046negxgwwm5ynqwn53t8aqjr6afd8g59nfqwxpdhylpcpzamhxue69uhhyetvv9ujuetcv9khqmr99e3k7mgzyqalp33lewf5vdq847t6te0wvnags0gs0mu72kz8938tn24wlfze6ge7aaw\nand nostr:naddr1qqrxyctwv9hxzq3q80cvv07tjdrrgpa0j7j7tmnyl2yr6yr7l8j4s3evf6u64th6gkwsxpqqqp65weyxdnl",
+		},
+		{
+			name:     "partial urls",
+			content:  "see example.com/path?x=1, Sub.Example.co.uk. and blog.nostr.net:8080/a#b but not me@example.com, file.txt, README.notatld or https://already.com/x #1 #Nostr #nostr",
+			wantTags: nostr.Tags{{"t", "nostr"}},
+			want:     "see https://example.com/path?x=1, https://Sub.Example.co.uk. and https://blog.nostr.net:8080/a#b but not me@example.com, file.txt, README.notatld or https://already.com/x #1 #Nostr #nostr",
+		},
+		{
+			name:    "media and emojis",
+			content: "my cat :cat: :dog: nostr.build/i/cat.JPG https://example.com/v.mp4?x=y https://example.com/page",
+			emojis:  []Emoji{{"cat", "https://example.com/cat.png"}},
+			wantTags: nostr.Tags{
+				{"emoji", "cat", "https://example.com/cat.png"},
+				{"imeta", "url https://nostr.build/i/cat.JPG", "m image/jpeg"},
+				{"imeta", "url https://example.com/v.mp4?x=y", "m video/mp4"},
+			},
+			want: "my cat :cat: :dog: https://nostr.build/i/cat.JPG https://example.com/v.mp4?x=y https://example.com/page",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			tags := tt.tags
+			if tags == nil {
+				tags = nostr.Tags{}
+			}
 			evt := &nostr.Event{
 				Content: tt.content,
-				Tags:    nostr.Tags{},
+				Tags:    tags,
 			}
 
-			PrepareNoteEvent(evt)
+			PrepareNoteEvent(evt, tt.emojis...)
+			require.Equal(t, tt.want, evt.Content)
+			require.Equal(t, tt.wantTags, evt.Tags)
+
+			// doing it again changes nothing
+			PrepareNoteEvent(evt, tt.emojis...)
 			require.Equal(t, tt.want, evt.Content)
 			require.Equal(t, tt.wantTags, evt.Tags)
 		})
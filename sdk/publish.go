@@ -0,0 +1,137 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/sdk/hints"
+)
+
+// Publish signs the event with the given signer (unless it is already signed) and sends it to the
+// relays where it is supposed to be found according to the outbox model: the "write" relays of the author,
+// the "read" relays of every pubkey tagged with "p" (except in follow lists) and the relays hinted in "e", "a"
+// and "q" tags.
+//
+// Relays that ask for NIP-42 authentication are authenticated with the same signer.
+//
+// It returns one result per relay, in the order in which they were selected. The relays that accepted the
+// event are recorded in the hints database and as relays where the event can be found. An error is only
+// returned when the event couldn't be signed or when no relay accepted it.
+func (sys *System) Publish(ctx context.Context, signer nostr.Signer, evt *nostr.Event) ([]nostr.PublishResult, error) {
+	if evt.Sig == "" || evt.ID == "" || evt.PubKey == "" {
+		if err := signer.SignEvent(ctx, evt); err != nil {
+			return nil, fmt.Errorf("failed to sign event: %w", err)
+		}
+	}
+
+	relays := sys.publishTargets(ctx, evt)
+	if len(relays) == 0 {
+		return nil, fmt.Errorf("no relays to publish to")
+	}
+
+	results := make([]nostr.PublishResult, len(relays))
+	wg := sync.WaitGroup{}
+	wg.Add(len(relays))
+	for i, url := range relays {
+		go func() {
+			defer wg.Done()
+			results[i] = sys.publishToRelay(ctx, signer, url, *evt)
+		}()
+	}
+	wg.Wait()
+
+	ephemeral := nostr.IsEphemeralKind(evt.Kind)
+	errs := make([]error, 0, len(results))
+	for _, res := range results {
+		if res.Error != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", res.RelayURL, res.Error))
+			continue
+		}
+		if ephemeral || IsVirtualRelay(res.RelayURL) {
+			continue
+		}
+		sys.Hints.Save(evt.PubKey, res.RelayURL, hints.MostRecentEventFetched, evt.CreatedAt)
+		sys.trackEventRelay(evt.ID, res.RelayURL, false)
+	}
+
+	if len(errs) == len(results) {
+		return results, fmt.Errorf("failed to publish to any relay: %w", errors.Join(errs...))
+	}
+	return results, nil
+}
+
+func (sys *System) publishToRelay(ctx context.Context, signer nostr.Signer, url string, evt nostr.Event) nostr.PublishResult {
+	relay, err := sys.Pool.EnsureRelay(url)
+	if err != nil {
+		return nostr.PublishResult{Error: err, RelayURL: url}
+	}
+
+	if err := sys.Pool.WaitPublish(ctx, url); err != nil {
+		return nostr.PublishResult{Error: err, RelayURL: url, Relay: relay}
+	}
+
+	err = relay.Publish(ctx, evt)
+	sys.Pool.Stats.RecordPublish(url, err)
+	if err != nil && strings.HasPrefix(err.Error(), "msg: auth-required:") {
+		if authErr := relay.Auth(ctx, func(authEvent *nostr.Event) error {
+			return signer.SignEvent(ctx, authEvent)
+		}); authErr != nil {
+			return nostr.PublishResult{Error: fmt.Errorf("failed to auth: %w", authErr), RelayURL: url, Relay: relay}
+		}
+		err = relay.Publish(ctx, evt)
+		sys.Pool.Stats.RecordPublish(url, err)
+	}
+
+	return nostr.PublishResult{Error: err, RelayURL: url, Relay: relay}
+}
+
+// publishTargets returns the normalized and deduplicated list of relays an event should be sent to.
+func (sys *System) publishTargets(ctx context.Context, evt *nostr.Event) []string {
+	relays := make([]string, 0, 12)
+	add := func(candidates ...string) {
+		for _, r := range candidates {
+			if p, err := url.Parse(r); err != nil || (p.Scheme != "wss" && p.Scheme != "ws") {
+				continue
+			}
+			r = nostr.NormalizeURL(r)
+			if !slices.Contains(relays, r) {
+				relays = append(relays, r)
+			}
+		}
+	}
+
+	write := sys.FetchWriteRelays(ctx, evt.PubKey)
+	if len(write) == 0 {
+		write = sys.FetchOutboxRelays(ctx, evt.PubKey, 3)
+	}
+	add(write...)
+
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "p":
+			if evt.Kind == nostr.KindFollowList || tag[1] == evt.PubKey || !nostr.IsValidPublicKey(tag[1]) {
+				continue
+			}
+			inbox := sys.FetchInboxRelays(ctx, tag[1], 3)
+			if len(inbox) > 3 {
+				inbox = inbox[0:3]
+			}
+			add(inbox...)
+		case "e", "a", "q":
+			if len(tag) >= 3 {
+				add(tag[2])
+			}
+		}
+	}
+
+	return relays
+}
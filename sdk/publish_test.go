@@ -0,0 +1,102 @@
+package sdk
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/keyer"
+	"github.com/nbd-wtf/go-nostr/nostrtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublish(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	start := func(r *nostrtest.Relay) string {
+		// "localhost" so these aren't treated as virtual relays
+		r.URL = nostr.NormalizeURL(strings.Replace(r.Start(), "127.0.0.1", "localhost", 1))
+		return r.URL
+	}
+
+	indexer := nostrtest.NewRelay()
+	indexerURL := start(indexer)
+	defer indexer.Close()
+	outbox := nostrtest.NewRelay()
+	outbox.RequireAuth = true
+	outboxURL := start(outbox)
+	defer outbox.Close()
+	inbox := nostrtest.NewRelay()
+	inboxURL := start(inbox)
+	defer inbox.Close()
+	hinted := nostrtest.NewRelay()
+	hintedURL := start(hinted)
+	defer hinted.Close()
+
+	aliceSecret := nostr.GeneratePrivateKey()
+	alice, _ := keyer.NewPlainKeySigner(aliceSecret)
+	alicePubkey, _ := nostr.GetPublicKey(aliceSecret)
+	bobSecret := nostr.GeneratePrivateKey()
+	bobPubkey, _ := nostr.GetPublicKey(bobSecret)
+
+	aliceList := nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      10002,
+		Tags:      nostr.Tags{{"r", outboxURL, "write"}, {"r", hintedURL, "read"}},
+	}
+	aliceList.Sign(aliceSecret)
+	bobList := nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      10002,
+		Tags:      nostr.Tags{{"r", inboxURL, "read"}},
+	}
+	bobList.Sign(bobSecret)
+	for _, evt := range []nostr.Event{aliceList, bobList} {
+		require.NoError(t, indexer.Store.SaveEvent(ctx, &evt))
+	}
+
+	sys := NewSystem(WithRelayListRelays([]string{indexerURL}))
+	defer sys.Close()
+
+	reply := &nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      1,
+		Content:   "hello bob",
+		Tags: nostr.Tags{
+			{"e", "ef2c94c3b17afa7c8f4b4f2ee8bfb4e4d5be6a4ef5c1a0dc0b1c40d1f5b0e7e2", hintedURL + "/"},
+			{"p", bobPubkey},
+			{"e", "fb3b6e6a83a4a7d67d6c1d98b85b1ef9d5a4c1c8c5b69d0b8b5a0a6a8f4e7d31", "https://not-a-relay.com"},
+		},
+	}
+	results, err := sys.Publish(ctx, alice, reply)
+	require.NoError(t, err)
+	require.Equal(t, alicePubkey, reply.PubKey)
+	require.NotEmpty(t, reply.Sig)
+
+	urls := make([]string, 0, len(results))
+	for _, res := range results {
+		require.NoError(t, res.Error, res.RelayURL)
+		urls = append(urls, res.RelayURL)
+	}
+	require.Equal(t, []string{outboxURL, hintedURL, inboxURL}, urls)
+
+	for _, r := range []*nostrtest.Relay{outbox, inbox, hinted} {
+		evts, _ := r.Store.QueryEvents(ctx, nostr.Filter{IDs: []string{reply.ID}})
+		require.Len(t, evts, 1)
+	}
+
+	seenOn, err := sys.GetEventRelays(reply.ID)
+	require.NoError(t, err)
+	require.ElementsMatch(t, urls, seenOn)
+	require.Contains(t, sys.Hints.TopN(alicePubkey, 5), outboxURL)
+
+	// everything fails
+	outbox.RejectEvent = func(ctx context.Context, evt *nostr.Event) (bool, string) { return true, "blocked: no" }
+	note := &nostr.Event{CreatedAt: nostr.Now(), Kind: 1, Content: "nobody wants this"}
+	results, err = sys.Publish(ctx, alice, note)
+	require.ErrorContains(t, err, "blocked: no")
+	require.Len(t, results, 1)
+}
@@ -0,0 +1,145 @@
+package sdk
+
+import (
+	"context"
+	"slices"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// RelaySelector decides from which relays to fetch events authored by a set of pubkeys.
+//
+// It returns a plan with at most one filter per relay, each containing the authors that should be
+// queried on that relay and the given kinds, so callers can open one subscription per relay instead
+// of one per pubkey.
+type RelaySelector interface {
+	SelectRelays(ctx context.Context, pubkeys []string, kinds []int) []nostr.DirectedFilter
+}
+
+var _ RelaySelector = (*GreedyRelaySelector)(nil)
+
+// GreedyRelaySelector is the default RelaySelector. It gets candidate relays for each pubkey from
+// System.FetchOutboxRelays and then picks relays using a greedy set cover: the relay that serves the
+// most authors that still need to be covered is picked first, and so on.
+//
+// It first tries to cover every author once and only then goes for redundancy, so when MaxConnections
+// is reached the relays left out are the ones that would give authors their second or third relay.
+// Authors that still don't get any relay are queried on one of the System.FallbackRelays if that was
+// selected, otherwise on the relay that serves most authors.
+type GreedyRelaySelector struct {
+	sys *System
+
+	// MaxConnections is the maximum number of relays in a plan. Zero means unlimited.
+	MaxConnections int
+
+	// MinRelaysPerAuthor is how many relays each author should be queried on, when possible.
+	MinRelaysPerAuthor int
+
+	// CandidatesPerAuthor is how many outbox relays are considered for each author.
+	CandidatesPerAuthor int
+}
+
+// NewGreedyRelaySelector returns a GreedyRelaySelector with default limits that uses the given System to
+// find relays for each author.
+func NewGreedyRelaySelector(sys *System) *GreedyRelaySelector {
+	return &GreedyRelaySelector{
+		sys:                 sys,
+		MaxConnections:      20,
+		MinRelaysPerAuthor:  2,
+		CandidatesPerAuthor: 5,
+	}
+}
+
+func (gs *GreedyRelaySelector) SelectRelays(ctx context.Context, pubkeys []string, kinds []int) []nostr.DirectedFilter {
+	if len(pubkeys) == 0 {
+		return nil
+	}
+
+	minPerAuthor := max(1, gs.MinRelaysPerAuthor)
+	candidates := make(map[string][]string, len(pubkeys))
+	authorsByRelay := make(map[string][]string)
+	for _, pubkey := range pubkeys {
+		if _, ok := candidates[pubkey]; ok {
+			continue
+		}
+		relays := gs.sys.FetchOutboxRelays(ctx, pubkey, max(gs.CandidatesPerAuthor, minPerAuthor))
+		candidates[pubkey] = relays
+		for _, url := range relays {
+			authorsByRelay[url] = append(authorsByRelay[url], pubkey)
+		}
+	}
+
+	selected := make([]string, 0, min(len(authorsByRelay), max(gs.MaxConnections, 1)))
+	assigned := make(map[string][]string, len(authorsByRelay)) // relay -> authors
+	covered := make(map[string]int, len(candidates))           // author -> number of relays
+
+	for round := 1; round <= minPerAuthor; round++ {
+		for gs.MaxConnections <= 0 || len(selected) < gs.MaxConnections {
+			// pick the relay that serves most authors that are still below this round's target,
+			// breaking ties by how well ranked that relay is on these authors' lists
+			best := ""
+			bestCount := 0
+			bestRank := 0
+			for url, authors := range authorsByRelay {
+				if slices.Contains(selected, url) {
+					continue
+				}
+				count := 0
+				rank := 0
+				for _, pubkey := range authors {
+					if covered[pubkey] < round {
+						count++
+						rank += len(candidates[pubkey]) - slices.Index(candidates[pubkey], url)
+					}
+				}
+				if count > bestCount ||
+					(count == bestCount && count > 0 && (rank > bestRank || (rank == bestRank && url < best))) {
+					best = url
+					bestCount = count
+					bestRank = rank
+				}
+			}
+			if bestCount == 0 {
+				break
+			}
+
+			selected = append(selected, best)
+			for _, pubkey := range authorsByRelay[best] {
+				if covered[pubkey] < minPerAuthor {
+					covered[pubkey]++
+					assigned[best] = append(assigned[best], pubkey)
+				}
+			}
+		}
+	}
+
+	// only happens when we ran out of connections, as every author has outbox relays
+	uncovered := make([]string, 0, len(candidates))
+	for pubkey := range candidates {
+		if covered[pubkey] == 0 {
+			uncovered = append(uncovered, pubkey)
+		}
+	}
+	if len(uncovered) > 0 && len(selected) > 0 {
+		target := selected[0]
+		for _, url := range selected {
+			if slices.Contains(gs.sys.FallbackRelays.URLs, url) {
+				target = url
+				break
+			}
+		}
+		assigned[target] = append(assigned[target], uncovered...)
+	}
+
+	dfs := make([]nostr.DirectedFilter, 0, len(selected))
+	for _, url := range selected {
+		authors := assigned[url]
+		slices.Sort(authors)
+		dfs = append(dfs, nostr.DirectedFilter{
+			Relay:  url,
+			Filter: nostr.Filter{Authors: authors, Kinds: kinds},
+		})
+	}
+
+	return dfs
+}
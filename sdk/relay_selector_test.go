@@ -0,0 +1,90 @@
+package sdk
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nostrtest"
+	"github.com/nbd-wtf/go-nostr/sdk/hints"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGreedyRelaySelector(t *testing.T) {
+	ctx := context.Background()
+
+	// so we don't go to the network looking for relay lists
+	indexer := nostrtest.NewRelay()
+	defer indexer.Close()
+	sys := NewSystem(WithRelayListRelays([]string{indexer.Start()}))
+	defer sys.Close()
+
+	authors := make([]string, 4)
+	for i := range authors {
+		authors[i], _ = nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	}
+	a, b, c, d := authors[0], authors[1], authors[2], authors[3]
+
+	for relay, pubkeys := range map[string][]string{
+		"wss://big.com":    {a, b, c},
+		"wss://medium.com": {c, d},
+		"wss://small.com":  {a},
+		"wss://other.com":  {b, d},
+	} {
+		for _, pubkey := range pubkeys {
+			sys.Hints.Save(pubkey, relay, hints.LastInRelayList, nostr.Now())
+		}
+	}
+
+	selector := NewGreedyRelaySelector(sys)
+	selector.MaxConnections = 3
+	selector.MinRelaysPerAuthor = 2
+
+	plan := selector.SelectRelays(ctx, authors, []int{1})
+	require.LessOrEqual(t, len(plan), 3)
+	require.Equal(t, "wss://big.com", plan[0].Relay)
+
+	count := make(map[string]int)
+	for _, df := range plan {
+		require.Equal(t, []int{1}, df.Kinds)
+		for _, pubkey := range df.Authors {
+			count[pubkey]++
+		}
+	}
+	for _, pubkey := range authors {
+		require.GreaterOrEqual(t, count[pubkey], 1, "every author must be covered")
+		require.LessOrEqual(t, count[pubkey], 2)
+	}
+
+	// without a limit everybody gets two relays
+	selector.MaxConnections = 0
+	plan = selector.SelectRelays(ctx, authors, []int{1})
+	count = make(map[string]int)
+	for _, df := range plan {
+		for _, pubkey := range df.Authors {
+			count[pubkey]++
+		}
+	}
+	for _, pubkey := range authors {
+		require.Equal(t, 2, count[pubkey])
+	}
+
+	// a single connection isn't enough for everybody, so d is looked for on the one we have
+	selector.MaxConnections = 1
+	plan = selector.SelectRelays(ctx, authors, []int{1})
+	require.Len(t, plan, 1)
+	require.Equal(t, "wss://big.com", plan[0].Relay)
+	require.ElementsMatch(t, []string{a, b, c, d}, plan[0].Authors)
+
+	// if one of the fallback relays was selected the authors left out go there instead
+	e, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	sys.Hints.Save(e, "wss://lonely.com", hints.LastInRelayList, nostr.Now())
+	sys.FallbackRelays.URLs = []string{"wss://medium.com", "wss://other.com"}
+	selector.MaxConnections = 2
+	selector.MinRelaysPerAuthor = 1
+	plan = selector.SelectRelays(ctx, append(authors, e), []int{1})
+	require.Len(t, plan, 2)
+	require.Equal(t, "wss://big.com", plan[0].Relay)
+	require.Contains(t, sys.FallbackRelays.URLs, plan[1].Relay)
+	require.ElementsMatch(t, []string{d, e}, plan[1].Authors)
+}
@@ -37,10 +37,12 @@ type System struct {
 	BlockedRelayListCache cache.Cache32[GenericList[RelayURL]]
 	SearchRelayListCache  cache.Cache32[GenericList[RelayURL]]
 	TopicListCache        cache.Cache32[GenericList[Topic]]
+	EmojiListCache        cache.Cache32[GenericList[Emoji]]
 	RelaySetsCache        cache.Cache32[GenericSets[RelayURL]]
 	FollowSetsCache       cache.Cache32[GenericSets[ProfileRef]]
 	TopicSetsCache        cache.Cache32[GenericSets[Topic]]
 	Hints                 hints.HintsDB
+	RelaySelector         RelaySelector
 	Pool                  *nostr.SimplePool
 	RelayListRelays       *RelayStream
 	FollowListRelays      *RelayStream
@@ -136,6 +138,10 @@ func NewSystem(mods ...SystemModifier) *System {
 		sys.RelayListCache = cache_memory.New32[GenericList[Relay]](8000)
 	}
 
+	if sys.RelaySelector == nil {
+		sys.RelaySelector = NewGreedyRelaySelector(sys)
+	}
+
 	if sys.Store == nil {
 		sys.Store = &nullstore.NullStore{}
 		sys.Store.Init()
@@ -165,6 +171,13 @@ func WithHintsDB(hdb hints.HintsDB) SystemModifier {
 	}
 }
 
+// WithRelaySelector returns a SystemModifier that sets the RelaySelector.
+func WithRelaySelector(rs RelaySelector) SystemModifier {
+	return func(sys *System) {
+		sys.RelaySelector = rs
+	}
+}
+
 // WithRelayListRelays returns a SystemModifier that sets the RelayListRelays.
 func WithRelayListRelays(list []string) SystemModifier {
 	return func(sys *System) {
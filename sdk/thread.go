@@ -0,0 +1,408 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip10"
+	"github.com/nbd-wtf/go-nostr/nip22"
+	"github.com/nbd-wtf/go-nostr/nip73"
+)
+
+// Thread is a tree of replies built by FetchThread, it includes both NIP-10 (kind:1) replies
+// and NIP-22 (kind:1111) comments.
+//
+// The tree can be read directly until Stream is called, after that new nodes may be added at
+// any time so it must only be read through Walk and Get.
+type Thread struct {
+	Root *ThreadNode
+
+	sys     *System
+	relays  []string
+	filters nostr.Filters
+
+	mu     sync.Mutex
+	nodes  map[string]*ThreadNode // by event id, and also by address for addressable events
+	latest nostr.Timestamp
+}
+
+// ThreadNode is an event in a thread.
+//
+// When a reply points to a parent we couldn't find a placeholder node without an Event is created
+// for that parent under the root, so the reply still shows up in the right place.
+type ThreadNode struct {
+	// the event id, or "<kind>:<pubkey>:<d>" for addressable events that were only referenced
+	// by address, or the NIP-73 identifier for comments on external things
+	ID string
+
+	Event   *nostr.Event  // nil for placeholders
+	Parent  *ThreadNode   // nil for the root
+	Replies []*ThreadNode // from the oldest to the newest
+}
+
+// IsPlaceholder tells if this node stands for an event we don't have.
+func (node *ThreadNode) IsPlaceholder() bool { return node.Event == nil }
+
+// FetchThread fetches the root of the thread the given pointer belongs to, then all the replies
+// to it, from the relays hinted in the pointers and from the outbox and inbox relays of the root
+// author.
+//
+// The pointer can be an EventPointer or an EntityPointer for the root or for any reply in the
+// thread, or a nip73.ExternalPointer for NIP-22 comments on external things.
+func (sys *System) FetchThread(ctx context.Context, pointer nostr.Pointer) (*Thread, error) {
+	t := &Thread{
+		sys:   sys,
+		nodes: make(map[string]*ThreadNode),
+	}
+
+	var start *nostr.Event
+	var root nostr.Pointer = pointer
+	var author string
+	isRoot := true
+
+	switch v := pointer.(type) {
+	case nostr.EventPointer:
+		t.relays = appendUnique(t.relays, v.Relays...)
+	case nostr.EntityPointer:
+		t.relays = appendUnique(t.relays, v.Relays...)
+	case nip73.ExternalPointer:
+	default:
+		return nil, fmt.Errorf("can't fetch a thread from %v", pointer)
+	}
+
+	if _, ok := pointer.(nip73.ExternalPointer); !ok {
+		evt, relays, err := sys.FetchSpecificEvent(ctx, pointer, FetchSpecificEventParameters{})
+		if err != nil {
+			return nil, err
+		}
+		start = evt
+		author = evt.PubKey
+		t.relays = appendUnique(t.relays, relays...)
+
+		// if this is a reply we go up to the actual root
+		if r := getThreadRoot(evt); r != nil {
+			root = r
+			isRoot = false
+			switch v := r.(type) {
+			case nostr.EventPointer:
+				t.relays = appendUnique(t.relays, v.Relays...)
+				if v.Author != "" {
+					author = v.Author
+				}
+			case nostr.EntityPointer:
+				t.relays = appendUnique(t.relays, v.Relays...)
+				author = v.PublicKey
+			}
+		}
+	}
+
+	// the root node
+	t.Root = &ThreadNode{ID: threadKey(root)}
+	t.nodes[t.Root.ID] = t.Root
+	if start != nil && isRoot {
+		t.setRoot(start)
+	} else if _, ok := root.(nip73.ExternalPointer); !ok {
+		if evt, relays, err := sys.FetchSpecificEvent(ctx, root, FetchSpecificEventParameters{}); err == nil {
+			t.setRoot(evt)
+			t.relays = appendUnique(t.relays, relays...)
+		}
+	}
+	if t.Root.Event != nil {
+		author = t.Root.Event.PubKey
+	}
+	if start != nil {
+		t.add(start)
+	}
+
+	// replies go to the outbox relays of their authors, which we don't know yet, and also to the inbox
+	// relays of the root author, so those are our best bet
+	if author != "" {
+		t.relays = appendUnique(t.relays, sys.FetchOutboxRelays(ctx, author, 3)...)
+		t.relays = appendUnique(t.relays, sys.FetchInboxRelays(ctx, author, 3)...)
+	}
+	t.relays = appendUnique(t.relays, sys.FallbackRelays.Next())
+
+	// replies can reference the root by id, by address or, for comments, by an external identifier
+	var rootID, rootAddress string
+	switch v := root.(type) {
+	case nostr.EventPointer:
+		rootID = v.ID
+	case nostr.EntityPointer:
+		rootAddress = v.AsTagReference()
+	case nip73.ExternalPointer:
+		t.filters = nostr.Filters{{Kinds: []int{nostr.KindComment}, Tags: nostr.TagMap{"I": []string{v.Thing}}}}
+	}
+	if t.Root.Event != nil {
+		rootID = t.Root.Event.ID
+		if nostr.IsAddressableKind(t.Root.Event.Kind) {
+			rootAddress = eventAddress(t.Root.Event)
+		}
+	}
+	if rootID != "" {
+		t.filters = append(t.filters,
+			nostr.Filter{Kinds: []int{nostr.KindTextNote, nostr.KindComment}, Tags: nostr.TagMap{"e": []string{rootID}}},
+			nostr.Filter{Kinds: []int{nostr.KindComment}, Tags: nostr.TagMap{"E": []string{rootID}}},
+		)
+	}
+	if rootAddress != "" {
+		t.filters = append(t.filters,
+			nostr.Filter{Kinds: []int{nostr.KindTextNote, nostr.KindComment}, Tags: nostr.TagMap{"a": []string{rootAddress}}},
+			nostr.Filter{Kinds: []int{nostr.KindComment}, Tags: nostr.TagMap{"A": []string{rootAddress}}},
+		)
+	}
+
+	t.fetch(ctx, t.filters)
+
+	// some replies may point to parents that don't reference the root, so we try to get these once
+	missing := make([]string, 0, 8)
+	for key, node := range t.nodes {
+		if node.Event == nil && node != t.Root && nostr.IsValid32ByteHex(key) {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		t.fetch(ctx, nostr.Filters{{IDs: missing}})
+	}
+
+	return t, nil
+}
+
+func (t *Thread) fetch(ctx context.Context, filters nostr.Filters) {
+	dfs := make([]nostr.DirectedFilter, 0, len(t.relays)*len(filters))
+	for _, url := range t.relays {
+		for _, filter := range filters {
+			dfs = append(dfs, nostr.DirectedFilter{Relay: url, Filter: filter})
+		}
+	}
+
+	for ie := range t.sys.Pool.BatchedSubManyEose(ctx, dfs, nostr.WithLabel("thread")) {
+		t.mu.Lock()
+		t.add(ie.Event)
+		t.mu.Unlock()
+	}
+}
+
+// Stream keeps the thread updated with replies as they are published. The returned channel emits
+// every node that is added to the tree or that stops being a placeholder, and is closed when ctx is
+// canceled.
+func (t *Thread) Stream(ctx context.Context) <-chan *ThreadNode {
+	ch := make(chan *ThreadNode)
+
+	t.mu.Lock()
+	since := t.latest
+	t.mu.Unlock()
+	if since == 0 {
+		since = nostr.Now()
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(t.filters))
+	for _, filter := range t.filters {
+		filter.Since = &since
+		go func() {
+			defer wg.Done()
+			for ie := range t.sys.Pool.SubscribeMany(ctx, slices.Clone(t.relays), filter, nostr.WithLabel("thread")) {
+				t.mu.Lock()
+				node, added := t.add(ie.Event)
+				t.mu.Unlock()
+
+				if added {
+					select {
+					case ch <- node:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+
+	return ch
+}
+
+// Walk calls fn for each node in the thread, depth-first and in order, starting at the root with depth 0.
+// It stops as soon as fn returns false.
+func (t *Thread) Walk(fn func(node *ThreadNode, depth int) bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var walk func(node *ThreadNode, depth int) bool
+	walk = func(node *ThreadNode, depth int) bool {
+		if !fn(node, depth) {
+			return false
+		}
+		for _, reply := range node.Replies {
+			if !walk(reply, depth+1) {
+				return false
+			}
+		}
+		return true
+	}
+	walk(t.Root, 0)
+}
+
+// Get returns the node for the given event id (or address, for addressable events).
+func (t *Thread) Get(id string) *ThreadNode {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.nodes[id]
+}
+
+func (t *Thread) setRoot(evt *nostr.Event) {
+	t.Root.Event = evt
+	t.nodes[evt.ID] = t.Root
+	if nostr.IsAddressableKind(evt.Kind) {
+		t.nodes[eventAddress(evt)] = t.Root
+	}
+}
+
+// add puts an event in the tree, it returns false if it was already there.
+func (t *Thread) add(evt *nostr.Event) (*ThreadNode, bool) {
+	node, ok := t.nodes[evt.ID]
+	if !ok && nostr.IsAddressableKind(evt.Kind) {
+		node, ok = t.nodes[eventAddress(evt)]
+	}
+	if ok && node.Event != nil {
+		if node.Event.ID == evt.ID || node.Event.CreatedAt >= evt.CreatedAt {
+			return node, false
+		}
+	}
+
+	if node == t.Root {
+		t.setRoot(evt)
+		return node, true
+	}
+
+	if node == nil {
+		node = &ThreadNode{ID: evt.ID}
+	}
+	node.Event = evt
+	t.nodes[evt.ID] = node
+	if nostr.IsAddressableKind(evt.Kind) {
+		t.nodes[eventAddress(evt)] = node
+	}
+	t.latest = max(t.latest, evt.CreatedAt)
+
+	parent := t.Root
+	if key := getParentKey(evt); key != "" {
+		if p, ok := t.nodes[key]; ok {
+			parent = p
+		} else {
+			parent = &ThreadNode{ID: key}
+			t.nodes[key] = parent
+			t.Root.insert(parent)
+		}
+	}
+
+	// don't let weird events create cycles
+	for ancestor := parent; ancestor != nil; ancestor = ancestor.Parent {
+		if ancestor == node {
+			parent = t.Root
+			break
+		}
+	}
+
+	// this was a placeholder, or an older version of an addressable event, that may have been somewhere else
+	if node.Parent != nil {
+		node.Parent.remove(node)
+	}
+	parent.insert(node)
+
+	// placeholders are ordered by their first reply, so the ordering above may have changed
+	for p := parent; p.Event == nil && p.Parent != nil; p = p.Parent {
+		p.Parent.sort()
+	}
+
+	return node, true
+}
+
+func (node *ThreadNode) insert(reply *ThreadNode) {
+	reply.Parent = node
+	node.Replies = append(node.Replies, reply)
+	node.sort()
+}
+
+func (node *ThreadNode) remove(reply *ThreadNode) {
+	if idx := slices.Index(node.Replies, reply); idx != -1 {
+		node.Replies = slices.Delete(node.Replies, idx, idx+1)
+	}
+	reply.Parent = nil
+}
+
+func (node *ThreadNode) sort() {
+	slices.SortStableFunc(node.Replies, func(a, b *ThreadNode) int {
+		if ta, tb := a.createdAt(), b.createdAt(); ta != tb {
+			return int(ta - tb)
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+}
+
+// createdAt is the time of the event, or of the oldest reply for placeholders.
+func (node *ThreadNode) createdAt() nostr.Timestamp {
+	if node.Event != nil {
+		return node.Event.CreatedAt
+	}
+	var oldest nostr.Timestamp
+	for _, reply := range node.Replies {
+		if ts := reply.createdAt(); oldest == 0 || ts < oldest {
+			oldest = ts
+		}
+	}
+	return oldest
+}
+
+// getThreadRoot returns the root of the thread this event is in, or nil if it is a root itself.
+func getThreadRoot(evt *nostr.Event) nostr.Pointer {
+	if evt.Kind == nostr.KindComment {
+		return nip22.GetThreadRoot(evt.Tags)
+	}
+	if evt.Kind == nostr.KindTextNote {
+		if root, ok := nip10.GetThreadRoot(evt.Tags).(nostr.EventPointer); ok && root.ID != "" {
+			return root
+		}
+	}
+	return nil
+}
+
+// getParentKey returns the key of the node this event is replying to.
+func getParentKey(evt *nostr.Event) string {
+	var parent nostr.Pointer
+	if evt.Kind == nostr.KindComment {
+		parent = nip22.GetImmediateParent(evt.Tags)
+	} else {
+		parent = nip10.GetImmediateParent(evt.Tags)
+	}
+	if parent == nil {
+		return ""
+	}
+	if key := threadKey(parent); key != evt.ID {
+		return key
+	}
+	return ""
+}
+
+func threadKey(pointer nostr.Pointer) string {
+	switch v := pointer.(type) {
+	case nostr.EventPointer:
+		return v.ID
+	case nostr.EntityPointer:
+		return v.AsTagReference()
+	case nip73.ExternalPointer:
+		return v.Thing
+	}
+	return ""
+}
+
+func eventAddress(evt *nostr.Event) string {
+	return fmt.Sprintf("%d:%s:%s", evt.Kind, evt.PubKey, evt.Tags.GetD())
+}
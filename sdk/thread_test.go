@@ -0,0 +1,141 @@
+package sdk
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nostrtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThreadTree(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	base := nostr.Now() - 1000
+	makeEvent := func(kind int, offset int, tags nostr.Tags) *nostr.Event {
+		evt := &nostr.Event{Kind: kind, CreatedAt: base + nostr.Timestamp(offset), Content: "x", Tags: tags}
+		evt.Sign(sk)
+		return evt
+	}
+
+	root := makeEvent(1, 0, nil)
+	r1 := makeEvent(1, 10, nostr.Tags{{"e", root.ID, "", "root"}})
+	r2 := makeEvent(1, 20, nostr.Tags{{"e", root.ID, "", "root"}, {"e", r1.ID, "", "reply"}})
+	// legacy positional tags: first is the root, last is the parent
+	r3 := makeEvent(1, 15, nostr.Tags{{"e", root.ID}, {"e", r1.ID}})
+	r4 := makeEvent(1, 5, nostr.Tags{{"e", root.ID, "", "root"}})
+	missing := makeEvent(1, 30, nostr.Tags{{"e", root.ID, "", "root"}})
+	r5 := makeEvent(1, 40, nostr.Tags{{"e", root.ID, "", "root"}, {"e", missing.ID, "", "reply"}, {"e", r4.ID, "", "mention"}})
+
+	thread := &Thread{Root: &ThreadNode{ID: root.ID}, nodes: map[string]*ThreadNode{}}
+	thread.nodes[root.ID] = thread.Root
+	thread.setRoot(root)
+
+	for _, evt := range []*nostr.Event{r2, r5, r3, r1, r4} {
+		_, added := thread.add(evt)
+		require.True(t, added)
+	}
+	_, added := thread.add(r1)
+	require.False(t, added)
+
+	ids := func(nodes []*ThreadNode) []string {
+		res := make([]string, len(nodes))
+		for i, node := range nodes {
+			res[i] = node.ID
+		}
+		return res
+	}
+
+	require.Equal(t, []string{r4.ID, r1.ID, missing.ID}, ids(thread.Root.Replies))
+	require.Equal(t, []string{r3.ID, r2.ID}, ids(thread.Get(r1.ID).Replies))
+	placeholder := thread.Get(missing.ID)
+	require.True(t, placeholder.IsPlaceholder())
+	require.Equal(t, []string{r5.ID}, ids(placeholder.Replies))
+
+	// the missing event shows up
+	node, added := thread.add(missing)
+	require.True(t, added)
+	require.Same(t, placeholder, node)
+	require.False(t, node.IsPlaceholder())
+	require.Equal(t, thread.Root, node.Parent)
+	require.Equal(t, []string{r5.ID}, ids(node.Replies))
+
+	depths := make([]int, 0, 7)
+	thread.Walk(func(node *ThreadNode, depth int) bool {
+		depths = append(depths, depth)
+		return true
+	})
+	require.Equal(t, []int{0, 1, 1, 2, 2, 1, 2}, depths)
+
+	// comments on external things
+	url := "https://example.com/article"
+	comments := &Thread{Root: &ThreadNode{ID: url}, nodes: map[string]*ThreadNode{}}
+	comments.nodes[url] = comments.Root
+	c1 := makeEvent(1111, 10, nostr.Tags{{"I", url}, {"K", "web"}, {"i", url}, {"k", "web"}})
+	c2 := makeEvent(1111, 20, nostr.Tags{{"I", url}, {"K", "web"}, {"e", c1.ID, "", c1.PubKey}, {"k", "1111"}})
+	comments.add(c2)
+	comments.add(c1)
+	require.Equal(t, []string{c1.ID}, ids(comments.Root.Replies))
+	require.Equal(t, []string{c2.ID}, ids(comments.Get(c1.ID).Replies))
+}
+
+func TestFetchThread(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	relay := nostrtest.NewRelay()
+	url := nostr.NormalizeURL(strings.Replace(relay.Start(), "127.0.0.1", "localhost", 1))
+	defer relay.Close()
+
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	save := func(evt *nostr.Event) *nostr.Event {
+		evt.Sign(sk)
+		require.NoError(t, relay.Store.SaveEvent(ctx, evt))
+		return evt
+	}
+
+	save(&nostr.Event{Kind: 10002, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"r", url}}})
+	root := save(&nostr.Event{Kind: 1, CreatedAt: nostr.Now() - 100, Content: "root"})
+	r1 := save(&nostr.Event{Kind: 1, CreatedAt: nostr.Now() - 90, Content: "r1", Tags: nostr.Tags{{"e", root.ID, url, "root"}}})
+	r2 := save(&nostr.Event{Kind: 1, CreatedAt: nostr.Now() - 80, Content: "r2", Tags: nostr.Tags{{"e", root.ID, url, "root"}, {"e", r1.ID, url, "reply"}}})
+	// this one doesn't mention the root, it can only be found by the missing parent lookup
+	r3 := save(&nostr.Event{Kind: 1, CreatedAt: nostr.Now() - 70, Content: "r3", Tags: nostr.Tags{{"e", r2.ID, url, "reply"}}})
+	save(&nostr.Event{Kind: 1, CreatedAt: nostr.Now() - 60, Content: "r4", Tags: nostr.Tags{{"e", root.ID, url, "root"}, {"e", r3.ID, url, "reply"}}})
+	save(&nostr.Event{Kind: 1, CreatedAt: nostr.Now() - 50, Content: "unrelated"})
+
+	sys := NewSystem(WithRelayListRelays([]string{url}), WithFallbackRelays([]string{url}), WithJustIDRelays([]string{url}))
+	defer sys.Close()
+
+	// starting from a reply
+	thread, err := sys.FetchThread(ctx, nostr.EventPointer{ID: r2.ID, Relays: []string{url}, Author: pk})
+	require.NoError(t, err)
+	require.Equal(t, root.ID, thread.Root.Event.ID)
+
+	contents := make([]string, 0, 5)
+	thread.Walk(func(node *ThreadNode, depth int) bool {
+		contents = append(contents, strings.Repeat(" ", depth)+node.Event.Content)
+		return true
+	})
+	require.Equal(t, []string{"root", " r1", "  r2", "   r3", "    r4"}, contents)
+
+	// new replies come in live
+	updates := thread.Stream(ctx)
+	time.Sleep(200 * time.Millisecond)
+	r5 := &nostr.Event{Kind: 1111, CreatedAt: nostr.Now(), Content: "r5", Tags: nostr.Tags{{"E", root.ID, url, pk}, {"K", "1"}, {"e", r1.ID, url, pk}, {"k", "1"}}}
+	r5.Sign(sk)
+	for res := range sys.Pool.PublishMany(ctx, []string{url}, *r5) {
+		require.NoError(t, res.Error)
+	}
+
+	select {
+	case node := <-updates:
+		require.Equal(t, r5.ID, node.ID)
+		require.Equal(t, r1.ID, node.Parent.ID)
+	case <-ctx.Done():
+		t.Fatal("didn't get the live reply")
+	}
+	require.Len(t, thread.Get(r1.ID).Replies, 2)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"sync"
 	"sync/atomic"
 )
@@ -21,8 +22,9 @@ type Subscription struct {
 
 	// the Events channel emits all EVENTs that come in a Subscription
 	// will be closed when the subscription ends
-	Events chan *Event
-	mu     sync.Mutex
+	Events  chan *Event
+	mu      sync.Mutex
+	closeMu sync.Mutex
 
 	// the EndOfStoredEvents channel gets closed when an EOSE comes for that subscription
 	EndOfStoredEvents chan struct{}
@@ -41,11 +43,22 @@ type Subscription struct {
 	// if it returns true that event will not be processed further.
 	checkDuplicateReplaceable func(rk ReplaceableKey, ts Timestamp) bool
 
+	// if it is not nil, eoseHook will be called when the EOSE arrives
+	eoseHook func()
+
 	match  func(*Event) bool // this will be either Filters.Match or Filters.MatchIgnoringTimestampConstraints
 	live   atomic.Bool
 	eosed  atomic.Bool
 	cancel context.CancelCauseFunc
 
+	// the most recent created_at we've received, used when resubscribing after a reconnection
+	lastSeen atomic.Int64
+
+	// ids of the events that could be sent to us again when resubscribing after a reconnection: all of
+	// them before the EOSE, then only the ones with created_at equal to lastSeen
+	replayable   map[string]Timestamp
+	replayableMu sync.Mutex
+
 	// this keeps track of the events we've received before the EOSE that we must dispatch before
 	// closing the EndOfStoredEvents channel
 	storedwg sync.WaitGroup
@@ -72,6 +85,11 @@ type WithCheckDuplicateReplaceable func(rk ReplaceableKey, ts Timestamp) bool
 
 func (_ WithCheckDuplicateReplaceable) IsSubscriptionOption() {}
 
+// withEOSEHook sets eoseHook on the subscription, it's used by the pool to collect stats
+type withEOSEHook func()
+
+func (_ withEOSEHook) IsSubscriptionOption() {}
+
 var (
 	_ SubscriptionOption = (WithLabel)("")
 	_ SubscriptionOption = (WithCheckDuplicate)(nil)
@@ -94,6 +112,17 @@ func (sub *Subscription) start() {
 func (sub *Subscription) GetID() string { return sub.id }
 
 func (sub *Subscription) dispatchEvent(evt *Event) {
+	if sub.Relay.reconnect != nil && !sub.trackReplayable(evt) {
+		return
+	}
+
+	for {
+		last := sub.lastSeen.Load()
+		if int64(evt.CreatedAt) <= last || sub.lastSeen.CompareAndSwap(last, int64(evt.CreatedAt)) {
+			break
+		}
+	}
+
 	added := false
 	if !sub.eosed.Load() {
 		sub.storedwg.Add(1)
@@ -117,8 +146,44 @@ func (sub *Subscription) dispatchEvent(evt *Event) {
 	}()
 }
 
+// trackReplayable returns false if evt was already dispatched before a reconnection.
+func (sub *Subscription) trackReplayable(evt *Event) bool {
+	sub.replayableMu.Lock()
+	defer sub.replayableMu.Unlock()
+
+	if _, seen := sub.replayable[evt.ID]; seen {
+		return false
+	}
+	if sub.replayable == nil {
+		sub.replayable = make(map[string]Timestamp)
+	}
+
+	if sub.eosed.Load() {
+		last := Timestamp(sub.lastSeen.Load())
+		if evt.CreatedAt < last {
+			// we will resume from last, so this won't come again
+			return true
+		} else if evt.CreatedAt > last {
+			clear(sub.replayable)
+		}
+	}
+	sub.replayable[evt.ID] = evt.CreatedAt
+	return true
+}
+
 func (sub *Subscription) dispatchEose() {
+	if sub.Relay.reconnect != nil {
+		// from now on we only need to remember what is at the boundary
+		sub.replayableMu.Lock()
+		last := Timestamp(sub.lastSeen.Load())
+		maps.DeleteFunc(sub.replayable, func(_ string, ts Timestamp) bool { return ts < last })
+		sub.replayableMu.Unlock()
+	}
+
 	if sub.eosed.CompareAndSwap(false, true) {
+		if sub.eoseHook != nil {
+			sub.eoseHook()
+		}
 		sub.match = sub.Filters.MatchIgnoringTimestampConstraints
 		go func() {
 			sub.storedwg.Wait()
@@ -148,9 +213,12 @@ func (sub *Subscription) unsub(err error) {
 	sub.cancel(err)
 
 	// mark subscription as closed and send a CLOSE to the relay (naïve sync.Once implementation)
+	// the lock makes concurrent callers wait until the CLOSE is actually sent
+	sub.closeMu.Lock()
 	if sub.live.CompareAndSwap(true, false) {
 		sub.Close()
 	}
+	sub.closeMu.Unlock()
 
 	// remove subscription from our map
 	sub.Relay.Subscriptions.Delete(sub.counter)
@@ -173,18 +241,28 @@ func (sub *Subscription) Sub(_ context.Context, filters Filters) {
 }
 
 // Fire sends the "REQ" command to the relay.
+//
+// If the relay is reconnecting the REQ is only sent once the connection is back.
 func (sub *Subscription) Fire() error {
+	return sub.fire(sub.Context, sub.Filters)
+}
+
+func (sub *Subscription) fire(ctx context.Context, filters Filters) error {
 	var reqb []byte
 	if sub.countResult == nil {
-		reqb, _ = ReqEnvelope{sub.id, sub.Filters}.MarshalJSON()
-	} else if len(sub.Filters) == 1 {
-		reqb, _ = CountEnvelope{sub.id, sub.Filters[0], nil, nil}.MarshalJSON()
+		reqb, _ = ReqEnvelope{sub.id, filters}.MarshalJSON()
+	} else if len(filters) == 1 {
+		reqb, _ = CountEnvelope{sub.id, filters[0], nil, nil}.MarshalJSON()
 	} else {
 		return fmt.Errorf("unexpected sub configuration")
 	}
 
 	sub.live.Store(true)
-	if err := <-sub.Relay.Write(reqb); err != nil {
+	if sub.Relay.IsReconnecting() {
+		// resume() will send it
+		return nil
+	}
+	if err := <-sub.Relay.write(ctx, reqb); err != nil {
 		err := fmt.Errorf("failed to write: %w", err)
 		sub.cancel(err)
 		return err